@@ -24,31 +24,47 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/jwtkeys"
 	applogger "github.com/tldr-it-stepankutaj/openvpn-mng/internal/logger"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/passwordhash"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/proxyproto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/radius"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/routes"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/tlsserver"
 
 	_ "github.com/tldr-it-stepankutaj/openvpn-mng/docs" // Swagger docs
 )
 
 var (
-	configPath string
-	version    = "1.0.1"
+	configPath   string
+	rotateJWTKey bool
+	version      = "1.0.1"
 )
 
 func init() {
 	flag.StringVar(&configPath, "config", "config.yaml", "Path to configuration file")
+	flag.BoolVar(&rotateJWTKey, "rotate-jwt-key", false, "Create a new JWT signing key, retire the current one and exit")
 }
 
 func main() {
@@ -84,8 +100,72 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Rotate the JWT signing key and exit; running instances pick up the new key
+	if rotateJWTKey {
+		key, err := jwtkeys.For(&cfg.Auth).Rotate()
+		if err != nil {
+			applogger.Error("Failed to rotate JWT signing key", "error", err)
+			os.Exit(1)
+		}
+		applogger.Info("JWT signing key rotated", "kid", key.ID, "algorithm", key.Algorithm)
+		return
+	}
+
+	// Hash new passwords with the configured algorithm; older hashes are upgraded on login
+	switch cfg.Auth.PasswordHash.Algorithm {
+	case passwordhash.AlgorithmArgon2id, passwordhash.AlgorithmBcrypt:
+	default:
+		applogger.Error("Unsupported password hash algorithm", "algorithm", cfg.Auth.PasswordHash.Algorithm)
+		os.Exit(1)
+	}
+	passwordhash.Configure(&cfg.Auth.PasswordHash)
+	applogger.Info("Password hashing configured", "algorithm", passwordhash.Default().Algorithm())
+
+	// Remember successful VPN logins for reconnect storms
+	services.ConfigureVpnAuthCache(&cfg.Auth.VpnAuthCache)
+	if cfg.Auth.VpnAuthCache.Enabled {
+		applogger.Info("VPN authentication cache enabled", "ttl", cfg.Auth.VpnAuthCache.TTL, "max_entries", cfg.Auth.VpnAuthCache.MaxEntries)
+	}
+
 	// Create a default admin user if not exists
-	createDefaultAdmin()
+	createDefaultAdmin(&cfg.Auth)
+
+	// Load JWT signing keys, creating the first one for RS256/EdDSA
+	if err := jwtkeys.For(&cfg.Auth).Load(); err != nil {
+		applogger.Error("Failed to load JWT signing keys", "error", err)
+		os.Exit(1)
+	}
+	applogger.Info("JWT signing configured", "algorithm", jwtkeys.For(&cfg.Auth).Algorithm())
+
+	// Emailed links need the external URL of the web UI
+	if cfg.Mail.Enabled && cfg.Server.PublicURL == "" {
+		applogger.Error("server.public_url is required when mail is enabled")
+		os.Exit(1)
+	}
+
+	// Browsers reject SameSite=None cookies without the Secure attribute
+	switch cfg.Auth.Cookies.SameSite {
+	case "lax", "strict", "none":
+	default:
+		applogger.Error("Unsupported cookie SameSite mode", "same_site", cfg.Auth.Cookies.SameSite)
+		os.Exit(1)
+	}
+	switch cfg.Auth.Cookies.Secure {
+	case "auto", "always", "never":
+	default:
+		applogger.Error("Unsupported cookie secure mode", "secure", cfg.Auth.Cookies.Secure)
+		os.Exit(1)
+	}
+	if cfg.Auth.Cookies.SameSite == "none" && cfg.Auth.Cookies.Secure == "never" {
+		applogger.Error("auth.cookies.same_site none requires secure cookies")
+		os.Exit(1)
+	}
+
+	// Check that the banned password list can be read
+	if err := services.NewPasswordPolicy(&cfg.Auth.PasswordPolicy).Load(); err != nil {
+		applogger.Error("Failed to load password policy", "error", err)
+		os.Exit(1)
+	}
 
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
@@ -99,16 +179,67 @@ func main() {
 	// Create rate limiter if enabled
 	var rateLimiter *middleware.RateLimiter
 	if cfg.Security.RateLimitEnabled {
-		rateLimiter = middleware.NewRateLimiter(&cfg.Security)
+		backend, err := middleware.NewRateLimitBackend(&cfg.Security)
+		if err != nil {
+			applogger.Error("Failed to configure rate limiting", "error", err)
+			os.Exit(1)
+		}
+		rateLimiter = middleware.NewRateLimiterWithBackend(&cfg.Security, backend)
 		defer rateLimiter.Stop()
 		applogger.Info("Rate limiting enabled",
-			"requests", cfg.Security.RateLimitRequests,
-			"window_seconds", cfg.Security.RateLimitWindow,
-			"burst", cfg.Security.RateLimitBurst)
+			"backend", cfg.Security.RateLimitBackend,
+			"login_requests", cfg.Security.RateLimits.Login.Requests,
+			"vpn_auth_requests", cfg.Security.RateLimits.VpnAuth.Requests,
+			"api_requests", cfg.Security.RateLimits.API.Requests)
+	}
+
+	// Start traffic stats rollup and retention job
+	trafficRollup := services.NewTrafficRollupService(&cfg.Traffic)
+	trafficRollup.Start()
+	defer trafficRollup.Stop()
+	applogger.Info("Traffic rollup enabled",
+		"interval_minutes", cfg.Traffic.RollupInterval,
+		"raw_retention_days", cfg.Traffic.RawRetentionDays,
+		"hourly_retention_days", cfg.Traffic.HourlyRetentionDays)
+
+	// Start anomaly detection job (traffic spikes)
+	if cfg.Anomaly.Enabled {
+		anomaly := services.NewAnomalyService(&cfg.Anomaly)
+		anomaly.Start()
+		defer anomaly.Stop()
+		applogger.Info("Anomaly detection enabled",
+			"block_severity", cfg.Anomaly.BlockSeverity)
+	}
+
+	// Start RADIUS server for OpenVPN's radiusplugin
+	if cfg.RADIUS.Enabled {
+		radiusServer, err := radius.NewServer(&cfg.RADIUS, &cfg.Auth, &cfg.Anomaly, &cfg.Security)
+		if err != nil {
+			applogger.Error("Failed to configure RADIUS server", "error", err)
+			os.Exit(1)
+		}
+		if err := radiusServer.Start(); err != nil {
+			applogger.Error("Failed to start RADIUS server", "error", err)
+			os.Exit(1)
+		}
+		defer radiusServer.Stop()
+		applogger.Info("RADIUS server enabled",
+			"auth_address", radiusServer.AuthAddr().String(),
+			"acct_address", radiusServer.AcctAddr().String(),
+			"clients", len(cfg.RADIUS.Clients))
 	}
 
 	// Create a Gin router with our custom logger middleware
 	r := gin.New()
+	if err := middleware.ConfigureClientIP(r, &cfg.Security); err != nil {
+		applogger.Error("Invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	if len(cfg.Security.TrustedProxies) > 0 {
+		applogger.Info("Trusted proxies configured",
+			"proxies", cfg.Security.TrustedProxies,
+			"headers", cfg.Security.RemoteIPHeaders)
+	}
 	r.Use(applogger.GinLogger())
 	r.Use(applogger.GinRecovery())
 
@@ -119,9 +250,7 @@ func main() {
 	// API status
 	if cfg.API.Enabled {
 		applogger.Info("REST API enabled", "path", "/api/v1")
-		if cfg.API.VpnToken != "" {
-			applogger.Info("VPN Auth API enabled", "path", "/api/v1/vpn-auth")
-		}
+		applogger.Info("VPN Auth API enabled", "path", "/api/v1/vpn-auth", "vpn_token", cfg.API.VpnToken != "")
 		if cfg.API.SwaggerEnabled {
 			applogger.Info("Swagger UI enabled", "path", "/swagger/index.html")
 		}
@@ -133,13 +262,99 @@ func main() {
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	applogger.Info("Starting server", "address", addr)
 
-	if err := r.Run(addr); err != nil {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		applogger.Error("Failed to start server", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Security.ProxyProtocol {
+		if len(cfg.Security.TrustedProxies) == 0 {
+			applogger.Error("PROXY protocol requires trusted proxies")
+			os.Exit(1)
+		}
+		listener, err = proxyproto.NewListener(listener, cfg.Security.TrustedProxies)
+		if err != nil {
+			applogger.Error("Invalid trusted proxies", "error", err)
+			os.Exit(1)
+		}
+		applogger.Info("PROXY protocol enabled for trusted proxies")
+	}
+
+	if !cfg.Server.TLS.Enabled() {
+		if err := r.RunListener(listener); err != nil {
+			applogger.Error("Failed to start server", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// HTTPS with certificates reloaded on SIGHUP or file change
+	reloader, err := tlsserver.NewReloader(&cfg.Server.TLS)
+	if err != nil {
+		applogger.Error("Failed to load TLS certificate", "error", err)
+		os.Exit(1)
+	}
+	tlsConfig, err := reloader.Config()
+	if err != nil {
+		applogger.Error("Invalid TLS configuration", "error", err)
+		os.Exit(1)
+	}
+	onReload := func(err error) {
+		if err != nil {
+			applogger.Error("Failed to reload TLS certificate, keeping the previous one", "error", err)
+			return
+		}
+		applogger.Info("TLS certificate reloaded", "not_after", reloader.Certificate().Leaf.NotAfter)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_, err := reloader.Reload()
+			onReload(err)
+		}
+	}()
+	if cfg.Server.TLS.ReloadInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go reloader.Watch(time.Duration(cfg.Server.TLS.ReloadInterval)*time.Second, stop, onReload)
+	}
+	applogger.Info("HTTPS enabled",
+		"min_version", cfg.Server.TLS.MinVersion,
+		"client_ca", cfg.Server.TLS.ClientCAFile != "",
+		"not_after", reloader.Certificate().Leaf.NotAfter)
+
+	if cfg.Server.TLS.RedirectPort > 0 {
+		redirectAddr := net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.TLS.RedirectPort))
+		redirect := &http.Server{
+			Addr:              redirectAddr,
+			Handler:           tlsserver.RedirectHandler(cfg.Server.PublicURL, cfg.Server.Port),
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		}
+		go func() {
+			if err := redirect.ListenAndServe(); err != nil {
+				applogger.Error("HTTP to HTTPS redirect stopped", "address", redirectAddr, "error", err)
+			}
+		}()
+		applogger.Info("Redirecting HTTP to HTTPS", "address", redirectAddr)
+	}
+
+	// Slow clients cannot hold connections open; no read or write timeout, as
+	// exports and large responses may take longer
+	server := &http.Server{
+		Handler:           r.Handler(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+	if err := server.ServeTLS(listener, "", ""); err != nil {
 		applogger.Error("Failed to start server", "error", err)
 		os.Exit(1)
 	}
 }
 
-func createDefaultAdmin() {
+func createDefaultAdmin(cfg *config.AuthConfig) {
 	userService := services.NewUserService()
 
 	// Check if admin exists
@@ -149,8 +364,14 @@ func createDefaultAdmin() {
 		return
 	}
 
+	password, generated, err := bootstrapAdminPassword(cfg)
+	if err != nil {
+		applogger.Error("Failed to determine default admin password", "error", err)
+		return
+	}
+
 	// Create admin user
-	hashedPassword, err := services.HashPassword("admin123")
+	hashedPassword, err := services.HashPassword(password)
 	if err != nil {
 		applogger.Error("Failed to hash password", "error", err)
 		return
@@ -158,14 +379,15 @@ func createDefaultAdmin() {
 
 	adminID := uuid.New()
 	admin := &models.User{
-		ID:        adminID,
-		Username:  "admin",
-		Password:  hashedPassword,
-		FirstName: "System",
-		LastName:  "Administrator",
-		Email:     "admin@localhost",
-		Role:      models.RoleAdmin,
-		CreatedBy: adminID,
+		ID:                 adminID,
+		Username:           "admin",
+		Password:           hashedPassword,
+		MustChangePassword: true,
+		FirstName:          "System",
+		LastName:           "Administrator",
+		Email:              "admin@localhost",
+		Role:               models.RoleAdmin,
+		CreatedBy:          adminID,
 	}
 
 	if err := database.GetDB().Create(admin).Error; err != nil {
@@ -173,6 +395,35 @@ func createDefaultAdmin() {
 		return
 	}
 
-	applogger.Info("Default admin user created", "username", "admin", "password", "admin123")
-	applogger.Warn("Please change the default admin password immediately!")
+	if generated {
+		applogger.Warn("Default admin user created with a random password, it must be changed on first login",
+			"username", "admin", "password", password)
+		return
+	}
+	applogger.Info("Default admin user created, the password must be changed on first login", "username", "admin")
+}
+
+// bootstrapAdminPassword returns the configured password of the default admin,
+// read from admin_password_file or admin_password, or a random one
+func bootstrapAdminPassword(cfg *config.AuthConfig) (string, bool, error) {
+	if cfg.AdminPasswordFile != "" {
+		data, err := os.ReadFile(cfg.AdminPasswordFile)
+		if err != nil {
+			return "", false, err
+		}
+		password := strings.TrimRight(string(data), "\r\n")
+		if password == "" {
+			return "", false, fmt.Errorf("admin password file %s is empty", cfg.AdminPasswordFile)
+		}
+		return password, false, nil
+	}
+	if cfg.AdminPassword != "" {
+		return cfg.AdminPassword, false, nil
+	}
+
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), true, nil
 }
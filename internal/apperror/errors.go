@@ -40,3 +40,7 @@ func TooManyRequests(msg string) *AppError {
 func Internal(msg string) *AppError {
 	return &AppError{Code: http.StatusInternalServerError, Err: "Internal Server Error", Message: msg}
 }
+
+func ServiceUnavailable(msg string) *AppError {
+	return &AppError{Code: http.StatusServiceUnavailable, Err: "Service Unavailable", Message: msg}
+}
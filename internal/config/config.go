@@ -2,9 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,16 +20,107 @@ type Config struct {
 	Logging  LoggingConfig  `yaml:"logging"`
 	VPN      VPNConfig      `yaml:"vpn"`
 	Security SecurityConfig `yaml:"security"`
+	Traffic  TrafficConfig  `yaml:"traffic"`
+	Anomaly  AnomalyConfig  `yaml:"anomaly"`
+	RADIUS   RADIUSConfig   `yaml:"radius"`
+	Mail     MailConfig     `yaml:"mail"`
+}
+
+// MailConfig represents the SMTP server used to send email
+type MailConfig struct {
+	Enabled            bool   `yaml:"enabled"`  // default: false
+	Host               string `yaml:"host"`     // SMTP server host
+	Port               int    `yaml:"port"`     // default: 587
+	Username           string `yaml:"username"` // empty = no authentication
+	Password           string `yaml:"password"`
+	From               string `yaml:"from"`                 // sender address, e.g. "OpenVPN Manager <vpn@example.com>"
+	TLS                string `yaml:"tls"`                  // "starttls" (default), "tls" (implicit TLS, port 465) or "none"
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // do not verify the server certificate
+	Timeout            int    `yaml:"timeout"`              // seconds, default: 10
+}
+
+// RADIUSConfig represents the RADIUS server for OpenVPN's radiusplugin
+type RADIUSConfig struct {
+	Enabled  bool           `yaml:"enabled"`   // default: false
+	AuthAddr string         `yaml:"auth_addr"` // UDP address for Access-Request, default: ":1812"
+	AcctAddr string         `yaml:"acct_addr"` // UDP address for Accounting-Request, default: ":1813"
+	Clients  []RADIUSClient `yaml:"clients"`   // NAS allowed to send requests, others are ignored
+}
+
+// RADIUSClient represents a NAS (OpenVPN server) and its shared secret
+type RADIUSClient struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"` // IP address or CIDR range of the NAS
+	Secret  string `yaml:"secret"`
+}
+
+// TrafficConfig represents traffic statistics rollup and retention configuration
+type TrafficConfig struct {
+	RollupInterval      int `yaml:"rollup_interval"`       // minutes between rollup runs, default: 5
+	RollupLookback      int `yaml:"rollup_lookback"`       // hours re-aggregated on each run to absorb late stats, default: 2
+	RawRetentionDays    int `yaml:"raw_retention_days"`    // days raw traffic stats are kept, default: 30
+	HourlyRetentionDays int `yaml:"hourly_retention_days"` // days hourly rollups are kept, at least 31, default: 90 (daily rollups are kept forever)
+}
+
+// AnomalyConfig represents VPN login anomaly detection configuration
+type AnomalyConfig struct {
+	Enabled              bool    `yaml:"enabled"`                 // default: false
+	BlockSeverity        string  `yaml:"block_severity"`          // "", "low", "medium", "high"; findings at or above block the login, empty = never block
+	MinHistorySessions   int     `yaml:"min_history_sessions"`    // sessions needed before unusual hours are detected, default: 20
+	UnusualHourRatio     float64 `yaml:"unusual_hour_ratio"`      // share of past logins within ±1 hour below which a login is unusual, default: 0.02
+	TrafficSpikeFactor   float64 `yaml:"traffic_spike_factor"`    // hourly traffic above baseline × factor is a spike, default: 5
+	TrafficSpikeMinBytes int64   `yaml:"traffic_spike_min_bytes"` // spikes below this volume are ignored, default: 104857600 (100 MB)
+	StuffingWindow       int     `yaml:"stuffing_window"`         // minutes, default: 10
+	StuffingUsernames    int     `yaml:"stuffing_usernames"`      // distinct failed usernames from one IP within the window, default: 5
 }
 
 // SecurityConfig represents security-related configuration
 type SecurityConfig struct {
-	RateLimitEnabled   bool `yaml:"rate_limit_enabled"`   // default: true
-	RateLimitRequests  int  `yaml:"rate_limit_requests"`  // max requests per window, default: 5
-	RateLimitWindow    int  `yaml:"rate_limit_window"`    // window in seconds, default: 60
-	RateLimitBurst     int  `yaml:"rate_limit_burst"`     // burst size, default: 10
-	LockoutMaxAttempts int  `yaml:"lockout_max_attempts"` // default: 5
-	LockoutDuration    int  `yaml:"lockout_duration"`     // minutes, default: 15
+	RateLimitEnabled   bool                  `yaml:"rate_limit_enabled"`   // default: true
+	RateLimitBackend   string                `yaml:"rate_limit_backend"`   // "memory" (default, per instance) or "database" (shared by all instances)
+	RateLimitRequests  int                   `yaml:"rate_limit_requests"`  // max requests per window, default: 5
+	RateLimitWindow    int                   `yaml:"rate_limit_window"`    // window in seconds, default: 60
+	RateLimitBurst     int                   `yaml:"rate_limit_burst"`     // burst size, default: 10
+	RateLimits         RateLimitPolicies     `yaml:"rate_limits"`          // per-route policies
+	LockoutMaxAttempts int                   `yaml:"lockout_max_attempts"` // default: 5
+	LockoutDuration    int                   `yaml:"lockout_duration"`     // minutes, default: 15
+	TrustedProxies     []string              `yaml:"trusted_proxies"`      // IPs/CIDRs of reverse proxies whose forwarding headers are trusted; empty = none
+	RemoteIPHeaders    []string              `yaml:"remote_ip_headers"`    // headers with the client IP set by trusted proxies, default: X-Forwarded-For, X-Real-IP
+	ProxyProtocol      bool                  `yaml:"proxy_protocol"`       // accept PROXY protocol v1/v2 headers from trusted proxies on the listener
+	Headers            SecurityHeadersConfig `yaml:"headers"`              // security headers of the web UI
+}
+
+// DefaultContentSecurityPolicy allows the web UI's scripts and styles, which
+// are partly inline, and Bootstrap and Chart.js from jsDelivr
+const DefaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"font-src 'self' https://cdn.jsdelivr.net; " +
+	"img-src 'self' data:; connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'"
+
+// SecurityHeadersConfig represents the security headers sent with web UI pages
+type SecurityHeadersConfig struct {
+	ContentSecurityPolicy string `yaml:"content_security_policy"` // default allows the UI's own and CDN assets; frame-ancestors is appended
+	FrameAncestors        string `yaml:"frame_ancestors"`         // sources that may frame the UI, default: 'none'
+	HSTSMaxAge            int    `yaml:"hsts_max_age"`            // seconds, sent over HTTPS only; default: 31536000, -1 = off
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains"`
+}
+
+// RateLimitPolicies represents the rate limits of groups of routes
+type RateLimitPolicies struct {
+	Login   RateLimitPolicy `yaml:"login"`    // login, password reset, SSO and security key login; default: rate_limit_* settings
+	VpnAuth RateLimitPolicy `yaml:"vpn_auth"` // VPN authentication per end user IP; default: rate_limit_* settings
+	API     RateLimitPolicy `yaml:"api"`      // other authenticated API requests; default: no limit
+}
+
+// RateLimitPolicy represents the requests allowed per client IP. The memory
+// backend refills a token bucket of burst size at requests per window; the
+// database backend allows the larger of requests and burst in any sliding
+// window.
+type RateLimitPolicy struct {
+	Requests int `yaml:"requests"` // max requests per window, 0 = no limit
+	Window   int `yaml:"window"`   // window in seconds
+	Burst    int `yaml:"burst"`    // burst size, default: requests
 }
 
 // VPNConfig represents VPN network configuration
@@ -46,8 +139,28 @@ type LoggingConfig struct {
 
 // ServerConfig represents server-specific configuration
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port"`
+	PublicURL string `yaml:"public_url"` // external URL of the web UI used in emailed links, e.g. "https://vpn.example.com"
+
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig represents HTTPS served by the manager itself. Certificate, key
+// and client CA files are reloaded on SIGHUP or when they change.
+type TLSConfig struct {
+	CertFile       string `yaml:"cert_file"`       // PEM certificate chain; HTTPS is enabled when set
+	KeyFile        string `yaml:"key_file"`        // PEM private key
+	ClientCAFile   string `yaml:"client_ca_file"`  // PEM CA bundle for client certificates (mTLS), empty = none
+	ClientAuth     string `yaml:"client_auth"`     // with client_ca_file: "require" (default) or "optional"
+	MinVersion     string `yaml:"min_version"`     // "1.2" (default) or "1.3"
+	ReloadInterval int    `yaml:"reload_interval"` // seconds between checks of the files for changes, default: 30, -1 = SIGHUP only
+	RedirectPort   int    `yaml:"redirect_port"`   // plain HTTP port redirecting to HTTPS, e.g. 80; 0 = off
+}
+
+// Enabled reports whether HTTPS is configured
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != ""
 }
 
 // DatabaseConfig represents database configuration
@@ -66,14 +179,163 @@ type APIConfig struct {
 	Enabled           bool     `yaml:"enabled"`
 	SwaggerEnabled    bool     `yaml:"swagger_enabled"`
 	SwaggerAllowedIPs []string `yaml:"swagger_allowed_ips"` // CIDR notation: "0.0.0.0/0" for all, "192.168.1.0/24" for subnet
-	VpnToken          string   `yaml:"vpn_token"`           // Token for VPN server authentication (X-VPN-Token header)
+	VpnToken          string   `yaml:"vpn_token"`           // Bootstrap token for VPN server authentication (X-VPN-Token header), besides API keys
 }
 
 // AuthConfig represents authentication configuration
 type AuthConfig struct {
-	JWTSecret     string `yaml:"jwt_secret"`
-	TokenExpiry   int    `yaml:"token_expiry"`   // in hours
-	SessionExpiry int    `yaml:"session_expiry"` // in hours
+	JWTSecret         string     `yaml:"jwt_secret"`
+	JWTAlgorithm      string     `yaml:"jwt_algorithm"`       // HS256 (jwt_secret, default), RS256 or EdDSA (rotatable keys in the database)
+	AccessTokenExpiry int        `yaml:"access_token_expiry"` // in minutes, lifetime of access tokens
+	TokenExpiry       int        `yaml:"token_expiry"`        // in hours, absolute lifetime of a login (refresh token family)
+	SessionExpiry     int        `yaml:"session_expiry"`      // in hours, a refresh token expires when unused this long
+	LDAP              LDAPConfig `yaml:"ldap"`
+	OIDC              OIDCConfig `yaml:"oidc"`
+
+	WebAuthn WebAuthnConfig `yaml:"webauthn"`
+
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy"`
+	PasswordHash   PasswordHashConfig   `yaml:"password_hash"`
+
+	VpnAuthCache VpnAuthCacheConfig `yaml:"vpn_auth_cache"`
+
+	Cookies CookieConfig `yaml:"cookies"`
+
+	AdminPassword       string `yaml:"admin_password"`        // password of the bootstrap admin, empty = random
+	PasswordResetExpiry int    `yaml:"password_reset_expiry"` // in minutes, lifetime of emailed password reset links
+	AdminPasswordFile   string `yaml:"admin_password_file"`   // file with the bootstrap admin password, e.g. a Docker secret
+}
+
+// CookieConfig represents the attributes of the web UI's cookies
+type CookieConfig struct {
+	SameSite string `yaml:"same_site"` // "lax" (default), "strict" or "none" (requires secure cookies)
+	Secure   string `yaml:"secure"`    // "auto" (default: over HTTPS, always when server.public_url is https), "always" or "never"
+	HTTPOnly *bool  `yaml:"http_only"` // hide the token cookies from JavaScript, default: true
+	Domain   string `yaml:"domain"`    // empty = host of the request only
+}
+
+// WebAuthnConfig represents security key and passkey login for the web UI.
+// Users with a registered key must use it after their password, or can sign
+// in with it alone.
+type WebAuthnConfig struct {
+	Enabled          bool     `yaml:"enabled"`            // default: false
+	RPID             string   `yaml:"rp_id"`              // relying party ID, the domain of the web UI; default: host of server.public_url
+	RPName           string   `yaml:"rp_name"`            // shown by the authenticator, default: "OpenVPN Manager"
+	Origins          []string `yaml:"origins"`            // origins of the web UI, default: server.public_url
+	Timeout          int      `yaml:"timeout"`            // seconds to complete a ceremony, default: 300
+	RequireForAdmins bool     `yaml:"require_for_admins"` // admins must sign in with a security key
+}
+
+// PasswordPolicyConfig represents the policy for local passwords
+type PasswordPolicyConfig struct {
+	MinLength        int    `yaml:"min_length"`        // default: 8
+	RequireUppercase bool   `yaml:"require_uppercase"` // at least one uppercase letter
+	RequireLowercase bool   `yaml:"require_lowercase"` // at least one lowercase letter
+	RequireDigit     bool   `yaml:"require_digit"`     // at least one digit
+	RequireSpecial   bool   `yaml:"require_special"`   // at least one character that is not a letter or digit
+	BannedListFile   string `yaml:"banned_list_file"`  // file with one banned password per line, compared case-insensitively
+	AllowUserInfo    bool   `yaml:"allow_user_info"`   // allow passwords containing the username or email local part
+	HistorySize      int    `yaml:"history_size"`      // previous passwords that cannot be reused, 0 = only the current one
+	MaxAgeDays       int    `yaml:"max_age_days"`      // password must be changed on next login after this many days, 0 = never
+}
+
+// PasswordHashConfig represents the hashing of new local passwords. Hashes
+// of another algorithm or with other parameters are replaced on the next
+// successful login.
+type PasswordHashConfig struct {
+	Algorithm         string `yaml:"algorithm"`          // argon2id (default) or bcrypt
+	Argon2Memory      int    `yaml:"argon2_memory"`      // in KiB, default: 19456
+	Argon2Time        int    `yaml:"argon2_time"`        // iterations, default: 2
+	Argon2Parallelism int    `yaml:"argon2_parallelism"` // threads, default: 1
+	BcryptCost        int    `yaml:"bcrypt_cost"`        // default: 10
+}
+
+// VpnAuthCacheConfig represents the cache of successful VPN logins, which
+// spares password hashing when many clients reconnect at once
+type VpnAuthCacheConfig struct {
+	Enabled    bool `yaml:"enabled"`     // default: false
+	TTL        int  `yaml:"ttl"`         // seconds a login is remembered, default: 60
+	MaxEntries int  `yaml:"max_entries"` // default: 10000
+}
+
+// AccessTokenDuration returns the lifetime of access tokens, 15 minutes if not set
+func (c *AuthConfig) AccessTokenDuration() time.Duration {
+	if c.AccessTokenExpiry <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.AccessTokenExpiry) * time.Minute
+}
+
+// RefreshTokenDuration returns how long an unused refresh token stays valid, 8 hours if not set
+func (c *AuthConfig) RefreshTokenDuration() time.Duration {
+	if c.SessionExpiry <= 0 {
+		return 8 * time.Hour
+	}
+	return time.Duration(c.SessionExpiry) * time.Hour
+}
+
+// SessionDuration returns the absolute lifetime of a login, 24 hours if not set
+func (c *AuthConfig) SessionDuration() time.Duration {
+	if c.TokenExpiry <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.TokenExpiry) * time.Hour
+}
+
+// PasswordResetDuration returns how long an emailed password reset link is valid, 30 minutes if not set
+func (c *AuthConfig) PasswordResetDuration() time.Duration {
+	if c.PasswordResetExpiry <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(c.PasswordResetExpiry) * time.Minute
+}
+
+// LDAPConfig represents LDAP / Active Directory authentication configuration.
+// Users are authenticated by a simple bind with user_dn_template, or by
+// searching base_dn with user_filter (bound as bind_dn) and binding as the
+// entry found. Local users (auth source "local") keep their local password.
+type LDAPConfig struct {
+	Enabled            bool              `yaml:"enabled"`
+	URL                string            `yaml:"url"`                  // ldap://host:389 or ldaps://host:636
+	StartTLS           bool              `yaml:"start_tls"`            // upgrade ldap:// connections with StartTLS
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"` // do not verify the server certificate
+	CACertFile         string            `yaml:"ca_cert_file"`         // PEM file with CA certificates, default: system pool
+	Timeout            int               `yaml:"timeout"`              // seconds, default: 10
+	UserDNTemplate     string            `yaml:"user_dn_template"`     // e.g. "uid=%s,ou=people,dc=example,dc=com" or "%s@example.com"
+	BindDN             string            `yaml:"bind_dn"`              // service account for search-then-bind
+	BindPassword       string            `yaml:"bind_password"`
+	BaseDN             string            `yaml:"base_dn"`              // search base for users
+	UserFilter         string            `yaml:"user_filter"`          // default: "(uid=%s)", AD: "(sAMAccountName=%s)"
+	FirstNameAttribute string            `yaml:"first_name_attribute"` // default: givenName
+	LastNameAttribute  string            `yaml:"last_name_attribute"`  // default: sn
+	EmailAttribute     string            `yaml:"email_attribute"`      // default: mail
+	GroupAttribute     string            `yaml:"group_attribute"`      // default: memberOf
+	AutoCreate         bool              `yaml:"auto_create"`          // create unknown users on first login
+	DefaultRole        string            `yaml:"default_role"`         // role of created users, default: USER
+	GroupMapping       map[string]string `yaml:"group_mapping"`        // LDAP group DN -> local group name, membership synced on login
+	RoleMapping        map[string]string `yaml:"role_mapping"`         // LDAP group DN -> role (ADMIN, MANAGER, USER), highest wins
+}
+
+// OIDCConfig represents OpenID Connect single sign-on configuration for the
+// web UI. Users sign in with the authorization code flow with PKCE and are
+// matched to local users by the issuer and subject of the identity; local and
+// LDAP users link the identity on their profile page first.
+type OIDCConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	IssuerURL      string            `yaml:"issuer_url"` // discovery is read from {issuer_url}/.well-known/openid-configuration
+	ClientID       string            `yaml:"client_id"`
+	ClientSecret   string            `yaml:"client_secret"`    // empty for public clients
+	RedirectURL    string            `yaml:"redirect_url"`     // e.g. "https://vpn.example.com/auth/oidc/callback"
+	Scopes         []string          `yaml:"scopes"`           // default: openid, profile, email
+	ButtonLabel    string            `yaml:"button_label"`     // login page button, default: "Sign in with SSO"
+	UsernameClaim  string            `yaml:"username_claim"`   // default: preferred_username
+	FirstNameClaim string            `yaml:"first_name_claim"` // default: given_name
+	LastNameClaim  string            `yaml:"last_name_claim"`  // default: family_name
+	EmailClaim     string            `yaml:"email_claim"`      // default: email
+	RoleClaim      string            `yaml:"role_claim"`       // claim with role values (string or list), e.g. "groups"; empty = no role mapping
+	RoleMapping    map[string]string `yaml:"role_mapping"`     // role claim value -> role (ADMIN, MANAGER, USER), highest wins
+	AutoCreate     bool              `yaml:"auto_create"`      // create unknown users on first login
+	DefaultRole    string            `yaml:"default_role"`     // role of created users, default: USER
 }
 
 // Load loads configuration from a YAML file with environment variable overrides
@@ -105,12 +367,145 @@ func Load(path string) (*Config, error) {
 	if config.Server.Port == 0 {
 		config.Server.Port = 8080
 	}
+	if config.Server.TLS.ClientAuth == "" {
+		config.Server.TLS.ClientAuth = "require"
+	}
+	if config.Server.TLS.MinVersion == "" {
+		config.Server.TLS.MinVersion = "1.2"
+	}
+	if config.Server.TLS.ReloadInterval == 0 {
+		config.Server.TLS.ReloadInterval = 30
+	}
+	if config.Auth.AccessTokenExpiry == 0 {
+		config.Auth.AccessTokenExpiry = 15
+	}
 	if config.Auth.TokenExpiry == 0 {
 		config.Auth.TokenExpiry = 24
 	}
 	if config.Auth.SessionExpiry == 0 {
 		config.Auth.SessionExpiry = 8
 	}
+	if config.Auth.PasswordPolicy.MinLength == 0 {
+		config.Auth.PasswordPolicy.MinLength = 8
+	}
+	config.Auth.PasswordHash.Algorithm = strings.ToLower(config.Auth.PasswordHash.Algorithm)
+	if config.Auth.PasswordHash.Algorithm == "" {
+		config.Auth.PasswordHash.Algorithm = "argon2id"
+	}
+	if config.Auth.PasswordHash.Argon2Memory == 0 {
+		config.Auth.PasswordHash.Argon2Memory = 19456
+	}
+	if config.Auth.PasswordHash.Argon2Time == 0 {
+		config.Auth.PasswordHash.Argon2Time = 2
+	}
+	if config.Auth.PasswordHash.Argon2Parallelism == 0 {
+		config.Auth.PasswordHash.Argon2Parallelism = 1
+	}
+	if config.Auth.PasswordHash.BcryptCost == 0 {
+		config.Auth.PasswordHash.BcryptCost = 10
+	}
+	if config.Auth.VpnAuthCache.TTL == 0 {
+		config.Auth.VpnAuthCache.TTL = 60
+	}
+	if config.Auth.VpnAuthCache.MaxEntries == 0 {
+		config.Auth.VpnAuthCache.MaxEntries = 10000
+	}
+	if config.Auth.LDAP.Timeout == 0 {
+		config.Auth.LDAP.Timeout = 10
+	}
+	if config.Auth.LDAP.UserFilter == "" {
+		config.Auth.LDAP.UserFilter = "(uid=%s)"
+	}
+	if config.Auth.LDAP.FirstNameAttribute == "" {
+		config.Auth.LDAP.FirstNameAttribute = "givenName"
+	}
+	if config.Auth.LDAP.LastNameAttribute == "" {
+		config.Auth.LDAP.LastNameAttribute = "sn"
+	}
+	if config.Auth.LDAP.EmailAttribute == "" {
+		config.Auth.LDAP.EmailAttribute = "mail"
+	}
+	if config.Auth.LDAP.GroupAttribute == "" {
+		config.Auth.LDAP.GroupAttribute = "memberOf"
+	}
+	if config.Auth.LDAP.DefaultRole == "" {
+		config.Auth.LDAP.DefaultRole = "USER"
+	}
+	if len(config.Auth.OIDC.Scopes) == 0 {
+		config.Auth.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.Auth.OIDC.ButtonLabel == "" {
+		config.Auth.OIDC.ButtonLabel = "Sign in with SSO"
+	}
+	if config.Auth.OIDC.UsernameClaim == "" {
+		config.Auth.OIDC.UsernameClaim = "preferred_username"
+	}
+	if config.Auth.OIDC.FirstNameClaim == "" {
+		config.Auth.OIDC.FirstNameClaim = "given_name"
+	}
+	if config.Auth.OIDC.LastNameClaim == "" {
+		config.Auth.OIDC.LastNameClaim = "family_name"
+	}
+	if config.Auth.OIDC.EmailClaim == "" {
+		config.Auth.OIDC.EmailClaim = "email"
+	}
+	if config.Auth.OIDC.DefaultRole == "" {
+		config.Auth.OIDC.DefaultRole = "USER"
+	}
+
+	if config.Auth.PasswordResetExpiry == 0 {
+		config.Auth.PasswordResetExpiry = 30
+	}
+
+	// WebAuthn defaults
+	if config.Auth.WebAuthn.RPName == "" {
+		config.Auth.WebAuthn.RPName = "OpenVPN Manager"
+	}
+	if config.Auth.WebAuthn.Timeout == 0 {
+		config.Auth.WebAuthn.Timeout = 300
+	}
+	if config.Server.PublicURL != "" {
+		if u, err := url.Parse(config.Server.PublicURL); err == nil && u.Host != "" {
+			if config.Auth.WebAuthn.RPID == "" {
+				config.Auth.WebAuthn.RPID = u.Hostname()
+			}
+			if len(config.Auth.WebAuthn.Origins) == 0 {
+				config.Auth.WebAuthn.Origins = []string{u.Scheme + "://" + u.Host}
+			}
+		}
+	}
+
+	// Cookie defaults
+	config.Auth.Cookies.SameSite = strings.ToLower(config.Auth.Cookies.SameSite)
+	if config.Auth.Cookies.SameSite == "" {
+		config.Auth.Cookies.SameSite = "lax"
+	}
+	config.Auth.Cookies.Secure = strings.ToLower(config.Auth.Cookies.Secure)
+	if config.Auth.Cookies.Secure == "" || config.Auth.Cookies.Secure == "auto" {
+		config.Auth.Cookies.Secure = "auto"
+		if strings.HasPrefix(strings.ToLower(config.Server.PublicURL), "https://") {
+			config.Auth.Cookies.Secure = "always"
+		}
+	}
+
+	// Mail defaults
+	if config.Mail.Port == 0 {
+		config.Mail.Port = 587
+	}
+	if config.Mail.TLS == "" {
+		config.Mail.TLS = "starttls"
+	}
+	if config.Mail.Timeout == 0 {
+		config.Mail.Timeout = 10
+	}
+
+	// RADIUS defaults
+	if config.RADIUS.AuthAddr == "" {
+		config.RADIUS.AuthAddr = ":1812"
+	}
+	if config.RADIUS.AcctAddr == "" {
+		config.RADIUS.AcctAddr = ":1813"
+	}
 
 	// Logging defaults
 	if config.Logging.Output == "" {
@@ -136,6 +531,41 @@ func Load(path string) (*Config, error) {
 	if config.Security.RateLimitBurst == 0 {
 		config.Security.RateLimitBurst = 10
 	}
+	config.Security.RateLimitBackend = strings.ToLower(config.Security.RateLimitBackend)
+	if config.Security.RateLimitBackend == "" {
+		config.Security.RateLimitBackend = "memory"
+	}
+	legacyPolicy := RateLimitPolicy{
+		Requests: config.Security.RateLimitRequests,
+		Window:   config.Security.RateLimitWindow,
+		Burst:    config.Security.RateLimitBurst,
+	}
+	if config.Security.RateLimits.Login.Requests == 0 {
+		config.Security.RateLimits.Login = legacyPolicy
+	}
+	if config.Security.RateLimits.VpnAuth.Requests == 0 {
+		config.Security.RateLimits.VpnAuth = legacyPolicy
+	}
+	for _, policy := range []*RateLimitPolicy{&config.Security.RateLimits.Login, &config.Security.RateLimits.VpnAuth, &config.Security.RateLimits.API} {
+		if policy.Window == 0 {
+			policy.Window = 60
+		}
+		if policy.Burst == 0 {
+			policy.Burst = policy.Requests
+		}
+	}
+	if config.Security.Headers.ContentSecurityPolicy == "" {
+		config.Security.Headers.ContentSecurityPolicy = DefaultContentSecurityPolicy
+	}
+	if config.Security.Headers.FrameAncestors == "" {
+		config.Security.Headers.FrameAncestors = "'none'"
+	}
+	if config.Security.Headers.HSTSMaxAge == 0 {
+		config.Security.Headers.HSTSMaxAge = 31536000
+	}
+	if len(config.Security.RemoteIPHeaders) == 0 {
+		config.Security.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+	}
 	if config.Security.LockoutMaxAttempts == 0 {
 		config.Security.LockoutMaxAttempts = 5
 	}
@@ -143,6 +573,44 @@ func Load(path string) (*Config, error) {
 		config.Security.LockoutDuration = 15
 	}
 
+	// Traffic defaults
+	if config.Traffic.RollupInterval == 0 {
+		config.Traffic.RollupInterval = 5
+	}
+	if config.Traffic.RollupLookback == 0 {
+		config.Traffic.RollupLookback = 2
+	}
+	if config.Traffic.RawRetentionDays == 0 {
+		config.Traffic.RawRetentionDays = 30
+	}
+	if config.Traffic.HourlyRetentionDays == 0 {
+		config.Traffic.HourlyRetentionDays = 90
+	}
+	// Monthly quotas sum hourly rollups from the start of the month
+	if config.Traffic.HourlyRetentionDays < 31 {
+		return nil, fmt.Errorf("traffic.hourly_retention_days must be at least 31, got %d", config.Traffic.HourlyRetentionDays)
+	}
+
+	// Anomaly detection defaults
+	if config.Anomaly.MinHistorySessions == 0 {
+		config.Anomaly.MinHistorySessions = 20
+	}
+	if config.Anomaly.UnusualHourRatio == 0 {
+		config.Anomaly.UnusualHourRatio = 0.02
+	}
+	if config.Anomaly.TrafficSpikeFactor == 0 {
+		config.Anomaly.TrafficSpikeFactor = 5
+	}
+	if config.Anomaly.TrafficSpikeMinBytes == 0 {
+		config.Anomaly.TrafficSpikeMinBytes = 100 * 1024 * 1024
+	}
+	if config.Anomaly.StuffingWindow == 0 {
+		config.Anomaly.StuffingWindow = 10
+	}
+	if config.Anomaly.StuffingUsernames == 0 {
+		config.Anomaly.StuffingUsernames = 5
+	}
+
 	// Database defaults
 	if config.Database.Type == "" {
 		config.Database.Type = "postgres"
@@ -174,6 +642,23 @@ func loadEnvOverrides(config *Config) {
 			config.Server.Port = port
 		}
 	}
+	if v := os.Getenv("SERVER_PUBLIC_URL"); v != "" {
+		config.Server.PublicURL = v
+	}
+	if v := os.Getenv("SERVER_TLS_CERT_FILE"); v != "" {
+		config.Server.TLS.CertFile = v
+	}
+	if v := os.Getenv("SERVER_TLS_KEY_FILE"); v != "" {
+		config.Server.TLS.KeyFile = v
+	}
+	if v := os.Getenv("SERVER_TLS_CLIENT_CA_FILE"); v != "" {
+		config.Server.TLS.ClientCAFile = v
+	}
+	if v := os.Getenv("SERVER_TLS_REDIRECT_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			config.Server.TLS.RedirectPort = port
+		}
+	}
 
 	// Database configuration
 	if v := os.Getenv("DB_TYPE"); v != "" {
@@ -204,6 +689,25 @@ func loadEnvOverrides(config *Config) {
 	if v := os.Getenv("AUTH_JWT_SECRET"); v != "" {
 		config.Auth.JWTSecret = v
 	}
+	if v := os.Getenv("AUTH_JWT_ALGORITHM"); v != "" {
+		config.Auth.JWTAlgorithm = v
+	}
+	if v := os.Getenv("AUTH_ADMIN_PASSWORD"); v != "" {
+		config.Auth.AdminPassword = v
+	}
+	if v := os.Getenv("AUTH_ADMIN_PASSWORD_FILE"); v != "" {
+		config.Auth.AdminPasswordFile = v
+	}
+	if v := os.Getenv("AUTH_PASSWORD_RESET_EXPIRY"); v != "" {
+		if expiry, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordResetExpiry = expiry
+		}
+	}
+	if v := os.Getenv("AUTH_ACCESS_TOKEN_EXPIRY"); v != "" {
+		if expiry, err := strconv.Atoi(v); err == nil {
+			config.Auth.AccessTokenExpiry = expiry
+		}
+	}
 	if v := os.Getenv("AUTH_TOKEN_EXPIRY"); v != "" {
 		if expiry, err := strconv.Atoi(v); err == nil {
 			config.Auth.TokenExpiry = expiry
@@ -214,6 +718,103 @@ func loadEnvOverrides(config *Config) {
 			config.Auth.SessionExpiry = expiry
 		}
 	}
+	if v := os.Getenv("AUTH_PASSWORD_MIN_LENGTH"); v != "" {
+		if length, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordPolicy.MinLength = length
+		}
+	}
+	if v := os.Getenv("AUTH_PASSWORD_BANNED_LIST_FILE"); v != "" {
+		config.Auth.PasswordPolicy.BannedListFile = v
+	}
+	if v := os.Getenv("AUTH_PASSWORD_HISTORY_SIZE"); v != "" {
+		if size, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordPolicy.HistorySize = size
+		}
+	}
+	if v := os.Getenv("AUTH_PASSWORD_MAX_AGE_DAYS"); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordPolicy.MaxAgeDays = days
+		}
+	}
+	if v := os.Getenv("AUTH_PASSWORD_HASH_ALGORITHM"); v != "" {
+		config.Auth.PasswordHash.Algorithm = strings.ToLower(v)
+	}
+	if v := os.Getenv("AUTH_PASSWORD_HASH_ARGON2_MEMORY"); v != "" {
+		if memory, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordHash.Argon2Memory = memory
+		}
+	}
+	if v := os.Getenv("AUTH_PASSWORD_HASH_ARGON2_TIME"); v != "" {
+		if iterations, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordHash.Argon2Time = iterations
+		}
+	}
+	if v := os.Getenv("AUTH_PASSWORD_HASH_ARGON2_PARALLELISM"); v != "" {
+		if threads, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordHash.Argon2Parallelism = threads
+		}
+	}
+	if v := os.Getenv("AUTH_PASSWORD_HASH_BCRYPT_COST"); v != "" {
+		if cost, err := strconv.Atoi(v); err == nil {
+			config.Auth.PasswordHash.BcryptCost = cost
+		}
+	}
+	if v := os.Getenv("AUTH_VPN_AUTH_CACHE_ENABLED"); v != "" {
+		config.Auth.VpnAuthCache.Enabled = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("AUTH_VPN_AUTH_CACHE_TTL"); v != "" {
+		if ttl, err := strconv.Atoi(v); err == nil {
+			config.Auth.VpnAuthCache.TTL = ttl
+		}
+	}
+	if v := os.Getenv("AUTH_LDAP_ENABLED"); v != "" {
+		config.Auth.LDAP.Enabled = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("AUTH_LDAP_URL"); v != "" {
+		config.Auth.LDAP.URL = v
+	}
+	if v := os.Getenv("AUTH_LDAP_BIND_DN"); v != "" {
+		config.Auth.LDAP.BindDN = v
+	}
+	if v := os.Getenv("AUTH_LDAP_BIND_PASSWORD"); v != "" {
+		config.Auth.LDAP.BindPassword = v
+	}
+	if v := os.Getenv("AUTH_LDAP_BASE_DN"); v != "" {
+		config.Auth.LDAP.BaseDN = v
+	}
+	if v := os.Getenv("AUTH_COOKIE_SAME_SITE"); v != "" {
+		config.Auth.Cookies.SameSite = v
+	}
+	if v := os.Getenv("AUTH_COOKIE_SECURE"); v != "" {
+		config.Auth.Cookies.Secure = v
+	}
+	if v := os.Getenv("AUTH_WEBAUTHN_ENABLED"); v != "" {
+		config.Auth.WebAuthn.Enabled = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("AUTH_WEBAUTHN_RP_ID"); v != "" {
+		config.Auth.WebAuthn.RPID = v
+	}
+	if v := os.Getenv("AUTH_WEBAUTHN_ORIGINS"); v != "" {
+		config.Auth.WebAuthn.Origins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("AUTH_WEBAUTHN_REQUIRE_FOR_ADMINS"); v != "" {
+		config.Auth.WebAuthn.RequireForAdmins = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("AUTH_OIDC_ENABLED"); v != "" {
+		config.Auth.OIDC.Enabled = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("AUTH_OIDC_ISSUER_URL"); v != "" {
+		config.Auth.OIDC.IssuerURL = v
+	}
+	if v := os.Getenv("AUTH_OIDC_CLIENT_ID"); v != "" {
+		config.Auth.OIDC.ClientID = v
+	}
+	if v := os.Getenv("AUTH_OIDC_CLIENT_SECRET"); v != "" {
+		config.Auth.OIDC.ClientSecret = v
+	}
+	if v := os.Getenv("AUTH_OIDC_REDIRECT_URL"); v != "" {
+		config.Auth.OIDC.RedirectURL = v
+	}
 
 	// API configuration
 	if v := os.Getenv("API_ENABLED"); v != "" {
@@ -247,6 +848,14 @@ func loadEnvOverrides(config *Config) {
 	if v := os.Getenv("SECURITY_RATE_LIMIT_ENABLED"); v != "" {
 		config.Security.RateLimitEnabled = strings.ToLower(v) == "true" || v == "1"
 	}
+	if v := os.Getenv("SECURITY_RATE_LIMIT_BACKEND"); v != "" {
+		config.Security.RateLimitBackend = v
+	}
+	if v := os.Getenv("SECURITY_RATE_LIMIT_API_REQUESTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Security.RateLimits.API.Requests = n
+		}
+	}
 	if v := os.Getenv("SECURITY_RATE_LIMIT_REQUESTS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			config.Security.RateLimitRequests = n
@@ -262,6 +871,17 @@ func loadEnvOverrides(config *Config) {
 			config.Security.RateLimitBurst = n
 		}
 	}
+	if v := os.Getenv("SECURITY_TRUSTED_PROXIES"); v != "" {
+		config.Security.TrustedProxies = strings.Split(v, ",")
+	}
+	if v := os.Getenv("SECURITY_HSTS_MAX_AGE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Security.Headers.HSTSMaxAge = n
+		}
+	}
+	if v := os.Getenv("SECURITY_PROXY_PROTOCOL"); v != "" {
+		config.Security.ProxyProtocol = strings.ToLower(v) == "true" || v == "1"
+	}
 	if v := os.Getenv("SECURITY_LOCKOUT_MAX_ATTEMPTS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			config.Security.LockoutMaxAttempts = n
@@ -273,6 +893,85 @@ func loadEnvOverrides(config *Config) {
 		}
 	}
 
+	// Traffic configuration
+	if v := os.Getenv("TRAFFIC_ROLLUP_INTERVAL"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Traffic.RollupInterval = n
+		}
+	}
+	if v := os.Getenv("TRAFFIC_ROLLUP_LOOKBACK"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Traffic.RollupLookback = n
+		}
+	}
+	if v := os.Getenv("TRAFFIC_RAW_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Traffic.RawRetentionDays = n
+		}
+	}
+	if v := os.Getenv("TRAFFIC_HOURLY_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Traffic.HourlyRetentionDays = n
+		}
+	}
+
+	// Anomaly detection configuration
+	if v := os.Getenv("ANOMALY_ENABLED"); v != "" {
+		config.Anomaly.Enabled = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("ANOMALY_BLOCK_SEVERITY"); v != "" {
+		config.Anomaly.BlockSeverity = v
+	}
+	if v := os.Getenv("ANOMALY_STUFFING_WINDOW"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Anomaly.StuffingWindow = n
+		}
+	}
+	if v := os.Getenv("ANOMALY_STUFFING_USERNAMES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.Anomaly.StuffingUsernames = n
+		}
+	}
+
+	// RADIUS configuration
+	if v := os.Getenv("RADIUS_ENABLED"); v != "" {
+		config.RADIUS.Enabled = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("RADIUS_AUTH_ADDR"); v != "" {
+		config.RADIUS.AuthAddr = v
+	}
+	if v := os.Getenv("RADIUS_ACCT_ADDR"); v != "" {
+		config.RADIUS.AcctAddr = v
+	}
+	if addr, secret := os.Getenv("RADIUS_CLIENT_ADDRESS"), os.Getenv("RADIUS_CLIENT_SECRET"); addr != "" && secret != "" {
+		config.RADIUS.Clients = append(config.RADIUS.Clients, RADIUSClient{Name: "env", Address: addr, Secret: secret})
+	}
+
+	// Mail configuration
+	if v := os.Getenv("MAIL_ENABLED"); v != "" {
+		config.Mail.Enabled = strings.ToLower(v) == "true" || v == "1"
+	}
+	if v := os.Getenv("MAIL_HOST"); v != "" {
+		config.Mail.Host = v
+	}
+	if v := os.Getenv("MAIL_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			config.Mail.Port = port
+		}
+	}
+	if v := os.Getenv("MAIL_USERNAME"); v != "" {
+		config.Mail.Username = v
+	}
+	if v := os.Getenv("MAIL_PASSWORD"); v != "" {
+		config.Mail.Password = v
+	}
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		config.Mail.From = v
+	}
+	if v := os.Getenv("MAIL_TLS"); v != "" {
+		config.Mail.TLS = v
+	}
+
 	// VPN configuration
 	if v := os.Getenv("VPN_NETWORK"); v != "" {
 		config.VPN.Network = v
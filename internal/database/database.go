@@ -51,6 +51,7 @@ func Migrate() error {
 		model interface{}
 	}{
 		{"users", &models.User{}},
+		{"user_identities", &models.UserIdentity{}},
 		{"groups", &models.Group{}},
 		{"user_groups", &models.UserGroup{}},
 		{"networks", &models.Network{}},
@@ -58,7 +59,21 @@ func Migrate() error {
 		{"audit_logs", &models.AuditLog{}},
 		{"vpn_sessions", &models.VpnSession{}},
 		{"vpn_traffic_stats", &models.VpnTrafficStats{}},
+		{"vpn_traffic_hourly", &models.VpnTrafficHourly{}},
+		{"vpn_traffic_daily", &models.VpnTrafficDaily{}},
+		{"traffic_rollup_state", &models.TrafficRollupState{}},
 		{"vpn_client_configs", &models.VpnClientConfig{}},
+		{"vpn_login_attempts", &models.VpnLoginAttempt{}},
+		{"security_alerts", &models.SecurityAlert{}},
+		{"api_keys", &models.APIKey{}},
+		{"refresh_tokens", &models.RefreshToken{}},
+		{"revoked_tokens", &models.RevokedToken{}},
+		{"jwt_signing_keys", &models.JWTSigningKey{}},
+		{"password_history", &models.PasswordHistory{}},
+		{"password_reset_tokens", &models.PasswordResetToken{}},
+		{"webauthn_credentials", &models.WebAuthnCredential{}},
+		{"webauthn_challenges", &models.WebAuthnChallenge{}},
+		{"rate_limit_counters", &models.RateLimitCounter{}},
 	}
 
 	for _, t := range tables {
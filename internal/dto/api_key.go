@@ -0,0 +1,88 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+// CreateAPIKeyRequest represents a request to create a new API key
+type CreateAPIKeyRequest struct {
+	Name       string               `json:"name" binding:"required,min=1,max=100"`
+	Scopes     []models.APIKeyScope `json:"scopes" binding:"required,min=1,dive,oneof=vpn-auth reports:read users:provision"`
+	AllowedIPs []string             `json:"allowed_ips,omitempty" binding:"max=50"` // IPs or CIDRs, empty = any
+	ExpiresAt  *time.Time           `json:"expires_at,omitempty"`
+}
+
+// APIKeyResponse represents an API key in API responses. The key itself is
+// only returned when it is created or rotated.
+type APIKeyResponse struct {
+	ID         uuid.UUID            `json:"id"`
+	Name       string               `json:"name"`
+	Prefix     string               `json:"prefix"`
+	Scopes     []models.APIKeyScope `json:"scopes"`
+	AllowedIPs []string             `json:"allowed_ips"`
+	ExpiresAt  *time.Time           `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time           `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time           `json:"last_used_at,omitempty"`
+	LastUsedIP string               `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	CreatedBy  uuid.UUID            `json:"created_by"`
+	Creator    *UserResponse        `json:"creator,omitempty"`
+}
+
+// APIKeySecretResponse represents a newly created or rotated API key
+type APIKeySecretResponse struct {
+	APIKeyResponse
+	Key string `json:"key"` // shown only once
+}
+
+// APIKeyListResponse represents a list of API keys
+type APIKeyListResponse struct {
+	Keys  []APIKeyResponse `json:"keys"`
+	Total int64            `json:"total"`
+}
+
+// ToAPIKeyResponse converts an APIKey model to APIKeyResponse DTO
+func ToAPIKeyResponse(key *models.APIKey) *APIKeyResponse {
+	if key == nil {
+		return nil
+	}
+
+	scopes := key.ScopeList()
+	if scopes == nil {
+		scopes = []models.APIKeyScope{}
+	}
+	allowedIPs := key.AllowedIPList()
+	if allowedIPs == nil {
+		allowedIPs = []string{}
+	}
+
+	response := &APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     scopes,
+		AllowedIPs: allowedIPs,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		CreatedAt:  key.CreatedAt,
+		CreatedBy:  key.CreatedBy,
+	}
+	if key.Creator != nil {
+		response.Creator = ToUserResponse(key.Creator)
+	}
+	return response
+}
+
+// ToAPIKeyResponseList converts a slice of APIKey models to APIKeyResponse DTOs
+func ToAPIKeyResponseList(keys []models.APIKey) []APIKeyResponse {
+	responses := make([]APIKeyResponse, len(keys))
+	for i := range keys {
+		responses[i] = *ToAPIKeyResponse(&keys[i])
+	}
+	return responses
+}
@@ -1,6 +1,9 @@
 package dto
 
 import (
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
 )
 
@@ -10,18 +13,64 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse represents a login response
+// LoginResponse represents a login or token refresh response. When the user
+// has a security key, the password login returns no tokens but
+// WebAuthnRequired and the options to sign in with the key.
 type LoginResponse struct {
-	Token     string        `json:"token"`
-	ExpiresIn int           `json:"expires_in"` // in seconds
-	User      *UserResponse `json:"user"`
+	Token                  string                `json:"token"`
+	ExpiresIn              int                   `json:"expires_in"` // in seconds
+	RefreshToken           string                `json:"refresh_token"`
+	RefreshExpiresIn       int                   `json:"refresh_expires_in"` // in seconds
+	PasswordChangeRequired bool                  `json:"password_change_required,omitempty"`
+	WebAuthnSetupRequired  bool                  `json:"webauthn_setup_required,omitempty"` // admin must register a security key
+	WebAuthnRequired       bool                  `json:"webauthn_required,omitempty"`
+	WebAuthn               *WebAuthnLoginOptions `json:"webauthn,omitempty"`
+	User                   *UserResponse         `json:"user,omitempty"`
+}
+
+// RefreshRequest represents a token refresh or logout request. The web
+// frontend sends the refresh token as cookie instead.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LoginSessionResponse represents an active web or API login of a user
+type LoginSessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Device     string    `json:"device"` // e.g. "Firefox on Linux"
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`   // login time
+	LastSeenAt time.Time `json:"last_seen_at"` // last login or token refresh
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // the session of the request
+}
+
+// LoginSessionListResponse represents the active logins of a user
+type LoginSessionListResponse struct {
+	Sessions []LoginSessionResponse `json:"sessions"`
+	Total    int64                  `json:"total"`
+}
+
+// ForgotPasswordRequest represents a request for a password reset link
+type ForgotPasswordRequest struct {
+	Login string `json:"login" binding:"required,max=255"` // username or email
+}
+
+// ResetPasswordRequest represents setting a new password with a reset link
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
 }
 
 // AuthUser represents the authenticated user context
 type AuthUser struct {
-	ID       string      `json:"id"`
-	Username string      `json:"username"`
-	Role     models.Role `json:"role"`
+	ID                     string      `json:"id"`
+	Username               string      `json:"username"`
+	Role                   models.Role `json:"role"`
+	PasswordChangeRequired bool        `json:"password_change_required,omitempty"`
+	WebAuthnSetupRequired  bool        `json:"webauthn_setup_required,omitempty"`
+	TokenID                string      `json:"-"` // jti of the access token, empty for API keys
 }
 
 // ErrorResponse represents an error response
@@ -9,25 +9,28 @@ import (
 
 // CreateGroupRequest represents a request to create a new group
 type CreateGroupRequest struct {
-	Name        string `json:"name" binding:"required,min=2,max=100"`
-	Description string `json:"description,omitempty" binding:"max=500"`
+	Name                string `json:"name" binding:"required,min=2,max=100"`
+	Description         string `json:"description,omitempty" binding:"max=500"`
+	MonthlyTrafficQuota int64  `json:"monthly_traffic_quota,omitempty" binding:"min=0"` // bytes shared by all members, 0 = unlimited
 }
 
 // UpdateGroupRequest represents a request to update a group
 type UpdateGroupRequest struct {
-	Name        string `json:"name,omitempty" binding:"omitempty,min=2,max=100"`
-	Description string `json:"description,omitempty" binding:"max=500"`
+	Name                string `json:"name,omitempty" binding:"omitempty,min=2,max=100"`
+	Description         string `json:"description,omitempty" binding:"max=500"`
+	MonthlyTrafficQuota *int64 `json:"monthly_traffic_quota,omitempty" binding:"omitempty,min=0"`
 }
 
 // GroupResponse represents a group in API responses
 type GroupResponse struct {
-	ID          uuid.UUID  `json:"id"`
-	Name        string     `json:"name"`
-	Description string     `json:"description,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
-	CreatedBy   uuid.UUID  `json:"created_by"`
-	UpdatedBy   *uuid.UUID `json:"updated_by,omitempty"`
+	ID                  uuid.UUID  `json:"id"`
+	Name                string     `json:"name"`
+	Description         string     `json:"description,omitempty"`
+	MonthlyTrafficQuota int64      `json:"monthly_traffic_quota"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           *time.Time `json:"updated_at,omitempty"`
+	CreatedBy           uuid.UUID  `json:"created_by"`
+	UpdatedBy           *uuid.UUID `json:"updated_by,omitempty"`
 }
 
 // GroupListResponse represents a paginated list of groups
@@ -59,13 +62,14 @@ func ToGroupResponse(group *models.Group) *GroupResponse {
 	}
 
 	return &GroupResponse{
-		ID:          group.ID,
-		Name:        group.Name,
-		Description: group.Description,
-		CreatedAt:   group.CreatedAt,
-		UpdatedAt:   group.UpdatedAt,
-		CreatedBy:   group.CreatedBy,
-		UpdatedBy:   group.UpdatedBy,
+		ID:                  group.ID,
+		Name:                group.Name,
+		Description:         group.Description,
+		MonthlyTrafficQuota: group.MonthlyTrafficQuota,
+		CreatedAt:           group.CreatedAt,
+		UpdatedAt:           group.UpdatedAt,
+		CreatedBy:           group.CreatedBy,
+		UpdatedBy:           group.UpdatedBy,
 	}
 }
 
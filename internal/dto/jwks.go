@@ -0,0 +1,18 @@
+package dto
+
+// JWK represents a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`           // RSA or OKP
+	Use string `json:"use"`           // always "sig"
+	Alg string `json:"alg"`           // RS256 or EdDSA
+	Kid string `json:"kid"`           // key ID, matches the kid header of tokens
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // Ed25519
+	X   string `json:"x,omitempty"`   // Ed25519 public key
+}
+
+// JWKSResponse represents a JSON Web Key Set
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QuotaStatusResponse represents a user's traffic usage against their quotas for the current period
+type QuotaStatusResponse struct {
+	UserID      uuid.UUID           `json:"user_id"`
+	PeriodStart time.Time           `json:"period_start"`
+	PeriodEnd   time.Time           `json:"period_end"`
+	Quota       int64               `json:"quota"` // bytes, 0 = unlimited
+	Usage       int64               `json:"usage"` // bytes used by the user in the period
+	Groups      []GroupQuotaStatus  `json:"groups,omitempty"`
+	Exceeded    bool                `json:"exceeded"`
+	ExceededBy  *QuotaExceededScope `json:"exceeded_by,omitempty"`
+}
+
+// GroupQuotaStatus represents a group's shared traffic usage against its quota
+type GroupQuotaStatus struct {
+	GroupID uuid.UUID `json:"group_id"`
+	Name    string    `json:"name"`
+	Quota   int64     `json:"quota"` // bytes, 0 = unlimited
+	Usage   int64     `json:"usage"` // bytes used by all group members in the period
+}
+
+// QuotaExceededScope describes which quota was exhausted
+type QuotaExceededScope struct {
+	Scope   string     `json:"scope"` // "user" or "group"
+	GroupID *uuid.UUID `json:"group_id,omitempty"`
+	Name    string     `json:"name,omitempty"`
+}
+
+// OverQuotaSessionResponse represents an active session whose user ran out of quota
+type OverQuotaSessionResponse struct {
+	SessionID uuid.UUID `json:"session_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	VpnIP     string    `json:"vpn_ip"`
+	Reason    string    `json:"reason"`
+}
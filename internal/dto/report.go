@@ -0,0 +1,46 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TopTalkersFilter represents parameters of the top talkers report
+type TopTalkersFilter struct {
+	Start  *time.Time `form:"start"`                                                         // default: 7 days before end
+	End    *time.Time `form:"end"`                                                           // default: now
+	Limit  int        `form:"limit,default=10" binding:"min=1,max=100"`                      // entries per list
+	SortBy string     `form:"sort_by,default=bytes" binding:"oneof=bytes sessions duration"` // ranking metric
+	Format string     `form:"format,default=json" binding:"oneof=json csv"`                  // response format
+}
+
+// UsageMetrics represents VPN usage of a user or group over a period
+type UsageMetrics struct {
+	BytesReceived    int64 `json:"bytes_received"`
+	BytesSent        int64 `json:"bytes_sent"`
+	TotalBytes       int64 `json:"total_bytes"`
+	Sessions         int64 `json:"sessions"`          // sessions started in the period
+	ConnectedSeconds int64 `json:"connected_seconds"` // connected time within the period
+}
+
+// TopTalkerEntry represents a ranked user or group in the top talkers report
+type TopTalkerEntry struct {
+	Rank          int          `json:"rank"`
+	ID            uuid.UUID    `json:"id"`
+	Name          string       `json:"name"`
+	Current       UsageMetrics `json:"current"`
+	Previous      UsageMetrics `json:"previous"`
+	ChangePercent *float64     `json:"change_percent"` // change of the ranking metric, null if previous is zero
+}
+
+// TopTalkersReport represents the top users and groups over a period compared to the previous period
+type TopTalkersReport struct {
+	Start         time.Time        `json:"start"`
+	End           time.Time        `json:"end"`
+	PreviousStart time.Time        `json:"previous_start"`
+	PreviousEnd   time.Time        `json:"previous_end"`
+	SortBy        string           `json:"sort_by"`
+	Users         []TopTalkerEntry `json:"users"`
+	Groups        []TopTalkerEntry `json:"groups"`
+}
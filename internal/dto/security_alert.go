@@ -0,0 +1,79 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+// SecurityAlertResponse represents a security alert in API responses
+type SecurityAlertResponse struct {
+	ID             uuid.UUID            `json:"id"`
+	Type           models.AlertType     `json:"type"`
+	Severity       models.AlertSeverity `json:"severity"`
+	UserID         *uuid.UUID           `json:"user_id,omitempty"`
+	Username       string               `json:"username,omitempty"`
+	SourceIP       string               `json:"source_ip,omitempty"`
+	Message        string               `json:"message"`
+	ObservedAt     time.Time            `json:"observed_at"`
+	Blocked        bool                 `json:"blocked"`
+	Acknowledged   bool                 `json:"acknowledged"`
+	AcknowledgedBy *uuid.UUID           `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time           `json:"acknowledged_at,omitempty"`
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+// SecurityAlertListResponse represents a paginated list of security alerts
+type SecurityAlertListResponse struct {
+	Alerts     []SecurityAlertResponse `json:"alerts"`
+	Total      int64                   `json:"total"`
+	Page       int                     `json:"page"`
+	PageSize   int                     `json:"page_size"`
+	TotalPages int                     `json:"total_pages"`
+}
+
+// SecurityAlertFilter represents filters for security alert queries
+type SecurityAlertFilter struct {
+	UserID       *uuid.UUID            `form:"user_id"`
+	Type         *models.AlertType     `form:"type"`
+	Severity     *models.AlertSeverity `form:"severity"`
+	SourceIP     string                `form:"source_ip"`
+	Acknowledged *bool                 `form:"acknowledged"`
+	StartDate    *time.Time            `form:"start_date"`
+	EndDate      *time.Time            `form:"end_date"`
+	Page         int                   `form:"page,default=1"`
+	PageSize     int                   `form:"page_size,default=20"`
+}
+
+// ToSecurityAlertResponse converts a SecurityAlert model to SecurityAlertResponse DTO
+func ToSecurityAlertResponse(alert *models.SecurityAlert) *SecurityAlertResponse {
+	if alert == nil {
+		return nil
+	}
+
+	return &SecurityAlertResponse{
+		ID:             alert.ID,
+		Type:           alert.Type,
+		Severity:       alert.Severity,
+		UserID:         alert.UserID,
+		Username:       alert.Username,
+		SourceIP:       alert.SourceIP,
+		Message:        alert.Message,
+		ObservedAt:     alert.ObservedAt,
+		Blocked:        alert.Blocked,
+		Acknowledged:   alert.Acknowledged,
+		AcknowledgedBy: alert.AcknowledgedBy,
+		AcknowledgedAt: alert.AcknowledgedAt,
+		CreatedAt:      alert.CreatedAt,
+	}
+}
+
+// ToSecurityAlertResponseList converts a slice of SecurityAlert models to SecurityAlertResponse DTOs
+func ToSecurityAlertResponseList(alerts []models.SecurityAlert) []SecurityAlertResponse {
+	responses := make([]SecurityAlertResponse, len(alerts))
+	for i := range alerts {
+		responses[i] = *ToSecurityAlertResponse(&alerts[i])
+	}
+	return responses
+}
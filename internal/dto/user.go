@@ -54,36 +54,39 @@ func (d *DateOnly) ToTimePtr() *time.Time {
 
 // CreateUserRequest represents a request to create a new user
 type CreateUserRequest struct {
-	Username   string      `json:"username" binding:"required,min=3,max=100"`
-	Password   string      `json:"password" binding:"required,min=8"`
-	ManagerID  *uuid.UUID  `json:"manager_id,omitempty"`
-	FirstName  string      `json:"first_name" binding:"required,max=100"`
-	MiddleName string      `json:"middle_name,omitempty" binding:"max=100"`
-	LastName   string      `json:"last_name" binding:"required,max=100"`
-	Email      string      `json:"email" binding:"required,email,max=255"`
-	Telephone  string      `json:"telephone,omitempty" binding:"max=50"`
-	Role       models.Role `json:"role" binding:"required,oneof=USER MANAGER ADMIN"`
-	IsActive   *bool       `json:"is_active,omitempty"`
-	ValidFrom  *DateOnly   `json:"valid_from,omitempty"`
-	ValidTo    *DateOnly   `json:"valid_to,omitempty"`
-	VpnIP      string      `json:"vpn_ip,omitempty" binding:"max=45"`
+	Username            string      `json:"username" binding:"required,min=3,max=100"`
+	Password            string      `json:"password" binding:"required,min=8"`
+	ManagerID           *uuid.UUID  `json:"manager_id,omitempty"`
+	FirstName           string      `json:"first_name" binding:"required,max=100"`
+	MiddleName          string      `json:"middle_name,omitempty" binding:"max=100"`
+	LastName            string      `json:"last_name" binding:"required,max=100"`
+	Email               string      `json:"email" binding:"required,email,max=255"`
+	Telephone           string      `json:"telephone,omitempty" binding:"max=50"`
+	Role                models.Role `json:"role" binding:"required,oneof=USER MANAGER ADMIN"`
+	IsActive            *bool       `json:"is_active,omitempty"`
+	ValidFrom           *DateOnly   `json:"valid_from,omitempty"`
+	ValidTo             *DateOnly   `json:"valid_to,omitempty"`
+	VpnIP               string      `json:"vpn_ip,omitempty" binding:"max=45"`
+	MonthlyTrafficQuota int64       `json:"monthly_traffic_quota,omitempty" binding:"min=0"` // bytes, 0 = unlimited
+	MustChangePassword  *bool       `json:"must_change_password,omitempty"`                  // default: true, only admins can set false
 }
 
 // UpdateUserRequest represents a request to update a user
 type UpdateUserRequest struct {
-	Username   string      `json:"username,omitempty" binding:"omitempty,min=3,max=100"`
-	Password   string      `json:"password,omitempty" binding:"omitempty,min=8"`
-	ManagerID  *uuid.UUID  `json:"manager_id,omitempty"`
-	FirstName  string      `json:"first_name,omitempty" binding:"max=100"`
-	MiddleName string      `json:"middle_name,omitempty" binding:"max=100"`
-	LastName   string      `json:"last_name,omitempty" binding:"max=100"`
-	Email      string      `json:"email,omitempty" binding:"omitempty,email,max=255"`
-	Telephone  string      `json:"telephone,omitempty" binding:"max=50"`
-	Role       models.Role `json:"role,omitempty" binding:"omitempty,oneof=USER MANAGER ADMIN"`
-	IsActive   *bool       `json:"is_active,omitempty"`
-	ValidFrom  *DateOnly   `json:"valid_from,omitempty"`
-	ValidTo    *DateOnly   `json:"valid_to,omitempty"`
-	VpnIP      *string     `json:"vpn_ip,omitempty" binding:"omitempty,max=45"`
+	Username            string      `json:"username,omitempty" binding:"omitempty,min=3,max=100"`
+	Password            string      `json:"password,omitempty" binding:"omitempty,min=8"`
+	ManagerID           *uuid.UUID  `json:"manager_id,omitempty"`
+	FirstName           string      `json:"first_name,omitempty" binding:"max=100"`
+	MiddleName          string      `json:"middle_name,omitempty" binding:"max=100"`
+	LastName            string      `json:"last_name,omitempty" binding:"max=100"`
+	Email               string      `json:"email,omitempty" binding:"omitempty,email,max=255"`
+	Telephone           string      `json:"telephone,omitempty" binding:"max=50"`
+	Role                models.Role `json:"role,omitempty" binding:"omitempty,oneof=USER MANAGER ADMIN"`
+	IsActive            *bool       `json:"is_active,omitempty"`
+	ValidFrom           *DateOnly   `json:"valid_from,omitempty"`
+	ValidTo             *DateOnly   `json:"valid_to,omitempty"`
+	VpnIP               *string     `json:"vpn_ip,omitempty" binding:"omitempty,max=45"`
+	MonthlyTrafficQuota *int64      `json:"monthly_traffic_quota,omitempty" binding:"omitempty,min=0"` // bytes, 0 = unlimited
 }
 
 // UpdatePasswordRequest represents a request to update user password
@@ -103,24 +106,27 @@ type UpdateProfileRequest struct {
 
 // UserResponse represents a user in API responses
 type UserResponse struct {
-	ID         uuid.UUID     `json:"id"`
-	Username   string        `json:"username"`
-	ManagerID  *uuid.UUID    `json:"manager_id,omitempty"`
-	Manager    *UserResponse `json:"manager,omitempty"`
-	FirstName  string        `json:"first_name"`
-	MiddleName string        `json:"middle_name,omitempty"`
-	LastName   string        `json:"last_name"`
-	Email      string        `json:"email"`
-	Telephone  string        `json:"telephone,omitempty"`
-	Role       models.Role   `json:"role"`
-	IsActive   bool          `json:"is_active"`
-	ValidFrom  *time.Time    `json:"valid_from,omitempty"`
-	ValidTo    *time.Time    `json:"valid_to,omitempty"`
-	VpnIP      string        `json:"vpn_ip,omitempty"`
-	CreatedAt  time.Time     `json:"created_at"`
-	UpdatedAt  *time.Time    `json:"updated_at,omitempty"`
-	CreatedBy  uuid.UUID     `json:"created_by"`
-	UpdatedBy  *uuid.UUID    `json:"updated_by,omitempty"`
+	ID                  uuid.UUID         `json:"id"`
+	Username            string            `json:"username"`
+	ManagerID           *uuid.UUID        `json:"manager_id,omitempty"`
+	Manager             *UserResponse     `json:"manager,omitempty"`
+	FirstName           string            `json:"first_name"`
+	MiddleName          string            `json:"middle_name,omitempty"`
+	LastName            string            `json:"last_name"`
+	Email               string            `json:"email"`
+	Telephone           string            `json:"telephone,omitempty"`
+	Role                models.Role       `json:"role"`
+	IsActive            bool              `json:"is_active"`
+	ValidFrom           *time.Time        `json:"valid_from,omitempty"`
+	ValidTo             *time.Time        `json:"valid_to,omitempty"`
+	VpnIP               string            `json:"vpn_ip,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           *time.Time        `json:"updated_at,omitempty"`
+	CreatedBy           uuid.UUID         `json:"created_by"`
+	UpdatedBy           *uuid.UUID        `json:"updated_by,omitempty"`
+	MonthlyTrafficQuota int64             `json:"monthly_traffic_quota"`
+	AuthSource          models.AuthSource `json:"auth_source"`
+	MustChangePassword  bool              `json:"must_change_password"`
 }
 
 // UserListResponse represents a paginated list of users
@@ -139,23 +145,26 @@ func ToUserResponse(user *models.User) *UserResponse {
 	}
 
 	response := &UserResponse{
-		ID:         user.ID,
-		Username:   user.Username,
-		ManagerID:  user.ManagerID,
-		FirstName:  user.FirstName,
-		MiddleName: user.MiddleName,
-		LastName:   user.LastName,
-		Email:      user.Email,
-		Telephone:  user.Telephone,
-		Role:       user.Role,
-		IsActive:   user.IsActive,
-		ValidFrom:  user.ValidFrom,
-		ValidTo:    user.ValidTo,
-		VpnIP:      user.VpnIP,
-		CreatedAt:  user.CreatedAt,
-		UpdatedAt:  user.UpdatedAt,
-		CreatedBy:  user.CreatedBy,
-		UpdatedBy:  user.UpdatedBy,
+		ID:                  user.ID,
+		Username:            user.Username,
+		ManagerID:           user.ManagerID,
+		FirstName:           user.FirstName,
+		MiddleName:          user.MiddleName,
+		LastName:            user.LastName,
+		Email:               user.Email,
+		Telephone:           user.Telephone,
+		Role:                user.Role,
+		IsActive:            user.IsActive,
+		ValidFrom:           user.ValidFrom,
+		ValidTo:             user.ValidTo,
+		VpnIP:               user.VpnIP,
+		CreatedAt:           user.CreatedAt,
+		UpdatedAt:           user.UpdatedAt,
+		CreatedBy:           user.CreatedBy,
+		UpdatedBy:           user.UpdatedBy,
+		MonthlyTrafficQuota: user.MonthlyTrafficQuota,
+		AuthSource:          user.AuthSource,
+		MustChangePassword:  user.MustChangePassword,
 	}
 
 	if user.Manager != nil {
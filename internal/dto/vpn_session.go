@@ -9,10 +9,11 @@ import (
 
 // CreateVpnSessionRequest represents a request to create a new VPN session
 type CreateVpnSessionRequest struct {
-	UserID      uuid.UUID `json:"user_id" binding:"required"`
-	VpnIP       string    `json:"vpn_ip" binding:"required,max=45"`
-	ClientIP    string    `json:"client_ip,omitempty" binding:"max=45"`
-	ConnectedAt time.Time `json:"connected_at" binding:"required"`
+	UserID        uuid.UUID `json:"user_id" binding:"required"`
+	VpnIP         string    `json:"vpn_ip" binding:"required,max=45"`
+	ClientIP      string    `json:"client_ip,omitempty" binding:"max=45"`
+	ConnectedAt   time.Time `json:"connected_at" binding:"required"`
+	AcctSessionID string    `json:"acct_session_id,omitempty" binding:"max=64"`
 }
 
 // UpdateVpnSessionRequest represents a request to update a VPN session (disconnect)
@@ -31,6 +32,45 @@ type CreateVpnTrafficStatsRequest struct {
 	BytesSentDelta     int64     `json:"bytes_sent_delta"`
 }
 
+// VpnTrafficStatsBatchEntry represents traffic of one session in a batch. It
+// carries either deltas since the previous report or cumulative counters of
+// the session as found in the OpenVPN status file.
+type VpnTrafficStatsBatchEntry struct {
+	SessionID          uuid.UUID  `json:"session_id" binding:"required"`
+	Timestamp          *time.Time `json:"timestamp"` // default: batch timestamp
+	BytesReceivedDelta *int64     `json:"bytes_received_delta" binding:"omitempty,min=0"`
+	BytesSentDelta     *int64     `json:"bytes_sent_delta" binding:"omitempty,min=0"`
+	BytesReceived      *int64     `json:"bytes_received" binding:"omitempty,min=0"` // cumulative counter
+	BytesSent          *int64     `json:"bytes_sent" binding:"omitempty,min=0"`     // cumulative counter
+}
+
+// CreateVpnTrafficStatsBatchRequest represents a request to create traffic stats of many sessions at once
+type CreateVpnTrafficStatsBatchRequest struct {
+	Timestamp *time.Time                  `json:"timestamp"` // default: now
+	Entries   []VpnTrafficStatsBatchEntry `json:"entries" binding:"required,min=1,max=5000,dive"`
+}
+
+// VpnTrafficStatsBatchSkipped represents a batch entry that was not stored
+type VpnTrafficStatsBatchSkipped struct {
+	SessionID uuid.UUID `json:"session_id"`
+	Reason    string    `json:"reason"`
+}
+
+// VpnTrafficStatsBatchQuotaExceeded represents a user of a traffic stats batch
+// who ran out of monthly quota and whose sessions should be disconnected
+type VpnTrafficStatsBatchQuotaExceeded struct {
+	UserID     uuid.UUID   `json:"user_id"`
+	SessionIDs []uuid.UUID `json:"session_ids"` // active sessions of the user in the batch
+}
+
+// VpnTrafficStatsBatchResponse represents the result of a traffic stats batch
+type VpnTrafficStatsBatchResponse struct {
+	Inserted      int                                 `json:"inserted"` // traffic stats entries stored
+	Sessions      int                                 `json:"sessions"` // sessions whose running totals were updated
+	Skipped       []VpnTrafficStatsBatchSkipped       `json:"skipped"`
+	QuotaExceeded []VpnTrafficStatsBatchQuotaExceeded `json:"quota_exceeded"`
+}
+
 // VpnSessionResponse represents a VPN session in API responses
 type VpnSessionResponse struct {
 	ID               uuid.UUID                `json:"id"`
@@ -46,6 +86,7 @@ type VpnSessionResponse struct {
 	DisconnectReason *models.DisconnectReason `json:"disconnect_reason,omitempty"`
 	Duration         string                   `json:"duration"`
 	IsActive         bool                     `json:"is_active"`
+	AcctSessionID    string                   `json:"acct_session_id,omitempty"`
 }
 
 // VpnSessionListResponse represents a paginated list of VPN sessions
@@ -76,6 +117,7 @@ type VpnTrafficStatsResponse struct {
 	BytesReceivedDelta int64     `json:"bytes_received_delta"`
 	BytesSentDelta     int64     `json:"bytes_sent_delta"`
 	TotalBytesDelta    int64     `json:"total_bytes_delta"`
+	QuotaExceeded      bool      `json:"quota_exceeded,omitempty"` // set on create when the session should be disconnected
 }
 
 // VpnTrafficStatsListResponse represents a paginated list of traffic stats
@@ -96,6 +138,31 @@ type VpnTrafficStatsFilter struct {
 	PageSize  int        `form:"page_size,default=20"`
 }
 
+// TrafficSeriesFilter represents parameters of a traffic time series query
+type TrafficSeriesFilter struct {
+	UserID    *uuid.UUID `form:"user_id"`
+	GroupID   *uuid.UUID `form:"group_id"`
+	NetworkID *uuid.UUID `form:"network_id"`                                 // members of the groups with access to the network
+	Start     *time.Time `form:"start"`                                      // default: 24 hours before end
+	End       *time.Time `form:"end"`                                        // default: now
+	Bucket    string     `form:"bucket,default=1h" binding:"oneof=5m 1h 1d"` // bucket size
+}
+
+// TrafficSeriesPoint represents traffic aggregated into one bucket
+type TrafficSeriesPoint struct {
+	Timestamp     time.Time `json:"timestamp"` // bucket start
+	BytesReceived int64     `json:"bytes_received"`
+	BytesSent     int64     `json:"bytes_sent"`
+}
+
+// TrafficSeriesResponse represents a traffic time series
+type TrafficSeriesResponse struct {
+	Bucket string               `json:"bucket"`
+	Start  time.Time            `json:"start"`
+	End    time.Time            `json:"end"`
+	Points []TrafficSeriesPoint `json:"points"`
+}
+
 // VpnUsageStats represents aggregated usage statistics
 type VpnUsageStats struct {
 	TotalSessions      int64 `json:"total_sessions"`
@@ -103,6 +170,8 @@ type VpnUsageStats struct {
 	TotalBytesReceived int64 `json:"total_bytes_received"`
 	TotalBytesSent     int64 `json:"total_bytes_sent"`
 	TotalBytes         int64 `json:"total_bytes"`
+	BytesLast24Hours   int64 `json:"bytes_last_24_hours"` // from traffic rollups
+	BytesLast30Days    int64 `json:"bytes_last_30_days"`  // from traffic rollups
 }
 
 // UserVpnUsageResponse represents VPN usage for a specific user
@@ -135,6 +204,7 @@ func ToVpnSessionResponse(session *models.VpnSession) *VpnSessionResponse {
 		DisconnectReason: session.DisconnectReason,
 		Duration:         session.Duration().String(),
 		IsActive:         session.IsActive(),
+		AcctSessionID:    session.AcctSessionID,
 	}
 
 	if session.User != nil {
@@ -0,0 +1,76 @@
+package dto
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/webauthn"
+)
+
+// WebAuthnRegisterRequest represents the browser's response to a security
+// key registration
+type WebAuthnRegisterRequest struct {
+	Name       string                      `json:"name" binding:"required,max=100"` // e.g. "YubiKey 5C"
+	Credential webauthn.CredentialResponse `json:"credential" binding:"required"`
+}
+
+// WebAuthnRenameRequest represents renaming a security key
+type WebAuthnRenameRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// WebAuthnLoginOptions represents the options for navigator.credentials.get()
+// when a security key login is started
+type WebAuthnLoginOptions struct {
+	PublicKey webauthn.RequestOptions `json:"publicKey"`
+}
+
+// WebAuthnRegisterOptions represents the options for
+// navigator.credentials.create() when a security key registration is started
+type WebAuthnRegisterOptions struct {
+	PublicKey webauthn.CreationOptions `json:"publicKey"`
+}
+
+// WebAuthnCredentialResponse represents a registered security key
+type WebAuthnCredentialResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// WebAuthnCredentialListResponse represents the security keys of a user
+type WebAuthnCredentialListResponse struct {
+	Credentials []WebAuthnCredentialResponse `json:"credentials"`
+	Total       int64                        `json:"total"`
+}
+
+// ToWebAuthnCredentialResponse converts a WebAuthnCredential model to WebAuthnCredentialResponse
+func ToWebAuthnCredentialResponse(c *models.WebAuthnCredential) *WebAuthnCredentialResponse {
+	if c == nil {
+		return nil
+	}
+	var transports []string
+	if c.Transports != "" {
+		transports = strings.Split(c.Transports, ",")
+	}
+	return &WebAuthnCredentialResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		Transports: transports,
+		LastUsedAt: c.LastUsedAt,
+		CreatedAt:  c.CreatedAt,
+	}
+}
+
+// ToWebAuthnCredentialResponseList converts a slice of WebAuthnCredential models to WebAuthnCredentialResponse DTOs
+func ToWebAuthnCredentialResponseList(credentials []models.WebAuthnCredential) []WebAuthnCredentialResponse {
+	responses := make([]WebAuthnCredentialResponse, len(credentials))
+	for i := range credentials {
+		responses[i] = *ToWebAuthnCredentialResponse(&credentials[i])
+	}
+	return responses
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+)
+
+// APIKeyHandler handles API key related requests
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+	auditLogger   *middleware.AuditLogger
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler() *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: services.NewAPIKeyService(),
+		auditLogger:   middleware.NewAuditLogger(),
+	}
+}
+
+// List godoc
+// @Summary      List API keys
+// @Description  Get all API keys of service accounts, including revoked keys (ADMIN only)
+// @Tags         api-keys
+// @Produce      json
+// @Success      200  {object} dto.APIKeyListResponse
+// @Failure      401  {object} dto.ErrorResponse
+// @Failure      403  {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/api-keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.apiKeyService.List()
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIKeyListResponse{
+		Keys:  dto.ToAPIKeyResponseList(keys),
+		Total: int64(len(keys)),
+	})
+}
+
+// Create godoc
+// @Summary      Create API key
+// @Description  Create an API key with scopes (vpn-auth, reports:read, users:provision), optional expiry and allowed IPs (ADMIN only). The key is returned only in this response.
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Param        request  body     dto.CreateAPIKeyRequest  true  "API key data"
+// @Success      201      {object} dto.APIKeySecretResponse
+// @Failure      400      {object} dto.ErrorResponse
+// @Failure      401      {object} dto.ErrorResponse
+// @Failure      403      {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/api-keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req dto.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	key, secret, err := h.apiKeyService.Create(&req, middleware.GetAuthUserID(c))
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	response := dto.ToAPIKeyResponse(key)
+	h.auditLogger.LogCreate(c, "api_key", key.ID, response)
+
+	c.JSON(http.StatusCreated, dto.APIKeySecretResponse{APIKeyResponse: *response, Key: secret})
+}
+
+// Get godoc
+// @Summary      Get API key
+// @Description  Get an API key by ID (ADMIN only)
+// @Tags         api-keys
+// @Produce      json
+// @Param        id   path     string  true  "API key ID"
+// @Success      200  {object} dto.APIKeyResponse
+// @Failure      400  {object} dto.ErrorResponse
+// @Failure      401  {object} dto.ErrorResponse
+// @Failure      403  {object} dto.ErrorResponse
+// @Failure      404  {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/api-keys/{id} [get]
+func (h *APIKeyHandler) Get(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid API key ID"))
+		return
+	}
+
+	key, err := h.apiKeyService.GetByID(id)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ToAPIKeyResponse(key))
+}
+
+// Revoke godoc
+// @Summary      Revoke API key
+// @Description  Revoke an API key; requests with it are rejected immediately (ADMIN only)
+// @Tags         api-keys
+// @Produce      json
+// @Param        id   path     string  true  "API key ID"
+// @Success      200  {object} dto.APIKeyResponse
+// @Failure      400  {object} dto.ErrorResponse
+// @Failure      401  {object} dto.ErrorResponse
+// @Failure      403  {object} dto.ErrorResponse
+// @Failure      404  {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/api-keys/{id}/revoke [post]
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid API key ID"))
+		return
+	}
+
+	key, err := h.apiKeyService.Revoke(id)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	response := dto.ToAPIKeyResponse(key)
+	h.auditLogger.Log(c, models.AuditActionUpdate, "api_key", &key.ID, nil, response, "API key revoked")
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Rotate godoc
+// @Summary      Rotate API key
+// @Description  Replace the key of an API key keeping its scopes and restrictions; the previous key stops working immediately (ADMIN only). The new key is returned only in this response.
+// @Tags         api-keys
+// @Produce      json
+// @Param        id   path     string  true  "API key ID"
+// @Success      200  {object} dto.APIKeySecretResponse
+// @Failure      400  {object} dto.ErrorResponse
+// @Failure      401  {object} dto.ErrorResponse
+// @Failure      403  {object} dto.ErrorResponse
+// @Failure      404  {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/api-keys/{id}/rotate [post]
+func (h *APIKeyHandler) Rotate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid API key ID"))
+		return
+	}
+
+	key, secret, err := h.apiKeyService.Rotate(id)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	response := dto.ToAPIKeyResponse(key)
+	h.auditLogger.Log(c, models.AuditActionUpdate, "api_key", &key.ID, nil, response, "API key rotated")
+
+	c.JSON(http.StatusOK, dto.APIKeySecretResponse{APIKeyResponse: *response, Key: secret})
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -12,15 +13,25 @@ import (
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
 )
 
+const (
+	// accessTokenCookie carries the access token of the web frontend
+	accessTokenCookie = "token"
+	// refreshTokenCookie carries the refresh token of the web frontend
+	refreshTokenCookie = "refresh_token"
+)
+
 // AuthHandler handles authentication requests
 type AuthHandler struct {
-	authService *services.AuthService
-	auditLogger *middleware.AuditLogger
-	config      *config.AuthConfig
-	blacklist   *middleware.TokenBlacklist
+	authService    *services.AuthService
+	refreshService *services.RefreshTokenService
+	auditLogger    *middleware.AuditLogger
+	config         *config.AuthConfig
+	blacklist      *middleware.TokenBlacklist
+	webAuthn       *services.WebAuthnService
 }
 
 // NewAuthHandler creates a new auth handler
@@ -32,16 +43,18 @@ func NewAuthHandler(cfg *config.AuthConfig, blacklist *middleware.TokenBlacklist
 		authService = services.NewAuthService(cfg)
 	}
 	return &AuthHandler{
-		authService: authService,
-		auditLogger: middleware.NewAuditLogger(),
-		config:      cfg,
-		blacklist:   blacklist,
+		authService:    authService,
+		refreshService: services.NewRefreshTokenService(cfg),
+		auditLogger:    middleware.NewAuditLogger(),
+		config:         cfg,
+		blacklist:      blacklist,
+		webAuthn:       services.NewWebAuthnService(&cfg.WebAuthn),
 	}
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return a short-lived JWT access token and a refresh token. Users with a registered security key get no tokens but webauthn_required and the options to complete the login at /api/v1/auth/webauthn/login/finish.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -49,6 +62,7 @@ func NewAuthHandler(cfg *config.AuthConfig, blacklist *middleware.TokenBlacklist
 // @Success 200 {object} dto.LoginResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
 // @Router /api/v1/auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req dto.LoginRequest
@@ -71,28 +85,119 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Users with a security key must also sign in with it
+	if h.config.WebAuthn.Enabled && h.webAuthn.HasCredentials(user.ID) {
+		options, err := h.webAuthn.BeginLogin(user)
+		if err != nil {
+			apperror.HandleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, dto.LoginResponse{
+			WebAuthnRequired: true,
+			WebAuthn:         &dto.WebAuthnLoginOptions{PublicKey: *options},
+		})
+		return
+	}
+
 	// Log login
 	err = h.auditLogger.LogLogin(c, user.ID, "Successful login")
 	if err != nil {
 		return
 	}
 
-	// Set cookie for web frontend with SameSite=Lax for CSRF protection
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie("token", token, h.config.SessionExpiry*3600, "/", "", false, true)
+	refreshToken, refresh, err := h.refreshService.Issue(user, token, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
 
-	c.JSON(http.StatusOK, dto.LoginResponse{
-		Token:     token,
-		ExpiresIn: h.config.TokenExpiry * 3600,
-		User:      dto.ToUserResponse(user),
-	})
+	setSessionCookies(c, h.config, token, refreshToken, refresh.ExpiresAt)
+
+	c.JSON(http.StatusOK, loginResponse(h.config, token, refreshToken, refresh.ExpiresAt, user))
+}
+
+// Refresh godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token (request body or refresh_token cookie) for a new access token and a new refresh token. Each refresh token can be used once; reusing one revokes all tokens of the login. 409 means another request has just rotated the token and the request should be retried with the new one.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body dto.RefreshRequest false "Refresh token, if not sent as cookie"
+// @Success 200 {object} dto.LoginResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /api/v1/auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req dto.RefreshRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		refreshToken, _ = c.Cookie(refreshTokenCookie)
+		if refreshToken != "" && !middleware.ValidCSRFToken(c) {
+			middleware.AbortCSRF(c)
+			return
+		}
+	}
+
+	pair, err := h.refreshService.Refresh(refreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if !errors.Is(err, services.ErrRefreshTokenRotated) {
+			clearSessionCookies(c, h.config)
+		}
+		apperror.HandleError(c, err)
+		return
+	}
+
+	setSessionCookies(c, h.config, pair.AccessToken, pair.RefreshToken, pair.Refresh.ExpiresAt)
+
+	c.JSON(http.StatusOK, loginResponse(h.config, pair.AccessToken, pair.RefreshToken, pair.Refresh.ExpiresAt, pair.User))
+}
+
+// RefreshSession is middleware for web pages that renews an expired access
+// token cookie using the refresh token cookie before authentication runs
+func (h *AuthHandler) RefreshSession(c *gin.Context) {
+	if c.GetHeader("Authorization") != "" {
+		return
+	}
+	if token, err := c.Cookie(accessTokenCookie); err == nil && token != "" {
+		if _, err := middleware.ParseToken(h.config, token); err == nil {
+			return
+		}
+	}
+	refreshToken, _ := c.Cookie(refreshTokenCookie)
+	if refreshToken == "" {
+		return
+	}
+
+	pair, err := h.refreshService.Refresh(refreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if !errors.Is(err, services.ErrRefreshTokenRotated) {
+			clearSessionCookies(c, h.config)
+		}
+		return
+	}
+
+	setSessionCookies(c, h.config, pair.AccessToken, pair.RefreshToken, pair.Refresh.ExpiresAt)
+	c.Request.Header.Set("Authorization", "Bearer "+pair.AccessToken)
 }
 
 // Logout godoc
 // @Summary Logout user
-// @Description Logout user and invalidate session
+// @Description Logout user, revoke the refresh token (request body or refresh_token cookie) and invalidate the access token
 // @Tags auth
+// @Accept json
 // @Produce json
+// @Param request body dto.RefreshRequest false "Refresh token to revoke, if not sent as cookie"
 // @Security BearerAuth
 // @Success 200 {object} dto.SuccessResponse
 // @Router /api/v1/auth/logout [post]
@@ -106,13 +211,27 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		}
 	}
 
-	// Blacklist the token so it cannot be reused
+	// Revoke the refresh token so the session cannot be renewed
+	var req dto.RefreshRequest
+	if c.Request.ContentLength > 0 {
+		_ = c.ShouldBindJSON(&req)
+	}
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		refreshToken, _ = c.Cookie(refreshTokenCookie)
+	}
+	if err := h.refreshService.Revoke(refreshToken); err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	// Blacklist the access token so it cannot be reused
 	if h.blacklist != nil {
 		rawToken := ""
 		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
 			rawToken = strings.TrimPrefix(authHeader, "Bearer ")
 		} else {
-			rawToken, _ = c.Cookie("token")
+			rawToken, _ = c.Cookie(accessTokenCookie)
 		}
 		if rawToken != "" {
 			// Parse expiry from token to know when to remove from blacklist
@@ -125,9 +244,7 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		}
 	}
 
-	// Clear cookie
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie("token", "", -1, "/", "", false, true)
+	clearSessionCookies(c, h.config)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Message: "Successfully logged out",
@@ -166,3 +283,34 @@ func (h *AuthHandler) Me(c *gin.Context) {
 
 	c.JSON(http.StatusOK, dto.ToUserResponse(user))
 }
+
+// setSessionCookies sets the token cookies of the web frontend, and a CSRF
+// token cookie when the session has none yet
+func setSessionCookies(c *gin.Context, cfg *config.AuthConfig, accessToken, refreshToken string, refreshExpiresAt time.Time) {
+	refreshMaxAge := int(time.Until(refreshExpiresAt).Seconds())
+	middleware.SetCookie(c, &cfg.Cookies, accessTokenCookie, accessToken, "/", int(cfg.AccessTokenDuration().Seconds()), true)
+	middleware.SetCookie(c, &cfg.Cookies, refreshTokenCookie, refreshToken, "/", refreshMaxAge, true)
+	if token, err := c.Cookie(middleware.CSRFCookie); err != nil || token == "" {
+		middleware.SetCSRFCookie(c, &cfg.Cookies, refreshMaxAge)
+	}
+}
+
+// clearSessionCookies removes the token and CSRF cookies of the web frontend
+func clearSessionCookies(c *gin.Context, cfg *config.AuthConfig) {
+	middleware.SetCookie(c, &cfg.Cookies, accessTokenCookie, "", "/", -1, true)
+	middleware.SetCookie(c, &cfg.Cookies, refreshTokenCookie, "", "/", -1, true)
+	middleware.SetCookie(c, &cfg.Cookies, middleware.CSRFCookie, "", "/", -1, false)
+}
+
+// loginResponse builds the response of a login or refresh
+func loginResponse(cfg *config.AuthConfig, accessToken, refreshToken string, refreshExpiresAt time.Time, user *models.User) dto.LoginResponse {
+	return dto.LoginResponse{
+		Token:                  accessToken,
+		ExpiresIn:              int(cfg.AccessTokenDuration().Seconds()),
+		RefreshToken:           refreshToken,
+		RefreshExpiresIn:       int(time.Until(refreshExpiresAt).Seconds()),
+		PasswordChangeRequired: services.NewPasswordPolicy(&cfg.PasswordPolicy).RequiresChange(user),
+		WebAuthnSetupRequired:  services.NewWebAuthnService(&cfg.WebAuthn).SetupRequired(user),
+		User:                   dto.ToUserResponse(user),
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/jwtkeys"
+)
+
+// JWKSHandler publishes the public keys access tokens are signed with
+type JWKSHandler struct {
+	keys *jwtkeys.KeySet
+}
+
+// NewJWKSHandler creates a new JWKS handler
+func NewJWKSHandler(cfg *config.AuthConfig) *JWKSHandler {
+	return &JWKSHandler{keys: jwtkeys.For(cfg)}
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys (RS256 or EdDSA) that verify access tokens, selected by the kid header of a token. Includes keys retired by a rotation until the tokens they signed expire. Empty when tokens are signed with the HS256 jwt_secret.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} dto.JWKSResponse
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	jwks, err := h.keys.JWKS()
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+)
+
+// LoginSessionHandler handles listing and revoking web and API logins
+type LoginSessionHandler struct {
+	refreshService *services.RefreshTokenService
+	auditLogger    *middleware.AuditLogger
+	blacklist      *middleware.TokenBlacklist
+	config         *config.AuthConfig
+}
+
+// NewLoginSessionHandler creates a new login session handler
+func NewLoginSessionHandler(cfg *config.AuthConfig, blacklist *middleware.TokenBlacklist) *LoginSessionHandler {
+	return &LoginSessionHandler{
+		refreshService: services.NewRefreshTokenService(cfg),
+		auditLogger:    middleware.NewAuditLogger(),
+		blacklist:      blacklist,
+		config:         cfg,
+	}
+}
+
+// List godoc
+// @Summary List my login sessions
+// @Description Get the active web and API logins of the current user with device, IP address and last activity
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.LoginSessionListResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /api/v1/auth/sessions [get]
+func (h *LoginSessionHandler) List(c *gin.Context) {
+	h.list(c, middleware.GetAuthUserID(c))
+}
+
+// Revoke godoc
+// @Summary Revoke a login session
+// @Description Sign out one login of the current user; its refresh and access tokens stop working
+// @Tags auth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/auth/sessions/{id} [delete]
+func (h *LoginSessionHandler) Revoke(c *gin.Context) {
+	h.revoke(c, middleware.GetAuthUserID(c), c.Param("id"))
+}
+
+// RevokeOthers godoc
+// @Summary Revoke other login sessions
+// @Description Sign out all logins of the current user except the one of this request
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /api/v1/auth/sessions [delete]
+func (h *LoginSessionHandler) RevokeOthers(c *gin.Context) {
+	userID := middleware.GetAuthUserID(c)
+	current := h.refreshService.SessionOfToken(userID, middleware.GetAuthUser(c).TokenID)
+	h.revokeAll(c, userID, current, "Revoked other login sessions")
+}
+
+// ListUserSessions godoc
+// @Summary List login sessions of a user
+// @Description Get the active web and API logins of a user (ADMIN only)
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.LoginSessionListResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/users/{id}/sessions [get]
+func (h *LoginSessionHandler) ListUserSessions(c *gin.Context) {
+	userID, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	h.list(c, userID)
+}
+
+// RevokeUserSession godoc
+// @Summary Revoke a login session of a user
+// @Description Sign out one login of a user (ADMIN only)
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Param session_id path string true "Session ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/users/{id}/sessions/{session_id} [delete]
+func (h *LoginSessionHandler) RevokeUserSession(c *gin.Context) {
+	userID, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	h.revoke(c, userID, c.Param("session_id"))
+}
+
+// RevokeUserSessions godoc
+// @Summary Revoke all login sessions of a user
+// @Description Sign out all logins of a user (ADMIN only)
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/users/{id}/sessions [delete]
+func (h *LoginSessionHandler) RevokeUserSessions(c *gin.Context) {
+	userID, ok := h.userParam(c)
+	if !ok {
+		return
+	}
+	h.revokeAll(c, userID, uuid.Nil, "Revoked all login sessions")
+}
+
+func (h *LoginSessionHandler) list(c *gin.Context, userID uuid.UUID) {
+	sessions, err := h.refreshService.ListSessions(userID, middleware.GetAuthUser(c).TokenID)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	response := dto.LoginSessionListResponse{
+		Sessions: make([]dto.LoginSessionResponse, len(sessions)),
+		Total:    int64(len(sessions)),
+	}
+	for i, s := range sessions {
+		response.Sessions[i] = dto.LoginSessionResponse{
+			ID:         s.ID,
+			Device:     s.Device,
+			IPAddress:  s.IPAddress,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.Current,
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *LoginSessionHandler) revoke(c *gin.Context, userID uuid.UUID, param string) {
+	sessionID, err := uuid.Parse(param)
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid session ID"))
+		return
+	}
+
+	current := h.refreshService.SessionOfToken(middleware.GetAuthUserID(c), middleware.GetAuthUser(c).TokenID)
+	tokenIDs, err := h.refreshService.RevokeSession(userID, sessionID)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+	h.markRevoked(tokenIDs)
+
+	h.auditLogger.Log(c, models.AuditActionLogout, "user", &userID, nil, nil, "Revoked login session "+sessionID.String())
+
+	// Revoking the own session is a logout
+	if sessionID == current {
+		clearSessionCookies(c, h.config)
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: "Session revoked",
+	})
+}
+
+func (h *LoginSessionHandler) revokeAll(c *gin.Context, userID, keep uuid.UUID, details string) {
+	tokenIDs, err := h.refreshService.RevokeSessions(userID, keep)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+	h.markRevoked(tokenIDs)
+
+	h.auditLogger.Log(c, models.AuditActionLogout, "user", &userID, nil, nil, details)
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: "Sessions revoked",
+	})
+}
+
+// userParam parses the user ID path parameter of the admin endpoints and
+// checks that the user exists
+func (h *LoginSessionHandler) userParam(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid user ID"))
+		return uuid.Nil, false
+	}
+	if _, err := services.GetUserByID(userID); err != nil {
+		apperror.HandleError(c, err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func (h *LoginSessionHandler) markRevoked(tokenIDs []string) {
+	if h.blacklist != nil {
+		h.blacklist.MarkRevoked(tokenIDs...)
+	}
+}
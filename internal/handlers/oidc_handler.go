@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+)
+
+const (
+	// oidcStateCookie carries state, nonce and PKCE verifier between login and callback
+	oidcStateCookie = "oidc_login"
+	// oidcStateMaxAge is the time in seconds the user has to sign in at the provider
+	oidcStateMaxAge = 600
+	// oidcLinkMode marks a state cookie of a signed-in user linking their account
+	oidcLinkMode = "link"
+)
+
+// OIDCHandler handles OpenID Connect single sign-on for the web UI
+type OIDCHandler struct {
+	oidcService    *services.OIDCService
+	authService    *services.AuthService
+	refreshService *services.RefreshTokenService
+	webAuthn       *services.WebAuthnService
+	auditLogger    *middleware.AuditLogger
+	config         *config.AuthConfig
+}
+
+// NewOIDCHandler creates a new OIDC handler
+func NewOIDCHandler(cfg *config.AuthConfig) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:    services.NewOIDCService(&cfg.OIDC),
+		authService:    services.NewAuthService(cfg),
+		refreshService: services.NewRefreshTokenService(cfg),
+		webAuthn:       services.NewWebAuthnService(&cfg.WebAuthn),
+		auditLogger:    middleware.NewAuditLogger(),
+		config:         cfg,
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	state, err := services.NewOIDCLoginState()
+	if err != nil {
+		h.loginError(c, "Failed to start single sign-on")
+		return
+	}
+
+	authURL, err := h.oidcService.AuthorizationURL(state)
+	if err != nil {
+		h.loginError(c, ssoErrorMessage(err))
+		return
+	}
+
+	h.setStateCookie(c, strings.Join([]string{state.State, state.Nonce, state.Verifier}, "."), oidcStateMaxAge)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// StartLink godoc
+// @Summary Start linking single sign-on
+// @Description Start linking an identity at the OpenID Connect provider to the current user. Open the returned URL in the browser; the provider redirects back to /auth/oidc/callback.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /api/v1/auth/oidc/link [post]
+func (h *OIDCHandler) StartLink(c *gin.Context) {
+	state, err := services.NewOIDCLoginState()
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	authURL, err := h.oidcService.AuthorizationURL(state)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	h.setStateCookie(c, strings.Join([]string{state.State, state.Nonce, state.Verifier, oidcLinkMode}, "."), oidcStateMaxAge)
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// LinkComplete links the identity at the end of a link started by StartLink.
+// Callback forwards here, where the session of the signed-in user is checked.
+func (h *OIDCHandler) LinkComplete(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 4 || parts[3] != oidcLinkMode || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(c.Query("state"))) != 1 {
+		h.linkError(c, "Single sign-on session expired, please try again")
+		return
+	}
+	state := &services.OIDCLoginState{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+
+	userID := middleware.GetAuthUserID(c)
+	if err := h.oidcService.Link(c.Query("code"), state, userID); err != nil {
+		h.linkError(c, ssoErrorMessage(err))
+		return
+	}
+
+	_ = h.auditLogger.Log(c, models.AuditActionUpdate, "user", &userID, nil, nil, "Linked single sign-on identity")
+	c.Redirect(http.StatusFound, "/profile?sso_linked=1")
+}
+
+// setStateCookie sets the login state cookie. The provider redirects back
+// cross-site, so SameSite=Strict is relaxed to Lax for this cookie.
+func (h *OIDCHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	cookies := h.config.Cookies
+	if cookies.SameSite == "strict" {
+		cookies.SameSite = "lax"
+	}
+	middleware.SetCookie(c, &cookies, oidcStateCookie, value, "/auth/oidc", maxAge, true)
+}
+
+// Callback completes the login at the redirect URL, sets the same token
+// cookie as the password login and redirects to the dashboard. Users with a
+// security key are sent back to the login page to sign in with it first.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if errCode := c.Query("error"); errCode != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = errCode
+		}
+		h.loginError(c, "Single sign-on failed: "+message)
+		return
+	}
+
+	parts := strings.Split(cookie, ".")
+	if len(parts) == 4 && parts[3] == oidcLinkMode {
+		// Keep the cookie for LinkComplete, which requires the user's session
+		h.setStateCookie(c, cookie, oidcStateMaxAge)
+		c.Redirect(http.StatusFound, "/auth/oidc/link/complete?"+c.Request.URL.RawQuery)
+		return
+	}
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(c.Query("state"))) != 1 {
+		h.loginError(c, "Single sign-on session expired, please try again")
+		return
+	}
+	state := &services.OIDCLoginState{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+
+	user, err := h.oidcService.Exchange(c.Query("code"), state)
+	if err != nil {
+		h.loginError(c, ssoErrorMessage(err))
+		return
+	}
+
+	// Users with a security key must also sign in with it, as with the password
+	// login. The login page reads the options from the URL fragment, which is
+	// not sent to the server.
+	if h.config.WebAuthn.Enabled && h.webAuthn.HasCredentials(user.ID) {
+		options, err := h.webAuthn.BeginLogin(user)
+		if err != nil {
+			h.loginError(c, ssoErrorMessage(err))
+			return
+		}
+		data, err := json.Marshal(dto.WebAuthnLoginOptions{PublicKey: *options})
+		if err != nil {
+			h.loginError(c, "Single sign-on failed")
+			return
+		}
+		c.Redirect(http.StatusFound, "/login#webauthn="+base64.RawURLEncoding.EncodeToString(data))
+		return
+	}
+
+	token, err := h.authService.IssueToken(user)
+	if err != nil {
+		h.loginError(c, ssoErrorMessage(err))
+		return
+	}
+
+	refreshToken, refresh, err := h.refreshService.Issue(user, token, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		h.loginError(c, "Single sign-on failed")
+		return
+	}
+
+	_ = h.auditLogger.LogLogin(c, user.ID, "Successful login via OIDC")
+
+	setSessionCookies(c, h.config, token, refreshToken, refresh.ExpiresAt)
+
+	// Like the login page, send admins who must register a security key and
+	// users who must change their password to the profile page
+	response := loginResponse(h.config, token, refreshToken, refresh.ExpiresAt, user)
+	if response.WebAuthnSetupRequired || response.PasswordChangeRequired {
+		c.Redirect(http.StatusFound, "/profile")
+		return
+	}
+	c.Redirect(http.StatusFound, "/dashboard")
+}
+
+// loginError redirects back to the login page showing message
+func (h *OIDCHandler) loginError(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, "/login?sso_error="+url.QueryEscape(message))
+}
+
+// linkError redirects back to the profile page showing message
+func (h *OIDCHandler) linkError(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, "/profile?sso_error="+url.QueryEscape(message))
+}
+
+// ssoErrorMessage returns the user-facing message of an application error
+func ssoErrorMessage(err error) string {
+	var appErr *apperror.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return "Single sign-on failed"
+}
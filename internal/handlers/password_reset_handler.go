@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	applogger "github.com/tldr-it-stepankutaj/openvpn-mng/internal/logger"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/mailer"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+)
+
+// forgotPasswordMessage is the answer to every reset request, whether the
+// account exists or not
+const forgotPasswordMessage = "If an account with this username or email exists, a password reset link has been sent to its email address"
+
+// PasswordResetHandler handles self-service password reset by email
+type PasswordResetHandler struct {
+	resetService *services.PasswordResetService
+	auditLogger  *middleware.AuditLogger
+}
+
+// NewPasswordResetHandler creates a new password reset handler. Reset links
+// point to publicURL.
+func NewPasswordResetHandler(authCfg *config.AuthConfig, publicURL string, m mailer.Mailer) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		resetService: services.NewPasswordResetService(authCfg, publicURL, m),
+		auditLogger:  middleware.NewAuditLogger(),
+	}
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Email a single-use password reset link to the local user with the given username or email. The response is the same whether the account exists or not.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body dto.ForgotPasswordRequest true "Username or email"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /api/v1/auth/password/forgot [post]
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	// Looking up the account, storing the token, sending the email and the
+	// audit log run after the response, which must not reveal whether the
+	// account exists, neither by content nor by timing
+	bg := c.Copy()
+	go func() {
+		user, err := h.resetService.Request(req.Login, bg.ClientIP())
+		if user != nil {
+			details := "Reset link sent"
+			if err != nil {
+				details = "Reset link could not be sent"
+			}
+			_ = h.auditLogger.LogPasswordReset(bg, user.ID, details)
+		}
+		if err != nil {
+			applogger.Error("Failed to send password reset link", "error", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: forgotPasswordMessage})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with the token from a password reset email. The token can be used once. The new password must satisfy the password policy; the account lockout is cleared and all sessions of the user are signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body dto.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /api/v1/auth/password/reset [post]
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	user, err := h.resetService.Reset(req.Token, req.NewPassword)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	_ = h.auditLogger.LogPasswordReset(c, user.ID, "Password reset with emailed link")
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Password has been reset"})
+}
+
+// ForgotPasswordPage renders the page requesting a reset link
+func (h *PasswordResetHandler) ForgotPasswordPage(c *gin.Context) {
+	c.HTML(http.StatusOK, "forgot_password.html", gin.H{
+		"title": "Forgot Password - OpenVPN Manager",
+	})
+}
+
+// ResetPasswordPage renders the page setting a new password from a reset link
+func (h *PasswordResetHandler) ResetPasswordPage(c *gin.Context) {
+	c.HTML(http.StatusOK, "reset_password.html", gin.H{
+		"title": "Reset Password - OpenVPN Manager",
+		"token": c.Query("token"),
+	})
+}
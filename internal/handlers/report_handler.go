@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+)
+
+// ReportHandler handles usage report requests
+type ReportHandler struct {
+	reportService *services.ReportService
+}
+
+// NewReportHandler creates a new report handler
+func NewReportHandler() *ReportHandler {
+	return &ReportHandler{
+		reportService: services.NewReportService(),
+	}
+}
+
+// GetTopTalkers godoc
+// @Summary      Top talkers report
+// @Description  Get the top users and groups by traffic, session count or connected time for a period, compared to the previous period of the same length (ADMIN only). Period bounds are aligned to whole hours.
+// @Tags         reports
+// @Produce      json
+// @Produce      text/csv
+// @Param        start    query    string  false  "Period start (RFC3339), default 7 days before end"
+// @Param        end      query    string  false  "Period end (RFC3339), default now"
+// @Param        limit    query    int     false  "Entries per list (1-100)"             default(10)
+// @Param        sort_by  query    string  false  "Ranking metric (bytes, sessions, duration)"  default(bytes)
+// @Param        format   query    string  false  "Response format (json, csv)"         default(json)
+// @Success      200      {object} dto.TopTalkersReport
+// @Failure      400      {object} dto.ErrorResponse
+// @Failure      401      {object} dto.ErrorResponse
+// @Failure      403      {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/reports/top-talkers [get]
+func (h *ReportHandler) GetTopTalkers(c *gin.Context) {
+	var filter dto.TopTalkersFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	report, err := h.reportService.GetTopTalkers(&filter)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	if filter.Format == "csv" {
+		filename := fmt.Sprintf("top-talkers-%s-%s.csv", report.Start.Format("20060102T1504"), report.End.Format("20060102T1504"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Status(http.StatusOK)
+		if err := writeTopTalkersCSV(c.Writer, report); err != nil {
+			_ = c.Error(err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// writeTopTalkersCSV writes users and groups of the report as CSV rows
+func writeTopTalkersCSV(w http.ResponseWriter, report *dto.TopTalkersReport) error {
+	writer := csv.NewWriter(w)
+	header := []string{
+		"type", "rank", "id", "name",
+		"total_bytes", "bytes_received", "bytes_sent", "sessions", "connected_seconds",
+		"previous_total_bytes", "previous_sessions", "previous_connected_seconds", "change_percent",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	write := func(entryType string, entries []dto.TopTalkerEntry) error {
+		for _, e := range entries {
+			change := ""
+			if e.ChangePercent != nil {
+				change = strconv.FormatFloat(*e.ChangePercent, 'f', 2, 64)
+			}
+			row := []string{
+				entryType,
+				strconv.Itoa(e.Rank),
+				e.ID.String(),
+				e.Name,
+				strconv.FormatInt(e.Current.TotalBytes, 10),
+				strconv.FormatInt(e.Current.BytesReceived, 10),
+				strconv.FormatInt(e.Current.BytesSent, 10),
+				strconv.FormatInt(e.Current.Sessions, 10),
+				strconv.FormatInt(e.Current.ConnectedSeconds, 10),
+				strconv.FormatInt(e.Previous.TotalBytes, 10),
+				strconv.FormatInt(e.Previous.Sessions, 10),
+				strconv.FormatInt(e.Previous.ConnectedSeconds, 10),
+				change,
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := write("user", report.Users); err != nil {
+		return err
+	}
+	if err := write("group", report.Groups); err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
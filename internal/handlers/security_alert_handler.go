@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+)
+
+// SecurityAlertHandler handles security alert related requests
+type SecurityAlertHandler struct {
+	anomalyService *services.AnomalyService
+}
+
+// NewSecurityAlertHandler creates a new security alert handler
+func NewSecurityAlertHandler(anomalyCfg *config.AnomalyConfig) *SecurityAlertHandler {
+	return &SecurityAlertHandler{
+		anomalyService: services.NewAnomalyService(anomalyCfg),
+	}
+}
+
+// List godoc
+// @Summary      List security alerts
+// @Description  Get a paginated list of anomalies detected in VPN logins and traffic (ADMIN only)
+// @Tags         security
+// @Accept       json
+// @Produce      json
+// @Param        user_id      query    string  false  "Filter by user ID"
+// @Param        type         query    string  false  "Filter by type (NEW_IP, UNUSUAL_HOUR, TRAFFIC_SPIKE, CREDENTIAL_STUFFING)"
+// @Param        severity     query    string  false  "Filter by severity (low, medium, high)"
+// @Param        source_ip    query    string  false  "Filter by source IP"
+// @Param        acknowledged query    bool    false  "Filter by acknowledgement"
+// @Param        start_date   query    string  false  "Filter by start date (RFC3339)"
+// @Param        end_date     query    string  false  "Filter by end date (RFC3339)"
+// @Param        page         query    int     false  "Page number"     default(1)
+// @Param        page_size    query    int     false  "Page size"       default(20)
+// @Success      200          {object} dto.SecurityAlertListResponse
+// @Failure      400          {object} dto.ErrorResponse
+// @Failure      401          {object} dto.ErrorResponse
+// @Failure      403          {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/security/alerts [get]
+func (h *SecurityAlertHandler) List(c *gin.Context) {
+	var filter dto.SecurityAlertFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	alerts, total, err := h.anomalyService.List(&filter)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	pageSize := filter.PageSize
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	c.JSON(http.StatusOK, dto.SecurityAlertListResponse{
+		Alerts:     dto.ToSecurityAlertResponseList(alerts),
+		Total:      total,
+		Page:       filter.Page,
+		PageSize:   pageSize,
+		TotalPages: services.CalculateTotalPages(total, pageSize),
+	})
+}
+
+// Get godoc
+// @Summary      Get security alert
+// @Description  Get a security alert by ID (ADMIN only)
+// @Tags         security
+// @Accept       json
+// @Produce      json
+// @Param        id   path     string  true  "Security alert ID"
+// @Success      200  {object} dto.SecurityAlertResponse
+// @Failure      400  {object} dto.ErrorResponse
+// @Failure      401  {object} dto.ErrorResponse
+// @Failure      403  {object} dto.ErrorResponse
+// @Failure      404  {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/security/alerts/{id} [get]
+func (h *SecurityAlertHandler) Get(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid security alert ID"))
+		return
+	}
+
+	alert, err := h.anomalyService.GetByID(id)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ToSecurityAlertResponse(alert))
+}
+
+// Acknowledge godoc
+// @Summary      Acknowledge security alert
+// @Description  Mark a security alert as reviewed (ADMIN only). Acknowledging approves the finding: a new client IP is not reported again and logins are no longer blocked because of the alert.
+// @Tags         security
+// @Accept       json
+// @Produce      json
+// @Param        id   path     string  true  "Security alert ID"
+// @Success      200  {object} dto.SecurityAlertResponse
+// @Failure      400  {object} dto.ErrorResponse
+// @Failure      401  {object} dto.ErrorResponse
+// @Failure      403  {object} dto.ErrorResponse
+// @Failure      404  {object} dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/security/alerts/{id}/acknowledge [put]
+func (h *SecurityAlertHandler) Acknowledge(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid security alert ID"))
+		return
+	}
+
+	alert, err := h.anomalyService.Acknowledge(id, middleware.GetAuthUserID(c))
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ToSecurityAlertResponse(alert))
+}
@@ -19,22 +19,29 @@ type UserHandler struct {
 	userService  *services.UserService
 	groupService *services.GroupService
 	vpnIPService *services.VPNIPService
+	quotaService *services.QuotaService
 	auditLogger  *middleware.AuditLogger
 }
 
-// NewUserHandler creates a new user handler
-func NewUserHandler(vpnCfg *config.VPNConfig) *UserHandler {
+// NewUserHandler creates a new user handler. An optional password policy
+// config is enforced when passwords are set.
+func NewUserHandler(vpnCfg *config.VPNConfig, policyCfg ...*config.PasswordPolicyConfig) *UserHandler {
+	userService := services.NewUserService()
+	if len(policyCfg) > 0 && policyCfg[0] != nil {
+		userService = services.NewUserServiceWithPolicy(policyCfg[0])
+	}
 	return &UserHandler{
-		userService:  services.NewUserService(),
+		userService:  userService,
 		groupService: services.NewGroupService(),
 		vpnIPService: services.NewVPNIPService(vpnCfg),
+		quotaService: services.NewQuotaService(),
 		auditLogger:  middleware.NewAuditLogger(),
 	}
 }
 
 // Create godoc
 // @Summary Create user
-// @Description Create a new user (Admin or Manager). Managers can only create users assigned to themselves.
+// @Description Create a new user (Admin or Manager). Managers can only create users assigned to themselves. The password must satisfy the password policy.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -72,6 +79,28 @@ func (h *UserHandler) Create(c *gin.Context) {
 			})
 			return
 		}
+		// Traffic quotas are set by admins only
+		if req.MonthlyTrafficQuota != 0 {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "Forbidden",
+				Message: "Cannot set traffic quota",
+				Code:    http.StatusForbidden,
+			})
+			return
+		}
+	}
+
+	// Only admins signed in themselves may let a new user keep the password
+	// they were given; managers and API keys always create users who must
+	// change it
+	if req.MustChangePassword != nil && !*req.MustChangePassword &&
+		(authUser.Role != models.RoleAdmin || middleware.GetAPIKey(c) != nil) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{
+			Error:   "Forbidden",
+			Message: "Cannot skip the password change on first login",
+			Code:    http.StatusForbidden,
+		})
+		return
 	}
 
 	// Handle VPN IP: validate if provided, auto-assign if empty
@@ -175,6 +204,79 @@ func (h *UserHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.ToUserResponse(user))
 }
 
+// GetQuota godoc
+// @Summary Get user traffic quota
+// @Description Get the current month traffic usage of a user against their own and their groups' quotas
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.QuotaStatusResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/users/{id}/quota [get]
+func (h *UserHandler) GetQuota(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "Invalid user ID",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	// Check access
+	authUser := middleware.GetAuthUser(c)
+	authUserID := middleware.GetAuthUserID(c)
+
+	user, err := h.userService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Error:   "Not Found",
+			Message: "User not found",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	// Check permissions
+	if authUser.Role == models.RoleUser && authUserID != user.ID {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{
+			Error:   "Forbidden",
+			Message: "Access denied",
+			Code:    http.StatusForbidden,
+		})
+		return
+	}
+
+	if authUser.Role == models.RoleManager {
+		if authUserID != user.ID && (user.ManagerID == nil || *user.ManagerID != authUserID) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "Forbidden",
+				Message: "Access denied",
+				Code:    http.StatusForbidden,
+			})
+			return
+		}
+	}
+
+	status, err := h.quotaService.GetStatus(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to get traffic quota",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
 // Update godoc
 // @Summary Update user
 // @Description Update a user. Admin can update anyone. Manager can update their subordinates. User cannot use this endpoint.
@@ -265,6 +367,15 @@ func (h *UserHandler) Update(c *gin.Context) {
 			})
 			return
 		}
+		// Traffic quotas are changed by admins only
+		if req.MonthlyTrafficQuota != nil && *req.MonthlyTrafficQuota != oldUser.MonthlyTrafficQuota {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "Forbidden",
+				Message: "Cannot change traffic quota",
+				Code:    http.StatusForbidden,
+			})
+			return
+		}
 	}
 
 	// Validate VPN IP if provided
@@ -339,7 +450,7 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 
 // UpdatePassword godoc
 // @Summary Update password
-// @Description Update own password
+// @Description Update own password. The new password must satisfy the password policy and must not be one of the recently used passwords. All sessions of the user, including the current one, are signed out.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -372,11 +483,7 @@ func (h *UserHandler) UpdatePassword(c *gin.Context) {
 			})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "Internal Server Error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		})
+		apperror.HandleError(c, err)
 		return
 	}
 
@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
 )
 
@@ -16,15 +22,29 @@ type VpnAuthHandler struct {
 	groupService   *services.GroupService
 	networkService *services.NetworkService
 	sessionService *services.VpnSessionService
+	quotaService   *services.QuotaService
+	statsService   *services.VpnTrafficStatsService
+	vpnAuthService *services.VpnAuthService
+	rateLimiter    *middleware.RateLimiter
 }
 
-// NewVpnAuthHandler creates a new VPN auth handler
-func NewVpnAuthHandler() *VpnAuthHandler {
+// NewVpnAuthHandler creates a new VPN auth handler. With a security config,
+// failed logins count towards the account lockout; with a rate limiter,
+// logins are limited per end user source IP rather than per VPN server.
+func NewVpnAuthHandler(authCfg *config.AuthConfig, anomalyCfg *config.AnomalyConfig, securityCfg *config.SecurityConfig, rateLimiter *middleware.RateLimiter) *VpnAuthHandler {
+	vpnAuthService := services.NewVpnAuthService(authCfg, anomalyCfg)
+	if securityCfg != nil {
+		vpnAuthService = services.NewVpnAuthServiceWithSecurity(authCfg, anomalyCfg, securityCfg)
+	}
 	return &VpnAuthHandler{
 		userService:    services.NewUserService(),
 		groupService:   services.NewGroupService(),
 		networkService: services.NewNetworkService(),
 		sessionService: services.NewVpnSessionService(),
+		quotaService:   services.NewQuotaService(),
+		statsService:   services.NewVpnTrafficStatsService(),
+		vpnAuthService: vpnAuthService,
+		rateLimiter:    rateLimiter,
 	}
 }
 
@@ -32,6 +52,9 @@ func NewVpnAuthHandler() *VpnAuthHandler {
 type VpnAuthRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// UntrustedIP is the client's real IP as reported by OpenVPN (untrusted_ip),
+	// used for rate limiting and anomaly detection
+	UntrustedIP string `json:"untrusted_ip,omitempty"`
 }
 
 // VpnAuthResponse represents a VPN authentication response
@@ -41,6 +64,8 @@ type VpnAuthResponse struct {
 	Username string     `json:"username,omitempty"`
 	VpnIP    string     `json:"vpn_ip,omitempty"`
 	Message  string     `json:"message,omitempty"`
+	// Locked is set when the account is locked after too many failed logins
+	Locked bool `json:"locked,omitempty"`
 }
 
 // VpnUserResponse represents a user response for VPN
@@ -74,7 +99,7 @@ type VpnUserRoutesResponse struct {
 
 // Authenticate godoc
 // @Summary      Authenticate VPN user
-// @Description  Authenticate a user for VPN connection (called by OpenVPN auth-user-pass-verify script)
+// @Description  Authenticate a user for VPN connection (called by OpenVPN auth-user-pass-verify script). When anomaly detection is enabled, suspicious logins are recorded as security alerts and may be denied. With LDAP enabled, directory users are verified against the directory. Logins are rate limited per untrusted_ip (the end user's address, falling back to the caller's), and failed logins lock the username like web logins; a locked account gets 423 with locked set and Retry-After.
 // @Tags         vpn-auth
 // @Accept       json
 // @Produce      json
@@ -82,6 +107,10 @@ type VpnUserRoutesResponse struct {
 // @Success      200          {object}  VpnAuthResponse
 // @Failure      400          {object}  dto.ErrorResponse
 // @Failure      401          {object}  VpnAuthResponse
+// @Failure      403          {object}  VpnAuthResponse
+// @Failure      423          {object}  VpnAuthResponse
+// @Failure      429          {object}  dto.ErrorResponse
+// @Failure      503          {object}  dto.ErrorResponse
 // @Security     VpnToken
 // @Router       /api/v1/vpn-auth/authenticate [post]
 func (h *VpnAuthHandler) Authenticate(c *gin.Context) {
@@ -95,47 +124,86 @@ func (h *VpnAuthHandler) Authenticate(c *gin.Context) {
 		return
 	}
 
-	// Authenticate user
-	user, err := services.AuthenticateUser(req.Username, req.Password)
+	if h.rateLimiter != nil {
+		if allowed, retryAfter := h.rateLimiter.Allow(middleware.RateLimitVpnAuth, vpnSourceIP(c, req.UntrustedIP)); !allowed {
+			h.rateLimiter.Reject(c, retryAfter)
+			return
+		}
+	}
+
+	user, err := h.vpnAuthService.Authenticate(req.Username, req.Password, req.UntrustedIP)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, VpnAuthResponse{
-			Success: false,
-			Message: "Invalid credentials",
-		})
+		h.authError(c, err)
 		return
 	}
 
-	// Check if user is active
-	if !user.IsActive {
-		c.JSON(http.StatusUnauthorized, VpnAuthResponse{
-			Success: false,
-			Message: "User account is disabled",
-		})
-		return
+	c.JSON(http.StatusOK, VpnAuthResponse{
+		Success:  true,
+		UserID:   &user.ID,
+		Username: user.Username,
+		VpnIP:    user.VpnIP,
+	})
+}
+
+// GetAuthCacheStats godoc
+// @Summary      Get VPN authentication cache statistics
+// @Description  Get the size and hit/miss counters of the cache of successful VPN logins (ADMIN only)
+// @Tags         vpn
+// @Produce      json
+// @Success      200 {object}  services.VpnAuthCacheStats
+// @Failure      401 {object}  dto.ErrorResponse
+// @Failure      403 {object}  dto.ErrorResponse
+// @Security     BearerAuth
+// @Router       /api/v1/vpn/auth-cache [get]
+func (h *VpnAuthHandler) GetAuthCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, services.GetVpnAuthCache().Stats())
+}
+
+// vpnSourceIP returns the end user's IP reported by the VPN server, or the
+// caller's IP when it is missing or malformed
+func vpnSourceIP(c *gin.Context, untrustedIP string) string {
+	if ip := net.ParseIP(untrustedIP); ip != nil {
+		return ip.String()
 	}
+	return c.ClientIP()
+}
 
-	// Check validity period
-	now := time.Now()
-	if user.ValidFrom != nil && now.Before(*user.ValidFrom) {
-		c.JSON(http.StatusUnauthorized, VpnAuthResponse{
+// authError responds to a denied VPN login
+func (h *VpnAuthHandler) authError(c *gin.Context, err error) {
+	var status int
+	var message string
+	var locked *services.AccountLockedError
+	switch {
+	case errors.As(err, &locked):
+		if retryAfter := int(time.Until(locked.Until).Seconds()) + 1; retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+		}
+		c.JSON(http.StatusLocked, VpnAuthResponse{
 			Success: false,
-			Message: "User account is not yet valid",
+			Message: "Account temporarily locked",
+			Locked:  true,
 		})
 		return
-	}
-	if user.ValidTo != nil && now.After(*user.ValidTo) {
-		c.JSON(http.StatusUnauthorized, VpnAuthResponse{
-			Success: false,
-			Message: "User account has expired",
-		})
+	case errors.Is(err, services.ErrInvalidCredentials):
+		status, message = http.StatusUnauthorized, "Invalid credentials"
+	case errors.Is(err, services.ErrUserInactive):
+		status, message = http.StatusUnauthorized, "User account is disabled"
+	case errors.Is(err, services.ErrUserNotYetValid):
+		status, message = http.StatusUnauthorized, "User account is not yet valid"
+	case errors.Is(err, services.ErrUserExpired):
+		status, message = http.StatusUnauthorized, "User account has expired"
+	case errors.Is(err, services.ErrQuotaExceeded):
+		status, message = http.StatusForbidden, "Monthly traffic quota exceeded"
+	case errors.Is(err, services.ErrVpnLoginBlocked):
+		status, message = http.StatusForbidden, "Login blocked by anomaly detection"
+	default:
+		apperror.HandleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, VpnAuthResponse{
-		Success:  true,
-		UserID:   &user.ID,
-		Username: user.Username,
-		VpnIP:    user.VpnIP,
+	c.JSON(status, VpnAuthResponse{
+		Success: false,
+		Message: message,
 	})
 }
 
@@ -390,6 +458,60 @@ func (h *VpnAuthHandler) DisconnectSession(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.ToVpnSessionResponse(session))
 }
 
+// CreateTrafficStatsBatch godoc
+// @Summary      Create traffic stats in batch
+// @Description  Store traffic of many sessions in a single transaction (called by VPN server). Each entry carries either deltas or cumulative counters from the status file, which are converted to deltas against the session's running total. Running totals of the sessions are updated; entries of unknown or disconnected sessions are skipped. Users who ran out of monthly quota are listed in quota_exceeded with the sessions to disconnect.
+// @Tags         vpn-auth
+// @Accept       json
+// @Produce      json
+// @Param        batch  body      dto.CreateVpnTrafficStatsBatchRequest  true  "Traffic of sessions"
+// @Success      201    {object}  dto.VpnTrafficStatsBatchResponse
+// @Failure      400    {object}  dto.ErrorResponse
+// @Security     VpnToken
+// @Router       /api/v1/vpn-auth/traffic-stats/batch [post]
+func (h *VpnAuthHandler) CreateTrafficStatsBatch(c *gin.Context) {
+	var req dto.CreateVpnTrafficStatsBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	response, err := h.statsService.CreateBatch(&req)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetSessionsOverQuota godoc
+// @Summary      List sessions over quota
+// @Description  List active sessions whose users exhausted their monthly traffic quota. The VPN server polls this endpoint, kills the listed clients via its management interface and reports the disconnect with reason QUOTA_EXCEEDED.
+// @Tags         vpn-auth
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  map[string][]dto.OverQuotaSessionResponse
+// @Security     VpnToken
+// @Router       /api/v1/vpn-auth/sessions/over-quota [get]
+func (h *VpnAuthHandler) GetSessionsOverQuota(c *gin.Context) {
+	sessions, err := h.quotaService.GetSessionsOverQuota()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: "Failed to check traffic quotas",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
 // ListAllUsers godoc
 // @Summary      List all active VPN users
 // @Description  Get a list of all active users for VPN (used for firewall rules generation)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
 )
@@ -13,6 +14,7 @@ import (
 type VpnSessionHandler struct {
 	sessionService *services.VpnSessionService
 	statsService   *services.VpnTrafficStatsService
+	quotaService   *services.QuotaService
 }
 
 // NewVpnSessionHandler creates a new VPN session handler
@@ -20,6 +22,7 @@ func NewVpnSessionHandler() *VpnSessionHandler {
 	return &VpnSessionHandler{
 		sessionService: services.NewVpnSessionService(),
 		statsService:   services.NewVpnTrafficStatsService(),
+		quotaService:   services.NewQuotaService(),
 	}
 }
 
@@ -255,7 +258,7 @@ func (h *VpnSessionHandler) GetUserStats(c *gin.Context) {
 
 // CreateTrafficStats godoc
 // @Summary      Create traffic stats
-// @Description  Create a new traffic stats entry (called by VPN server)
+// @Description  Create a new traffic stats entry (called by VPN server). The response has quota_exceeded set when the session's user ran out of monthly quota and should be disconnected.
 // @Tags         vpn-sessions
 // @Accept       json
 // @Produce      json
@@ -278,7 +281,12 @@ func (h *VpnSessionHandler) CreateTrafficStats(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, dto.ToVpnTrafficStatsResponse(stats))
+	response := dto.ToVpnTrafficStatsResponse(stats)
+	if session, err := h.sessionService.GetByID(stats.SessionID); err == nil && session.IsActive() {
+		response.QuotaExceeded = h.quotaService.Check(session.UserID) == services.ErrQuotaExceeded
+	}
+
+	c.JSON(http.StatusCreated, response)
 }
 
 // ListTrafficStats godoc
@@ -324,3 +332,41 @@ func (h *VpnSessionHandler) ListTrafficStats(c *gin.Context) {
 		TotalPages: services.CalculateTotalPages(total, pageSize),
 	})
 }
+
+// GetTrafficSeries godoc
+// @Summary      Get traffic time series
+// @Description  Get received/sent traffic aggregated into 5m, 1h or 1d buckets, optionally for a single user, group or network (ADMIN only). 1d buckets are local days. 5m buckets are limited to the raw traffic stats retention.
+// @Tags         vpn-sessions
+// @Accept       json
+// @Produce      json
+// @Param        user_id   query    string  false  "Filter by user ID"
+// @Param        group_id  query    string  false  "Filter by group ID"
+// @Param        network_id query   string  false  "Filter by network ID (members of the groups with access)"
+// @Param        start     query    string  false  "Series start (RFC3339), default 24 hours before end"
+// @Param        end       query    string  false  "Series end (RFC3339), default now"
+// @Param        bucket    query    string  false  "Bucket size (5m, 1h, 1d)"  default(1h)
+// @Success      200       {object} dto.TrafficSeriesResponse
+// @Failure      400       {object} dto.ErrorResponse
+// @Failure      401       {object} map[string]string
+// @Failure      403       {object} map[string]string
+// @Security     BearerAuth
+// @Router       /api/v1/vpn/traffic-series [get]
+func (h *VpnSessionHandler) GetTrafficSeries(c *gin.Context) {
+	var filter dto.TrafficSeriesFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	series, err := h.statsService.GetSeries(&filter)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
@@ -16,11 +17,17 @@ type WebHandler struct {
 	networkService         *services.NetworkService
 	dashboardService       *services.DashboardService
 	vpnClientConfigService *services.VpnClientConfigService
+	oidcConfig             *config.OIDCConfig
+	passwordResetEnabled   bool
+	webAuthnEnabled        bool
 }
 
 // NewWebHandler creates a new web handler
-func NewWebHandler() *WebHandler {
+func NewWebHandler(authCfg *config.AuthConfig, mailCfg *config.MailConfig) *WebHandler {
 	return &WebHandler{
+		oidcConfig:             &authCfg.OIDC,
+		passwordResetEnabled:   mailCfg.Enabled,
+		webAuthnEnabled:        authCfg.WebAuthn.Enabled,
 		userService:            services.NewUserService(),
 		groupService:           services.NewGroupService(),
 		networkService:         services.NewNetworkService(),
@@ -37,7 +44,11 @@ func (h *WebHandler) IndexPage(c *gin.Context) {
 // LoginPage renders the login page
 func (h *WebHandler) LoginPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "login.html", gin.H{
-		"title": "Login - OpenVPN Manager",
+		"title":            "Login - OpenVPN Manager",
+		"oidc_enabled":     h.oidcConfig.Enabled,
+		"oidc_label":       h.oidcConfig.ButtonLabel,
+		"reset_enabled":    h.passwordResetEnabled,
+		"webauthn_enabled": h.webAuthnEnabled,
 	})
 }
 
@@ -108,9 +119,11 @@ func (h *WebHandler) UsersPage(c *gin.Context) {
 
 // UserDetailPage renders the user detail page
 func (h *WebHandler) UserDetailPage(c *gin.Context) {
-	// Implementation for user detail page
+	authUser := middleware.GetAuthUser(c)
+
 	c.HTML(http.StatusOK, "user_detail.html", gin.H{
 		"title": "User Detail - OpenVPN Manager",
+		"role":  authUser.Role,
 	})
 }
 
@@ -149,9 +162,14 @@ func (h *WebHandler) ProfilePage(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "profile.html", gin.H{
-		"title": "Profile - OpenVPN Manager",
-		"user":  user,
-		"role":  authUser.Role,
+		"title":                    "Profile - OpenVPN Manager",
+		"user":                     user,
+		"role":                     authUser.Role,
+		"password_change_required": authUser.PasswordChangeRequired,
+		"webauthn_enabled":         h.webAuthnEnabled,
+		"webauthn_setup_required":  authUser.WebAuthnSetupRequired,
+		"oidc_enabled":             h.oidcConfig.Enabled,
+		"oidc_label":               h.oidcConfig.ButtonLabel,
 	})
 }
 
@@ -203,6 +221,25 @@ func (h *WebHandler) AuditPage(c *gin.Context) {
 	})
 }
 
+// SecurityAlertsPage renders the security alerts page (ADMIN only)
+func (h *WebHandler) SecurityAlertsPage(c *gin.Context) {
+	authUser := middleware.GetAuthUser(c)
+
+	// Only ADMIN can access security alerts
+	if authUser.Role != models.RoleAdmin {
+		c.HTML(http.StatusForbidden, "error.html", gin.H{
+			"title":   "Access Denied - OpenVPN Manager",
+			"message": "You don't have permission to access this page",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "security_alerts.html", gin.H{
+		"title": "Security Alerts - OpenVPN Manager",
+		"role":  authUser.Role,
+	})
+}
+
 // SessionsPage renders the VPN sessions history page (ADMIN only)
 func (h *WebHandler) SessionsPage(c *gin.Context) {
 	authUser := middleware.GetAuthUser(c)
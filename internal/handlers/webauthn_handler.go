@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/webauthn"
+)
+
+// WebAuthnHandler handles security key registration and login
+type WebAuthnHandler struct {
+	webAuthnService *services.WebAuthnService
+	authService     *services.AuthService
+	refreshService  *services.RefreshTokenService
+	auditLogger     *middleware.AuditLogger
+	config          *config.AuthConfig
+}
+
+// NewWebAuthnHandler creates a new WebAuthn handler
+func NewWebAuthnHandler(cfg *config.AuthConfig) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webAuthnService: services.NewWebAuthnService(&cfg.WebAuthn),
+		authService:     services.NewAuthService(cfg),
+		refreshService:  services.NewRefreshTokenService(cfg),
+		auditLogger:     middleware.NewAuditLogger(),
+		config:          cfg,
+	}
+}
+
+// BeginLogin godoc
+// @Summary Start security key login
+// @Description Start a passwordless login with a passkey (discoverable credential). Pass the returned options to navigator.credentials.get() and send the result to /api/v1/auth/webauthn/login/finish. Users with a security key who log in with their password get the options of the second factor in the login response instead.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} dto.WebAuthnLoginOptions
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /api/v1/auth/webauthn/login/begin [post]
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	options, err := h.webAuthnService.BeginLogin(nil)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.WebAuthnLoginOptions{PublicKey: *options})
+}
+
+// FinishLogin godoc
+// @Summary Finish security key login
+// @Description Verify the credential returned by navigator.credentials.get(), as passwordless login or as second factor after the password, and return the same tokens as the password login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body webauthn.CredentialResponse true "PublicKeyCredential with base64url encoded binary fields"
+// @Success 200 {object} dto.LoginResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /api/v1/auth/webauthn/login/finish [post]
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var req webauthn.CredentialResponse
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	user, err := h.webAuthnService.FinishLogin(&req)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	token, err := h.authService.IssueToken(user)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	refreshToken, refresh, err := h.refreshService.Issue(user, token, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	_ = h.auditLogger.LogLogin(c, user.ID, "Successful login with security key")
+
+	setSessionCookies(c, h.config, token, refreshToken, refresh.ExpiresAt)
+
+	c.JSON(http.StatusOK, loginResponse(h.config, token, refreshToken, refresh.ExpiresAt, user))
+}
+
+// BeginRegistration godoc
+// @Summary Start security key registration
+// @Description Start registering a security key or passkey for the current user. Pass the returned options to navigator.credentials.create() and send the result to /api/v1/auth/webauthn/register/finish.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.WebAuthnRegisterOptions
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /api/v1/auth/webauthn/register/begin [post]
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	user, err := services.GetUserByID(middleware.GetAuthUserID(c))
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	options, err := h.webAuthnService.BeginRegistration(user)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.WebAuthnRegisterOptions{PublicKey: *options})
+}
+
+// FinishRegistration godoc
+// @Summary Finish security key registration
+// @Description Verify the credential returned by navigator.credentials.create() and store it under the given name
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body dto.WebAuthnRegisterRequest true "Key name and PublicKeyCredential"
+// @Security BearerAuth
+// @Success 201 {object} dto.WebAuthnCredentialResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /api/v1/auth/webauthn/register/finish [post]
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	var req dto.WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	user, err := services.GetUserByID(middleware.GetAuthUserID(c))
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	credential, err := h.webAuthnService.FinishRegistration(user, req.Name, &req.Credential)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	response := dto.ToWebAuthnCredentialResponse(credential)
+	h.auditLogger.LogCreate(c, "webauthn_credential", credential.ID, response)
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListCredentials godoc
+// @Summary List security keys
+// @Description Get the security keys and passkeys of the current user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.WebAuthnCredentialListResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /api/v1/auth/webauthn/credentials [get]
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	credentials, err := h.webAuthnService.ListCredentials(middleware.GetAuthUserID(c))
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.WebAuthnCredentialListResponse{
+		Credentials: dto.ToWebAuthnCredentialResponseList(credentials),
+		Total:       int64(len(credentials)),
+	})
+}
+
+// RenameCredential godoc
+// @Summary Rename security key
+// @Description Rename a security key of the current user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path string true "Security key ID"
+// @Param request body dto.WebAuthnRenameRequest true "New name"
+// @Security BearerAuth
+// @Success 200 {object} dto.WebAuthnCredentialResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/auth/webauthn/credentials/{id} [put]
+func (h *WebAuthnHandler) RenameCredential(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid security key ID"))
+		return
+	}
+
+	var req dto.WebAuthnRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	credential, err := h.webAuthnService.RenameCredential(middleware.GetAuthUserID(c), id, req.Name)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ToWebAuthnCredentialResponse(credential))
+}
+
+// DeleteCredential godoc
+// @Summary Remove security key
+// @Description Remove a security key of the current user. Admins cannot remove their last key while webauthn.require_for_admins is set.
+// @Tags auth
+// @Produce json
+// @Param id path string true "Security key ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/auth/webauthn/credentials/{id} [delete]
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid security key ID"))
+		return
+	}
+
+	user, err := services.GetUserByID(middleware.GetAuthUserID(c))
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	credential, err := h.webAuthnService.DeleteCredential(user, id)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	h.auditLogger.LogDelete(c, "webauthn_credential", credential.ID, dto.ToWebAuthnCredentialResponse(credential))
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Message: "Security key removed"})
+}
+
+// ResetUserCredentials godoc
+// @Summary Remove all security keys of a user
+// @Description Remove all security keys of a user who lost them, so they can sign in with their password and register a new key (ADMIN only)
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/v1/users/{id}/webauthn-credentials [delete]
+func (h *WebAuthnHandler) ResetUserCredentials(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.HandleError(c, apperror.Validation("Invalid user ID"))
+		return
+	}
+
+	if _, err := services.GetUserByID(id); err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	removed, err := h.webAuthnService.DeleteAllCredentials(id)
+	if err != nil {
+		apperror.HandleError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, models.AuditActionDelete, "user", &id, nil, nil, "Removed all security keys")
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: "Security keys removed",
+		Data:    gin.H{"removed": removed},
+	})
+}
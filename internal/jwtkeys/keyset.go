@@ -0,0 +1,382 @@
+// Package jwtkeys signs and verifies access tokens. Tokens are signed with
+// the HMAC jwt_secret (HS256) or with RS256/EdDSA keys stored in the
+// database, which can be rotated without invalidating issued tokens.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const (
+	// reloadInterval is how often keys are reloaded, so rotations done by
+	// another instance or the rotate command are picked up
+	reloadInterval = time.Minute
+	// unknownKeyReloadInterval limits reloads caused by tokens with an unknown kid
+	unknownKeyReloadInterval = 5 * time.Second
+	// retiredKeyGrace is how long past the access token lifetime a retired key is kept
+	retiredKeyGrace = 5 * time.Minute
+	// rsaKeyBits is the size of generated RSA keys
+	rsaKeyBits = 2048
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported JWT algorithm")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrNotRotatable         = errors.New("the HS256 jwt_secret cannot be rotated; set jwt_algorithm to RS256 or EdDSA")
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[*config.AuthConfig]*KeySet)
+)
+
+// KeySet holds the signing key and the verification keys of an auth configuration
+type KeySet struct {
+	config *config.AuthConfig
+
+	mu         sync.RWMutex
+	signing    *signingKey
+	keys       map[string]*signingKey // kid → key, including retired keys
+	loadedAt   time.Time
+	reloadedAt time.Time // last reload caused by an unknown kid
+}
+
+type signingKey struct {
+	id        string
+	algorithm string
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// For returns the key set of an auth configuration
+func For(cfg *config.AuthConfig) *KeySet {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	s, ok := registry[cfg]
+	if !ok {
+		s = &KeySet{config: cfg, keys: make(map[string]*signingKey)}
+		registry[cfg] = s
+	}
+	return s
+}
+
+// Algorithm returns the configured signing algorithm, HS256 if not set
+func (s *KeySet) Algorithm() string {
+	if s.config.JWTAlgorithm == "" {
+		return AlgorithmHS256
+	}
+	return s.config.JWTAlgorithm
+}
+
+// Load validates the configuration and loads the keys from the database,
+// creating the first signing key if there is none
+func (s *KeySet) Load() error {
+	switch s.Algorithm() {
+	case AlgorithmHS256:
+		return nil
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, s.Algorithm())
+	}
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	hasSigningKey := s.signing != nil
+	s.mu.RUnlock()
+	if hasSigningKey {
+		return nil
+	}
+	_, err := s.Rotate()
+	return err
+}
+
+// Sign signs claims with the current signing key
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.Algorithm() == AlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.config.JWTSecret))
+	}
+
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.algorithm), claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// Parse verifies a token and parses its claims. Only the configured
+// algorithm is accepted.
+func (s *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, s.keyFunc, jwt.WithValidMethods([]string{s.Algorithm()}))
+}
+
+// Rotate creates a new signing key and retires the previous ones. Retired
+// keys keep verifying tokens they signed until those expire, so nobody is
+// logged out.
+func (s *KeySet) Rotate() (*models.JWTSigningKey, error) {
+	algorithm := s.Algorithm()
+	if algorithm == AlgorithmHS256 {
+		return nil, ErrNotRotatable
+	}
+
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	db := database.GetDB()
+	if err := db.Model(&models.JWTSigningKey{}).Where("retired_at IS NULL").Update("retired_at", now).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Create(key).Error; err != nil {
+		return nil, err
+	}
+	db.Where("retired_at < ?", now.Add(-s.retiredKeyLifetime())).Delete(&models.JWTSigningKey{})
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// JWKS returns the public keys that verify tokens as a JSON Web Key Set.
+// It is empty for HS256, whose secret must not be published.
+func (s *KeySet) JWKS() (*dto.JWKSResponse, error) {
+	response := &dto.JWKSResponse{Keys: []dto.JWK{}}
+	if s.Algorithm() == AlgorithmHS256 {
+		return response, nil
+	}
+	if err := s.reloadIfStale(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		jwk := dto.JWK{Use: "sig", Alg: key.algorithm, Kid: key.id}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		response.Keys = append(response.Keys, jwk)
+	}
+	return response, nil
+}
+
+// keyFunc returns the verification key for a token by its kid header
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if s.Algorithm() == AlgorithmHS256 {
+		return []byte(s.config.JWTSecret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+	if err := s.reloadIfStale(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	reloadedAt := s.reloadedAt
+	s.mu.RUnlock()
+
+	// The key may have been created by another instance since the last load
+	if !ok && time.Since(reloadedAt) >= unknownKeyReloadInterval {
+		s.mu.Lock()
+		s.reloadedAt = time.Now()
+		s.mu.Unlock()
+		if err := s.reload(); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		key, ok = s.keys[kid]
+		s.mu.RUnlock()
+	}
+	if !ok || key.algorithm != token.Method.Alg() {
+		return nil, ErrUnknownKey
+	}
+	return key.public, nil
+}
+
+// signingKey returns the current signing key, loading keys if needed
+func (s *KeySet) signingKey() (*signingKey, error) {
+	if err := s.reloadIfStale(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	key := s.signing
+	s.mu.RUnlock()
+	if key == nil {
+		if err := s.Load(); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		key = s.signing
+		s.mu.RUnlock()
+	}
+	if key == nil || key.algorithm != s.Algorithm() {
+		return nil, fmt.Errorf("no %s signing key, rotate keys to create one", s.Algorithm())
+	}
+	return key, nil
+}
+
+// reloadIfStale reloads keys when they were loaded longer than reloadInterval ago
+func (s *KeySet) reloadIfStale() error {
+	s.mu.RLock()
+	stale := time.Since(s.loadedAt) >= reloadInterval
+	s.mu.RUnlock()
+	if !stale {
+		return nil
+	}
+	return s.reload()
+}
+
+// reload loads the signing key and the retired keys still verifying tokens
+func (s *KeySet) reload() error {
+	var rows []models.JWTSigningKey
+	if err := database.GetDB().
+		Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-s.retiredKeyLifetime())).
+		Order("created_at DESC").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(rows))
+	var signing *signingKey
+	for i := range rows {
+		key, err := parseKey(&rows[i])
+		if err != nil {
+			return fmt.Errorf("JWT signing key %s: %w", rows[i].ID, err)
+		}
+		keys[key.id] = key
+		// The newest key that is not retired signs
+		if signing == nil && rows[i].RetiredAt == nil && key.algorithm == s.Algorithm() {
+			signing = key
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.signing = signing
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// retiredKeyLifetime is how long a retired key verifies tokens: the lifetime
+// of the last access tokens it signed plus a grace period for clock skew
+func (s *KeySet) retiredKeyLifetime() time.Duration {
+	return s.config.AccessTokenDuration() + retiredKeyGrace
+}
+
+// generateKey generates a new key pair for the algorithm
+func generateKey(algorithm string) (*models.JWTSigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &models.JWTSigningKey{
+		ID:         base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// parseKey parses a stored key pair
+func parseKey(row *models.JWTSigningKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(row.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid private key PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		if row.Algorithm != AlgorithmRS256 {
+			return nil, errors.New("RSA key stored for " + row.Algorithm)
+		}
+	case ed25519.PrivateKey:
+		if row.Algorithm != AlgorithmEdDSA {
+			return nil, errors.New("Ed25519 key stored for " + row.Algorithm)
+		}
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+
+	return &signingKey{
+		id:        row.ID,
+		algorithm: row.Algorithm,
+		private:   private,
+		public:    private.Public(),
+	}, nil
+}
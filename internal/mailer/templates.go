@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates are stored as <name>.txt and <name>.html. The text template
+// defines "subject" and "body"; the HTML template is optional.
+//
+//go:embed templates/*
+var templateFS embed.FS
+
+// Render builds a message for a recipient from a named template
+func Render(name, to string, data interface{}) (*Message, error) {
+	// Every template defines "subject" and "body", so each is parsed on its own
+	tmpl, err := texttemplate.ParseFS(templateFS, "templates/"+name+".txt")
+	if err != nil {
+		return nil, fmt.Errorf("unknown mail template %s: %w", name, err)
+	}
+
+	var subject, text bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.ExecuteTemplate(&text, "body", data); err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+
+	if _, err := fs.Stat(templateFS, "templates/"+name+".html"); err == nil {
+		htmlTmpl, err := htmltemplate.ParseFS(templateFS, "templates/"+name+".html")
+		if err != nil {
+			return nil, err
+		}
+		var html bytes.Buffer
+		if err := htmlTmpl.Execute(&html, data); err != nil {
+			return nil, err
+		}
+		msg.HTML = html.String()
+	}
+	return msg, nil
+}
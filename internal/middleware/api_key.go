@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+const (
+	APIKeyHeader     = "X-API-Key"
+	APIKeyContextKey = "api_key"
+)
+
+// APIKeyValidator validates API keys of service accounts
+type APIKeyValidator interface {
+	// ValidateAPIKey returns the API key if it is valid, may be used from
+	// clientIP and grants scope
+	ValidateAPIKey(key, clientIP string, scope models.APIKeyScope) (*models.APIKey, error)
+}
+
+// AuthOrAPIKey creates authentication middleware for endpoints that service
+// accounts may call. Requests with an X-API-Key header are authenticated by
+// an API key granting scope and act as the admin who created the key; other
+// requests are authenticated like AuthMiddleware.
+func AuthOrAPIKey(cfg *config.AuthConfig, blacklist *TokenBlacklist, keys APIKeyValidator, scope models.APIKeyScope) gin.HandlerFunc {
+	auth := AuthMiddleware(cfg, blacklist)
+	return func(c *gin.Context) {
+		token := c.GetHeader(APIKeyHeader)
+		if token == "" {
+			auth(c)
+			return
+		}
+
+		key, err := keys.ValidateAPIKey(token, c.ClientIP(), scope)
+		if err != nil {
+			apperror.HandleError(c, err)
+			c.Abort()
+			return
+		}
+
+		// The key is only as powerful as the account that created it
+		if key.Creator == nil || !key.Creator.IsActive {
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+				Error:   "Unauthorized",
+				Message: "API key owner is disabled",
+				Code:    http.StatusUnauthorized,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(APIKeyContextKey, key)
+		c.Set(AuthUserKey, &dto.AuthUser{
+			ID:       key.Creator.ID.String(),
+			Username: key.Creator.Username,
+			Role:     key.Creator.Role,
+		})
+
+		c.Next()
+	}
+}
+
+// GetAPIKey returns the API key the request was authenticated with, or nil
+func GetAPIKey(c *gin.Context) *models.APIKey {
+	key, exists := c.Get(APIKeyContextKey)
+	if !exists {
+		return nil
+	}
+	return key.(*models.APIKey)
+}
@@ -83,6 +83,21 @@ func (al *AuditLogger) LogLogin(c *gin.Context, userID uuid.UUID, details string
 	return database.GetDB().Create(auditLog).Error
 }
 
+// LogPasswordReset logs a password reset request or completion of an
+// unauthenticated user
+func (al *AuditLogger) LogPasswordReset(c *gin.Context, userID uuid.UUID, details string) error {
+	auditLog := &models.AuditLog{
+		UserID:     userID,
+		Action:     models.AuditActionPasswordReset,
+		EntityType: "user",
+		EntityID:   &userID,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Details:    details,
+	}
+	return database.GetDB().Create(auditLog).Error
+}
+
 // LogLogout logs a logout action
 func (al *AuditLogger) LogLogout(c *gin.Context, userID uuid.UUID) error {
 	auditLog := &models.AuditLog{
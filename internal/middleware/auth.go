@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/jwtkeys"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
 )
 
@@ -16,16 +17,40 @@ const (
 	AuthUserKey = "auth_user"
 )
 
+// passwordChangePaths are the routes a user whose password has expired may
+// still use, so they can change it on the profile page or sign out
+var passwordChangePaths = map[string]bool{
+	"/api/v1/auth/logout":     true,
+	"/api/v1/auth/me":         true,
+	"/api/v1/users/password":  true,
+	"/api/v1/users/:id/quota": true,
+	"/profile":                true,
+}
+
+// webAuthnSetupPaths are the routes an admin who must sign in with a security
+// key but has none registered may still use, so they can register one
+var webAuthnSetupPaths = map[string]bool{
+	"/api/v1/auth/logout":                   true,
+	"/api/v1/auth/me":                       true,
+	"/api/v1/auth/webauthn/credentials":     true,
+	"/api/v1/auth/webauthn/register/begin":  true,
+	"/api/v1/auth/webauthn/register/finish": true,
+	"/api/v1/users/:id/quota":               true,
+	"/profile":                              true,
+}
+
 // Claims represents JWT claims
 type Claims struct {
-	UserID   string      `json:"user_id"`
-	Username string      `json:"username"`
-	Role     models.Role `json:"role"`
+	UserID                 string      `json:"user_id"`
+	Username               string      `json:"username"`
+	Role                   models.Role `json:"role"`
+	PasswordChangeRequired bool        `json:"pwd_change,omitempty"`     // password expired, only password change is allowed
+	WebAuthnSetupRequired  bool        `json:"webauthn_setup,omitempty"` // security key required but not registered, only registration is allowed
 	jwt.RegisteredClaims
 }
 
 // AuthMiddleware creates authentication middleware.
-// If blacklist is non-nil, tokens on the blacklist are rejected.
+// If blacklist is non-nil, revoked tokens are rejected.
 func AuthMiddleware(cfg *config.AuthConfig, blacklist *TokenBlacklist) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
@@ -42,43 +67,68 @@ func AuthMiddleware(cfg *config.AuthConfig, blacklist *TokenBlacklist) gin.Handl
 				c.Abort()
 				return
 			}
+
+			// The browser sends the cookie on cross-site requests as well
+			if !ValidCSRFToken(c) {
+				AbortCSRF(c)
+				return
+			}
 		} else {
 			// Remove "Bearer " prefix
 			authHeader = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 
-		// Check token blacklist
-		if blacklist != nil && blacklist.IsBlacklisted(authHeader) {
+		// Parse token
+		claims, err := ParseToken(cfg, authHeader)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
 				Error:   "Unauthorized",
-				Message: "Token has been invalidated",
+				Message: "Invalid or expired token",
 				Code:    http.StatusUnauthorized,
 			})
 			c.Abort()
 			return
 		}
 
-		// Parse token
-		token, err := jwt.ParseWithClaims(authHeader, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		// Check revoked tokens
+		if blacklist != nil && blacklist.IsRevoked(authHeader, claims) {
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
 				Error:   "Unauthorized",
-				Message: "Invalid or expired token",
+				Message: "Token has been invalidated",
 				Code:    http.StatusUnauthorized,
 			})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error:   "Unauthorized",
-				Message: "Invalid token claims",
-				Code:    http.StatusUnauthorized,
+		// Restrict tokens of users whose password has expired
+		if claims.PasswordChangeRequired && !passwordChangePaths[c.FullPath()] {
+			if !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				c.Redirect(http.StatusFound, "/profile")
+				c.Abort()
+				return
+			}
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "Forbidden",
+				Message: "Password has expired and must be changed",
+				Code:    http.StatusForbidden,
+			})
+			c.Abort()
+			return
+		}
+
+		// Restrict tokens of admins who have to register a security key
+		if claims.WebAuthnSetupRequired && !webAuthnSetupPaths[c.FullPath()] &&
+			!(claims.PasswordChangeRequired && passwordChangePaths[c.FullPath()]) {
+			if !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				c.Redirect(http.StatusFound, "/profile")
+				c.Abort()
+				return
+			}
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "Forbidden",
+				Message: "A security key must be registered",
+				Code:    http.StatusForbidden,
 			})
 			c.Abort()
 			return
@@ -86,15 +136,31 @@ func AuthMiddleware(cfg *config.AuthConfig, blacklist *TokenBlacklist) gin.Handl
 
 		// Set user in context
 		c.Set(AuthUserKey, &dto.AuthUser{
-			ID:       claims.UserID,
-			Username: claims.Username,
-			Role:     claims.Role,
+			ID:                     claims.UserID,
+			Username:               claims.Username,
+			Role:                   claims.Role,
+			PasswordChangeRequired: claims.PasswordChangeRequired,
+			WebAuthnSetupRequired:  claims.WebAuthnSetupRequired,
+			TokenID:                claims.ID,
 		})
 
 		c.Next()
 	}
 }
 
+// ParseToken verifies a JWT access token and returns its claims
+func ParseToken(cfg *config.AuthConfig, tokenString string) (*Claims, error) {
+	token, err := jwtkeys.For(cfg).Parse(tokenString, &Claims{})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
 // RequireRole creates middleware that requires specific roles
 func RequireRole(roles ...models.Role) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+)
+
+// Double-submit CSRF protection: the web UI reads the csrf_token cookie and
+// echoes it in the X-CSRF-Token header of state-changing requests. Another
+// site can make the browser send the cookie, but cannot read it.
+const (
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// SetCookie sets a cookie of the web UI with the configured SameSite, Secure
+// and Domain attributes. httpOnly cookies are hidden from JavaScript unless
+// disabled by configuration. A negative maxAge deletes the cookie.
+func SetCookie(c *gin.Context, cfg *config.CookieConfig, name, value, path string, maxAge int, httpOnly bool) {
+	switch cfg.SameSite {
+	case "strict":
+		c.SetSameSite(http.SameSiteStrictMode)
+	case "none":
+		c.SetSameSite(http.SameSiteNoneMode)
+	default:
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	secure := cfg.Secure == "always" || (cfg.Secure != "never" && c.Request.TLS != nil)
+	if cfg.HTTPOnly != nil && !*cfg.HTTPOnly {
+		httpOnly = false
+	}
+	c.SetCookie(name, value, maxAge, path, cfg.Domain, secure, httpOnly)
+}
+
+// SetCSRFCookie sets a new CSRF token cookie, e.g. on login
+func SetCSRFCookie(c *gin.Context, cfg *config.CookieConfig, maxAge int) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	SetCookie(c, cfg, CSRFCookie, base64.RawURLEncoding.EncodeToString(b), "/", maxAge, false)
+}
+
+// EnsureCSRFCookie is middleware for web pages that sets a CSRF token cookie
+// for sessions started before CSRF protection, so their requests keep working
+func EnsureCSRFCookie(cfg *config.CookieConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, err := c.Cookie(CSRFCookie); err != nil || token == "" {
+			SetCSRFCookie(c, cfg, 0)
+		}
+		c.Next()
+	}
+}
+
+// ValidCSRFToken checks the CSRF header of a request against its cookie.
+// Safe methods need no token.
+func ValidCSRFToken(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie, err := c.Cookie(CSRFCookie)
+	header := c.GetHeader(CSRFHeader)
+	return err == nil && cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// AbortCSRF rejects a cookie-authenticated request without a valid CSRF token
+func AbortCSRF(c *gin.Context) {
+	c.JSON(http.StatusForbidden, dto.ErrorResponse{
+		Error:   "Forbidden",
+		Message: "Missing or invalid CSRF token",
+		Code:    http.StatusForbidden,
+	})
+	c.Abort()
+}
@@ -6,9 +6,28 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
 )
 
+// ConfigureClientIP makes c.ClientIP() of the engine return the real client
+// IP: forwarding headers are honoured only on requests from trusted proxies,
+// otherwise the peer address is the client. Audit logs, rate limits and IP
+// filters all use c.ClientIP().
+func ConfigureClientIP(r *gin.Engine, cfg *config.SecurityConfig) error {
+	var proxies []string
+	for _, proxy := range cfg.TrustedProxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	r.ForwardedByClientIP = true
+	if len(cfg.RemoteIPHeaders) > 0 {
+		r.RemoteIPHeaders = cfg.RemoteIPHeaders
+	}
+	return r.SetTrustedProxies(proxies)
+}
+
 // IPFilter creates middleware that restricts access based on IP addresses
 func IPFilter(allowedCIDRs []string) gin.HandlerFunc {
 	// Parse all CIDR ranges
@@ -52,9 +71,7 @@ func IPFilter(allowedCIDRs []string) gin.HandlerFunc {
 			return
 		}
 
-		// Get client IP
-		clientIP := getClientIP(c)
-		ip := net.ParseIP(clientIP)
+		ip := net.ParseIP(c.ClientIP())
 		if ip == nil {
 			c.JSON(http.StatusForbidden, dto.ErrorResponse{
 				Error:   "Forbidden",
@@ -82,26 +99,3 @@ func IPFilter(allowedCIDRs []string) gin.HandlerFunc {
 		c.Abort()
 	}
 }
-
-// getClientIP extracts the real client IP from the request
-func getClientIP(c *gin.Context) string {
-	// Check X-Forwarded-For header (for reverse proxy)
-	if xff := c.GetHeader("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// Check X-Real-IP header
-	if xri := c.GetHeader("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
-	if err != nil {
-		return c.Request.RemoteAddr
-	}
-	return ip
-}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseRateLimitBackend counts requests in the rate_limit_counters table,
+// so all instances behind a load balancer share the limits. It approximates
+// a sliding window by weighing the previous fixed window's count by its
+// overlap with the window ending now. It works on PostgreSQL, MySQL and
+// SQLite.
+type DatabaseRateLimitBackend struct {
+	stopCh chan struct{}
+}
+
+// NewDatabaseRateLimitBackend creates a new database backend and starts the
+// cleanup goroutine
+func NewDatabaseRateLimitBackend() *DatabaseRateLimitBackend {
+	b := &DatabaseRateLimitBackend{stopCh: make(chan struct{})}
+	go b.cleanupLoop()
+	return b
+}
+
+// Allow counts a request under key and checks the sliding window. Rejected
+// requests are not counted.
+func (b *DatabaseRateLimitBackend) Allow(key string, policy config.RateLimitPolicy) (bool, time.Duration, error) {
+	db := database.GetDB()
+	now := time.Now()
+	window := int64(policy.Window)
+	current := now.Unix() / window * window
+	previous := current - window
+	limit := policy.Requests
+	if policy.Burst > limit {
+		limit = policy.Burst
+	}
+
+	// Count first and undo when over the limit, so concurrent requests of
+	// several instances cannot all pass a check made before counting
+	counter := models.RateLimitCounter{
+		LimitKey:    key,
+		WindowStart: current,
+		Hits:        1,
+		ExpiresAt:   time.Unix(current+2*window, 0),
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "limit_key"}, {Name: "window_start"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"hits": gorm.Expr("hits + 1")}),
+	}).Create(&counter).Error
+	if err != nil {
+		return false, 0, err
+	}
+
+	var counters []models.RateLimitCounter
+	if err := db.Where("limit_key = ? AND window_start IN ?", key, []int64{previous, current}).
+		Find(&counters).Error; err != nil {
+		return false, 0, err
+	}
+	var previousHits, currentHits int
+	for _, c := range counters {
+		if c.WindowStart == current {
+			currentHits = c.Hits
+		} else {
+			previousHits = c.Hits
+		}
+	}
+
+	elapsed := float64(now.UnixNano()-current*int64(time.Second)) / float64(window*int64(time.Second))
+	estimate := float64(previousHits)*(1-elapsed) + float64(currentHits)
+	if estimate <= float64(limit) {
+		return true, 0, nil
+	}
+
+	if err := db.Model(&models.RateLimitCounter{}).
+		Where("limit_key = ? AND window_start = ?", key, current).
+		UpdateColumn("hits", gorm.Expr("hits - 1")).Error; err != nil {
+		return false, 0, err
+	}
+	return false, time.Unix(current+window, 0).Sub(now), nil
+}
+
+// Stop stops the cleanup goroutine
+func (b *DatabaseRateLimitBackend) Stop() {
+	close(b.stopCh)
+}
+
+func (b *DatabaseRateLimitBackend) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.cleanup()
+		case <-b.stopCh:
+			return
+		}
+	}
+}
+
+func (b *DatabaseRateLimitBackend) cleanup() {
+	if db := database.GetDB(); db != nil {
+		db.Where("expires_at < ?", time.Now()).Delete(&models.RateLimitCounter{})
+	}
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"sync"
@@ -9,49 +11,184 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	applogger "github.com/tldr-it-stepankutaj/openvpn-mng/internal/logger"
 	"golang.org/x/time/rate"
 )
 
+// Rate limit policies
+const (
+	RateLimitLogin   = "login"
+	RateLimitVpnAuth = "vpn-auth"
+	RateLimitAPI     = "api"
+)
+
+// Rate limit backends
+const (
+	RateLimitBackendMemory   = "memory"
+	RateLimitBackendDatabase = "database"
+)
+
+// RateLimitBackend counts requests per key. The memory backend is local to
+// the instance; the database backend is shared by all instances.
+type RateLimitBackend interface {
+	// Allow counts a request under key and reports whether it is within the
+	// policy, otherwise how long until the next request may pass
+	Allow(key string, policy config.RateLimitPolicy) (bool, time.Duration, error)
+	// Stop stops the cleanup goroutine
+	Stop()
+}
+
+// RateLimiter provides per-IP rate limiting with a policy per group of routes
+type RateLimiter struct {
+	backend  RateLimitBackend
+	policies map[string]config.RateLimitPolicy
+}
+
+// NewRateLimiter creates a new in-memory rate limiter from config
+func NewRateLimiter(cfg *config.SecurityConfig) *RateLimiter {
+	return NewRateLimiterWithBackend(cfg, NewMemoryRateLimitBackend())
+}
+
+// NewRateLimiterWithBackend creates a new rate limiter from config counting
+// requests in backend
+func NewRateLimiterWithBackend(cfg *config.SecurityConfig, backend RateLimitBackend) *RateLimiter {
+	legacy := config.RateLimitPolicy{
+		Requests: cfg.RateLimitRequests,
+		Window:   cfg.RateLimitWindow,
+		Burst:    cfg.RateLimitBurst,
+	}
+	login, vpnAuth := cfg.RateLimits.Login, cfg.RateLimits.VpnAuth
+	if login.Requests == 0 {
+		login = legacy
+	}
+	if vpnAuth.Requests == 0 {
+		vpnAuth = legacy
+	}
+	return &RateLimiter{
+		backend: backend,
+		policies: map[string]config.RateLimitPolicy{
+			RateLimitLogin:   login,
+			RateLimitVpnAuth: vpnAuth,
+			RateLimitAPI:     cfg.RateLimits.API,
+		},
+	}
+}
+
+// NewRateLimitBackend creates the backend named by cfg
+func NewRateLimitBackend(cfg *config.SecurityConfig) (RateLimitBackend, error) {
+	switch cfg.RateLimitBackend {
+	case "", RateLimitBackendMemory:
+		return NewMemoryRateLimitBackend(), nil
+	case RateLimitBackendDatabase:
+		return NewDatabaseRateLimitBackend(), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit backend %q", cfg.RateLimitBackend)
+	}
+}
+
+// Stop stops the cleanup goroutine of the backend
+func (rl *RateLimiter) Stop() {
+	rl.backend.Stop()
+}
+
+// Middleware returns a Gin middleware that enforces the login policy
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return rl.PolicyMiddleware(RateLimitLogin)
+}
+
+// PolicyMiddleware returns a Gin middleware that enforces a policy per client IP
+func (rl *RateLimiter) PolicyMiddleware(policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, retryAfter := rl.Allow(policy, c.ClientIP())
+		if !allowed {
+			rl.Reject(c, retryAfter)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Allow counts a request under key, usually a client IP, and reports whether
+// it is within the policy. Policies without a limit allow everything, and
+// requests are allowed when the backend fails.
+func (rl *RateLimiter) Allow(policy, key string) (bool, time.Duration) {
+	p, ok := rl.policies[policy]
+	if !ok || p.Requests <= 0 || p.Window <= 0 {
+		return true, 0
+	}
+	allowed, retryAfter, err := rl.backend.Allow(policy+":"+key, p)
+	if err != nil {
+		applogger.Warn("Rate limit check failed", "policy", policy, "error", err)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// Reject aborts a request over the rate limit with 429 Too Many Requests
+func (rl *RateLimiter) Reject(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
+		Error:   "Too Many Requests",
+		Message: "Rate limit exceeded. Please try again later.",
+		Code:    http.StatusTooManyRequests,
+	})
+	c.Abort()
+}
+
 type ipLimiter struct {
 	limiter  *rate.Limiter
 	lastSeen time.Time
 }
 
-// RateLimiter provides per-IP rate limiting
-type RateLimiter struct {
+// MemoryRateLimitBackend keeps a token bucket per key in memory. Each
+// instance counts on its own.
+type MemoryRateLimitBackend struct {
 	mu       sync.Mutex
 	limiters map[string]*ipLimiter
-	rate     rate.Limit
-	burst    int
 	stopCh   chan struct{}
 }
 
-// NewRateLimiter creates a new rate limiter from config
-func NewRateLimiter(cfg *config.SecurityConfig) *RateLimiter {
-	r := rate.Limit(float64(cfg.RateLimitRequests) / float64(cfg.RateLimitWindow))
-	rl := &RateLimiter{
+// NewMemoryRateLimitBackend creates a new in-memory backend and starts the
+// cleanup goroutine
+func NewMemoryRateLimitBackend() *MemoryRateLimitBackend {
+	b := &MemoryRateLimitBackend{
 		limiters: make(map[string]*ipLimiter),
-		rate:     r,
-		burst:    cfg.RateLimitBurst,
 		stopCh:   make(chan struct{}),
 	}
-	go rl.cleanupLoop()
-	return rl
+	go b.cleanupLoop()
+	return b
+}
+
+// Allow takes a token from the bucket of key
+func (b *MemoryRateLimitBackend) Allow(key string, policy config.RateLimitPolicy) (bool, time.Duration, error) {
+	limit := rate.Limit(float64(policy.Requests) / float64(policy.Window))
+	burst := policy.Burst
+	if burst <= 0 {
+		burst = policy.Requests
+	}
+	if b.getLimiter(key, limit, burst).Allow() {
+		return true, 0, nil
+	}
+	return false, time.Duration(float64(time.Second) / float64(limit)), nil
 }
 
 // Stop stops the cleanup goroutine
-func (rl *RateLimiter) Stop() {
-	close(rl.stopCh)
+func (b *MemoryRateLimitBackend) Stop() {
+	close(b.stopCh)
 }
 
-func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+func (b *MemoryRateLimitBackend) getLimiter(key string, limit rate.Limit, burst int) *rate.Limiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	v, exists := rl.limiters[ip]
+	v, exists := b.limiters[key]
 	if !exists {
-		limiter := rate.NewLimiter(rl.rate, rl.burst)
-		rl.limiters[ip] = &ipLimiter{limiter: limiter, lastSeen: time.Now()}
+		limiter := rate.NewLimiter(limit, burst)
+		b.limiters[key] = &ipLimiter{limiter: limiter, lastSeen: time.Now()}
 		return limiter
 	}
 
@@ -59,50 +196,26 @@ func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
 	return v.limiter
 }
 
-func (rl *RateLimiter) cleanupLoop() {
+func (b *MemoryRateLimitBackend) cleanupLoop() {
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			rl.cleanup()
-		case <-rl.stopCh:
+			b.cleanup()
+		case <-b.stopCh:
 			return
 		}
 	}
 }
 
-func (rl *RateLimiter) cleanup() {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+func (b *MemoryRateLimitBackend) cleanup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	cutoff := time.Now().Add(-10 * time.Minute)
-	for ip, v := range rl.limiters {
+	for key, v := range b.limiters {
 		if v.lastSeen.Before(cutoff) {
-			delete(rl.limiters, ip)
-		}
-	}
-}
-
-// Middleware returns a Gin middleware that enforces rate limiting
-func (rl *RateLimiter) Middleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := getClientIP(c)
-		limiter := rl.getLimiter(ip)
-
-		if !limiter.Allow() {
-			retryAfter := int(1.0 / float64(rl.rate))
-			if retryAfter < 1 {
-				retryAfter = 1
-			}
-			c.Header("Retry-After", strconv.Itoa(retryAfter))
-			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
-				Error:   "Too Many Requests",
-				Message: "Rate limit exceeded. Please try again later.",
-				Code:    http.StatusTooManyRequests,
-			})
-			c.Abort()
-			return
+			delete(b.limiters, key)
 		}
-		c.Next()
 	}
 }
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+)
+
+// SecurityHeaders creates middleware adding Content-Security-Policy (with
+// frame-ancestors), X-Frame-Options, X-Content-Type-Options and
+// Referrer-Policy to web UI responses, plus Strict-Transport-Security when
+// served over HTTPS or https is set for deployments behind a TLS proxy
+func SecurityHeaders(cfg *config.SecurityHeadersConfig, https bool) gin.HandlerFunc {
+	csp := strings.TrimSuffix(strings.TrimSpace(cfg.ContentSecurityPolicy), ";")
+	if cfg.FrameAncestors != "" {
+		if csp != "" {
+			csp += "; "
+		}
+		csp += "frame-ancestors " + cfg.FrameAncestors
+	}
+	frameOptions := ""
+	switch cfg.FrameAncestors {
+	case "'none'":
+		frameOptions = "DENY"
+	case "'self'":
+		frameOptions = "SAMEORIGIN"
+	}
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(cfg.HSTSMaxAge)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		if csp != "" {
+			header.Set("Content-Security-Policy", csp)
+		}
+		if frameOptions != "" {
+			header.Set("X-Frame-Options", frameOptions)
+		}
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "same-origin")
+		if hsts != "" && (https || c.Request.TLS != nil) {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		c.Next()
+	}
+}
@@ -3,42 +3,128 @@ package middleware
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"sync"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
 )
 
-// TokenBlacklist tracks invalidated JWT tokens until they expire naturally
+// revocationCacheTTL is how long a database lookup is cached. Revocations
+// made on other replicas take effect after at most this long.
+const revocationCacheTTL = 30 * time.Second
+
+// TokenBlacklist tracks invalidated JWT tokens until they expire naturally.
+// Revocations are stored in the database by token ID (jti), so they survive
+// restarts and apply to all replicas; tokens issued before a user's
+// tokens_valid_after watermark are invalid as well. Database lookups are
+// cached in memory for a short time.
 type TokenBlacklist struct {
 	mu     sync.RWMutex
-	tokens map[string]time.Time // SHA-256 hash of token → expiry time
+	tokens map[string]time.Time         // SHA-256 hash of token → expiry time, revoked by this process
+	jtis   map[string]jtiCacheEntry     // jti → cached revocation state
+	users  map[uuid.UUID]userCacheEntry // user ID → cached watermark
 	stopCh chan struct{}
 }
 
+type jtiCacheEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+type userCacheEntry struct {
+	validAfter *time.Time
+	deleted    bool
+	checkedAt  time.Time
+}
+
 // NewTokenBlacklist creates a new token blacklist and starts the cleanup goroutine
 func NewTokenBlacklist() *TokenBlacklist {
 	b := &TokenBlacklist{
 		tokens: make(map[string]time.Time),
+		jtis:   make(map[string]jtiCacheEntry),
+		users:  make(map[uuid.UUID]userCacheEntry),
 		stopCh: make(chan struct{}),
 	}
 	go b.cleanupLoop()
 	return b
 }
 
-// Add blacklists a token until the given expiry time
+// Add blacklists a token until the given expiry time. Tokens with a jti are
+// also stored in the database.
 func (b *TokenBlacklist) Add(tokenString string, expiry time.Time) {
 	hash := hashToken(tokenString)
+	claims := unverifiedClaims(tokenString)
+
 	b.mu.Lock()
 	b.tokens[hash] = expiry
+	if claims != nil && claims.ID != "" {
+		b.jtis[claims.ID] = jtiCacheEntry{revoked: true, checkedAt: time.Now()}
+	}
 	b.mu.Unlock()
+
+	if claims == nil || claims.ID == "" || database.GetDB() == nil {
+		return
+	}
+	revoked := &models.RevokedToken{JTI: claims.ID, ExpiresAt: expiry}
+	if userID, err := uuid.Parse(claims.UserID); err == nil {
+		revoked.UserID = userID
+	}
+	database.GetDB().Where(models.RevokedToken{JTI: claims.ID}).FirstOrCreate(revoked)
+}
+
+// MarkRevoked caches token IDs that were just stored as revoked in the
+// database, so this instance rejects them without waiting for the cache TTL
+func (b *TokenBlacklist) MarkRevoked(jtis ...string) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, jti := range jtis {
+		b.jtis[jti] = jtiCacheEntry{revoked: true, checkedAt: now}
+	}
 }
 
 // IsBlacklisted checks if a token has been blacklisted
 func (b *TokenBlacklist) IsBlacklisted(tokenString string) bool {
 	hash := hashToken(tokenString)
 	b.mu.RLock()
-	defer b.mu.RUnlock()
 	_, exists := b.tokens[hash]
-	return exists
+	b.mu.RUnlock()
+	if exists {
+		return true
+	}
+
+	claims := unverifiedClaims(tokenString)
+	return claims != nil && claims.ID != "" && b.isRevokedJTI(claims.ID)
+}
+
+// IsRevoked checks if a verified token was blacklisted or issued before the
+// tokens_valid_after watermark of its user
+func (b *TokenBlacklist) IsRevoked(tokenString string, claims *Claims) bool {
+	if b.IsBlacklisted(tokenString) {
+		return true
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return true
+	}
+
+	entry, ok := b.userEntry(userID)
+	if !ok {
+		return true
+	}
+	if entry.deleted {
+		return true
+	}
+	if entry.validAfter == nil {
+		return false
+	}
+	// iat has second precision, so the watermark is truncated to seconds too
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(*entry.validAfter)
 }
 
 // Stop stops the cleanup goroutine
@@ -46,6 +132,60 @@ func (b *TokenBlacklist) Stop() {
 	close(b.stopCh)
 }
 
+// isRevokedJTI checks the database for a revoked jti, caching the result.
+// Lookup errors count as revoked.
+func (b *TokenBlacklist) isRevokedJTI(jti string) bool {
+	now := time.Now()
+	b.mu.RLock()
+	entry, ok := b.jtis[jti]
+	b.mu.RUnlock()
+	if ok && now.Sub(entry.checkedAt) < revocationCacheTTL {
+		return entry.revoked
+	}
+	if database.GetDB() == nil {
+		return false
+	}
+
+	var count int64
+	if err := database.GetDB().Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return true
+	}
+	b.mu.Lock()
+	b.jtis[jti] = jtiCacheEntry{revoked: count > 0, checkedAt: now}
+	b.mu.Unlock()
+	return count > 0
+}
+
+// userEntry returns the cached watermark of a user, loading it from the
+// database when stale. It returns false if the lookup failed.
+func (b *TokenBlacklist) userEntry(userID uuid.UUID) (userCacheEntry, bool) {
+	now := time.Now()
+	b.mu.RLock()
+	entry, ok := b.users[userID]
+	b.mu.RUnlock()
+	if ok && now.Sub(entry.checkedAt) < revocationCacheTTL {
+		return entry, true
+	}
+	if database.GetDB() == nil {
+		return userCacheEntry{}, true
+	}
+
+	var user models.User
+	err := database.GetDB().Select("id", "tokens_valid_after").First(&user, "id = ?", userID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		entry = userCacheEntry{deleted: true, checkedAt: now}
+	case err != nil:
+		return userCacheEntry{}, false
+	default:
+		entry = userCacheEntry{validAfter: user.TokensValidAfter, checkedAt: now}
+	}
+	b.mu.Lock()
+	b.users[userID] = entry
+	b.mu.Unlock()
+	return entry, true
+}
+
 func (b *TokenBlacklist) cleanupLoop() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
@@ -62,12 +202,35 @@ func (b *TokenBlacklist) cleanupLoop() {
 func (b *TokenBlacklist) cleanup() {
 	now := time.Now()
 	b.mu.Lock()
-	defer b.mu.Unlock()
 	for hash, expiry := range b.tokens {
 		if expiry.Before(now) {
 			delete(b.tokens, hash)
 		}
 	}
+	for jti, entry := range b.jtis {
+		if now.Sub(entry.checkedAt) >= revocationCacheTTL {
+			delete(b.jtis, jti)
+		}
+	}
+	for userID, entry := range b.users {
+		if now.Sub(entry.checkedAt) >= revocationCacheTTL {
+			delete(b.users, userID)
+		}
+	}
+	b.mu.Unlock()
+
+	if database.GetDB() != nil {
+		database.GetDB().Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+	}
+}
+
+// unverifiedClaims returns the claims of a token without verifying it, or nil
+func unverifiedClaims(tokenString string) *Claims {
+	claims := &Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return nil
+	}
+	return claims
 }
 
 func hashToken(token string) string {
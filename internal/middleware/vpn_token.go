@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
 )
 
 const (
@@ -13,11 +16,13 @@ const (
 
 // VpnTokenAuth creates middleware for VPN token authentication
 // This is used by the OpenVPN server to authenticate API requests
-// instead of using a service account with JWT
-func VpnTokenAuth(vpnToken string) gin.HandlerFunc {
+// instead of using a service account with JWT.
+// The token is either the vpn_token from the configuration or an API key
+// with the vpn-auth scope, sent in the X-VPN-Token or X-API-Key header.
+func VpnTokenAuth(vpnToken string, keys APIKeyValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if VPN token is configured
-		if vpnToken == "" {
+		if vpnToken == "" && keys == nil {
 			c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{
 				Error:   "Service Unavailable",
 				Message: "VPN token authentication is not configured",
@@ -29,6 +34,9 @@ func VpnTokenAuth(vpnToken string) gin.HandlerFunc {
 
 		// Get token from header
 		token := c.GetHeader(VpnTokenHeader)
+		if token == "" {
+			token = c.GetHeader(APIKeyHeader)
+		}
 		if token == "" {
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
 				Error:   "Unauthorized",
@@ -40,7 +48,11 @@ func VpnTokenAuth(vpnToken string) gin.HandlerFunc {
 		}
 
 		// Validate token
-		if token != vpnToken {
+		if vpnToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(vpnToken)) == 1 {
+			c.Next()
+			return
+		}
+		if keys == nil {
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
 				Error:   "Unauthorized",
 				Message: "Invalid VPN token",
@@ -50,6 +62,14 @@ func VpnTokenAuth(vpnToken string) gin.HandlerFunc {
 			return
 		}
 
+		key, err := keys.ValidateAPIKey(token, c.ClientIP(), models.APIKeyScopeVpnAuth)
+		if err != nil {
+			apperror.HandleError(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(APIKeyContextKey, key)
+
 		c.Next()
 	}
 }
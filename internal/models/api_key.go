@@ -0,0 +1,106 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKeyScope represents a set of endpoints an API key may call
+type APIKeyScope string
+
+const (
+	// APIKeyScopeVpnAuth grants access to the VPN Auth API used by OpenVPN servers
+	APIKeyScopeVpnAuth APIKeyScope = "vpn-auth"
+	// APIKeyScopeReports grants read-only access to sessions, traffic and reports
+	APIKeyScopeReports APIKeyScope = "reports:read"
+	// APIKeyScopeUsers grants access to user provisioning endpoints
+	APIKeyScopeUsers APIKeyScope = "users:provision"
+)
+
+// IsValid checks if the scope is known
+func (s APIKeyScope) IsValid() bool {
+	switch s {
+	case APIKeyScopeVpnAuth, APIKeyScopeReports, APIKeyScopeUsers:
+		return true
+	}
+	return false
+}
+
+// APIKey represents a key for service accounts calling the API. Only a hash
+// of the key is stored; requests made with it act as the admin who created it.
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"` // first characters of the key, to recognize it
+	KeyHash    string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"size:255;not null" json:"scopes"`        // comma separated APIKeyScope values
+	AllowedIPs string     `gorm:"size:1000" json:"allowed_ips,omitempty"` // comma separated IPs or CIDRs, empty = any
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	CreatedBy  uuid.UUID  `gorm:"type:uuid;not null;index" json:"created_by"`
+	Creator    *User      `gorm:"-" json:"creator,omitempty"` // loaded by APIKeyService
+}
+
+// BeforeCreate hook to generate UUID before creating a new API key
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the scopes of the key
+func (k *APIKey) ScopeList() []APIKeyScope {
+	var scopes []APIKeyScope
+	for _, s := range splitList(k.Scopes) {
+		scopes = append(scopes, APIKeyScope(s))
+	}
+	return scopes
+}
+
+// HasScope checks if the key grants the scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedIPList returns the IPs and CIDRs the key may be used from
+func (k *APIKey) AllowedIPList() []string {
+	return splitList(k.AllowedIPs)
+}
+
+// IsRevoked checks if the key was revoked
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// IsExpired checks if the key is past its expiry
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && now.After(*k.ExpiresAt)
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -17,6 +17,8 @@ const (
 	AuditActionDelete AuditAction = "DELETE"
 	AuditActionLogin  AuditAction = "LOGIN"
 	AuditActionLogout AuditAction = "LOGOUT"
+
+	AuditActionPasswordReset AuditAction = "PASSWORD_RESET"
 )
 
 // AuditLog represents an audit log entry
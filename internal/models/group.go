@@ -9,14 +9,15 @@ import (
 
 // Group represents a group in the system (e.g., IT, HR, Finance)
 type Group struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
-	Name        string         `gorm:"uniqueIndex;size:100;not null" json:"name"`
-	Description string         `gorm:"size:500" json:"description,omitempty"`
-	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   *time.Time     `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
-	CreatedBy   uuid.UUID      `gorm:"type:uuid;not null" json:"created_by"`
-	UpdatedBy   *uuid.UUID     `gorm:"type:uuid" json:"updated_by,omitempty"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                  uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
+	Name                string         `gorm:"uniqueIndex;size:100;not null" json:"name"`
+	Description         string         `gorm:"size:500" json:"description,omitempty"`
+	MonthlyTrafficQuota int64          `gorm:"not null;default:0" json:"monthly_traffic_quota"` // bytes shared by all members, 0 = unlimited
+	CreatedAt           time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           *time.Time     `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
+	CreatedBy           uuid.UUID      `gorm:"type:uuid;not null" json:"created_by"`
+	UpdatedBy           *uuid.UUID     `gorm:"type:uuid" json:"updated_by,omitempty"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // BeforeCreate hook to generate UUID before creating a new group
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// JWTSigningKey represents an asymmetric key pair used to sign access tokens.
+// The newest key that is not retired signs new tokens; retired keys only
+// verify tokens signed before the rotation until those expire.
+type JWTSigningKey struct {
+	ID         string     `gorm:"primaryKey;size:64" json:"kid"`
+	Algorithm  string     `gorm:"size:10;not null" json:"algorithm"` // RS256 or EdDSA
+	PrivateKey string     `gorm:"type:text;not null" json:"-"`       // PKCS #8 PEM
+	PublicKey  string     `gorm:"type:text;not null" json:"public_key"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+	RetiredAt  *time.Time `gorm:"index" json:"retired_at,omitempty"`
+}
+
+// TableName returns the table name for the JWTSigningKey model
+func (JWTSigningKey) TableName() string {
+	return "jwt_signing_keys"
+}
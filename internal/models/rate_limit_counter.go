@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RateLimitCounter counts the requests of a rate limit key in a fixed window.
+// The database rate limit backend weighs the counts of the current and the
+// previous window into a sliding window shared by all instances; rows can be
+// deleted once they expire.
+type RateLimitCounter struct {
+	LimitKey    string    `gorm:"primaryKey;size:191" json:"limit_key"`
+	WindowStart int64     `gorm:"primaryKey;autoIncrement:false" json:"window_start"` // unix seconds
+	Hits        int       `gorm:"not null;default:0" json:"hits"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName returns the table name for the RateLimitCounter model
+func (RateLimitCounter) TableName() string {
+	return "rate_limit_counters"
+}
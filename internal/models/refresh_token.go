@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken represents a refresh token of a login. Each refresh replaces
+// the token with a new one of the same family; presenting a token that was
+// already replaced revokes the whole family. Only a hash of the token is stored.
+// A family is a login session, listed to the user by its family ID.
+type RefreshToken struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	FamilyID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"family_id"` // shared by all tokens of one login
+	TokenHash       string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt       time.Time  `gorm:"not null;index" json:"expires_at"`
+	FamilyExpiresAt time.Time  `gorm:"not null" json:"family_expires_at"` // no token of the family is issued after this
+	UsedAt          *time.Time `json:"used_at,omitempty"`
+	ReplacedBy      *uuid.UUID `gorm:"type:uuid" json:"replaced_by,omitempty"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	IPAddress       string     `gorm:"size:45" json:"ip_address,omitempty"`
+	UserAgent       string     `gorm:"size:255" json:"user_agent,omitempty"`
+	// jti and expiry of the access token issued with this refresh token, so
+	// revoking the session revokes it as well
+	AccessTokenID        string     `gorm:"size:64" json:"-"`
+	AccessTokenExpiresAt *time.Time `json:"-"`
+	CreatedAt            time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID before creating a new refresh token
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// IsUsed checks if the token was already exchanged for a new one
+func (t *RefreshToken) IsUsed() bool {
+	return t.UsedAt != nil
+}
+
+// IsRevoked checks if the token was revoked
+func (t *RefreshToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+// IsExpired checks if the token is past its expiry
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return now.After(t.ExpiresAt)
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AlertType represents the kind of anomaly that raised a security alert
+type AlertType string
+
+const (
+	AlertTypeNewIP              AlertType = "NEW_IP"
+	AlertTypeUnusualHour        AlertType = "UNUSUAL_HOUR"
+	AlertTypeTrafficSpike       AlertType = "TRAFFIC_SPIKE"
+	AlertTypeCredentialStuffing AlertType = "CREDENTIAL_STUFFING"
+)
+
+// AlertSeverity represents the severity of a security alert
+type AlertSeverity string
+
+const (
+	AlertSeverityLow    AlertSeverity = "low"
+	AlertSeverityMedium AlertSeverity = "medium"
+	AlertSeverityHigh   AlertSeverity = "high"
+)
+
+// Level returns the severity as a comparable number, 0 for unknown values
+func (s AlertSeverity) Level() int {
+	switch s {
+	case AlertSeverityLow:
+		return 1
+	case AlertSeverityMedium:
+		return 2
+	case AlertSeverityHigh:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// VpnLoginAttempt represents a VPN authentication attempt
+type VpnLoginAttempt struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	Username  string     `gorm:"size:100;not null;index" json:"username"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"` // set when the user exists
+	SourceIP  string     `gorm:"size:45;index" json:"source_ip,omitempty"`
+	Success   bool       `gorm:"not null;default:false" json:"success"`
+	CreatedAt time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID before creating a new login attempt
+func (a *VpnLoginAttempt) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the VpnLoginAttempt model
+func (VpnLoginAttempt) TableName() string {
+	return "vpn_login_attempts"
+}
+
+// SecurityAlert represents an anomaly detected in VPN logins or traffic
+type SecurityAlert struct {
+	ID             uuid.UUID     `gorm:"type:uuid;primary_key" json:"id"`
+	Type           AlertType     `gorm:"size:30;not null;index" json:"type"`
+	Severity       AlertSeverity `gorm:"size:10;not null;index" json:"severity"`
+	UserID         *uuid.UUID    `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Username       string        `gorm:"size:100" json:"username,omitempty"`
+	SourceIP       string        `gorm:"size:45;index" json:"source_ip,omitempty"`
+	Message        string        `gorm:"size:500;not null" json:"message"`
+	ObservedAt     time.Time     `gorm:"not null;index" json:"observed_at"` // login time or traffic hour
+	Blocked        bool          `gorm:"default:false" json:"blocked"`      // authentication was denied
+	Acknowledged   bool          `gorm:"default:false;index" json:"acknowledged"`
+	AcknowledgedBy *uuid.UUID    `gorm:"type:uuid" json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time    `json:"acknowledged_at,omitempty"`
+	CreatedAt      time.Time     `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID before creating a new security alert
+func (a *SecurityAlert) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the SecurityAlert model
+func (SecurityAlert) TableName() string {
+	return "security_alerts"
+}
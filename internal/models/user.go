@@ -7,6 +7,15 @@ import (
 	"gorm.io/gorm"
 )
 
+// AuthSource identifies where a user's credentials are verified
+type AuthSource string
+
+const (
+	AuthSourceLocal AuthSource = "local"
+	AuthSourceLDAP  AuthSource = "ldap"
+	AuthSourceOIDC  AuthSource = "oidc"
+)
+
 // User represents a user in the system
 type User struct {
 	ID                  uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
@@ -24,8 +33,13 @@ type User struct {
 	ValidFrom           *time.Time     `gorm:"type:date" json:"valid_from,omitempty"`
 	ValidTo             *time.Time     `gorm:"type:date" json:"valid_to,omitempty"`
 	VpnIP               string         `gorm:"size:45" json:"vpn_ip,omitempty"`
+	MonthlyTrafficQuota int64          `gorm:"not null;default:0" json:"monthly_traffic_quota"` // bytes, 0 = unlimited
 	FailedLoginAttempts int            `gorm:"not null;default:0" json:"-"`
 	LockedUntil         *time.Time     `json:"locked_until,omitempty"`
+	TokensValidAfter    *time.Time     `json:"-"`                                                   // tokens issued before are invalid
+	PasswordChangedAt   *time.Time     `json:"password_changed_at,omitempty"`                       // nil = since creation
+	MustChangePassword  bool           `gorm:"not null;default:false" json:"must_change_password"`  // password set by someone else, change on next login
+	AuthSource          AuthSource     `gorm:"size:20;not null;default:'local'" json:"auth_source"` // local password or directory
 	CreatedAt           time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt           *time.Time     `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
 	CreatedBy           uuid.UUID      `gorm:"type:uuid;not null" json:"created_by"`
@@ -55,6 +69,19 @@ func (u *User) GetFullName() string {
 	return u.FirstName + " " + u.LastName
 }
 
+// HasLocalPassword checks if the user signs in with a password stored in the database
+func (u *User) HasLocalPassword() bool {
+	return u.AuthSource == "" || u.AuthSource == AuthSourceLocal
+}
+
+// PasswordSetAt returns when the local password was last set
+func (u *User) PasswordSetAt() time.Time {
+	if u.PasswordChangedAt != nil {
+		return *u.PasswordChangedAt
+	}
+	return u.CreatedAt
+}
+
 // IsAdmin checks if the user is an admin
 func (u *User) IsAdmin() bool {
 	return u.Role == RoleAdmin
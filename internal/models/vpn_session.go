@@ -16,6 +16,7 @@ const (
 	DisconnectReasonServerShutdown DisconnectReason = "SERVER_SHUTDOWN"
 	DisconnectReasonError          DisconnectReason = "ERROR"
 	DisconnectReasonAdminAction    DisconnectReason = "ADMIN_ACTION"
+	DisconnectReasonQuotaExceeded  DisconnectReason = "QUOTA_EXCEEDED"
 )
 
 // VpnSession represents a VPN connection session
@@ -30,6 +31,7 @@ type VpnSession struct {
 	BytesReceived    int64             `gorm:"default:0" json:"bytes_received"`
 	BytesSent        int64             `gorm:"default:0" json:"bytes_sent"`
 	DisconnectReason *DisconnectReason `gorm:"size:20" json:"disconnect_reason,omitempty"`
+	AcctSessionID    string            `gorm:"size:64;index" json:"acct_session_id,omitempty"` // RADIUS Acct-Session-Id
 }
 
 // BeforeCreate hook to generate UUID before creating a new session
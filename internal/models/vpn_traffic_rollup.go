@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VpnTrafficHourly represents traffic of a user aggregated into one hour bucket
+type VpnTrafficHourly struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	BucketStart   time.Time `gorm:"not null;uniqueIndex:idx_vpn_traffic_hourly_bucket_user" json:"bucket_start"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_vpn_traffic_hourly_bucket_user;index" json:"user_id"`
+	BytesReceived int64     `gorm:"default:0" json:"bytes_received"`
+	BytesSent     int64     `gorm:"default:0" json:"bytes_sent"`
+}
+
+// BeforeCreate hook to generate UUID before creating a new rollup entry
+func (h *VpnTrafficHourly) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the VpnTrafficHourly model
+func (VpnTrafficHourly) TableName() string {
+	return "vpn_traffic_hourly"
+}
+
+// VpnTrafficDaily represents traffic of a user aggregated into one day bucket
+type VpnTrafficDaily struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	BucketStart   time.Time `gorm:"not null;uniqueIndex:idx_vpn_traffic_daily_bucket_user" json:"bucket_start"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_vpn_traffic_daily_bucket_user;index" json:"user_id"`
+	BytesReceived int64     `gorm:"default:0" json:"bytes_received"`
+	BytesSent     int64     `gorm:"default:0" json:"bytes_sent"`
+}
+
+// BeforeCreate hook to generate UUID before creating a new rollup entry
+func (d *VpnTrafficDaily) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the VpnTrafficDaily model
+func (VpnTrafficDaily) TableName() string {
+	return "vpn_traffic_daily"
+}
+
+// TrafficRollupState records up to which point raw traffic stats have been rolled up
+type TrafficRollupState struct {
+	Name          string    `gorm:"size:50;primary_key" json:"name"`
+	RolledUpUntil time.Time `gorm:"not null" json:"rolled_up_until"` // exclusive, aligned to an hour
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the TrafficRollupState model
+func (TrafficRollupState) TableName() string {
+	return "traffic_rollup_state"
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredential represents a security key or passkey registered by a
+// user for signing in to the web UI
+type WebAuthnCredential struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name         string     `gorm:"size:100;not null" json:"name"`
+	CredentialID string     `gorm:"size:1400;not null;uniqueIndex" json:"-"` // base64url credential ID
+	PublicKey    []byte     `gorm:"not null" json:"-"`                       // COSE_Key
+	Algorithm    int        `gorm:"not null" json:"algorithm"`               // COSE algorithm
+	SignCount    uint32     `gorm:"not null;default:0" json:"-"`
+	AAGUID       string     `gorm:"size:36" json:"aaguid,omitempty"`      // authenticator model
+	Transports   string     `gorm:"size:100" json:"transports,omitempty"` // comma separated, e.g. "usb,nfc"
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID before creating a new credential
+func (c *WebAuthnCredential) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the WebAuthnCredential model
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnChallenge represents a pending WebAuthn registration or login.
+// Each challenge can be answered once.
+type WebAuthnChallenge struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	Challenge string     `gorm:"size:64;not null;uniqueIndex" json:"-"` // base64url
+	Purpose   string     `gorm:"size:20;not null" json:"purpose"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"` // nil for passwordless login
+	ExpiresAt time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// WebAuthn challenge purposes
+const (
+	WebAuthnPurposeRegister     = "register"
+	WebAuthnPurposeLogin        = "login"         // passwordless login
+	WebAuthnPurposeSecondFactor = "second_factor" // after the password
+)
+
+// BeforeCreate hook to generate UUID before creating a new challenge
+func (c *WebAuthnChallenge) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName returns the table name for the WebAuthnChallenge model
+func (WebAuthnChallenge) TableName() string {
+	return "webauthn_challenges"
+}
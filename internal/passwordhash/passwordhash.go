@@ -0,0 +1,214 @@
+// Package passwordhash hashes and verifies local passwords. New hashes use
+// argon2id in PHC string format ($argon2id$v=19$m=...,t=...,p=...$salt$hash)
+// or bcrypt, as configured; existing hashes of either algorithm verify
+// regardless of the configuration, and NeedsRehash tells when a hash should
+// be replaced after a successful login because the configured algorithm or
+// parameters changed.
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported algorithms
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Default argon2id parameters (OWASP recommendation) and bcrypt cost
+const (
+	DefaultArgon2Memory      = 19456 // KiB
+	DefaultArgon2Time        = 2
+	DefaultArgon2Parallelism = 1
+	DefaultBcryptCost        = bcrypt.DefaultCost
+)
+
+const (
+	saltLength = 16
+	keyLength  = 32
+
+	// Limits for parameters read from stored hashes
+	maxArgon2Memory = 4 * 1024 * 1024 // 4 GiB in KiB
+	maxArgon2Time   = 100
+)
+
+// ErrUnknownFormat is returned for hashes of no supported algorithm
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Hasher hashes passwords with the configured algorithm and parameters
+type Hasher struct {
+	algorithm   string
+	memory      uint32
+	time        uint32
+	parallelism uint8
+	bcryptCost  int
+}
+
+// New creates a hasher from cfg; zero values fall back to the defaults
+func New(cfg *config.PasswordHashConfig) *Hasher {
+	h := &Hasher{
+		algorithm:   AlgorithmArgon2id,
+		memory:      DefaultArgon2Memory,
+		time:        DefaultArgon2Time,
+		parallelism: DefaultArgon2Parallelism,
+		bcryptCost:  DefaultBcryptCost,
+	}
+	if cfg == nil {
+		return h
+	}
+	if strings.EqualFold(cfg.Algorithm, AlgorithmBcrypt) {
+		h.algorithm = AlgorithmBcrypt
+	}
+	if cfg.Argon2Memory > 0 {
+		h.memory = uint32(cfg.Argon2Memory)
+	}
+	if cfg.Argon2Time > 0 {
+		h.time = uint32(cfg.Argon2Time)
+	}
+	if cfg.Argon2Parallelism > 0 && cfg.Argon2Parallelism <= 255 {
+		h.parallelism = uint8(cfg.Argon2Parallelism)
+	}
+	if cfg.BcryptCost >= bcrypt.MinCost && cfg.BcryptCost <= bcrypt.MaxCost {
+		h.bcryptCost = cfg.BcryptCost
+	}
+	return h
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultHasher = New(nil)
+)
+
+// Configure sets the hasher used by Default, typically once at startup
+func Configure(cfg *config.PasswordHashConfig) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultHasher = New(cfg)
+}
+
+// Default returns the hasher set by Configure, argon2id with the default
+// parameters if it was not called
+func Default() *Hasher {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultHasher
+}
+
+// Algorithm returns the algorithm of new hashes
+func (h *Hasher) Algorithm() string {
+	return h.algorithm
+}
+
+// Hash hashes a password
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.parallelism, keyLength)
+	return encodeArgon2id(argon2Params{memory: h.memory, time: h.time, parallelism: h.parallelism}, salt, key), nil
+}
+
+// Verify checks a password against a hash of any supported algorithm. It
+// returns an error only for hashes it cannot parse.
+func (h *Hasher) Verify(password, hash string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1, nil
+	case isBcrypt(hash):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, ErrUnknownFormat
+	}
+}
+
+// NeedsRehash checks if a hash was created with another algorithm or other
+// parameters than the hasher's, so it should be replaced on the next login
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if h.algorithm == AlgorithmBcrypt {
+		if !isBcrypt(hash) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.bcryptCost
+	}
+
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.memory != h.memory || params.time != h.time || params.parallelism != h.parallelism ||
+		len(salt) < saltLength || len(key) != keyLength
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2Params struct {
+	memory      uint32
+	time        uint32
+	parallelism uint8
+}
+
+func encodeArgon2id(params argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.memory, params.time, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != AlgorithmArgon2id {
+		return params, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	var memory, time uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	if memory == 0 || memory > maxArgon2Memory || time == 0 || time > maxArgon2Time || parallelism == 0 {
+		return params, nil, nil, fmt.Errorf("argon2 parameters out of range %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return params, nil, nil, errors.New("invalid argon2 salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2 hash")
+	}
+	return argon2Params{memory: memory, time: time, parallelism: parallelism}, salt, key, nil
+}
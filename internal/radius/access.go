@@ -0,0 +1,116 @@
+package radius
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+)
+
+// handleAccess answers Access-Request packets with PAP credentials
+func (s *Server) handleAccess(w radius.ResponseWriter, r *radius.Request) {
+	if r.Code != radius.CodeAccessRequest {
+		return
+	}
+
+	username := rfc2865.UserName_GetString(r.Packet)
+	password := rfc2865.UserPassword_GetString(r.Packet)
+	if username == "" || password == "" {
+		s.reject(w, r, "Invalid credentials")
+		return
+	}
+
+	user, err := s.vpnAuth.Authenticate(username, password, rfc2865.CallingStationID_GetString(r.Packet))
+	if err != nil {
+		message, denied := denialMessage(err)
+		if !denied {
+			// Let the NAS retry instead of rejecting a valid user
+			s.logger.Error("RADIUS authentication failed", "username", username, "error", err)
+			return
+		}
+		s.logger.Info("RADIUS login denied", "username", username, "reason", message)
+		s.reject(w, r, message)
+		return
+	}
+
+	response := r.Response(radius.CodeAccessAccept)
+	if ip := net.ParseIP(user.VpnIP).To4(); ip != nil {
+		_ = rfc2865.FramedIPAddress_Set(response, ip)
+	}
+	routes, err := s.userRoutes(user)
+	if err != nil {
+		s.logger.Error("RADIUS failed to load user routes", "username", username, "error", err)
+		return
+	}
+	for _, route := range routes {
+		_ = rfc2865.FramedRoute_AddString(response, route)
+	}
+
+	if err := w.Write(response); err != nil {
+		s.logger.Error("RADIUS failed to send response", "error", err)
+		return
+	}
+	s.logger.Info("RADIUS login accepted", "username", username, "routes", len(routes))
+}
+
+func (s *Server) reject(w radius.ResponseWriter, r *radius.Request, message string) {
+	response := r.Response(radius.CodeAccessReject)
+	_ = rfc2865.ReplyMessage_SetString(response, message)
+	if err := w.Write(response); err != nil {
+		s.logger.Error("RADIUS failed to send response", "error", err)
+	}
+}
+
+// userRoutes returns a Framed-Route value for each IPv4 network of the user's groups
+func (s *Server) userRoutes(user *models.User) ([]string, error) {
+	groups, err := s.groups.GetUserGroupsWithNetworks(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var routes []string
+	for _, group := range groups {
+		for _, network := range group.Networks {
+			_, ipNet, err := net.ParseCIDR(network.CIDR)
+			if err != nil || ipNet.IP.To4() == nil {
+				continue
+			}
+			cidr := ipNet.String()
+			if seen[cidr] {
+				continue
+			}
+			seen[cidr] = true
+			routes = append(routes, fmt.Sprintf("%s 0.0.0.0 1", cidr))
+		}
+	}
+	return routes, nil
+}
+
+// denialMessage returns the Reply-Message for a denied login, matching the
+// messages of the VPN Auth API. It returns false for errors that are not a
+// denial, such as an unreachable LDAP server.
+func denialMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		return "Invalid credentials", true
+	case errors.Is(err, services.ErrUserInactive):
+		return "User account is disabled", true
+	case errors.Is(err, services.ErrUserNotYetValid):
+		return "User account is not yet valid", true
+	case errors.Is(err, services.ErrUserExpired):
+		return "User account has expired", true
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return "Monthly traffic quota exceeded", true
+	case errors.Is(err, services.ErrVpnLoginBlocked):
+		return "Login blocked by anomaly detection", true
+	case errors.Is(err, services.ErrAccountLocked):
+		return "Account temporarily locked", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,186 @@
+package radius
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+	"layeh.com/radius/rfc2869"
+)
+
+// accountingRecord holds the attributes of an Accounting-Request
+type accountingRecord struct {
+	status        rfc2866.AcctStatusType
+	username      string
+	acctSessionID string
+	vpnIP         string
+	clientIP      string
+	eventTime     time.Time
+	sessionTime   time.Duration
+	bytesReceived int64
+	bytesSent     int64
+	cause         rfc2866.AcctTerminateCause
+}
+
+func parseAccountingRecord(p *radius.Packet) *accountingRecord {
+	eventTime := rfc2869.EventTimestamp_Get(p)
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+	eventTime = eventTime.Add(-time.Duration(rfc2866.AcctDelayTime_Get(p)) * time.Second)
+
+	record := &accountingRecord{
+		status:        rfc2866.AcctStatusType_Get(p),
+		username:      rfc2865.UserName_GetString(p),
+		acctSessionID: rfc2866.AcctSessionID_GetString(p),
+		clientIP:      rfc2865.CallingStationID_GetString(p),
+		eventTime:     eventTime,
+		sessionTime:   time.Duration(rfc2866.AcctSessionTime_Get(p)) * time.Second,
+		bytesReceived: int64(rfc2869.AcctInputGigawords_Get(p))<<32 | int64(rfc2866.AcctInputOctets_Get(p)),
+		bytesSent:     int64(rfc2869.AcctOutputGigawords_Get(p))<<32 | int64(rfc2866.AcctOutputOctets_Get(p)),
+		cause:         rfc2866.AcctTerminateCause_Get(p),
+	}
+	if ip := rfc2865.FramedIPAddress_Get(p); ip != nil {
+		record.vpnIP = ip.String()
+	}
+	return record
+}
+
+// handleAccounting records Accounting-Request packets as VPN sessions and
+// traffic stats. The response is only sent once the record is stored, so the
+// NAS retransmits requests that failed.
+func (s *Server) handleAccounting(w radius.ResponseWriter, r *radius.Request) {
+	if r.Code != radius.CodeAccountingRequest {
+		return
+	}
+
+	record := parseAccountingRecord(r.Packet)
+	var err error
+	switch record.status {
+	case rfc2866.AcctStatusType_Value_Start:
+		err = s.accountingStart(record)
+	case rfc2866.AcctStatusType_Value_InterimUpdate:
+		err = s.accountingInterim(record)
+	case rfc2866.AcctStatusType_Value_Stop:
+		err = s.accountingStop(record)
+	}
+
+	if errors.Is(err, services.ErrUserNotFound) {
+		// Retrying will not help, acknowledge the request
+		s.logger.Warn("RADIUS accounting for unknown user", "username", record.username, "acct_session_id", record.acctSessionID)
+	} else if err != nil {
+		s.logger.Error("RADIUS accounting failed", "username", record.username, "acct_session_id", record.acctSessionID, "error", err)
+		return
+	}
+
+	if err := w.Write(r.Response(radius.CodeAccountingResponse)); err != nil {
+		s.logger.Error("RADIUS failed to send response", "error", err)
+	}
+}
+
+func (s *Server) accountingStart(record *accountingRecord) error {
+	// Retransmitted Accounting-Start
+	if _, err := s.sessions.GetActiveSessionByAcctSessionID(record.acctSessionID); err == nil {
+		return nil
+	}
+	_, err := s.createSession(record, record.eventTime)
+	return err
+}
+
+func (s *Server) accountingInterim(record *accountingRecord) error {
+	session, err := s.findOrCreateSession(record)
+	if err != nil {
+		return err
+	}
+	return s.recordTraffic(session, record)
+}
+
+func (s *Server) accountingStop(record *accountingRecord) error {
+	session, err := s.findOrCreateSession(record)
+	if err != nil {
+		return err
+	}
+	if err := s.recordTraffic(session, record); err != nil {
+		return err
+	}
+
+	// Reload the running totals updated by the traffic stats
+	session, err = s.sessions.GetByID(session.ID)
+	if err != nil {
+		return err
+	}
+	_, err = s.sessions.Disconnect(session.ID, &dto.UpdateVpnSessionRequest{
+		DisconnectedAt:   record.eventTime,
+		BytesReceived:    session.BytesReceived,
+		BytesSent:        session.BytesSent,
+		DisconnectReason: disconnectReason(record.cause),
+	})
+	return err
+}
+
+// findOrCreateSession returns the active session of the record, creating it
+// when the Accounting-Start was lost
+func (s *Server) findOrCreateSession(record *accountingRecord) (*models.VpnSession, error) {
+	if session, err := s.sessions.GetActiveSessionByAcctSessionID(record.acctSessionID); err == nil {
+		return session, nil
+	}
+	return s.createSession(record, record.eventTime.Add(-record.sessionTime))
+}
+
+func (s *Server) createSession(record *accountingRecord, connectedAt time.Time) (*models.VpnSession, error) {
+	user, err := s.users.GetByUsername(record.username)
+	if err != nil {
+		return nil, err
+	}
+
+	vpnIP := record.vpnIP
+	if vpnIP == "" {
+		vpnIP = user.VpnIP
+	}
+
+	return s.sessions.Create(&dto.CreateVpnSessionRequest{
+		UserID:        user.ID,
+		VpnIP:         vpnIP,
+		ClientIP:      record.clientIP,
+		ConnectedAt:   connectedAt,
+		AcctSessionID: record.acctSessionID,
+	})
+}
+
+// recordTraffic stores the session's cumulative counters as traffic stats
+func (s *Server) recordTraffic(session *models.VpnSession, record *accountingRecord) error {
+	_, err := s.stats.CreateBatch(&dto.CreateVpnTrafficStatsBatchRequest{
+		Timestamp: &record.eventTime,
+		Entries: []dto.VpnTrafficStatsBatchEntry{{
+			SessionID:     session.ID,
+			BytesReceived: &record.bytesReceived,
+			BytesSent:     &record.bytesSent,
+		}},
+	})
+	return err
+}
+
+// disconnectReason maps an Acct-Terminate-Cause to a disconnect reason
+func disconnectReason(cause rfc2866.AcctTerminateCause) *models.DisconnectReason {
+	var reason models.DisconnectReason
+	switch cause {
+	case 0:
+		return nil
+	case rfc2866.AcctTerminateCause_Value_UserRequest:
+		reason = models.DisconnectReasonUserRequest
+	case rfc2866.AcctTerminateCause_Value_IdleTimeout, rfc2866.AcctTerminateCause_Value_SessionTimeout:
+		reason = models.DisconnectReasonTimeout
+	case rfc2866.AcctTerminateCause_Value_AdminReset:
+		reason = models.DisconnectReasonAdminAction
+	case rfc2866.AcctTerminateCause_Value_AdminReboot, rfc2866.AcctTerminateCause_Value_NASReboot:
+		reason = models.DisconnectReasonServerShutdown
+	default:
+		reason = models.DisconnectReasonError
+	}
+	return &reason
+}
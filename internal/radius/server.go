@@ -0,0 +1,171 @@
+// Package radius implements a RADIUS server for OpenVPN servers using
+// radiusplugin: Access-Request with PAP is authenticated like the VPN Auth
+// API, accounting requests are recorded as VPN sessions and traffic stats.
+package radius
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	applogger "github.com/tldr-it-stepankutaj/openvpn-mng/internal/logger"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"layeh.com/radius"
+)
+
+// shutdownTimeout limits waiting for requests in progress on Stop
+const shutdownTimeout = 5 * time.Second
+
+// nasClient is a configured NAS with its parsed address range
+type nasClient struct {
+	name    string
+	network *net.IPNet
+	secret  []byte
+}
+
+// Server answers RADIUS authentication and accounting requests
+type Server struct {
+	config   *config.RADIUSConfig
+	clients  []nasClient
+	logger   *slog.Logger
+	vpnAuth  *services.VpnAuthService
+	users    *services.UserService
+	sessions *services.VpnSessionService
+	stats    *services.VpnTrafficStatsService
+	groups   *services.GroupService
+
+	authConn   net.PacketConn
+	acctConn   net.PacketConn
+	authServer *radius.PacketServer
+	acctServer *radius.PacketServer
+}
+
+// NewServer creates a new RADIUS server. With a security config, failed
+// logins count towards the account lockout.
+func NewServer(cfg *config.RADIUSConfig, authCfg *config.AuthConfig, anomalyCfg *config.AnomalyConfig, securityCfg ...*config.SecurityConfig) (*Server, error) {
+	clients := make([]nasClient, 0, len(cfg.Clients))
+	for _, c := range cfg.Clients {
+		if c.Secret == "" {
+			return nil, fmt.Errorf("radius client %q has no secret", c.Address)
+		}
+		network, err := parseAddress(c.Address)
+		if err != nil {
+			return nil, fmt.Errorf("radius client %q: %w", c.Address, err)
+		}
+		clients = append(clients, nasClient{name: c.Name, network: network, secret: []byte(c.Secret)})
+	}
+
+	logger := applogger.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	vpnAuth := services.NewVpnAuthService(authCfg, anomalyCfg)
+	if len(securityCfg) > 0 && securityCfg[0] != nil {
+		vpnAuth = services.NewVpnAuthServiceWithSecurity(authCfg, anomalyCfg, securityCfg[0])
+	}
+
+	return &Server{
+		config:   cfg,
+		clients:  clients,
+		logger:   logger,
+		vpnAuth:  vpnAuth,
+		users:    services.NewUserService(),
+		sessions: services.NewVpnSessionService(),
+		stats:    services.NewVpnTrafficStatsService(),
+		groups:   services.NewGroupService(),
+	}, nil
+}
+
+// parseAddress parses an IP address or CIDR range
+func parseAddress(address string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		_, network, err := net.ParseCIDR(address)
+		return network, err
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Start listens on the authentication and accounting addresses
+func (s *Server) Start() error {
+	authConn, err := net.ListenPacket("udp", s.config.AuthAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.config.AuthAddr, err)
+	}
+	acctConn, err := net.ListenPacket("udp", s.config.AcctAddr)
+	if err != nil {
+		_ = authConn.Close()
+		return fmt.Errorf("failed to listen on %s: %w", s.config.AcctAddr, err)
+	}
+	s.authConn, s.acctConn = authConn, acctConn
+
+	s.authServer = &radius.PacketServer{
+		SecretSource: s,
+		Handler:      radius.HandlerFunc(s.handleAccess),
+	}
+	s.acctServer = &radius.PacketServer{
+		SecretSource: s,
+		Handler:      radius.HandlerFunc(s.handleAccounting),
+	}
+	go s.serve(s.authServer, authConn)
+	go s.serve(s.acctServer, acctConn)
+
+	return nil
+}
+
+func (s *Server) serve(server *radius.PacketServer, conn net.PacketConn) {
+	if err := server.Serve(conn); err != nil && err != radius.ErrServerShutdown {
+		s.logger.Error("RADIUS server stopped", "address", conn.LocalAddr().String(), "error", err)
+	}
+}
+
+// Stop stops the server, waiting briefly for requests in progress
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if s.authServer != nil {
+		_ = s.authServer.Shutdown(ctx)
+	}
+	if s.acctServer != nil {
+		_ = s.acctServer.Shutdown(ctx)
+	}
+}
+
+// AuthAddr returns the address the authentication server listens on
+func (s *Server) AuthAddr() net.Addr {
+	return s.authConn.LocalAddr()
+}
+
+// AcctAddr returns the address the accounting server listens on
+func (s *Server) AcctAddr() net.Addr {
+	return s.acctConn.LocalAddr()
+}
+
+// RADIUSSecret returns the shared secret of the NAS at remoteAddr. Requests
+// from unknown addresses get no secret and are discarded.
+func (s *Server) RADIUSSecret(_ context.Context, remoteAddr net.Addr) ([]byte, error) {
+	udpAddr, ok := remoteAddr.(*net.UDPAddr)
+	if !ok {
+		return nil, nil
+	}
+	for _, c := range s.clients {
+		if c.network.Contains(udpAddr.IP) {
+			return c.secret, nil
+		}
+	}
+	s.logger.Warn("RADIUS request from unknown client", "address", udpAddr.IP.String())
+	return nil, nil
+}
@@ -1,13 +1,17 @@
 package routes
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/handlers"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/mailer"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
 )
 
 // SetupRoutes sets up all routes
@@ -20,26 +24,71 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, rateLimiter *middleware.Rate
 
 	// Handlers
 	authHandler := handlers.NewAuthHandler(&cfg.Auth, blacklist, &cfg.Security)
-	userHandler := handlers.NewUserHandler(&cfg.VPN)
+	userHandler := handlers.NewUserHandler(&cfg.VPN, &cfg.Auth.PasswordPolicy)
 	groupHandler := handlers.NewGroupHandler()
 	networkHandler := handlers.NewNetworkHandler()
 	vpnSessionHandler := handlers.NewVpnSessionHandler()
-	vpnAuthHandler := handlers.NewVpnAuthHandler()
+	vpnAuthHandler := handlers.NewVpnAuthHandler(&cfg.Auth, &cfg.Anomaly, &cfg.Security, rateLimiter)
 	vpnIPHandler := handlers.NewVPNIPHandler(&cfg.VPN)
 	vpnClientConfigHandler := handlers.NewVpnClientConfigHandler()
 	auditHandler := handlers.NewAuditHandler()
-	webHandler := handlers.NewWebHandler()
+	reportHandler := handlers.NewReportHandler()
+	securityAlertHandler := handlers.NewSecurityAlertHandler(&cfg.Anomaly)
+	apiKeyHandler := handlers.NewAPIKeyHandler()
+	jwksHandler := handlers.NewJWKSHandler(&cfg.Auth)
+	webHandler := handlers.NewWebHandler(&cfg.Auth, &cfg.Mail)
+	loginSessionHandler := handlers.NewLoginSessionHandler(&cfg.Auth, blacklist)
+
+	// Self-service password reset needs email
+	var passwordResetHandler *handlers.PasswordResetHandler
+	if cfg.Mail.Enabled {
+		passwordResetHandler = handlers.NewPasswordResetHandler(&cfg.Auth, cfg.Server.PublicURL, mailer.New(&cfg.Mail))
+	}
+
+	// Security key and passkey login
+	var webAuthnHandler *handlers.WebAuthnHandler
+	if cfg.Auth.WebAuthn.Enabled {
+		webAuthnHandler = handlers.NewWebAuthnHandler(&cfg.Auth)
+	}
+
+	// OpenID Connect single sign-on
+	var oidcHandler *handlers.OIDCHandler
+	if cfg.Auth.OIDC.Enabled {
+		oidcHandler = handlers.NewOIDCHandler(&cfg.Auth)
+	}
+
+	// API keys of service accounts
+	apiKeys := services.NewAPIKeyService()
+
+	// Public keys verifying access tokens, for other services
+	r.GET("/.well-known/jwks.json", jwksHandler.JWKS)
 
 	// Web routes (HTML pages)
 	webRoutes := r.Group("/")
+	webRoutes.Use(middleware.SecurityHeaders(&cfg.Security.Headers, strings.HasPrefix(cfg.Server.PublicURL, "https://")))
 	{
 		// Public routes
 		webRoutes.GET("/", webHandler.IndexPage)
 		webRoutes.GET("/login", webHandler.LoginPage)
+		if passwordResetHandler != nil {
+			webRoutes.GET("/forgot-password", passwordResetHandler.ForgotPasswordPage)
+			webRoutes.GET("/reset-password", passwordResetHandler.ResetPasswordPage)
+		}
+
+		// OpenID Connect single sign-on
+		if oidcHandler != nil {
+			if rateLimiter != nil {
+				webRoutes.GET("/auth/oidc/login", rateLimiter.Middleware(), oidcHandler.Login)
+				webRoutes.GET("/auth/oidc/callback", rateLimiter.Middleware(), oidcHandler.Callback)
+			} else {
+				webRoutes.GET("/auth/oidc/login", oidcHandler.Login)
+				webRoutes.GET("/auth/oidc/callback", oidcHandler.Callback)
+			}
+		}
 
 		// Protected web routes
 		protected := webRoutes.Group("/")
-		protected.Use(middleware.AuthMiddleware(&cfg.Auth, blacklist))
+		protected.Use(authHandler.RefreshSession, middleware.AuthMiddleware(&cfg.Auth, blacklist), middleware.EnsureCSRFCookie(&cfg.Auth.Cookies))
 		{
 			protected.GET("/dashboard", webHandler.DashboardPage)
 			protected.GET("/users", webHandler.UsersPage)
@@ -47,9 +96,13 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, rateLimiter *middleware.Rate
 			protected.GET("/groups", webHandler.GroupsPage)
 			protected.GET("/networks", webHandler.NetworksPage)
 			protected.GET("/audit", webHandler.AuditPage)
+			protected.GET("/security-alerts", webHandler.SecurityAlertsPage)
 			protected.GET("/sessions", webHandler.SessionsPage)
 			protected.GET("/profile", webHandler.ProfilePage)
 			protected.GET("/vpn-settings", webHandler.VpnSettingsPage)
+			if oidcHandler != nil {
+				protected.GET("/auth/oidc/link/complete", oidcHandler.LinkComplete)
+			}
 		}
 	}
 
@@ -65,34 +118,71 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, rateLimiter *middleware.Rate
 				} else {
 					auth.POST("/login", authHandler.Login)
 				}
+				auth.POST("/refresh", authHandler.Refresh)
+
+				// Password reset (public)
+				if passwordResetHandler != nil {
+					if rateLimiter != nil {
+						auth.POST("/password/forgot", rateLimiter.Middleware(), passwordResetHandler.ForgotPassword)
+						auth.POST("/password/reset", rateLimiter.Middleware(), passwordResetHandler.ResetPassword)
+					} else {
+						auth.POST("/password/forgot", passwordResetHandler.ForgotPassword)
+						auth.POST("/password/reset", passwordResetHandler.ResetPassword)
+					}
+				}
+
+				// Security key login (public)
+				if webAuthnHandler != nil {
+					if rateLimiter != nil {
+						auth.POST("/webauthn/login/begin", rateLimiter.Middleware(), webAuthnHandler.BeginLogin)
+						auth.POST("/webauthn/login/finish", rateLimiter.Middleware(), webAuthnHandler.FinishLogin)
+					} else {
+						auth.POST("/webauthn/login/begin", webAuthnHandler.BeginLogin)
+						auth.POST("/webauthn/login/finish", webAuthnHandler.FinishLogin)
+					}
+				}
 			}
 
 			// Protected API routes
 			protected := api.Group("/")
+			if rateLimiter != nil {
+				protected.Use(rateLimiter.PolicyMiddleware(middleware.RateLimitAPI))
+			}
 			protected.Use(middleware.AuthMiddleware(&cfg.Auth, blacklist))
 			{
 				// Auth
 				protected.POST("/auth/logout", authHandler.Logout)
 				protected.GET("/auth/me", authHandler.Me)
 
-				// Users
+				// Web and API logins
+				protected.GET("/auth/sessions", loginSessionHandler.List)
+				protected.DELETE("/auth/sessions", loginSessionHandler.RevokeOthers)
+				protected.DELETE("/auth/sessions/:id", loginSessionHandler.Revoke)
+				protected.GET("/users/:id/sessions", middleware.RequireAdmin(), loginSessionHandler.ListUserSessions)
+				protected.DELETE("/users/:id/sessions", middleware.RequireAdmin(), loginSessionHandler.RevokeUserSessions)
+				protected.DELETE("/users/:id/sessions/:session_id", middleware.RequireAdmin(), loginSessionHandler.RevokeUserSession)
+
+				// Security keys of the current user
+				if webAuthnHandler != nil {
+					protected.POST("/auth/webauthn/register/begin", webAuthnHandler.BeginRegistration)
+					protected.POST("/auth/webauthn/register/finish", webAuthnHandler.FinishRegistration)
+					protected.GET("/auth/webauthn/credentials", webAuthnHandler.ListCredentials)
+					protected.PUT("/auth/webauthn/credentials/:id", webAuthnHandler.RenameCredential)
+					protected.DELETE("/auth/webauthn/credentials/:id", webAuthnHandler.DeleteCredential)
+					protected.DELETE("/users/:id/webauthn-credentials", middleware.RequireAdmin(), webAuthnHandler.ResetUserCredentials)
+				}
+
+				// Single sign-on identity of the current user
+				if oidcHandler != nil {
+					protected.POST("/auth/oidc/link", oidcHandler.StartLink)
+				}
+
+				// Users - own profile (provisioning endpoints are registered below)
 				users := protected.Group("/users")
 				{
 					// Profile endpoints (must be before /:id to avoid conflict)
 					users.PUT("/profile", userHandler.UpdateProfile)
 					users.PUT("/password", userHandler.UpdatePassword)
-
-					// CRUD endpoints with role-based access
-					users.GET("", userHandler.List)
-					users.POST("", middleware.RequireManagerOrAdmin(), userHandler.Create)
-					users.GET("/:id", userHandler.Get)
-					users.PUT("/:id", userHandler.Update)
-					users.DELETE("/:id", middleware.RequireAdmin(), userHandler.Delete)
-
-					// User groups management
-					users.GET("/:id/groups", userHandler.GetGroups)
-					users.POST("/:id/groups", middleware.RequireRole(models.RoleAdmin, models.RoleManager), userHandler.AddGroup)
-					users.DELETE("/:id/groups/:group_id", middleware.RequireRole(models.RoleAdmin, models.RoleManager), userHandler.RemoveGroup)
 				}
 
 				// Groups
@@ -142,22 +232,18 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, rateLimiter *middleware.Rate
 					vpn.PUT("/sessions/:id/disconnect", vpnSessionHandler.Disconnect)
 					vpn.POST("/traffic-stats", vpnSessionHandler.CreateTrafficStats)
 
-					// Read endpoints - Admin only
+					// Admin only (read endpoints are registered below)
 					vpnAdmin := vpn.Group("")
 					vpnAdmin.Use(middleware.RequireAdmin())
 					{
-						vpnAdmin.GET("/sessions", vpnSessionHandler.List)
-						vpnAdmin.GET("/sessions/active", vpnSessionHandler.GetActive)
-						vpnAdmin.GET("/sessions/:id", vpnSessionHandler.Get)
-						vpnAdmin.GET("/stats", vpnSessionHandler.GetStats)
-						vpnAdmin.GET("/stats/users", vpnSessionHandler.GetUserStats)
-						vpnAdmin.GET("/traffic-stats", vpnSessionHandler.ListTrafficStats)
-
 						// VPN Client Config management - Admin only
 						vpnAdmin.GET("/client-config", vpnClientConfigHandler.Get)
 						vpnAdmin.PUT("/client-config", vpnClientConfigHandler.Update)
 						vpnAdmin.GET("/client-config/preview", vpnClientConfigHandler.Preview)
 						vpnAdmin.GET("/client-config/default-template", vpnClientConfigHandler.GetDefaultTemplate)
+
+						// VPN authentication cache counters
+						vpnAdmin.GET("/auth-cache", vpnAuthHandler.GetAuthCacheStats)
 					}
 				}
 
@@ -173,28 +259,83 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, rateLimiter *middleware.Rate
 					audit.GET("/user/:user_id", auditHandler.GetByUser)
 					audit.GET("/:id", auditHandler.Get)
 				}
+
+				// API keys (Admin only)
+				keys := protected.Group("/api-keys")
+				keys.Use(middleware.RequireAdmin())
+				{
+					keys.GET("", apiKeyHandler.List)
+					keys.POST("", apiKeyHandler.Create)
+					keys.GET("/:id", apiKeyHandler.Get)
+					keys.POST("/:id/revoke", apiKeyHandler.Revoke)
+					keys.POST("/:id/rotate", apiKeyHandler.Rotate)
+				}
+
+				// Security alerts (Admin only)
+				security := protected.Group("/security/alerts")
+				security.Use(middleware.RequireAdmin())
+				{
+					security.GET("", securityAlertHandler.List)
+					security.GET("/:id", securityAlertHandler.Get)
+					security.PUT("/:id/acknowledge", securityAlertHandler.Acknowledge)
+				}
 			}
-		}
 
-		// VPN Auth routes (token-based authentication for OpenVPN server)
-		if cfg.API.VpnToken != "" {
-			vpnAuth := api.Group("/vpn-auth")
-			vpnAuth.Use(middleware.VpnTokenAuth(cfg.API.VpnToken))
+			// User provisioning (also API keys with the users:provision scope)
+			provisioning := api.Group("/users")
+			if rateLimiter != nil {
+				provisioning.Use(rateLimiter.PolicyMiddleware(middleware.RateLimitAPI))
+			}
+			provisioning.Use(middleware.AuthOrAPIKey(&cfg.Auth, blacklist, apiKeys, models.APIKeyScopeUsers))
 			{
-				if rateLimiter != nil {
-					vpnAuth.POST("/authenticate", rateLimiter.Middleware(), vpnAuthHandler.Authenticate)
-				} else {
-					vpnAuth.POST("/authenticate", vpnAuthHandler.Authenticate)
-				}
-				vpnAuth.GET("/users", vpnAuthHandler.ListAllUsers)
-				vpnAuth.GET("/users/:id", vpnAuthHandler.GetUserByID)
-				vpnAuth.GET("/users/:id/routes", vpnAuthHandler.GetUserRoutes)
-				vpnAuth.GET("/users/by-username/:username", vpnAuthHandler.GetUserByUsername)
-				vpnAuth.POST("/sessions", vpnAuthHandler.CreateSession)
-				vpnAuth.PUT("/sessions/:id/disconnect", vpnAuthHandler.DisconnectSession)
+				// CRUD endpoints with role-based access
+				provisioning.GET("", userHandler.List)
+				provisioning.POST("", middleware.RequireManagerOrAdmin(), userHandler.Create)
+				provisioning.GET("/:id", userHandler.Get)
+				provisioning.PUT("/:id", userHandler.Update)
+				provisioning.DELETE("/:id", middleware.RequireAdmin(), userHandler.Delete)
+
+				// User groups management
+				provisioning.GET("/:id/quota", userHandler.GetQuota)
+				provisioning.GET("/:id/groups", userHandler.GetGroups)
+				provisioning.POST("/:id/groups", middleware.RequireRole(models.RoleAdmin, models.RoleManager), userHandler.AddGroup)
+				provisioning.DELETE("/:id/groups/:group_id", middleware.RequireRole(models.RoleAdmin, models.RoleManager), userHandler.RemoveGroup)
+			}
+
+			// Reporting - Admin only (also API keys with the reports:read scope)
+			reporting := api.Group("/")
+			if rateLimiter != nil {
+				reporting.Use(rateLimiter.PolicyMiddleware(middleware.RateLimitAPI))
+			}
+			reporting.Use(middleware.AuthOrAPIKey(&cfg.Auth, blacklist, apiKeys, models.APIKeyScopeReports), middleware.RequireAdmin())
+			{
+				reporting.GET("/vpn/sessions", vpnSessionHandler.List)
+				reporting.GET("/vpn/sessions/active", vpnSessionHandler.GetActive)
+				reporting.GET("/vpn/sessions/:id", vpnSessionHandler.Get)
+				reporting.GET("/vpn/stats", vpnSessionHandler.GetStats)
+				reporting.GET("/vpn/stats/users", vpnSessionHandler.GetUserStats)
+				reporting.GET("/vpn/traffic-stats", vpnSessionHandler.ListTrafficStats)
+				reporting.GET("/vpn/traffic-series", vpnSessionHandler.GetTrafficSeries)
+				reporting.GET("/reports/top-talkers", reportHandler.GetTopTalkers)
 			}
 		}
 
+		// VPN Auth routes (vpn_token or API keys with the vpn-auth scope, for OpenVPN server)
+		vpnAuth := api.Group("/vpn-auth")
+		vpnAuth.Use(middleware.VpnTokenAuth(cfg.API.VpnToken, apiKeys))
+		{
+			// Rate limited by the handler per end user IP, the caller is the VPN server
+			vpnAuth.POST("/authenticate", vpnAuthHandler.Authenticate)
+			vpnAuth.GET("/users", vpnAuthHandler.ListAllUsers)
+			vpnAuth.GET("/users/:id", vpnAuthHandler.GetUserByID)
+			vpnAuth.GET("/users/:id/routes", vpnAuthHandler.GetUserRoutes)
+			vpnAuth.GET("/users/by-username/:username", vpnAuthHandler.GetUserByUsername)
+			vpnAuth.POST("/sessions", vpnAuthHandler.CreateSession)
+			vpnAuth.PUT("/sessions/:id/disconnect", vpnAuthHandler.DisconnectSession)
+			vpnAuth.GET("/sessions/over-quota", vpnAuthHandler.GetSessionsOverQuota)
+			vpnAuth.POST("/traffic-stats/batch", vpnAuthHandler.CreateTrafficStatsBatch)
+		}
+
 		// Swagger documentation (if enabled)
 		if cfg.API.SwaggerEnabled {
 			swagger := r.Group("/swagger")
@@ -0,0 +1,538 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	applogger "github.com/tldr-it-stepankutaj/openvpn-mng/internal/logger"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSecurityAlertNotFound = apperror.NotFound("Security alert not found")
+)
+
+const (
+	// anomalyCheckInterval is how often traffic spikes are checked in the background
+	anomalyCheckInterval = 15 * time.Minute
+	// loginHistorySize limits how many past sessions are used for the login hour profile
+	loginHistorySize = 500
+	// unusualHourAlertWindow suppresses repeated unusual hour alerts for a user
+	unusualHourAlertWindow = 24 * time.Hour
+	// trafficBaselineWindow is the history a traffic spike is compared against
+	trafficBaselineWindow = 7 * 24 * time.Hour
+	// trafficBaselineMinHours is the number of active hours needed for a baseline
+	trafficBaselineMinHours = 24
+	// failedAttemptRetention is how long failed login attempts are kept
+	failedAttemptRetention = 30 * 24 * time.Hour
+)
+
+// AnomalyService detects suspicious VPN logins and traffic and records them as security alerts
+type AnomalyService struct {
+	config *config.AnomalyConfig
+	stopCh chan struct{}
+}
+
+// NewAnomalyService creates a new anomaly detection service
+func NewAnomalyService(cfg *config.AnomalyConfig) *AnomalyService {
+	return &AnomalyService{
+		config: cfg,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Enabled reports whether anomaly detection is turned on
+func (s *AnomalyService) Enabled() bool {
+	return s.config != nil && s.config.Enabled
+}
+
+// Start periodically checks traffic spikes and prunes old login attempts in the background
+func (s *AnomalyService) Start() {
+	go s.loop()
+}
+
+// Stop stops the background goroutine
+func (s *AnomalyService) Stop() {
+	close(s.stopCh)
+}
+
+func (s *AnomalyService) loop() {
+	ticker := time.NewTicker(anomalyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.runAndLog()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+func (s *AnomalyService) runAndLog() {
+	now := time.Now()
+	alerts, err := s.CheckTrafficSpikes(now)
+	if err != nil {
+		applogger.Error("Traffic spike check failed", "error", err)
+	} else if len(alerts) > 0 {
+		applogger.Warn("Traffic spikes detected", "count", len(alerts))
+	}
+	if err := s.PruneAttempts(now); err != nil {
+		applogger.Error("Failed to prune login attempts", "error", err)
+	}
+}
+
+// blocks reports whether findings of the given severity deny authentication
+func (s *AnomalyService) blocks(severity models.AlertSeverity) bool {
+	threshold := models.AlertSeverity(s.config.BlockSeverity).Level()
+	return threshold > 0 && severity.Level() >= threshold
+}
+
+// RecordAttempt stores a VPN authentication attempt
+func (s *AnomalyService) RecordAttempt(username string, userID *uuid.UUID, sourceIP string, success bool, at time.Time) error {
+	return database.GetDB().Create(&models.VpnLoginAttempt{
+		Username:  username,
+		UserID:    userID,
+		SourceIP:  sourceIP,
+		Success:   success,
+		CreatedAt: at,
+	}).Error
+}
+
+// PruneAttempts deletes failed login attempts past their retention. Successful
+// attempts are kept as they make up the history of known client IPs.
+func (s *AnomalyService) PruneAttempts(now time.Time) error {
+	return database.GetDB().
+		Where("success = ? AND created_at < ?", false, now.Add(-failedAttemptRetention)).
+		Delete(&models.VpnLoginAttempt{}).Error
+}
+
+// failedUsernames returns the number of distinct usernames that failed to
+// authenticate from sourceIP within the stuffing window before now
+func (s *AnomalyService) failedUsernames(sourceIP string, now time.Time) (int64, error) {
+	since := now.Add(-time.Duration(s.config.StuffingWindow) * time.Minute)
+	var count int64
+	err := database.GetDB().Model(&models.VpnLoginAttempt{}).
+		Where("source_ip = ? AND success = ? AND created_at > ? AND created_at <= ?", sourceIP, false, since, now).
+		Distinct("username").
+		Count(&count).Error
+	return count, err
+}
+
+// IsSourceBlocked reports whether logins from sourceIP are denied because of
+// ongoing credential stuffing
+func (s *AnomalyService) IsSourceBlocked(sourceIP string, now time.Time) (bool, error) {
+	if !s.Enabled() || sourceIP == "" || !s.blocks(models.AlertSeverityHigh) {
+		return false, nil
+	}
+	count, err := s.failedUsernames(sourceIP, now)
+	if err != nil {
+		return false, err
+	}
+	return count >= int64(s.config.StuffingUsernames), nil
+}
+
+// CheckFailedLogin raises a credential stuffing alert when failed logins for
+// many different usernames come from the same IP within the stuffing window.
+// At most one alert is raised per IP and window.
+func (s *AnomalyService) CheckFailedLogin(username, sourceIP string, now time.Time) (*models.SecurityAlert, error) {
+	if !s.Enabled() || sourceIP == "" {
+		return nil, nil
+	}
+
+	count, err := s.failedUsernames(sourceIP, now)
+	if err != nil || count < int64(s.config.StuffingUsernames) {
+		return nil, err
+	}
+
+	window := time.Duration(s.config.StuffingWindow) * time.Minute
+	var existing int64
+	if err := database.GetDB().Model(&models.SecurityAlert{}).
+		Where("type = ? AND source_ip = ? AND observed_at > ?", models.AlertTypeCredentialStuffing, sourceIP, now.Add(-window)).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	alert := &models.SecurityAlert{
+		Type:       models.AlertTypeCredentialStuffing,
+		Severity:   models.AlertSeverityHigh,
+		Username:   username,
+		SourceIP:   sourceIP,
+		Message:    fmt.Sprintf("Failed logins for %d different usernames from %s within %d minutes", count, sourceIP, s.config.StuffingWindow),
+		ObservedAt: now,
+		Blocked:    s.blocks(models.AlertSeverityHigh),
+	}
+	if err := database.GetDB().Create(alert).Error; err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// loginFinding is an anomaly found while checking a successful login
+type loginFinding struct {
+	alertType models.AlertType
+	severity  models.AlertSeverity
+	message   string
+	sourceIP  string        // restricts matching of earlier alerts to the IP
+	window    time.Duration // restricts matching of earlier alerts to this window, 0 = any time
+}
+
+// CheckLogin checks a login with valid credentials for anomalies and records
+// new findings as alerts. It returns true when the login must be denied: a
+// finding reaches the block severity, or the user has an unacknowledged
+// traffic spike alert that does. Acknowledging an alert approves it, e.g. a
+// new client IP is not reported again once its alert was acknowledged.
+func (s *AnomalyService) CheckLogin(user *models.User, sourceIP string, now time.Time) (bool, error) {
+	if !s.Enabled() {
+		return false, nil
+	}
+
+	var findings []loginFinding
+	if sourceIP != "" {
+		finding, err := s.checkNewIP(user, sourceIP)
+		if err != nil {
+			return false, err
+		}
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	finding, err := s.checkUnusualHour(user, now)
+	if err != nil {
+		return false, err
+	}
+	if finding != nil {
+		findings = append(findings, *finding)
+	}
+
+	blocked := false
+	for _, f := range findings {
+		previous, err := s.latestAlert(user.ID, f, now)
+		if err != nil {
+			return false, err
+		}
+		if previous != nil && previous.Acknowledged {
+			continue
+		}
+
+		block := s.blocks(f.severity)
+		blocked = blocked || block
+		if previous != nil {
+			continue
+		}
+
+		if err := database.GetDB().Create(&models.SecurityAlert{
+			Type:       f.alertType,
+			Severity:   f.severity,
+			UserID:     &user.ID,
+			Username:   user.Username,
+			SourceIP:   sourceIP,
+			Message:    f.message,
+			ObservedAt: now,
+			Blocked:    block,
+		}).Error; err != nil {
+			return false, err
+		}
+	}
+
+	if !blocked && s.blocks(models.AlertSeverityMedium) {
+		var pending int64
+		if err := database.GetDB().Model(&models.SecurityAlert{}).
+			Where("type = ? AND user_id = ? AND acknowledged = ?", models.AlertTypeTrafficSpike, user.ID, false).
+			Count(&pending).Error; err != nil {
+			return false, err
+		}
+		blocked = pending > 0
+	}
+
+	return blocked, nil
+}
+
+// latestAlert returns the most recent alert matching a finding, or nil
+func (s *AnomalyService) latestAlert(userID uuid.UUID, f loginFinding, now time.Time) (*models.SecurityAlert, error) {
+	query := database.GetDB().Where("type = ? AND user_id = ?", f.alertType, userID)
+	if f.sourceIP != "" {
+		query = query.Where("source_ip = ?", f.sourceIP)
+	}
+	if f.window > 0 {
+		query = query.Where("observed_at > ?", now.Add(-f.window))
+	}
+
+	var alert models.SecurityAlert
+	err := query.Order("created_at DESC").First(&alert).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// checkNewIP reports a login from a client IP the user has never connected
+// from. The first login of a user is not reported.
+func (s *AnomalyService) checkNewIP(user *models.User, sourceIP string) (*loginFinding, error) {
+	db := database.GetDB()
+
+	var history int64
+	if err := db.Model(&models.VpnSession{}).
+		Where("user_id = ? AND client_ip <> ''", user.ID).
+		Count(&history).Error; err != nil {
+		return nil, err
+	}
+	var attempts int64
+	if err := db.Model(&models.VpnLoginAttempt{}).
+		Where("user_id = ? AND success = ? AND source_ip <> ''", user.ID, true).
+		Count(&attempts).Error; err != nil {
+		return nil, err
+	}
+	if history+attempts == 0 {
+		return nil, nil
+	}
+
+	var seen int64
+	if err := db.Model(&models.VpnSession{}).
+		Where("user_id = ? AND client_ip = ?", user.ID, sourceIP).
+		Count(&seen).Error; err != nil {
+		return nil, err
+	}
+	if seen == 0 {
+		if err := db.Model(&models.VpnLoginAttempt{}).
+			Where("user_id = ? AND success = ? AND source_ip = ?", user.ID, true, sourceIP).
+			Count(&seen).Error; err != nil {
+			return nil, err
+		}
+	}
+	if seen > 0 {
+		return nil, nil
+	}
+
+	return &loginFinding{
+		alertType: models.AlertTypeNewIP,
+		severity:  models.AlertSeverityMedium,
+		message:   fmt.Sprintf("Login from new client IP %s", sourceIP),
+		sourceIP:  sourceIP,
+	}, nil
+}
+
+// checkUnusualHour reports a login at an hour of day (±1 hour) that is rare
+// in the user's session history. Users with too little history are skipped.
+func (s *AnomalyService) checkUnusualHour(user *models.User, now time.Time) (*loginFinding, error) {
+	var connectedAt []time.Time
+	if err := database.GetDB().Model(&models.VpnSession{}).
+		Where("user_id = ? AND connected_at < ?", user.ID, now).
+		Order("connected_at DESC").
+		Limit(loginHistorySize).
+		Pluck("connected_at", &connectedAt).Error; err != nil {
+		return nil, err
+	}
+	if len(connectedAt) < s.config.MinHistorySessions {
+		return nil, nil
+	}
+
+	hour := now.Local().Hour()
+	near := 0
+	for _, t := range connectedAt {
+		d := t.Local().Hour() - hour
+		if d < 0 {
+			d = -d
+		}
+		if d > 12 {
+			d = 24 - d
+		}
+		if d <= 1 {
+			near++
+		}
+	}
+
+	ratio := float64(near) / float64(len(connectedAt))
+	if ratio >= s.config.UnusualHourRatio {
+		return nil, nil
+	}
+
+	return &loginFinding{
+		alertType: models.AlertTypeUnusualHour,
+		severity:  models.AlertSeverityLow,
+		message:   fmt.Sprintf("Login at unusual hour %02d:00, %d of %d previous sessions started within an hour of it", hour, near, len(connectedAt)),
+		window:    unusualHourAlertWindow,
+	}, nil
+}
+
+// CheckTrafficSpikes compares each user's traffic in the last rolled-up hour
+// with their average active hour over the preceding week and raises an alert
+// when it exceeds the baseline by the configured factor. Each user and hour
+// is reported once.
+func (s *AnomalyService) CheckTrafficSpikes(now time.Time) ([]models.SecurityAlert, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+
+	watermark, err := GetTrafficRollupWatermark()
+	if err != nil || watermark.IsZero() {
+		return nil, err
+	}
+	hour := watermark.UTC().Add(-time.Hour)
+
+	db := database.GetDB()
+	var current []models.VpnTrafficHourly
+	if err := db.Where("bucket_start = ?", hour).Find(&current).Error; err != nil {
+		return nil, err
+	}
+
+	var alerts []models.SecurityAlert
+	for _, row := range current {
+		total := row.BytesReceived + row.BytesSent
+		if total < s.config.TrafficSpikeMinBytes {
+			continue
+		}
+
+		var baseline struct {
+			Hours int64
+			Bytes int64
+		}
+		if err := db.Model(&models.VpnTrafficHourly{}).
+			Select("COUNT(*) as hours, COALESCE(SUM(bytes_received + bytes_sent), 0) as bytes").
+			Where("user_id = ? AND bucket_start >= ? AND bucket_start < ?", row.UserID, hour.Add(-trafficBaselineWindow), hour).
+			Scan(&baseline).Error; err != nil {
+			return nil, err
+		}
+		if baseline.Hours < trafficBaselineMinHours {
+			continue
+		}
+		average := float64(baseline.Bytes) / float64(baseline.Hours)
+		if float64(total) < average*s.config.TrafficSpikeFactor {
+			continue
+		}
+
+		var existing int64
+		if err := db.Model(&models.SecurityAlert{}).
+			Where("type = ? AND user_id = ? AND observed_at = ?", models.AlertTypeTrafficSpike, row.UserID, hour).
+			Count(&existing).Error; err != nil {
+			return nil, err
+		}
+		if existing > 0 {
+			continue
+		}
+
+		var user models.User
+		if err := db.Unscoped().Select("id, username").First(&user, "id = ?", row.UserID).Error; err != nil {
+			return nil, err
+		}
+
+		userID := row.UserID
+		alert := models.SecurityAlert{
+			Type:       models.AlertTypeTrafficSpike,
+			Severity:   models.AlertSeverityMedium,
+			UserID:     &userID,
+			Username:   user.Username,
+			Message:    fmt.Sprintf("Transferred %d bytes in one hour, %.1fx the average of %.0f bytes", total, float64(total)/average, average),
+			ObservedAt: hour,
+			Blocked:    s.blocks(models.AlertSeverityMedium),
+		}
+		if err := db.Create(&alert).Error; err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, nil
+}
+
+// List returns a paginated list of security alerts with optional filters
+func (s *AnomalyService) List(filter *dto.SecurityAlertFilter) ([]models.SecurityAlert, int64, error) {
+	var alerts []models.SecurityAlert
+	var total int64
+
+	query := database.GetDB().Model(&models.SecurityAlert{})
+
+	// Apply filters
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Type != nil {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Severity != nil {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.SourceIP != "" {
+		query = query.Where("source_ip = ?", filter.SourceIP)
+	}
+	if filter.Acknowledged != nil {
+		query = query.Where("acknowledged = ?", *filter.Acknowledged)
+	}
+	if filter.StartDate != nil {
+		query = query.Where("created_at >= ?", filter.StartDate)
+	}
+	if filter.EndDate != nil {
+		query = query.Where("created_at <= ?", filter.EndDate)
+	}
+
+	// Count total
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Apply pagination
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	pageSize := filter.PageSize
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	offset := (page - 1) * pageSize
+
+	if err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&alerts).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return alerts, total, nil
+}
+
+// GetByID returns a security alert by ID
+func (s *AnomalyService) GetByID(id uuid.UUID) (*models.SecurityAlert, error) {
+	var alert models.SecurityAlert
+	if err := database.GetDB().First(&alert, "id = ?", id).Error; err != nil {
+		return nil, ErrSecurityAlertNotFound
+	}
+	return &alert, nil
+}
+
+// Acknowledge marks a security alert as reviewed by an administrator
+func (s *AnomalyService) Acknowledge(id uuid.UUID, acknowledgedBy uuid.UUID) (*models.SecurityAlert, error) {
+	alert, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Acknowledged {
+		return alert, nil
+	}
+
+	now := time.Now()
+	alert.Acknowledged = true
+	alert.AcknowledgedBy = &acknowledgedBy
+	alert.AcknowledgedAt = &now
+	if err := database.GetDB().Model(alert).Updates(map[string]interface{}{
+		"acknowledged":    true,
+		"acknowledged_by": acknowledgedBy,
+		"acknowledged_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
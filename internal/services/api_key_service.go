@@ -0,0 +1,292 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPIKeyNotFound     = apperror.NotFound("API key not found")
+	ErrInvalidAPIKey      = apperror.Unauthorized("Invalid API key")
+	ErrAPIKeyRevoked      = apperror.Unauthorized("API key has been revoked")
+	ErrAPIKeyExpired      = apperror.Unauthorized("API key has expired")
+	ErrAPIKeyIPNotAllowed = apperror.Forbidden("API key is not allowed from this IP address")
+	ErrAPIKeyScope        = apperror.Forbidden("API key does not grant access to this endpoint")
+	ErrInvalidAllowedIP   = apperror.Validation("Invalid IP address or CIDR in allowed_ips")
+	ErrAPIKeyExpiryPast   = apperror.Validation("Expiry must be in the future")
+	ErrAPIKeyNotRotatable = apperror.Validation("Revoked API keys cannot be rotated")
+)
+
+const (
+	// apiKeyPrefix marks keys issued by this application
+	apiKeyPrefix = "ovm_"
+	// apiKeyDisplayLength is the number of leading characters stored to recognize a key
+	apiKeyDisplayLength = 12
+	// apiKeyLastUsedInterval limits how often last use is written for a busy key
+	apiKeyLastUsedInterval = time.Minute
+)
+
+// APIKeyService handles API keys of service accounts
+type APIKeyService struct{}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{}
+}
+
+// List returns all API keys, newest first
+func (s *APIKeyService) List() ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := database.GetDB().Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(keys))
+	for i := range keys {
+		ids[i] = keys[i].CreatedBy
+	}
+	var creators []models.User
+	if err := database.GetDB().Where("id IN ?", ids).Find(&creators).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*models.User, len(creators))
+	for i := range creators {
+		byID[creators[i].ID] = &creators[i]
+	}
+	for i := range keys {
+		keys[i].Creator = byID[keys[i].CreatedBy]
+	}
+	return keys, nil
+}
+
+// GetByID gets an API key by ID
+func (s *APIKeyService) GetByID(id uuid.UUID) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := database.GetDB().First(&key, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	if err := loadCreator(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Create creates a new API key and returns it together with the key itself,
+// which is not stored and cannot be retrieved later
+func (s *APIKeyService) Create(req *dto.CreateAPIKeyRequest, createdBy uuid.UUID) (*models.APIKey, string, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrAPIKeyExpiryPast
+	}
+	for _, address := range req.AllowedIPs {
+		if _, err := parseIPOrCIDR(address); err != nil {
+			return nil, "", ErrInvalidAllowedIP
+		}
+	}
+
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !scope.IsValid() {
+			return nil, "", apperror.Validation("Invalid scope: " + string(scope))
+		}
+		if !containsFold(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &models.APIKey{
+		Name:       req.Name,
+		Prefix:     secret[:apiKeyDisplayLength],
+		KeyHash:    hashSecret(secret),
+		Scopes:     strings.Join(scopes, ","),
+		AllowedIPs: strings.Join(req.AllowedIPs, ","),
+		ExpiresAt:  req.ExpiresAt,
+		CreatedBy:  createdBy,
+	}
+	if err := database.GetDB().Create(key).Error; err != nil {
+		return nil, "", err
+	}
+
+	key, err = s.GetByID(key.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// Revoke revokes an API key. Revoked keys are kept for auditing.
+func (s *APIKeyService) Revoke(id uuid.UUID) (*models.APIKey, error) {
+	key, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.IsRevoked() {
+		return key, nil
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	if err := database.GetDB().Model(key).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Rotate replaces the key of an API key, keeping its name, scopes and
+// restrictions. The previous key stops working immediately.
+func (s *APIKeyService) Rotate(id uuid.UUID) (*models.APIKey, string, error) {
+	key, err := s.GetByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if key.IsRevoked() {
+		return nil, "", ErrAPIKeyNotRotatable
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key.Prefix = secret[:apiKeyDisplayLength]
+	key.KeyHash = hashSecret(secret)
+	if err := database.GetDB().Model(key).Updates(map[string]interface{}{
+		"prefix":   key.Prefix,
+		"key_hash": key.KeyHash,
+	}).Error; err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// ValidateAPIKey checks that a key is valid, may be used from clientIP and
+// grants scope, and records its use
+func (s *APIKeyService) ValidateAPIKey(secret, clientIP string, scope models.APIKeyScope) (*models.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := database.GetDB().First(&key, "key_hash = ?", hashSecret(secret)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if err := loadCreator(&key); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.IsRevoked() {
+		return nil, ErrAPIKeyRevoked
+	}
+	if key.IsExpired(now) {
+		return nil, ErrAPIKeyExpired
+	}
+	if !ipAllowed(key.AllowedIPList(), clientIP) {
+		return nil, ErrAPIKeyIPNotAllowed
+	}
+	if !key.HasScope(scope) {
+		return nil, ErrAPIKeyScope
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedInterval || key.LastUsedIP != clientIP {
+		key.LastUsedAt = &now
+		key.LastUsedIP = clientIP
+		if err := database.GetDB().Model(&key).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// loadCreator loads the user who created the key; it stays nil when the user was deleted
+func loadCreator(key *models.APIKey) error {
+	var creator models.User
+	err := database.GetDB().First(&creator, "id = ?", key.CreatedBy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	key.Creator = &creator
+	return nil
+}
+
+// generateAPIKey returns a new random key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret returns the hex SHA-256 hash a random secret, such as an API
+// key, refresh token or password reset token, is stored as. The secrets are
+// random, so a fast hash is sufficient.
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// parseIPOrCIDR parses an IP address or CIDR range
+func parseIPOrCIDR(address string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		_, network, err := net.ParseCIDR(address)
+		return network, err
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, errors.New("invalid IP address")
+	}
+	bits := 8 * len(ip)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// ipAllowed checks if clientIP is in one of the allowed IPs or CIDRs. An
+// empty list allows any IP.
+func ipAllowed(allowed []string, clientIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, address := range allowed {
+		if network, err := parseIPOrCIDR(address); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
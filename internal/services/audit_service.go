@@ -152,6 +152,7 @@ func (s *AuditService) GetActions() []models.AuditAction {
 		models.AuditActionDelete,
 		models.AuditActionLogin,
 		models.AuditActionLogout,
+		models.AuditActionPasswordReset,
 	}
 }
 
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,9 +10,10 @@ import (
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/jwtkeys"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/passwordhash"
 )
 
 var (
@@ -24,43 +26,55 @@ var (
 
 // AuthService provides authentication services
 type AuthService struct {
-	config   *config.AuthConfig
-	security *config.SecurityConfig
+	config        *config.AuthConfig
+	security      *config.SecurityConfig
+	authenticator Authenticator
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(cfg *config.AuthConfig) *AuthService {
 	return &AuthService{
-		config: cfg,
+		config:        cfg,
+		authenticator: NewAuthenticator(cfg),
 	}
 }
 
 // NewAuthServiceWithSecurity creates a new auth service with security config for lockout
 func NewAuthServiceWithSecurity(cfg *config.AuthConfig, sec *config.SecurityConfig) *AuthService {
 	return &AuthService{
-		config:   cfg,
-		security: sec,
+		config:        cfg,
+		security:      sec,
+		authenticator: NewAuthenticator(cfg),
 	}
 }
 
 // Authenticate authenticates a user and returns a JWT token
 func (s *AuthService) Authenticate(username, password string) (string, *models.User, error) {
+	// Users provisioned from a directory on first login do not exist yet
+	var existing *models.User
 	var user models.User
-	if err := database.GetDB().Where("username = ?", username).First(&user).Error; err != nil {
-		return "", nil, ErrInvalidCredentials
+	if err := database.GetDB().Where("username = ?", username).First(&user).Error; err == nil {
+		existing = &user
 	}
 
 	// Check account lockout
-	if s.security != nil && user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
-		remaining := int(time.Until(*user.LockedUntil).Seconds())
+	if s.security != nil && existing != nil && existing.LockedUntil != nil && existing.LockedUntil.After(time.Now()) {
+		remaining := int(time.Until(*existing.LockedUntil).Seconds())
 		return "", nil, apperror.TooManyRequests(
 			fmt.Sprintf("Account temporarily locked. Try again in %d seconds", remaining))
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		s.recordFailedLogin(&user)
-		return "", nil, ErrInvalidCredentials
+	authenticated, err := s.authenticator.Authenticate(username, password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			if existing != nil {
+				recordFailedLogin(s.security, existing)
+			}
+			return "", nil, ErrInvalidCredentials
+		}
+		return "", nil, err
 	}
+	user = *authenticated
 
 	// Check if user is active and within validity period
 	if err := s.validateUserAccess(&user); err != nil {
@@ -68,7 +82,7 @@ func (s *AuthService) Authenticate(username, password string) (string, *models.U
 	}
 
 	// Reset failed attempts on successful login
-	s.resetFailedLogin(&user)
+	resetFailedLogin(s.security, &user)
 
 	// Generate JWT token
 	token, err := s.generateToken(&user)
@@ -79,25 +93,35 @@ func (s *AuthService) Authenticate(username, password string) (string, *models.U
 	return token, &user, nil
 }
 
-// recordFailedLogin increments failed login attempts and locks account if threshold exceeded
-func (s *AuthService) recordFailedLogin(user *models.User) {
-	if s.security == nil {
+// IssueToken checks that a user signed in by an external identity provider
+// may log in and returns a JWT token for them
+func (s *AuthService) IssueToken(user *models.User) (string, error) {
+	if err := s.validateUserAccess(user); err != nil {
+		return "", err
+	}
+	return s.generateToken(user)
+}
+
+// recordFailedLogin increments failed login attempts and locks account if
+// threshold exceeded. Web and VPN logins share the counter.
+func recordFailedLogin(sec *config.SecurityConfig, user *models.User) {
+	if sec == nil {
 		return
 	}
 	user.FailedLoginAttempts++
 	updates := map[string]interface{}{
 		"failed_login_attempts": user.FailedLoginAttempts,
 	}
-	if user.FailedLoginAttempts >= s.security.LockoutMaxAttempts {
-		lockUntil := time.Now().Add(time.Duration(s.security.LockoutDuration) * time.Minute)
+	if user.FailedLoginAttempts >= sec.LockoutMaxAttempts {
+		lockUntil := time.Now().Add(time.Duration(sec.LockoutDuration) * time.Minute)
 		updates["locked_until"] = lockUntil
 	}
 	database.GetDB().Model(user).Updates(updates)
 }
 
 // resetFailedLogin clears failed login attempts and lockout
-func (s *AuthService) resetFailedLogin(user *models.User) {
-	if s.security == nil {
+func resetFailedLogin(sec *config.SecurityConfig, user *models.User) {
+	if sec == nil {
 		return
 	}
 	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
@@ -138,33 +162,34 @@ func (s *AuthService) validateUserAccess(user *models.User) error {
 	return nil
 }
 
-// generateToken generates a JWT token for a user
+// generateToken generates a short-lived JWT access token for a user
 func (s *AuthService) generateToken(user *models.User) (string, error) {
 	claims := &middleware.Claims{
-		UserID:   user.ID.String(),
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:                 user.ID.String(),
+		Username:               user.Username,
+		Role:                   user.Role,
+		PasswordChangeRequired: NewPasswordPolicy(&s.config.PasswordPolicy).RequiresChange(user),
+		WebAuthnSetupRequired:  NewWebAuthnService(&s.config.WebAuthn).SetupRequired(user),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(s.config.TokenExpiry) * time.Hour)),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.AccessTokenDuration())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	return jwtkeys.For(s.config).Sign(claims)
 }
 
-// HashPassword hashes a password
+// HashPassword hashes a password with the configured algorithm
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return passwordhash.Default().Hash(password)
 }
 
-// VerifyPassword verifies a password against a hash
+// VerifyPassword verifies a password against an argon2id or bcrypt hash
 func VerifyPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	ok, err := passwordhash.Default().Verify(password, hash)
+	return err == nil && ok
 }
 
 // GetUserByID returns a user by ID
@@ -176,16 +201,7 @@ func GetUserByID(id uuid.UUID) (*models.User, error) {
 	return &user, nil
 }
 
-// AuthenticateUser authenticates a user by username and password (for VPN without JWT)
+// AuthenticateUser authenticates a local user by username and password (for VPN without JWT)
 func AuthenticateUser(username, password string) (*models.User, error) {
-	var user models.User
-	if err := database.GetDB().Where("username = ?", username).First(&user).Error; err != nil {
-		return nil, ErrInvalidCredentials
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, ErrInvalidCredentials
-	}
-
-	return &user, nil
+	return (&LocalAuthenticator{}).Authenticate(username, password)
 }
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	applogger "github.com/tldr-it-stepankutaj/openvpn-mng/internal/logger"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/passwordhash"
+)
+
+// Authenticator verifies user credentials and returns the matching local user.
+// Implementations return ErrInvalidCredentials for wrong credentials; other
+// errors mean the credentials could not be checked.
+type Authenticator interface {
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// NewAuthenticator returns the authenticator configured in cfg: LDAP with
+// local users kept on their local password, or local only
+func NewAuthenticator(cfg *config.AuthConfig) Authenticator {
+	local := &LocalAuthenticator{}
+	if cfg != nil && cfg.LDAP.Enabled {
+		return NewLDAPAuthenticator(&cfg.LDAP, local)
+	}
+	return local
+}
+
+// LocalAuthenticator verifies passwords against the hashes in the users table
+type LocalAuthenticator struct{}
+
+// Authenticate checks the password of a local user. A hash of an outdated
+// algorithm or with outdated parameters is replaced by a new one.
+func (a *LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	if err := database.GetDB().Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.HasLocalPassword() {
+		return nil, ErrInvalidCredentials
+	}
+
+	hasher := passwordhash.Default()
+	if ok, err := hasher.Verify(password, user.Password); err != nil || !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if hasher.NeedsRehash(user.Password) {
+		rehashPassword(hasher, &user, password)
+	}
+
+	return &user, nil
+}
+
+// rehashPassword stores a new hash of the verified password. Failures are
+// only logged, the login goes on with the old hash.
+func rehashPassword(hasher *passwordhash.Hasher, user *models.User, password string) {
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		applogger.Warn("Failed to rehash password", "user_id", user.ID, "error", err)
+		return
+	}
+	// Only replace the hash that was verified, a concurrent password change wins
+	result := database.GetDB().Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		UpdateColumn("password", hash)
+	if result.Error != nil {
+		applogger.Warn("Failed to store rehashed password", "user_id", user.ID, "error", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		user.Password = hash
+	}
+}
+
+// externalProfile is the user profile asserted by a directory or identity provider
+type externalProfile struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Role      models.Role // empty when no role is mapped
+}
+
+// provisionExternalUser creates a user of source on first login, or refreshes
+// the profile and mapped role of an existing user of that source. Existing
+// users of other sources are returned unchanged.
+func provisionExternalUser(user *models.User, username string, source models.AuthSource, profile externalProfile, autoCreate bool, defaultRole string) (*models.User, error) {
+	if profile.Email == "" {
+		// Emails are unique and required; use a reserved domain as placeholder
+		profile.Email = username + "@" + string(source) + ".invalid"
+	}
+
+	db := database.GetDB()
+	if user == nil {
+		if !autoCreate {
+			return nil, ErrInvalidCredentials
+		}
+
+		password, err := unusablePassword()
+		if err != nil {
+			return nil, err
+		}
+		role := profile.Role
+		if role == "" {
+			role = models.Role(defaultRole)
+		}
+		user = &models.User{
+			Username:   username,
+			Password:   password,
+			FirstName:  profile.FirstName,
+			LastName:   profile.LastName,
+			Email:      profile.Email,
+			Role:       role,
+			IsActive:   true,
+			AuthSource: source,
+			CreatedBy:  uuid.Nil,
+		}
+		if err := db.Create(user).Error; err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	if user.AuthSource != source {
+		return user, nil
+	}
+
+	updates := map[string]interface{}{}
+	if user.FirstName != profile.FirstName {
+		updates["first_name"] = profile.FirstName
+		user.FirstName = profile.FirstName
+	}
+	if user.LastName != profile.LastName {
+		updates["last_name"] = profile.LastName
+		user.LastName = profile.LastName
+	}
+	if user.Email != profile.Email {
+		updates["email"] = profile.Email
+		user.Email = profile.Email
+	}
+	if profile.Role != "" && user.Role != profile.Role {
+		updates["role"] = profile.Role
+		user.Role = profile.Role
+	}
+	if len(updates) > 0 {
+		if err := db.Model(user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// mapRole returns the highest role mapped from values (group DNs or claim values)
+func mapRole(mapping map[string]string, values []string) models.Role {
+	rank := map[models.Role]int{models.RoleUser: 1, models.RoleManager: 2, models.RoleAdmin: 3}
+	var role models.Role
+	for key, mapped := range mapping {
+		if !containsFold(values, key) {
+			continue
+		}
+		r := models.Role(strings.ToUpper(mapped))
+		if rank[r] > rank[role] {
+			role = r
+		}
+	}
+	return role
+}
+
+// unusablePassword returns a random password hash nobody knows the password of
+func unusablePassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return HashPassword(hex.EncodeToString(b))
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
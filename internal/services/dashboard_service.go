@@ -85,51 +85,67 @@ func (s *DashboardService) GetAdminStats() (*DashboardStats, error) {
 	return stats, nil
 }
 
-// getTrafficStats returns daily traffic stats for the last N days
+// getTrafficStats returns daily traffic stats for the last N days, read from the
+// daily rollups plus raw traffic stats newer than the rollup watermark
 func (s *DashboardService) getTrafficStats(days int) ([]DailyTrafficStats, error) {
-	startDate := time.Now().AddDate(0, 0, -days)
+	now := time.Now()
+	firstDay := dayStart(now.AddDate(0, 0, -(days - 1)))
 
 	type DayStats struct {
-		Day           string
+		BucketStart   time.Time
 		BytesReceived int64
 		BytesSent     int64
 	}
 	var results []DayStats
 
-	// Query to get daily aggregated traffic
-	dbType := database.GetDB().Dialector.Name()
-	var dateFormat string
-	if dbType == "postgres" {
-		dateFormat = "TO_CHAR(disconnected_at, 'YYYY-MM-DD')"
-	} else {
-		// MySQL
-		dateFormat = "DATE_FORMAT(disconnected_at, '%Y-%m-%d')"
-	}
-
-	query := database.GetDB().Table("vpn_sessions").
-		Select(dateFormat+" as day, COALESCE(SUM(bytes_received), 0) as bytes_received, COALESCE(SUM(bytes_sent), 0) as bytes_sent").
-		Where("disconnected_at IS NOT NULL AND disconnected_at >= ?", startDate).
-		Group("day").
-		Order("day ASC")
-
-	if err := query.Scan(&results).Error; err != nil {
+	if err := database.GetDB().Model(&models.VpnTrafficDaily{}).
+		Select("bucket_start, COALESCE(SUM(bytes_received), 0) as bytes_received, COALESCE(SUM(bytes_sent), 0) as bytes_sent").
+		Where("bucket_start >= ?", firstDay).
+		Group("bucket_start").
+		Scan(&results).Error; err != nil {
 		return nil, err
 	}
 
-	// Convert to response format and fill in missing days with zeros
 	statsMap := make(map[string]DailyTrafficStats)
 	for _, r := range results {
-		statsMap[r.Day] = DailyTrafficStats{
-			Date:          r.Day,
+		date := r.BucketStart.In(time.Local).Format("2006-01-02")
+		statsMap[date] = DailyTrafficStats{
+			Date:          date,
 			BytesReceived: r.BytesReceived,
 			BytesSent:     r.BytesSent,
 		}
 	}
 
-	// Generate all days in range
+	// Add traffic that has not been rolled up yet
+	watermark, err := GetTrafficRollupWatermark()
+	if err != nil {
+		return nil, err
+	}
+	tailStart := firstDay
+	if watermark.After(tailStart) {
+		tailStart = dayStart(watermark)
+	}
+	for day := tailStart; day.Before(now); day = nextDay(day) {
+		since := day
+		if watermark.After(since) {
+			since = watermark
+		}
+		totals, err := SumTraffic(nil, since, nextDay(day))
+		if err != nil {
+			return nil, err
+		}
+		date := day.In(time.Local).Format("2006-01-02")
+		st := statsMap[date]
+		st.Date = date
+		st.BytesReceived += totals.BytesReceived
+		st.BytesSent += totals.BytesSent
+		statsMap[date] = st
+	}
+
+	// Generate all days in range, filling in missing days with zeros
 	stats := make([]DailyTrafficStats, 0, days)
 	for i := days - 1; i >= 0; i-- {
-		date := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
 		if s, ok := statsMap[date]; ok {
 			stats = append(stats, s)
 		} else {
@@ -32,9 +32,10 @@ func (s *GroupService) Create(req *dto.CreateGroupRequest, createdBy uuid.UUID)
 	}
 
 	group := &models.Group{
-		Name:        req.Name,
-		Description: req.Description,
-		CreatedBy:   createdBy,
+		Name:                req.Name,
+		Description:         req.Description,
+		MonthlyTrafficQuota: req.MonthlyTrafficQuota,
+		CreatedBy:           createdBy,
 	}
 
 	if err := database.GetDB().Create(group).Error; err != nil {
@@ -71,19 +72,30 @@ func (s *GroupService) Update(id uuid.UUID, req *dto.UpdateGroupRequest, updated
 	if req.Description != "" {
 		updates["description"] = req.Description
 	}
+	if req.MonthlyTrafficQuota != nil {
+		updates["monthly_traffic_quota"] = *req.MonthlyTrafficQuota
+	}
 
 	updates["updated_by"] = updatedBy
 
 	if err := database.GetDB().Model(group).Updates(updates).Error; err != nil {
 		return nil, err
 	}
+	if req.MonthlyTrafficQuota != nil {
+		// Cached VPN logins of members skipped the old quota
+		vpnAuthCache.Clear()
+	}
 
 	return s.GetByID(id)
 }
 
 // Delete soft deletes a group
 func (s *GroupService) Delete(id uuid.UUID) error {
-	return database.GetDB().Delete(&models.Group{}, "id = ?", id).Error
+	if err := database.GetDB().Delete(&models.Group{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	vpnAuthCache.Clear()
+	return nil
 }
 
 // List lists groups with pagination
@@ -121,12 +133,20 @@ func (s *GroupService) AddUserToGroup(groupID, userID, createdBy uuid.UUID) erro
 		CreatedBy: createdBy,
 	}
 
-	return database.GetDB().Create(userGroup).Error
+	if err := database.GetDB().Create(userGroup).Error; err != nil {
+		return err
+	}
+	vpnAuthCache.Invalidate(userID)
+	return nil
 }
 
 // RemoveUserFromGroup removes a user from a group
 func (s *GroupService) RemoveUserFromGroup(groupID, userID uuid.UUID) error {
-	return database.GetDB().Delete(&models.UserGroup{}, "group_id = ? AND user_id = ?", groupID, userID).Error
+	if err := database.GetDB().Delete(&models.UserGroup{}, "group_id = ? AND user_id = ?", groupID, userID).Error; err != nil {
+		return err
+	}
+	vpnAuthCache.Invalidate(userID)
+	return nil
 }
 
 // GetGroupUsers gets all users in a group
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLDAPUnavailable = apperror.ServiceUnavailable("Directory server is unavailable")
+)
+
+// LDAPAuthenticator authenticates users against an LDAP / Active Directory
+// server and provisions them just in time. Users with a local auth source are
+// delegated to the local authenticator.
+type LDAPAuthenticator struct {
+	config *config.LDAPConfig
+	local  Authenticator
+}
+
+// NewLDAPAuthenticator creates a new LDAP authenticator
+func NewLDAPAuthenticator(cfg *config.LDAPConfig, local Authenticator) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		config: cfg,
+		local:  local,
+	}
+}
+
+// Authenticate binds to the directory as the user and creates or updates the local user
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	// An empty password would be an unauthenticated bind, which servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var existing *models.User
+	var user models.User
+	err := database.GetDB().Where("username = ?", username).First(&user).Error
+	switch {
+	case err == nil:
+		if user.AuthSource != models.AuthSourceLDAP {
+			return a.local.Authenticate(username, password)
+		}
+		existing = &user
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	entry, err := a.bind(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.provision(existing, username, entry)
+}
+
+// connect opens a connection to the directory, upgraded with StartTLS if configured
+func (a *LDAPAuthenticator) connect() (*ldap.Conn, error) {
+	tlsConfig, err := a.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(a.config.Timeout) * time.Second
+	conn, err := ldap.DialURL(a.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	if a.config.StartTLS && !strings.HasPrefix(strings.ToLower(a.config.URL), "ldaps://") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// tlsConfig returns the TLS configuration for ldaps:// and StartTLS
+func (a *LDAPAuthenticator) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: a.config.InsecureSkipVerify,
+	}
+	if u, err := url.Parse(a.config.URL); err == nil {
+		cfg.ServerName = u.Hostname()
+	}
+
+	if a.config.CACertFile != "" {
+		pem, err := os.ReadFile(a.config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", a.config.CACertFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// attributes returns the entry attributes read from the directory
+func (a *LDAPAuthenticator) attributes() []string {
+	return []string{
+		a.config.FirstNameAttribute,
+		a.config.LastNameAttribute,
+		a.config.EmailAttribute,
+		a.config.GroupAttribute,
+	}
+}
+
+// bind verifies the credentials with a simple bind (user_dn_template) or by
+// searching the user and binding as the entry found, and returns the user's entry
+func (a *LDAPAuthenticator) bind(username, password string) (*ldap.Entry, error) {
+	conn, err := a.connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	defer conn.Close()
+
+	if a.config.UserDNTemplate != "" {
+		dn := fmt.Sprintf(a.config.UserDNTemplate, ldap.EscapeDN(username))
+		if err := conn.Bind(dn, password); err != nil {
+			return nil, bindError(err)
+		}
+
+		// Read attributes as the user; a failed lookup leaves the profile empty
+		if a.config.BaseDN != "" {
+			if entry, err := a.search(conn, username); err == nil {
+				return entry, nil
+			}
+		} else {
+			request := ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, a.config.Timeout, false,
+				"(objectClass=*)", a.attributes(), nil)
+			if result, err := conn.Search(request); err == nil && len(result.Entries) == 1 {
+				return result.Entries[0], nil
+			}
+		}
+		return &ldap.Entry{DN: dn}, nil
+	}
+
+	if a.config.BindDN != "" {
+		if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service account bind failed: %v", ErrLDAPUnavailable, err)
+		}
+	}
+
+	entry, err := a.search(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, bindError(err)
+	}
+
+	return entry, nil
+}
+
+// search returns the single entry matching the user filter
+func (a *LDAPAuthenticator) search(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, a.config.Timeout, false,
+		fmt.Sprintf(a.config.UserFilter, ldap.EscapeFilter(username)), a.attributes(), nil)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// bindError maps a failed user bind to ErrInvalidCredentials
+func bindError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	return fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+}
+
+// provision creates the user on first login or updates their profile, role
+// and mapped group memberships from the directory entry
+func (a *LDAPAuthenticator) provision(user *models.User, username string, entry *ldap.Entry) (*models.User, error) {
+	memberOf := entry.GetEqualFoldAttributeValues(a.config.GroupAttribute)
+	profile := externalProfile{
+		FirstName: entry.GetEqualFoldAttributeValue(a.config.FirstNameAttribute),
+		LastName:  entry.GetEqualFoldAttributeValue(a.config.LastNameAttribute),
+		Email:     entry.GetEqualFoldAttributeValue(a.config.EmailAttribute),
+		Role:      mapRole(a.config.RoleMapping, memberOf),
+	}
+
+	user, err := provisionExternalUser(user, username, models.AuthSourceLDAP, profile, a.config.AutoCreate, a.config.DefaultRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.syncGroups(user.ID, memberOf); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// syncGroups adds the user to mapped local groups of their directory groups
+// and removes them from mapped groups they are no longer a member of
+func (a *LDAPAuthenticator) syncGroups(userID uuid.UUID, memberOf []string) error {
+	if len(a.config.GroupMapping) == 0 {
+		return nil
+	}
+
+	want := make(map[string]bool)
+	for groupDN, name := range a.config.GroupMapping {
+		if _, ok := want[name]; !ok {
+			want[name] = false
+		}
+		if containsFold(memberOf, groupDN) {
+			want[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	var groups []models.Group
+	if err := database.GetDB().Where("name IN ?", names).Find(&groups).Error; err != nil {
+		return err
+	}
+
+	var current []models.UserGroup
+	if err := database.GetDB().Where("user_id = ?", userID).Find(&current).Error; err != nil {
+		return err
+	}
+	isMember := make(map[uuid.UUID]bool, len(current))
+	for _, ug := range current {
+		isMember[ug.GroupID] = true
+	}
+
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, group := range groups {
+			switch {
+			case want[group.Name] && !isMember[group.ID]:
+				if err := tx.Create(&models.UserGroup{GroupID: group.ID, UserID: userID, CreatedBy: uuid.Nil}).Error; err != nil {
+					return err
+				}
+			case !want[group.Name] && isMember[group.ID]:
+				if err := tx.Delete(&models.UserGroup{}, "group_id = ? AND user_id = ?", group.ID, userID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,521 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOIDCUnavailable   = apperror.ServiceUnavailable("Identity provider is unavailable")
+	ErrOIDCLoginFailed   = apperror.Unauthorized("Single sign-on failed")
+	ErrOIDCUserNotFound  = apperror.Forbidden("No account exists for this identity")
+	ErrOIDCNotLinked     = apperror.Forbidden("An account with this username exists but is not linked to this identity; sign in with your password and link single sign-on on your profile page")
+	ErrOIDCLinkedToOther = apperror.Conflict("This identity is already linked to another account")
+)
+
+// oidcHTTPTimeout limits requests to the identity provider
+const oidcHTTPTimeout = 10 * time.Second
+
+// OIDCLoginState holds the per-login secrets of the authorization code flow
+type OIDCLoginState struct {
+	State    string
+	Nonce    string
+	Verifier string // PKCE code verifier
+}
+
+// NewOIDCLoginState generates random state, nonce and PKCE verifier
+func NewOIDCLoginState() (*OIDCLoginState, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &OIDCLoginState{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// oidcDiscovery is the subset of the provider metadata used for login
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// OIDCService signs users in with an OpenID Connect provider
+type OIDCService struct {
+	config *config.OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+}
+
+// NewOIDCService creates a new OIDC service
+func NewOIDCService(cfg *config.OIDCConfig) *OIDCService {
+	return &OIDCService{
+		config: cfg,
+		client: &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// Enabled reports whether OIDC login is configured
+func (s *OIDCService) Enabled() bool {
+	return s.config != nil && s.config.Enabled
+}
+
+// AuthorizationURL returns the provider URL the browser is redirected to for login
+func (s *OIDCService) AuthorizationURL(state *OIDCLoginState) (string, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.config.ClientID},
+		"redirect_uri":          {s.config.RedirectURL},
+		"scope":                 {strings.Join(s.config.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code, verifies the ID token and returns
+// the local user linked to the identity, creating it on first login if
+// configured
+func (s *OIDCService) Exchange(code string, state *OIDCLoginState) (*models.User, error) {
+	claims, err := s.verifiedClaims(code, state)
+	if err != nil {
+		return nil, err
+	}
+	return s.provision(claims)
+}
+
+// Link redeems the authorization code and links the identity of the ID token
+// to the signed-in user, so that they can sign in with it from then on
+func (s *OIDCService) Link(code string, state *OIDCLoginState, userID uuid.UUID) error {
+	claims, err := s.verifiedClaims(code, state)
+	if err != nil {
+		return err
+	}
+	issuer, subject, err := identityOf(claims)
+	if err != nil {
+		return err
+	}
+
+	identity, err := findIdentity(issuer, subject)
+	if err != nil {
+		return err
+	}
+	if identity != nil {
+		if identity.UserID != userID {
+			return ErrOIDCLinkedToOther
+		}
+		return nil
+	}
+	return database.GetDB().Create(&models.UserIdentity{UserID: userID, Issuer: issuer, Subject: subject}).Error
+}
+
+// verifiedClaims redeems the authorization code and returns the claims of the
+// verified ID token
+func (s *OIDCService) verifiedClaims(code string, state *OIDCLoginState) (jwt.MapClaims, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := s.redeemCode(discovery, code, state.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.verifyIDToken(discovery, rawIDToken, state.Nonce)
+}
+
+// getDiscovery returns the cached provider metadata, fetching it on first use
+func (s *OIDCService) getDiscovery() (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(s.config.IssuerURL, "/")
+	var discovery oidcDiscovery
+	if err := s.getJSON(issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrOIDCUnavailable, discovery.Issuer, issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrOIDCUnavailable)
+	}
+
+	s.discovery = &discovery
+	return s.discovery, nil
+}
+
+// getJSON fetches a JSON document from the provider
+func (s *OIDCService) getJSON(u string, v interface{}) error {
+	resp, err := s.client.Get(u)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCUnavailable, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %d", ErrOIDCUnavailable, u, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCUnavailable, err)
+	}
+	return nil
+}
+
+// redeemCode exchanges the authorization code for tokens and returns the ID token
+func (s *OIDCService) redeemCode(discovery *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.config.RedirectURL},
+		"client_id":     {s.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOIDCUnavailable, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token)
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return "", fmt.Errorf("%w: token endpoint returned %d", ErrOIDCUnavailable, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("%w: %s %s", ErrOIDCLoginFailed, token.Error, token.ErrorDescription)
+	case decodeErr != nil:
+		return "", fmt.Errorf("%w: %v", ErrOIDCUnavailable, decodeErr)
+	case token.IDToken == "":
+		return "", fmt.Errorf("%w: no id_token in token response", ErrOIDCLoginFailed)
+	}
+
+	return token.IDToken, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of the ID token
+func (s *OIDCService) verifyIDToken(discovery *oidcDiscovery, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(discovery, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(s.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		if errors.Is(err, ErrOIDCUnavailable) {
+			return nil, ErrOIDCUnavailable
+		}
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCLoginFailed)
+	}
+
+	return claims, nil
+}
+
+// signingKey returns the provider key with the given key ID, refreshing the
+// key set once when the key is unknown (the provider rotated its keys)
+func (s *OIDCService) signingKey(discovery *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key := lookupKey(s.keys, kid); key != nil {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := s.getJSON(discovery.JwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	s.keys = keys
+
+	if key := lookupKey(s.keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey returns the key with kid, or the only key when the token has no key ID
+func lookupKey(keys map[string]crypto.PublicKey, kid string) crypto.PublicKey {
+	if key, ok := keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// jsonWebKey is an RSA or EC public key of a JWK set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// provision returns the local user linked to the identity (issuer and
+// subject) of the verified claims. Without a link, an OIDC user created by
+// this provider before identities were recorded is linked by username, and a
+// new user is created on first login if configured. Local and LDAP users are
+// never matched by username; they link the identity on their profile page.
+func (s *OIDCService) provision(claims jwt.MapClaims) (*models.User, error) {
+	issuer, subject, err := identityOf(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := externalProfile{
+		FirstName: claimString(claims, s.config.FirstNameClaim),
+		LastName:  claimString(claims, s.config.LastNameClaim),
+		Email:     claimString(claims, s.config.EmailClaim),
+	}
+	if s.config.RoleClaim != "" {
+		profile.Role = mapRole(s.config.RoleMapping, claimStrings(claims, s.config.RoleClaim))
+	}
+
+	identity, err := findIdentity(issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		var user models.User
+		if err := database.GetDB().First(&user, "id = ?", identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		// Only OIDC users get their profile from the claims
+		return provisionExternalUser(&user, user.Username, models.AuthSourceOIDC, profile, false, s.config.DefaultRole)
+	}
+
+	username := claimString(claims, s.config.UsernameClaim)
+	if username == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrOIDCLoginFailed, s.config.UsernameClaim)
+	}
+
+	var existing *models.User
+	var user models.User
+	err = database.GetDB().Where("username = ?", username).First(&user).Error
+	switch {
+	case err == nil:
+		if user.AuthSource != models.AuthSourceOIDC {
+			return nil, ErrOIDCNotLinked
+		}
+		var linked int64
+		if err := database.GetDB().Model(&models.UserIdentity{}).
+			Where("user_id = ? AND issuer = ?", user.ID, issuer).
+			Count(&linked).Error; err != nil {
+			return nil, err
+		}
+		if linked > 0 {
+			// Another identity of this provider owns the account
+			return nil, ErrOIDCNotLinked
+		}
+		existing = &user
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	provisioned, err := provisionExternalUser(existing, username, models.AuthSourceOIDC, profile, s.config.AutoCreate, s.config.DefaultRole)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, ErrOIDCUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.GetDB().Create(&models.UserIdentity{UserID: provisioned.ID, Issuer: issuer, Subject: subject}).Error; err != nil {
+		return nil, err
+	}
+	return provisioned, nil
+}
+
+// identityOf returns the issuer and subject identifying the account at the provider
+func identityOf(claims jwt.MapClaims) (string, string, error) {
+	issuer, subject := claimString(claims, "iss"), claimString(claims, "sub")
+	if issuer == "" || subject == "" {
+		return "", "", fmt.Errorf("%w: missing iss or sub claim", ErrOIDCLoginFailed)
+	}
+	return issuer, subject, nil
+}
+
+// findIdentity returns the identity linked to issuer and subject, or nil.
+// An identity left behind by a deleted user is removed.
+func findIdentity(issuer, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := database.GetDB().Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var users int64
+	if err := database.GetDB().Model(&models.User{}).Where("id = ?", identity.UserID).Count(&users).Error; err != nil {
+		return nil, err
+	}
+	if users == 0 {
+		return nil, database.GetDB().Delete(&identity).Error
+	}
+	return &identity, nil
+}
+
+// claimString returns a string claim, or "" when missing
+func claimString(claims jwt.MapClaims, name string) string {
+	v, _ := claims[name].(string)
+	return v
+}
+
+// claimStrings returns a claim holding a string or a list of strings
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
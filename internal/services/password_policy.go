@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPasswordBanned   = apperror.Validation("Password is too common; choose a different one")
+	ErrPasswordUserInfo = apperror.Validation("Password must not contain the username or email")
+	ErrPasswordReused   = apperror.Validation("Password was used recently; choose a different one")
+)
+
+// PasswordPolicy validates new local passwords against the configured rules
+// and the password history of a user
+type PasswordPolicy struct {
+	config *config.PasswordPolicyConfig
+
+	bannedOnce sync.Once
+	banned     map[string]struct{}
+	bannedErr  error
+}
+
+// NewPasswordPolicy creates a password policy. A nil config applies only the
+// default minimum length.
+func NewPasswordPolicy(cfg *config.PasswordPolicyConfig) *PasswordPolicy {
+	if cfg == nil {
+		cfg = &config.PasswordPolicyConfig{}
+	}
+	return &PasswordPolicy{config: cfg}
+}
+
+// Load reads the banned password list, so that a missing file is reported at startup
+func (p *PasswordPolicy) Load() error {
+	p.bannedOnce.Do(func() {
+		p.banned, p.bannedErr = loadBannedPasswords(p.config.BannedListFile)
+	})
+	return p.bannedErr
+}
+
+// Validate checks a new password against the policy rules. All unmet length
+// and character class rules are reported in one error.
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+	var missing []string
+	minLength := p.config.MinLength
+	if minLength == 0 {
+		minLength = 8
+	}
+	if len([]rune(password)) < minLength {
+		missing = append(missing, fmt.Sprintf("at least %d characters", minLength))
+	}
+
+	var upper, lower, digit, special bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			special = true
+		}
+	}
+	if p.config.RequireUppercase && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.config.RequireLowercase && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.config.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if p.config.RequireSpecial && !special {
+		missing = append(missing, "a special character")
+	}
+	if len(missing) > 0 {
+		return apperror.Validation("Password must contain " + strings.Join(missing, ", "))
+	}
+
+	if !p.config.AllowUserInfo && containsUserInfo(password, username, email) {
+		return ErrPasswordUserInfo
+	}
+
+	if err := p.Load(); err != nil {
+		return err
+	}
+	if _, ok := p.banned[strings.ToLower(password)]; ok {
+		return ErrPasswordBanned
+	}
+	return nil
+}
+
+// CheckHistory rejects a password equal to the current one or to one of the
+// last history_size passwords of a user
+func (p *PasswordPolicy) CheckHistory(db *gorm.DB, user *models.User, password string) error {
+	if user.Password != "" && VerifyPassword(password, user.Password) {
+		return ErrPasswordReused
+	}
+	if p.config.HistorySize <= 0 {
+		return nil
+	}
+
+	var history []models.PasswordHistory
+	if err := db.Where("user_id = ?", user.ID).Order("created_at DESC").
+		Limit(p.config.HistorySize).Find(&history).Error; err != nil {
+		return err
+	}
+	for _, h := range history {
+		if VerifyPassword(password, h.PasswordHash) {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// Remember stores the password hash being replaced in the history of a user
+// and drops entries beyond history_size
+func (p *PasswordPolicy) Remember(db *gorm.DB, userID uuid.UUID, oldHash string) error {
+	if p.config.HistorySize <= 0 {
+		return nil
+	}
+	if err := db.Create(&models.PasswordHistory{UserID: userID, PasswordHash: oldHash}).Error; err != nil {
+		return err
+	}
+
+	var keep []uuid.UUID
+	if err := db.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("created_at DESC").Limit(p.config.HistorySize).Pluck("id", &keep).Error; err != nil {
+		return err
+	}
+	return db.Where("user_id = ? AND id NOT IN ?", userID, keep).Delete(&models.PasswordHistory{}).Error
+}
+
+// RequiresChange checks if a user must change their local password before
+// doing anything else, because it was set by someone else or has expired
+func (p *PasswordPolicy) RequiresChange(user *models.User) bool {
+	if !user.HasLocalPassword() {
+		return false
+	}
+	return user.MustChangePassword || p.IsExpired(user)
+}
+
+// IsExpired checks if the local password of a user is older than max_age_days
+func (p *PasswordPolicy) IsExpired(user *models.User) bool {
+	if p.config.MaxAgeDays <= 0 || !user.HasLocalPassword() {
+		return false
+	}
+	maxAge := time.Duration(p.config.MaxAgeDays) * 24 * time.Hour
+	return time.Since(user.PasswordSetAt()) > maxAge
+}
+
+// containsUserInfo checks if a password contains the username or the local
+// part of the email address. Parts shorter than 3 characters are ignored.
+func containsUserInfo(password, username, email string) bool {
+	lower := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(email, "@")
+	for _, part := range []string{username, localPart} {
+		part = strings.ToLower(part)
+		if len(part) >= 3 && strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBannedPasswords reads one password per line. Empty lines and lines
+// starting with # are skipped.
+func loadBannedPasswords(path string) (map[string]struct{}, error) {
+	banned := make(map[string]struct{})
+	if path == "" {
+		return banned, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open banned password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		banned[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read banned password list: %w", err)
+	}
+	return banned, nil
+}
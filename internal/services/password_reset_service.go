@@ -0,0 +1,159 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/mailer"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidResetToken = apperror.Validation("Password reset link is invalid or has expired")
+)
+
+// passwordResetMail is the data of the password_reset mail template
+type passwordResetMail struct {
+	Name      string
+	Username  string
+	Link      string
+	ExpiresIn int // minutes
+}
+
+// PasswordResetService lets users who forgot their password set a new one
+// through a single-use link sent by email
+type PasswordResetService struct {
+	config    *config.AuthConfig
+	publicURL string
+	mailer    mailer.Mailer
+	users     *UserService
+}
+
+// NewPasswordResetService creates a new password reset service. Links in the
+// emails point to publicURL.
+func NewPasswordResetService(cfg *config.AuthConfig, publicURL string, m mailer.Mailer) *PasswordResetService {
+	return &PasswordResetService{
+		config:    cfg,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		mailer:    m,
+		users:     NewUserServiceWithPolicy(&cfg.PasswordPolicy),
+	}
+}
+
+// Request emails a reset link to the active local user with the given
+// username or email. Earlier links of the user stop working. It returns the
+// user, or nil if no such user exists; callers must answer the same way in
+// both cases so that accounts cannot be enumerated. Only an existing account
+// writes a token and sends an email, so callers must not wait for Request
+// either; the response time would reveal the account.
+func (s *PasswordResetService) Request(login, ipAddress string) (*models.User, error) {
+	now := time.Now()
+	database.GetDB().Where("expires_at < ?", now).Delete(&models.PasswordResetToken{})
+
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return nil, nil
+	}
+	var user models.User
+	if err := database.GetDB().Where("username = ? OR email = ?", login, login).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !user.IsActive || !user.HasLocalPassword() || user.Email == "" {
+		return nil, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	token := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashSecret(secret),
+		ExpiresAt: now.Add(s.config.PasswordResetDuration()),
+		IPAddress: ipAddress,
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := mailer.Render("password_reset", user.Email, passwordResetMail{
+		Name:      user.GetFullName(),
+		Username:  user.Username,
+		Link:      s.publicURL + "/reset-password?token=" + url.QueryEscape(secret),
+		ExpiresIn: int(s.config.PasswordResetDuration().Minutes()),
+	})
+	if err != nil {
+		return &user, err
+	}
+	return &user, s.mailer.Send(msg)
+}
+
+// Reset sets a new password with a reset token. The token is consumed, the
+// account lockout is cleared and all sessions of the user are signed out.
+func (s *PasswordResetService) Reset(token, newPassword string) (*models.User, error) {
+	if token == "" {
+		return nil, ErrInvalidResetToken
+	}
+	var reset models.PasswordResetToken
+	if err := database.GetDB().First(&reset, "token_hash = ?", hashSecret(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if !reset.IsUsable(now) {
+		return nil, ErrInvalidResetToken
+	}
+
+	user, err := s.users.GetByID(reset.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	if !user.IsActive || !user.HasLocalPassword() {
+		return nil, ErrInvalidResetToken
+	}
+
+	err = s.users.setPassword(user, newPassword, user.ID, func(tx *gorm.DB) error {
+		// Consume the token; a concurrent reset with the same token fails
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+)
+
+var (
+	ErrQuotaExceeded = apperror.Forbidden("Monthly traffic quota exceeded")
+)
+
+// QuotaService provides monthly traffic quota accounting and enforcement
+type QuotaService struct {
+	userService  *UserService
+	groupService *GroupService
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService() *QuotaService {
+	return &QuotaService{
+		userService:  NewUserService(),
+		groupService: NewGroupService(),
+	}
+}
+
+// CurrentQuotaPeriod returns the calendar month containing t as [start, end)
+func CurrentQuotaPeriod(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+// GetUserUsage returns the bytes transferred by a user in [since, until)
+func (s *QuotaService) GetUserUsage(userID uuid.UUID, since, until time.Time) (int64, error) {
+	totals, err := SumTraffic([]uuid.UUID{userID}, since, until)
+	return totals.Total(), err
+}
+
+// GetGroupUsage returns the bytes transferred by all members of a group in [since, until)
+func (s *QuotaService) GetGroupUsage(groupID uuid.UUID, since, until time.Time) (int64, error) {
+	members := database.GetDB().Table("user_groups").Select("user_id").Where("group_id = ?", groupID)
+	totals, err := SumTraffic(members, since, until)
+	return totals.Total(), err
+}
+
+// GetStatus returns the current period usage of a user against their own and their groups' quotas
+func (s *QuotaService) GetStatus(userID uuid.UUID) (*dto.QuotaStatusResponse, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := CurrentQuotaPeriod(time.Now())
+	status := &dto.QuotaStatusResponse{
+		UserID:      user.ID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Quota:       user.MonthlyTrafficQuota,
+	}
+
+	status.Usage, err = s.GetUserUsage(user.ID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if status.Quota > 0 && status.Usage >= status.Quota {
+		status.Exceeded = true
+		status.ExceededBy = &dto.QuotaExceededScope{Scope: "user"}
+	}
+
+	groups, err := s.groupService.GetUserGroups(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.MonthlyTrafficQuota <= 0 {
+			continue
+		}
+		usage, err := s.GetGroupUsage(group.ID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		status.Groups = append(status.Groups, dto.GroupQuotaStatus{
+			GroupID: group.ID,
+			Name:    group.Name,
+			Quota:   group.MonthlyTrafficQuota,
+			Usage:   usage,
+		})
+		if !status.Exceeded && usage >= group.MonthlyTrafficQuota {
+			groupID := group.ID
+			status.Exceeded = true
+			status.ExceededBy = &dto.QuotaExceededScope{Scope: "group", GroupID: &groupID, Name: group.Name}
+		}
+	}
+
+	return status, nil
+}
+
+// Check returns ErrQuotaExceeded if the user or any of their groups has exhausted its quota
+func (s *QuotaService) Check(userID uuid.UUID) error {
+	status, err := s.GetStatus(userID)
+	if err != nil {
+		return err
+	}
+	if status.Exceeded {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// GetSessionsOverQuota returns active sessions whose users have exhausted a quota
+// and should be disconnected by the VPN server
+func (s *QuotaService) GetSessionsOverQuota() ([]dto.OverQuotaSessionResponse, error) {
+	sessions, err := NewVpnSessionService().GetActiveSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.OverQuotaSessionResponse, 0)
+	checked := make(map[uuid.UUID]*dto.QuotaStatusResponse)
+	for _, session := range sessions {
+		status, ok := checked[session.UserID]
+		if !ok {
+			status, err = s.GetStatus(session.UserID)
+			if err != nil {
+				return nil, err
+			}
+			checked[session.UserID] = status
+		}
+		if !status.Exceeded {
+			continue
+		}
+
+		reason := "User monthly traffic quota exceeded"
+		if status.ExceededBy != nil && status.ExceededBy.Scope == "group" {
+			reason = "Group " + status.ExceededBy.Name + " monthly traffic quota exceeded"
+		}
+		username := ""
+		if session.User != nil {
+			username = session.User.Username
+		}
+		result = append(result, dto.OverQuotaSessionResponse{
+			SessionID: session.ID,
+			UserID:    session.UserID,
+			Username:  username,
+			VpnIP:     session.VpnIP,
+			Reason:    reason,
+		})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,420 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = apperror.Unauthorized("Invalid refresh token")
+	ErrRefreshTokenExpired = apperror.Unauthorized("Refresh token has expired")
+	ErrRefreshTokenReused  = apperror.Unauthorized("Refresh token was already used; the session has been revoked")
+	ErrRefreshTokenRotated = apperror.Conflict("Refresh token was just rotated by another request")
+)
+
+// refreshTokenGracePeriod is how long after a rotation the replaced token is
+// answered with ErrRefreshTokenRotated instead of being treated as reuse, so
+// that concurrent requests of one browser do not revoke its session
+const refreshTokenGracePeriod = 10 * time.Second
+
+// TokenPair holds the tokens issued by a refresh
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	Refresh      *models.RefreshToken
+	User         *models.User
+}
+
+// RefreshTokenService issues and rotates refresh tokens
+type RefreshTokenService struct {
+	config      *config.AuthConfig
+	authService *AuthService
+}
+
+// NewRefreshTokenService creates a new refresh token service
+func NewRefreshTokenService(cfg *config.AuthConfig) *RefreshTokenService {
+	return &RefreshTokenService{
+		config:      cfg,
+		authService: NewAuthService(cfg),
+	}
+}
+
+// Issue starts a new token family for a user who just logged in with the
+// given access token and returns its first refresh token
+func (s *RefreshTokenService) Issue(user *models.User, accessToken, ipAddress, userAgent string) (string, *models.RefreshToken, error) {
+	now := time.Now()
+	s.pruneExpired(now)
+
+	familyExpiresAt := now.Add(s.config.SessionDuration())
+	return s.create(database.GetDB(), user.ID, uuid.New(), familyExpiresAt, accessToken, ipAddress, userAgent, now)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token of the same family. A token can be exchanged only once; presenting it
+// again revokes the whole family.
+func (s *RefreshTokenService) Refresh(token, ipAddress, userAgent string) (*TokenPair, error) {
+	if token == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var current models.RefreshToken
+	if err := database.GetDB().First(&current, "token_hash = ?", hashSecret(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if current.IsRevoked() {
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.IsUsed() {
+		if now.Sub(*current.UsedAt) < refreshTokenGracePeriod {
+			return nil, ErrRefreshTokenRotated
+		}
+		if err := s.revokeFamily(current.FamilyID, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if current.IsExpired(now) || !now.Before(current.FamilyExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, "id = ?", current.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_ = s.revokeFamily(current.FamilyID, now)
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	accessToken, err := s.authService.IssueToken(&user)
+	if err != nil {
+		// The user was disabled or expired since logging in
+		_ = s.revokeFamily(current.FamilyID, now)
+		return nil, err
+	}
+
+	var secret string
+	var next *models.RefreshToken
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		secret, next, err = s.create(tx, current.UserID, current.FamilyID, current.FamilyExpiresAt, accessToken, ipAddress, userAgent, now)
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"used_at": now, "replaced_by": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Another request rotated the token first
+			return ErrRefreshTokenRotated
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: secret,
+		Refresh:      next,
+		User:         &user,
+	}, nil
+}
+
+// Revoke revokes the family of a refresh token, ending the login it belongs
+// to. Unknown tokens are ignored.
+func (s *RefreshTokenService) Revoke(token string) error {
+	if token == "" {
+		return nil
+	}
+	var current models.RefreshToken
+	if err := database.GetDB().First(&current, "token_hash = ?", hashSecret(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.revokeFamily(current.FamilyID, time.Now())
+}
+
+// InvalidateUserTokens makes all tokens issued to a user so far invalid:
+// access tokens through the tokens_valid_after watermark and refresh tokens
+// by revoking them. Used on password change, role change and deactivation.
+func InvalidateUserTokens(userID uuid.UUID) error {
+	// JWT iat has second precision
+	now := time.Now().Truncate(time.Second)
+	if err := database.GetDB().Unscoped().Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("tokens_valid_after", now).Error; err != nil {
+		return err
+	}
+	return database.GetDB().Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
+
+// create stores a new refresh token of a family. Its expiry is the idle
+// lifetime, but never past the end of the family.
+func (s *RefreshTokenService) create(tx *gorm.DB, userID, familyID uuid.UUID, familyExpiresAt time.Time, accessToken, ipAddress, userAgent string, now time.Time) (string, *models.RefreshToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	expiresAt := now.Add(s.config.RefreshTokenDuration())
+	if expiresAt.After(familyExpiresAt) {
+		expiresAt = familyExpiresAt
+	}
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	token := &models.RefreshToken{
+		UserID:          userID,
+		FamilyID:        familyID,
+		TokenHash:       hashSecret(secret),
+		ExpiresAt:       expiresAt,
+		FamilyExpiresAt: familyExpiresAt,
+		IPAddress:       ipAddress,
+		UserAgent:       userAgent,
+	}
+	claims := &middleware.Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err == nil && claims.ExpiresAt != nil {
+		token.AccessTokenID = claims.ID
+		token.AccessTokenExpiresAt = &claims.ExpiresAt.Time
+	}
+	if err := tx.Create(token).Error; err != nil {
+		return "", nil, err
+	}
+	return secret, token, nil
+}
+
+// revokeFamily revokes all tokens of a family
+func (s *RefreshTokenService) revokeFamily(familyID uuid.UUID, now time.Time) error {
+	return database.GetDB().Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
+
+// pruneExpired deletes tokens of families that ended more than a day ago.
+// Recently ended families are kept so reuse of their tokens is still detected.
+func (s *RefreshTokenService) pruneExpired(now time.Time) {
+	database.GetDB().Where("family_expires_at < ?", now.Add(-24*time.Hour)).Delete(&models.RefreshToken{})
+}
+
+// LoginSession is an active login of a user, i.e. a refresh token family.
+// IP address and user agent are those of the last login or refresh.
+type LoginSession struct {
+	ID         uuid.UUID
+	Device     string
+	IPAddress  string
+	UserAgent  string
+	CreatedAt  time.Time // login time
+	LastSeenAt time.Time // last login or refresh
+	ExpiresAt  time.Time // end of the session unless refreshed
+	Current    bool      // the session of the request
+}
+
+// ListSessions returns the active logins of a user, most recently seen
+// first. currentTokenID is the jti of the caller's access token and marks
+// the session of the request.
+func (s *RefreshTokenService) ListSessions(userID uuid.UUID, currentTokenID string) ([]LoginSession, error) {
+	var heads []models.RefreshToken
+	if err := database.GetDB().
+		Where("user_id = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&heads).Error; err != nil {
+		return nil, err
+	}
+	sessions := make([]LoginSession, 0, len(heads))
+	if len(heads) == 0 {
+		return sessions, nil
+	}
+
+	familyIDs := make([]uuid.UUID, len(heads))
+	for i, head := range heads {
+		familyIDs[i] = head.FamilyID
+	}
+	var tokens []models.RefreshToken
+	if err := database.GetDB().Select("family_id", "access_token_id", "created_at").
+		Where("family_id IN ?", familyIDs).
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	started := make(map[uuid.UUID]time.Time)
+	current := make(map[uuid.UUID]bool)
+	for _, token := range tokens {
+		if t, ok := started[token.FamilyID]; !ok || token.CreatedAt.Before(t) {
+			started[token.FamilyID] = token.CreatedAt
+		}
+		if currentTokenID != "" && token.AccessTokenID == currentTokenID {
+			current[token.FamilyID] = true
+		}
+	}
+
+	for _, head := range heads {
+		sessions = append(sessions, LoginSession{
+			ID:         head.FamilyID,
+			Device:     DeviceName(head.UserAgent),
+			IPAddress:  head.IPAddress,
+			UserAgent:  head.UserAgent,
+			CreatedAt:  started[head.FamilyID],
+			LastSeenAt: head.CreatedAt,
+			ExpiresAt:  head.ExpiresAt,
+			Current:    current[head.FamilyID],
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends a login of a user and revokes its access tokens. It
+// returns the jti of each revoked access token that has not expired yet.
+func (s *RefreshTokenService) RevokeSession(userID, sessionID uuid.UUID) ([]string, error) {
+	var count int64
+	if err := database.GetDB().Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, sessionID, time.Now()).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, apperror.NotFound("Session not found")
+	}
+	return s.revokeSessions(userID, func(db *gorm.DB) *gorm.DB {
+		return db.Where("family_id = ?", sessionID)
+	})
+}
+
+// RevokeSessions ends all logins of a user except keepSessionID (uuid.Nil
+// keeps none) like RevokeSession
+func (s *RefreshTokenService) RevokeSessions(userID, keepSessionID uuid.UUID) ([]string, error) {
+	return s.revokeSessions(userID, func(db *gorm.DB) *gorm.DB {
+		return db.Where("family_id <> ?", keepSessionID)
+	})
+}
+
+// SessionOfToken returns the session an access token was issued to, or
+// uuid.Nil if it does not belong to an active session
+func (s *RefreshTokenService) SessionOfToken(userID uuid.UUID, tokenID string) uuid.UUID {
+	var token models.RefreshToken
+	if tokenID == "" || database.GetDB().Select("family_id").
+		Where("user_id = ? AND access_token_id = ? AND revoked_at IS NULL", userID, tokenID).
+		First(&token).Error != nil {
+		return uuid.Nil
+	}
+	return token.FamilyID
+}
+
+// revokeSessions revokes the refresh tokens of a user selected by scope and
+// stores their unexpired access tokens as revoked
+func (s *RefreshTokenService) revokeSessions(userID uuid.UUID, scope func(*gorm.DB) *gorm.DB) ([]string, error) {
+	now := time.Now()
+	var jtis []string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var tokens []models.RefreshToken
+		if err := scope(tx.Where("user_id = ? AND revoked_at IS NULL", userID)).
+			Find(&tokens).Error; err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(tokens))
+		var revoked []models.RevokedToken
+		for i, token := range tokens {
+			ids[i] = token.ID
+			if token.AccessTokenID != "" && token.AccessTokenExpiresAt != nil && token.AccessTokenExpiresAt.After(now) {
+				jtis = append(jtis, token.AccessTokenID)
+				revoked = append(revoked, models.RevokedToken{
+					JTI:       token.AccessTokenID,
+					UserID:    userID,
+					ExpiresAt: *token.AccessTokenExpiresAt,
+				})
+			}
+		}
+		if err := tx.Model(&models.RefreshToken{}).Where("id IN ?", ids).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if len(revoked) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jtis, nil
+}
+
+// DeviceName describes a user agent as browser and operating system, e.g.
+// "Firefox on Linux", or by its product name for other clients such as curl
+func DeviceName(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown"
+	}
+
+	browser := ""
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"), strings.Contains(userAgent, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"), strings.Contains(userAgent, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	system := ""
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		system = "iOS"
+	case strings.Contains(userAgent, "Android"):
+		system = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		system = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(userAgent, "CrOS"):
+		system = "ChromeOS"
+	case strings.Contains(userAgent, "Linux"):
+		system = "Linux"
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	// e.g. "curl/8.5.0" or "python-requests/2.31"
+	product, _, _ := strings.Cut(userAgent, " ")
+	product, _, _ = strings.Cut(product, "/")
+	return product
+}
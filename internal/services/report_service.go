@@ -0,0 +1,297 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+var (
+	ErrInvalidReportPeriod = apperror.Validation("End must be after start")
+)
+
+// ReportService provides VPN usage reports
+type ReportService struct{}
+
+// NewReportService creates a new report service
+func NewReportService() *ReportService {
+	return &ReportService{}
+}
+
+// GetTopTalkers returns the top users and groups by traffic, session count or
+// connected time for the requested period, compared to the previous period of
+// the same length. The period bounds are aligned to whole hours, or to local
+// days if the periods start before the hourly rollups, where only daily
+// rollups are kept.
+func (s *ReportService) GetTopTalkers(filter *dto.TopTalkersFilter) (*dto.TopTalkersReport, error) {
+	now := time.Now().UTC()
+
+	end := now
+	if filter.End != nil {
+		end = filter.End.UTC()
+	}
+	start := end.AddDate(0, 0, -7)
+	if filter.Start != nil {
+		start = filter.Start.UTC()
+	}
+	if !end.After(start) {
+		return nil, ErrInvalidReportPeriod
+	}
+
+	// Align to hours so that hourly rollups cover the period exactly
+	start = start.Truncate(time.Hour)
+	if aligned := end.Truncate(time.Hour); !aligned.Equal(end) {
+		end = aligned.Add(time.Hour)
+	}
+	previousStart := start.Add(-end.Sub(start))
+
+	// Before the hourly rollups only daily rollups are kept, align to local days
+	hourlyStart, err := GetHourlyRollupStart()
+	if err != nil {
+		return nil, err
+	}
+	if previousStart.Before(hourlyStart) {
+		start = dayStart(start)
+		if aligned := dayStart(end); aligned.Before(end) {
+			end = nextDay(aligned)
+		}
+		days := int((end.Sub(start) + 12*time.Hour) / (24 * time.Hour))
+		local := start.In(time.Local)
+		previousStart = time.Date(local.Year(), local.Month(), local.Day()-days, 0, 0, 0, 0, time.Local).UTC()
+	}
+
+	limit := filter.Limit
+	if limit < 1 {
+		limit = 10
+	}
+	sortBy := filter.SortBy
+	if sortBy == "" {
+		sortBy = "bytes"
+	}
+
+	current, err := collectUserUsage(start, end, now)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := collectUserUsage(previousStart, start, now)
+	if err != nil {
+		return nil, err
+	}
+
+	userNames, err := userNames(current)
+	if err != nil {
+		return nil, err
+	}
+	groupCurrent, groupPrevious, groupNames, err := aggregateGroupUsage(current, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.TopTalkersReport{
+		Start:         start,
+		End:           end,
+		PreviousStart: previousStart,
+		PreviousEnd:   start,
+		SortBy:        sortBy,
+		Users:         rankUsage(current, previous, userNames, sortBy, limit),
+		Groups:        rankUsage(groupCurrent, groupPrevious, groupNames, sortBy, limit),
+	}, nil
+}
+
+// collectUserUsage returns usage metrics per user for [start, end)
+func collectUserUsage(start, end, now time.Time) (map[uuid.UUID]*dto.UsageMetrics, error) {
+	usage := make(map[uuid.UUID]*dto.UsageMetrics)
+	get := func(userID uuid.UUID) *dto.UsageMetrics {
+		m, ok := usage[userID]
+		if !ok {
+			m = &dto.UsageMetrics{}
+			usage[userID] = m
+		}
+		return m
+	}
+
+	// Traffic
+	traffic, err := SumTrafficByUser(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for userID, t := range traffic {
+		m := get(userID)
+		m.BytesReceived = t.BytesReceived
+		m.BytesSent = t.BytesSent
+		m.TotalBytes = t.Total()
+	}
+
+	// Sessions started in the period
+	type sessionCount struct {
+		UserID uuid.UUID
+		Count  int64
+	}
+	var counts []sessionCount
+	if err := database.GetDB().Model(&models.VpnSession{}).
+		Select("user_id, COUNT(*) as count").
+		Where("connected_at >= ? AND connected_at < ?", start, end).
+		Group("user_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		get(c.UserID).Sessions = c.Count
+	}
+
+	// Connected time within the period
+	type sessionSpan struct {
+		UserID         uuid.UUID
+		ConnectedAt    time.Time
+		DisconnectedAt *time.Time
+	}
+	var spans []sessionSpan
+	if err := database.GetDB().Model(&models.VpnSession{}).
+		Select("user_id, connected_at, disconnected_at").
+		Where("connected_at < ? AND (disconnected_at IS NULL OR disconnected_at > ?)", end, start).
+		Scan(&spans).Error; err != nil {
+		return nil, err
+	}
+	for _, sp := range spans {
+		from := sp.ConnectedAt
+		if from.Before(start) {
+			from = start
+		}
+		to := now
+		if sp.DisconnectedAt != nil {
+			to = *sp.DisconnectedAt
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			get(sp.UserID).ConnectedSeconds += int64(to.Sub(from) / time.Second)
+		}
+	}
+
+	return usage, nil
+}
+
+// userNames returns usernames of the users in usage
+func userNames(usage map[uuid.UUID]*dto.UsageMetrics) (map[uuid.UUID]string, error) {
+	names := make(map[uuid.UUID]string, len(usage))
+	if len(usage) == 0 {
+		return names, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(usage))
+	for id := range usage {
+		ids = append(ids, id)
+	}
+
+	var users []models.User
+	if err := database.GetDB().Unscoped().Select("id, username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names, nil
+}
+
+// aggregateGroupUsage sums user usage per group; a user in several groups counts towards each
+func aggregateGroupUsage(current, previous map[uuid.UUID]*dto.UsageMetrics) (map[uuid.UUID]*dto.UsageMetrics, map[uuid.UUID]*dto.UsageMetrics, map[uuid.UUID]string, error) {
+	var groups []models.Group
+	if err := database.GetDB().Select("id, name").Find(&groups).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	names := make(map[uuid.UUID]string, len(groups))
+	for _, g := range groups {
+		names[g.ID] = g.Name
+	}
+
+	var memberships []models.UserGroup
+	if err := database.GetDB().Find(&memberships).Error; err != nil {
+		return nil, nil, nil, err
+	}
+
+	groupCurrent := make(map[uuid.UUID]*dto.UsageMetrics)
+	groupPrevious := make(map[uuid.UUID]*dto.UsageMetrics)
+	for _, m := range memberships {
+		if _, ok := names[m.GroupID]; !ok {
+			continue
+		}
+		if u, ok := current[m.UserID]; ok {
+			addUsage(groupCurrent, m.GroupID, u)
+		}
+		if u, ok := previous[m.UserID]; ok {
+			addUsage(groupPrevious, m.GroupID, u)
+		}
+	}
+
+	return groupCurrent, groupPrevious, names, nil
+}
+
+func addUsage(usage map[uuid.UUID]*dto.UsageMetrics, id uuid.UUID, u *dto.UsageMetrics) {
+	m, ok := usage[id]
+	if !ok {
+		m = &dto.UsageMetrics{}
+		usage[id] = m
+	}
+	m.BytesReceived += u.BytesReceived
+	m.BytesSent += u.BytesSent
+	m.TotalBytes += u.TotalBytes
+	m.Sessions += u.Sessions
+	m.ConnectedSeconds += u.ConnectedSeconds
+}
+
+// usageMetric returns the value of the ranking metric
+func usageMetric(m dto.UsageMetrics, sortBy string) int64 {
+	switch sortBy {
+	case "sessions":
+		return m.Sessions
+	case "duration":
+		return m.ConnectedSeconds
+	default:
+		return m.TotalBytes
+	}
+}
+
+// rankUsage returns the top entries with a non-zero ranking metric
+func rankUsage(current, previous map[uuid.UUID]*dto.UsageMetrics, names map[uuid.UUID]string, sortBy string, limit int) []dto.TopTalkerEntry {
+	entries := make([]dto.TopTalkerEntry, 0, len(current))
+	for id, m := range current {
+		if usageMetric(*m, sortBy) == 0 {
+			continue
+		}
+		entry := dto.TopTalkerEntry{
+			ID:      id,
+			Name:    names[id],
+			Current: *m,
+		}
+		if p, ok := previous[id]; ok {
+			entry.Previous = *p
+		}
+		if prev := usageMetric(entry.Previous, sortBy); prev > 0 {
+			change := float64(usageMetric(entry.Current, sortBy)-prev) * 100 / float64(prev)
+			entry.ChangePercent = &change
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := usageMetric(entries[i].Current, sortBy), usageMetric(entries[j].Current, sortBy)
+		if a != b {
+			return a > b
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidTrafficEntry = apperror.Validation("Each entry needs either bytes_received_delta/bytes_sent_delta or cumulative bytes_received/bytes_sent")
+)
+
+// trafficBatchInsertSize limits the rows inserted by a single statement
+const trafficBatchInsertSize = 500
+
+// CreateBatch stores traffic of many sessions in a single transaction and
+// updates the running totals of the sessions. Cumulative counters are
+// converted to deltas against the session's running total; counters lower
+// than the total are ignored. Entries of unknown or disconnected sessions are
+// skipped, entries without traffic are not stored. Users of the batch who ran
+// out of monthly quota are returned with their sessions to disconnect.
+func (s *VpnTrafficStatsService) CreateBatch(req *dto.CreateVpnTrafficStatsBatchRequest) (*dto.VpnTrafficStatsBatchResponse, error) {
+	batchTime := time.Now()
+	if req.Timestamp != nil {
+		batchTime = *req.Timestamp
+	}
+	timestamp := func(e *dto.VpnTrafficStatsBatchEntry) time.Time {
+		if e.Timestamp != nil {
+			return *e.Timestamp
+		}
+		return batchTime
+	}
+
+	for _, e := range req.Entries {
+		hasDelta := e.BytesReceivedDelta != nil || e.BytesSentDelta != nil
+		hasCounter := e.BytesReceived != nil || e.BytesSent != nil
+		if hasDelta == hasCounter {
+			return nil, ErrInvalidTrafficEntry
+		}
+	}
+
+	// Apply entries of a session in chronological order
+	entries := make([]dto.VpnTrafficStatsBatchEntry, len(req.Entries))
+	copy(entries, req.Entries)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return timestamp(&entries[i]).Before(timestamp(&entries[j]))
+	})
+
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	for _, e := range entries {
+		if !seen[e.SessionID] {
+			seen[e.SessionID] = true
+			ids = append(ids, e.SessionID)
+		}
+	}
+
+	response := &dto.VpnTrafficStatsBatchResponse{
+		Skipped:       []dto.VpnTrafficStatsBatchSkipped{},
+		QuotaExceeded: []dto.VpnTrafficStatsBatchQuotaExceeded{},
+	}
+	var updated []*models.VpnSession
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Lock the sessions so that running totals of concurrent batches and
+		// disconnects are not lost. SQLite serializes write transactions.
+		query := tx.Where("id IN ?", ids).Order("id")
+		if tx.Dialector.Name() != "sqlite" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var sessions []models.VpnSession
+		if err := query.Find(&sessions).Error; err != nil {
+			return err
+		}
+		byID := make(map[uuid.UUID]*models.VpnSession, len(sessions))
+		for i := range sessions {
+			byID[sessions[i].ID] = &sessions[i]
+		}
+
+		skipped := make(map[uuid.UUID]bool)
+		skip := func(id uuid.UUID, reason string) {
+			if !skipped[id] {
+				skipped[id] = true
+				response.Skipped = append(response.Skipped, dto.VpnTrafficStatsBatchSkipped{SessionID: id, Reason: reason})
+			}
+		}
+
+		var stats []models.VpnTrafficStats
+		added := make(map[uuid.UUID]*TrafficTotals)
+		for i := range entries {
+			e := &entries[i]
+			session, ok := byID[e.SessionID]
+			if !ok {
+				skip(e.SessionID, "session not found")
+				continue
+			}
+			if !session.IsActive() {
+				skip(e.SessionID, "session disconnected")
+				continue
+			}
+
+			var received, sent int64
+			if e.BytesReceived != nil || e.BytesSent != nil {
+				received = counterDelta(session.BytesReceived, e.BytesReceived)
+				sent = counterDelta(session.BytesSent, e.BytesSent)
+			} else {
+				if e.BytesReceivedDelta != nil {
+					received = *e.BytesReceivedDelta
+				}
+				if e.BytesSentDelta != nil {
+					sent = *e.BytesSentDelta
+				}
+			}
+
+			session.BytesReceived += received
+			session.BytesSent += sent
+			if _, ok := added[session.ID]; !ok {
+				added[session.ID] = &TrafficTotals{}
+				updated = append(updated, session)
+			}
+			added[session.ID].BytesReceived += received
+			added[session.ID].BytesSent += sent
+
+			if received > 0 || sent > 0 {
+				stats = append(stats, models.VpnTrafficStats{
+					SessionID:          session.ID,
+					Timestamp:          timestamp(e),
+					BytesReceivedDelta: received,
+					BytesSentDelta:     sent,
+				})
+			}
+		}
+
+		if len(stats) > 0 {
+			if err := tx.CreateInBatches(stats, trafficBatchInsertSize).Error; err != nil {
+				return err
+			}
+		}
+		for _, session := range updated {
+			if err := tx.Model(&models.VpnSession{}).Where("id = ?", session.ID).Updates(map[string]interface{}{
+				"bytes_received": gorm.Expr("bytes_received + ?", added[session.ID].BytesReceived),
+				"bytes_sent":     gorm.Expr("bytes_sent + ?", added[session.ID].BytesSent),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		response.Inserted = len(stats)
+		response.Sessions = len(updated)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the quota of each user of the batch once the traffic is committed
+	var userIDs []uuid.UUID
+	sessionsOf := make(map[uuid.UUID][]uuid.UUID)
+	for _, session := range updated {
+		if _, ok := sessionsOf[session.UserID]; !ok {
+			userIDs = append(userIDs, session.UserID)
+		}
+		sessionsOf[session.UserID] = append(sessionsOf[session.UserID], session.ID)
+	}
+	quotaService := NewQuotaService()
+	for _, userID := range userIDs {
+		if quotaService.Check(userID) == ErrQuotaExceeded {
+			response.QuotaExceeded = append(response.QuotaExceeded, dto.VpnTrafficStatsBatchQuotaExceeded{
+				UserID:     userID,
+				SessionIDs: sessionsOf[userID],
+			})
+		}
+	}
+
+	return response, nil
+}
+
+// counterDelta returns the growth of a cumulative counter over the running total
+func counterDelta(total int64, counter *int64) int64 {
+	if counter == nil || *counter <= total {
+		return 0
+	}
+	return *counter - total
+}
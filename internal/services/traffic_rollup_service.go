@@ -0,0 +1,467 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	applogger "github.com/tldr-it-stepankutaj/openvpn-mng/internal/logger"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+// trafficRollupStateName is the key of the hourly rollup watermark row
+const trafficRollupStateName = "hourly"
+
+// trafficPruneStateName is the key of the row recording up to when hourly
+// rollups have been pruned
+const trafficPruneStateName = "hourly_pruned"
+
+// maxRollupChunk limits how many hours are aggregated in a single transaction
+const maxRollupChunk = 24 * time.Hour
+
+// TrafficTotals represents aggregated traffic counters
+type TrafficTotals struct {
+	BytesReceived int64 `json:"bytes_received"`
+	BytesSent     int64 `json:"bytes_sent"`
+}
+
+// Total returns total bytes transferred
+func (t TrafficTotals) Total() int64 {
+	return t.BytesReceived + t.BytesSent
+}
+
+// TrafficRollupService aggregates raw traffic stats into hourly and daily
+// rollups and prunes data past its retention
+type TrafficRollupService struct {
+	config *config.TrafficConfig
+	stopCh chan struct{}
+}
+
+// NewTrafficRollupService creates a new traffic rollup service
+func NewTrafficRollupService(cfg *config.TrafficConfig) *TrafficRollupService {
+	return &TrafficRollupService{
+		config: cfg,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start runs the rollup immediately and then periodically in the background
+func (s *TrafficRollupService) Start() {
+	go s.loop()
+}
+
+// Stop stops the background rollup goroutine
+func (s *TrafficRollupService) Stop() {
+	close(s.stopCh)
+}
+
+func (s *TrafficRollupService) loop() {
+	s.runAndLog()
+
+	ticker := time.NewTicker(time.Duration(s.config.RollupInterval) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.runAndLog()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+func (s *TrafficRollupService) runAndLog() {
+	start := time.Now()
+	if err := s.Run(start); err != nil {
+		applogger.Error("Traffic rollup failed", "error", err)
+		return
+	}
+	applogger.Debug("Traffic rollup completed", "elapsed", time.Since(start))
+}
+
+// Run rolls up all complete hours before now and prunes expired data
+func (s *TrafficRollupService) Run(now time.Time) error {
+	until := now.UTC().Truncate(time.Hour)
+
+	from, err := s.rollupStart(until)
+	if err != nil {
+		return err
+	}
+
+	for from.Before(until) {
+		to := from.Add(maxRollupChunk)
+		if to.After(until) {
+			to = until
+		}
+		if err := s.RollupHours(from, to); err != nil {
+			return err
+		}
+		from = to
+	}
+
+	return s.Prune(now)
+}
+
+// rollupStart returns the first hour that needs to be (re-)aggregated
+func (s *TrafficRollupService) rollupStart(until time.Time) (time.Time, error) {
+	watermark, err := GetTrafficRollupWatermark()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if watermark.IsZero() {
+		// First run: start at the oldest raw stats entry
+		var oldest models.VpnTrafficStats
+		err := database.GetDB().Order("timestamp ASC").First(&oldest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return until, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		return oldest.Timestamp.UTC().Truncate(time.Hour), nil
+	}
+
+	from := watermark.Add(-time.Duration(s.config.RollupLookback) * time.Hour)
+	if from.After(until) {
+		from = until
+	}
+	return from, nil
+}
+
+// RollupHours (re-)aggregates raw traffic stats of the hours in [from, to) into
+// hourly rollups, refreshes the daily rollups of the affected days and moves the
+// watermark forward. Both bounds must be aligned to an hour.
+func (s *TrafficRollupService) RollupHours(from, to time.Time) error {
+	from, to = from.UTC(), to.UTC()
+
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		for hour := from; hour.Before(to); hour = hour.Add(time.Hour) {
+			if err := rollupHour(tx, hour); err != nil {
+				return err
+			}
+		}
+
+		for day := dayStart(from); day.Before(to); day = nextDay(day) {
+			if err := rollupDay(tx, day); err != nil {
+				return err
+			}
+		}
+
+		return advanceRollupState(tx, trafficRollupStateName, to)
+	})
+}
+
+// rollupHour replaces the hourly rollup rows of a single hour
+func rollupHour(tx *gorm.DB, hour time.Time) error {
+	type userTraffic struct {
+		UserID        uuid.UUID
+		BytesReceived int64
+		BytesSent     int64
+	}
+	var rows []userTraffic
+
+	if err := tx.Table("vpn_traffic_stats").
+		Select("vpn_sessions.user_id, COALESCE(SUM(vpn_traffic_stats.bytes_received_delta), 0) as bytes_received, COALESCE(SUM(vpn_traffic_stats.bytes_sent_delta), 0) as bytes_sent").
+		Joins("JOIN vpn_sessions ON vpn_sessions.id = vpn_traffic_stats.session_id").
+		Where("vpn_traffic_stats.timestamp >= ? AND vpn_traffic_stats.timestamp < ?", hour, hour.Add(time.Hour)).
+		Group("vpn_sessions.user_id").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("bucket_start = ?", hour).Delete(&models.VpnTrafficHourly{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	rollups := make([]models.VpnTrafficHourly, len(rows))
+	for i, r := range rows {
+		rollups[i] = models.VpnTrafficHourly{
+			BucketStart:   hour,
+			UserID:        r.UserID,
+			BytesReceived: r.BytesReceived,
+			BytesSent:     r.BytesSent,
+		}
+	}
+	return tx.Create(&rollups).Error
+}
+
+// rollupDay replaces the daily rollup rows of a single day from the hourly rollups
+func rollupDay(tx *gorm.DB, day time.Time) error {
+	type userTraffic struct {
+		UserID        uuid.UUID
+		BytesReceived int64
+		BytesSent     int64
+	}
+	var rows []userTraffic
+
+	if err := tx.Model(&models.VpnTrafficHourly{}).
+		Select("user_id, COALESCE(SUM(bytes_received), 0) as bytes_received, COALESCE(SUM(bytes_sent), 0) as bytes_sent").
+		Where("bucket_start >= ? AND bucket_start < ?", day, nextDay(day)).
+		Group("user_id").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("bucket_start = ?", day).Delete(&models.VpnTrafficDaily{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	rollups := make([]models.VpnTrafficDaily, len(rows))
+	for i, r := range rows {
+		rollups[i] = models.VpnTrafficDaily{
+			BucketStart:   day,
+			UserID:        r.UserID,
+			BytesReceived: r.BytesReceived,
+			BytesSent:     r.BytesSent,
+		}
+	}
+	return tx.Create(&rollups).Error
+}
+
+// advanceRollupState stores the new time of a state row unless the existing one
+// is further ahead
+func advanceRollupState(tx *gorm.DB, name string, until time.Time) error {
+	var state models.TrafficRollupState
+	err := tx.First(&state, "name = ?", name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&models.TrafficRollupState{
+			Name:          name,
+			RolledUpUntil: until,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	if !until.After(state.RolledUpUntil) {
+		return nil
+	}
+	return tx.Model(&state).Update("rolled_up_until", until).Error
+}
+
+// Prune deletes raw traffic stats and hourly rollups past their retention.
+// Raw stats that have not been rolled up yet are never deleted. Traffic before
+// the pruned hourly rollups is read from the daily rollups.
+func (s *TrafficRollupService) Prune(now time.Time) error {
+	watermark, err := GetTrafficRollupWatermark()
+	if err != nil {
+		return err
+	}
+
+	rawCutoff := now.UTC().AddDate(0, 0, -s.config.RawRetentionDays)
+	safeCutoff := watermark.Add(-time.Duration(s.config.RollupLookback) * time.Hour)
+	if safeCutoff.Before(rawCutoff) {
+		rawCutoff = safeCutoff
+	}
+	if err := database.GetDB().Where("timestamp < ?", rawCutoff).Delete(&models.VpnTrafficStats{}).Error; err != nil {
+		return err
+	}
+
+	hourlyCutoff := now.UTC().AddDate(0, 0, -s.config.HourlyRetentionDays)
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bucket_start < ?", hourlyCutoff).Delete(&models.VpnTrafficHourly{}).Error; err != nil {
+			return err
+		}
+		return advanceRollupState(tx, trafficPruneStateName, hourlyCutoff)
+	})
+}
+
+// GetTrafficRollupWatermark returns the time up to which raw traffic stats have
+// been rolled up (zero if the rollup has never run)
+func GetTrafficRollupWatermark() (time.Time, error) {
+	return getRollupState(trafficRollupStateName)
+}
+
+// GetHourlyRollupStart returns the start of the first local day whose hourly
+// rollups are complete. Earlier days are only available as daily rollups.
+// It is zero if hourly rollups have never been pruned.
+func GetHourlyRollupStart() (time.Time, error) {
+	prunedUntil, err := getRollupState(trafficPruneStateName)
+	if err != nil || prunedUntil.IsZero() {
+		return time.Time{}, err
+	}
+	day := dayStart(prunedUntil)
+	if day.Before(prunedUntil) {
+		day = nextDay(day)
+	}
+	return day, nil
+}
+
+func getRollupState(name string) (time.Time, error) {
+	var state models.TrafficRollupState
+	err := database.GetDB().First(&state, "name = ?", name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return state.RolledUpUntil.UTC(), nil
+}
+
+// trafficRanges splits [since, until) into the parts read from daily rollups,
+// hourly rollups and raw stats. Daily rollups are read for the whole days in
+// the range before the hourly rollups start; partial days there are not
+// available. Hourly rollups are read up to the watermark and raw stats after it.
+type trafficRanges struct {
+	dailyFrom, dailyUntil   time.Time
+	hourlyFrom, hourlyUntil time.Time
+	rawFrom, rawUntil       time.Time
+}
+
+// getTrafficRanges returns the trafficRanges of [since, until)
+func getTrafficRanges(since, until time.Time) (trafficRanges, error) {
+	since, until = since.UTC(), until.UTC()
+	r := trafficRanges{hourlyFrom: since, rawUntil: until}
+
+	watermark, err := GetTrafficRollupWatermark()
+	if err != nil {
+		return r, err
+	}
+	hourlyStart, err := GetHourlyRollupStart()
+	if err != nil {
+		return r, err
+	}
+
+	if since.Before(hourlyStart) {
+		r.dailyFrom = dayStart(since)
+		if r.dailyFrom.Before(since) {
+			r.dailyFrom = nextDay(r.dailyFrom)
+		}
+		r.dailyUntil = hourlyStart
+		if until.Before(r.dailyUntil) {
+			r.dailyUntil = dayStart(until)
+		}
+		r.hourlyFrom = hourlyStart
+	}
+
+	r.hourlyUntil = watermark
+	if until.Before(r.hourlyUntil) {
+		r.hourlyUntil = until
+	}
+
+	r.rawFrom = since
+	if watermark.After(r.rawFrom) {
+		r.rawFrom = watermark
+	}
+	return r, nil
+}
+
+// userTrafficRow represents traffic of one user, or of all users if UserID is not selected
+type userTrafficRow struct {
+	UserID        uuid.UUID
+	BytesReceived int64
+	BytesSent     int64
+}
+
+// sumTrafficRows sums the traffic of the given users in [since, until) from
+// daily rollups, hourly rollups and raw stats, per user if byUser is set
+func sumTrafficRows(userIDs interface{}, since, until time.Time, byUser bool) ([]userTrafficRow, error) {
+	r, err := getTrafficRanges(since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := "COALESCE(SUM(bytes_received), 0) as bytes_received, COALESCE(SUM(bytes_sent), 0) as bytes_sent"
+	rollup := func(model interface{}, from, to time.Time) *gorm.DB {
+		query := database.GetDB().Model(model).
+			Where("bucket_start >= ? AND bucket_start < ?", from, to)
+		if userIDs != nil {
+			query = query.Where("user_id IN (?)", userIDs)
+		}
+		if byUser {
+			return query.Select("user_id, " + sums).Group("user_id")
+		}
+		return query.Select(sums)
+	}
+
+	var queries []*gorm.DB
+	if r.dailyFrom.Before(r.dailyUntil) {
+		queries = append(queries, rollup(&models.VpnTrafficDaily{}, r.dailyFrom, r.dailyUntil))
+	}
+	if r.hourlyFrom.Before(r.hourlyUntil) {
+		queries = append(queries, rollup(&models.VpnTrafficHourly{}, r.hourlyFrom, r.hourlyUntil))
+	}
+	if r.rawFrom.Before(r.rawUntil) {
+		sums := "COALESCE(SUM(vpn_traffic_stats.bytes_received_delta), 0) as bytes_received, COALESCE(SUM(vpn_traffic_stats.bytes_sent_delta), 0) as bytes_sent"
+		query := database.GetDB().Table("vpn_traffic_stats").
+			Where("vpn_traffic_stats.timestamp >= ? AND vpn_traffic_stats.timestamp < ?", r.rawFrom, r.rawUntil)
+		if userIDs != nil || byUser {
+			query = query.Joins("JOIN vpn_sessions ON vpn_sessions.id = vpn_traffic_stats.session_id")
+		}
+		if userIDs != nil {
+			query = query.Where("vpn_sessions.user_id IN (?)", userIDs)
+		}
+		if byUser {
+			query = query.Select("vpn_sessions.user_id, " + sums).Group("vpn_sessions.user_id")
+		} else {
+			query = query.Select(sums)
+		}
+		queries = append(queries, query)
+	}
+
+	var result []userTrafficRow
+	for _, query := range queries {
+		var rows []userTrafficRow
+		if err := query.Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, rows...)
+	}
+	return result, nil
+}
+
+// SumTraffic returns the traffic of the given users in [since, until). userIDs
+// may be nil for all users, a slice of IDs or a subquery selecting user IDs.
+// since should be aligned to an hour, and to a local day if it is before the
+// hourly retention.
+func SumTraffic(userIDs interface{}, since, until time.Time) (TrafficTotals, error) {
+	var totals TrafficTotals
+	rows, err := sumTrafficRows(userIDs, since, until, false)
+	if err != nil {
+		return totals, err
+	}
+	for _, r := range rows {
+		totals.BytesReceived += r.BytesReceived
+		totals.BytesSent += r.BytesSent
+	}
+	return totals, nil
+}
+
+// SumTrafficByUser returns the traffic of every user with traffic in [since, until),
+// combining the rollups and raw stats the same way as SumTraffic
+func SumTrafficByUser(since, until time.Time) (map[uuid.UUID]TrafficTotals, error) {
+	rows, err := sumTrafficRows(nil, since, until, true)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uuid.UUID]TrafficTotals)
+	for _, r := range rows {
+		t := result[r.UserID]
+		t.BytesReceived += r.BytesReceived
+		t.BytesSent += r.BytesSent
+		result[r.UserID] = t
+	}
+	return result, nil
+}
+
+// dayStart returns the start of the local day containing t, in UTC
+func dayStart(t time.Time) time.Time {
+	local := t.In(time.Local)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local).UTC()
+}
+
+// nextDay returns the start of the local day following the day starting at day, in UTC
+func nextDay(day time.Time) time.Time {
+	local := day.In(time.Local)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, time.Local).UTC()
+}
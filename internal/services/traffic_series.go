@@ -0,0 +1,204 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxSeriesPoints limits the number of buckets returned by a single series query
+const maxSeriesPoints = 2000
+
+var (
+	ErrInvalidSeriesBucket = apperror.Validation("Bucket must be one of 5m, 1h, 1d")
+	ErrInvalidSeriesRange  = apperror.Validation("End must be after start")
+	ErrSeriesTooLarge      = apperror.Validation(fmt.Sprintf("Time range contains more than %d buckets, use a larger bucket", maxSeriesPoints))
+)
+
+// seriesBuckets maps supported bucket names to their size
+var seriesBuckets = map[string]time.Duration{
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// GetSeries returns traffic aggregated into fixed-size buckets. 5m and 1h
+// buckets are aligned to the Unix epoch (UTC), 1d buckets to local days like
+// the dashboard. 5m buckets are computed from raw traffic stats and are
+// therefore limited to the raw retention; 1h buckets are computed from the
+// hourly rollups plus raw stats newer than the rollup watermark, and 1d buckets
+// also from the daily rollups past the hourly retention.
+func (s *VpnTrafficStatsService) GetSeries(filter *dto.TrafficSeriesFilter) (*dto.TrafficSeriesResponse, error) {
+	bucket := filter.Bucket
+	if bucket == "" {
+		bucket = "1h"
+	}
+	size, ok := seriesBuckets[bucket]
+	if !ok {
+		return nil, ErrInvalidSeriesBucket
+	}
+	daily := bucket == "1d"
+
+	end := time.Now().UTC()
+	if filter.End != nil {
+		end = filter.End.UTC()
+	}
+	start := end.Add(-24 * time.Hour)
+	if filter.Start != nil {
+		start = filter.Start.UTC()
+	}
+	if !end.After(start) {
+		return nil, ErrInvalidSeriesRange
+	}
+
+	// Align start down to a bucket boundary. Daily buckets are summed from
+	// hours and folded into local days.
+	seconds := int64(size / time.Second)
+	keyOf := func(t time.Time) int64 { return t.Unix() }
+	if daily {
+		start = dayStart(start)
+		seconds = int64(time.Hour / time.Second)
+		keyOf = func(t time.Time) int64 { return dayStart(t).Unix() }
+	} else {
+		start = time.Unix(start.Unix()/seconds*seconds, 0).UTC()
+	}
+	if end.Sub(start)/size > maxSeriesPoints {
+		return nil, ErrSeriesTooLarge
+	}
+
+	// Optional user, group or network scope
+	var userIDs interface{}
+	if filter.UserID != nil {
+		userIDs = []uuid.UUID{*filter.UserID}
+	} else if filter.GroupID != nil {
+		userIDs = database.GetDB().Table("user_groups").Select("user_id").Where("group_id = ?", *filter.GroupID)
+	} else if filter.NetworkID != nil {
+		groupIDs := database.GetDB().Table("network_groups").Select("group_id").Where("network_id = ?", *filter.NetworkID)
+		userIDs = database.GetDB().Table("user_groups").Select("user_id").Where("group_id IN (?)", groupIDs)
+	}
+
+	values := make(map[int64]*dto.TrafficSeriesPoint)
+	add := func(t time.Time, received, sent int64) {
+		key := keyOf(t)
+		p, ok := values[key]
+		if !ok {
+			p = &dto.TrafficSeriesPoint{Timestamp: time.Unix(key, 0).UTC()}
+			values[key] = p
+		}
+		p.BytesReceived += received
+		p.BytesSent += sent
+	}
+
+	rawFrom := start
+	if bucket != "5m" {
+		r, err := getTrafficRanges(start, end)
+		if err != nil {
+			return nil, err
+		}
+		if daily && r.dailyFrom.Before(r.dailyUntil) {
+			query := database.GetDB().Model(&models.VpnTrafficDaily{}).
+				Select("bucket_start, COALESCE(SUM(bytes_received), 0) as bytes_received, COALESCE(SUM(bytes_sent), 0) as bytes_sent").
+				Where("bucket_start >= ? AND bucket_start < ?", r.dailyFrom, r.dailyUntil).
+				Group("bucket_start")
+			if userIDs != nil {
+				query = query.Where("user_id IN (?)", userIDs)
+			}
+			var rows []struct {
+				BucketStart   time.Time
+				BytesReceived int64
+				BytesSent     int64
+			}
+			if err := query.Scan(&rows).Error; err != nil {
+				return nil, err
+			}
+			for _, row := range rows {
+				add(row.BucketStart, row.BytesReceived, row.BytesSent)
+			}
+		}
+		if r.hourlyFrom.Before(r.hourlyUntil) {
+			query := database.GetDB().Table("vpn_traffic_hourly").
+				Select(bucketExpr("vpn_traffic_hourly.bucket_start", seconds)+" as bucket, COALESCE(SUM(vpn_traffic_hourly.bytes_received), 0) as bytes_received, COALESCE(SUM(vpn_traffic_hourly.bytes_sent), 0) as bytes_sent").
+				Where("vpn_traffic_hourly.bucket_start >= ? AND vpn_traffic_hourly.bucket_start < ?", r.hourlyFrom, r.hourlyUntil)
+			if userIDs != nil {
+				query = query.Where("vpn_traffic_hourly.user_id IN (?)", userIDs)
+			}
+			if err := scanSeries(query, add); err != nil {
+				return nil, err
+			}
+		}
+		rawFrom = r.rawFrom
+	}
+
+	if rawFrom.Before(end) {
+		query := database.GetDB().Table("vpn_traffic_stats").
+			Select(bucketExpr("vpn_traffic_stats.timestamp", seconds)+" as bucket, COALESCE(SUM(vpn_traffic_stats.bytes_received_delta), 0) as bytes_received, COALESCE(SUM(vpn_traffic_stats.bytes_sent_delta), 0) as bytes_sent").
+			Where("vpn_traffic_stats.timestamp >= ? AND vpn_traffic_stats.timestamp < ?", rawFrom, end)
+		if userIDs != nil {
+			query = query.Joins("JOIN vpn_sessions ON vpn_sessions.id = vpn_traffic_stats.session_id").
+				Where("vpn_sessions.user_id IN (?)", userIDs)
+		}
+		if err := scanSeries(query, add); err != nil {
+			return nil, err
+		}
+	}
+
+	// Generate all buckets in range, filling in empty ones with zeros
+	next := func(t time.Time) time.Time { return t.Add(size) }
+	if daily {
+		next = nextDay
+	}
+	points := make([]dto.TrafficSeriesPoint, 0, end.Sub(start)/size+1)
+	for t := start; t.Before(end); t = next(t) {
+		if p, ok := values[t.Unix()]; ok {
+			points = append(points, *p)
+		} else {
+			points = append(points, dto.TrafficSeriesPoint{Timestamp: t})
+		}
+	}
+
+	return &dto.TrafficSeriesResponse{
+		Bucket: bucket,
+		Start:  start,
+		End:    end,
+		Points: points,
+	}, nil
+}
+
+// scanSeries runs a bucketed aggregation query and passes its rows to add
+func scanSeries(query *gorm.DB, add func(t time.Time, received, sent int64)) error {
+	type bucketRow struct {
+		Bucket        int64
+		BytesReceived int64
+		BytesSent     int64
+	}
+	var rows []bucketRow
+
+	if err := query.Group("bucket").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		add(time.Unix(r.Bucket, 0).UTC(), r.BytesReceived, r.BytesSent)
+	}
+	return nil
+}
+
+// bucketExpr returns a SQL expression flooring a timestamp column to the start of
+// its bucket, as Unix seconds
+func bucketExpr(column string, seconds int64) string {
+	switch database.GetDB().Dialector.Name() {
+	case "postgres":
+		return fmt.Sprintf("CAST(FLOOR(EXTRACT(EPOCH FROM %s) / %d) * %d AS BIGINT)", column, seconds, seconds)
+	case "mysql":
+		return fmt.Sprintf("CAST(FLOOR(UNIX_TIMESTAMP(%s) / %d) * %d AS SIGNED)", column, seconds, seconds)
+	default:
+		// SQLite
+		return fmt.Sprintf("(CAST(strftime('%%s', %s) AS INTEGER) / %d) * %d", column, seconds, seconds)
+	}
+}
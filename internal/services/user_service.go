@@ -2,9 +2,11 @@ package services
 
 import (
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
@@ -12,15 +14,23 @@ import (
 )
 
 var (
-	ErrUserExists = apperror.Conflict("User already exists")
+	ErrUserExists                = apperror.Conflict("User already exists")
+	ErrPasswordManagedExternally = apperror.Validation("Password is managed by an external identity provider")
 )
 
 // UserService provides user management services
-type UserService struct{}
+type UserService struct {
+	policy *PasswordPolicy
+}
 
-// NewUserService creates a new user service
+// NewUserService creates a new user service with the default password policy
 func NewUserService() *UserService {
-	return &UserService{}
+	return &UserService{policy: NewPasswordPolicy(nil)}
+}
+
+// NewUserServiceWithPolicy creates a new user service that enforces a password policy
+func NewUserServiceWithPolicy(cfg *config.PasswordPolicyConfig) *UserService {
+	return &UserService{policy: NewPasswordPolicy(cfg)}
 }
 
 // Create creates a new user
@@ -31,11 +41,22 @@ func (s *UserService) Create(req *dto.CreateUserRequest, createdBy uuid.UUID) (*
 		return nil, ErrUserExists
 	}
 
+	if err := s.policy.Validate(req.Password, req.Username, req.Email); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := HashPassword(req.Password)
 	if err != nil {
 		return nil, err
 	}
+	now := time.Now()
+
+	// The password was chosen by whoever created the user
+	mustChangePassword := true
+	if req.MustChangePassword != nil {
+		mustChangePassword = *req.MustChangePassword
+	}
 
 	// Default is_active to true if not specified
 	isActive := true
@@ -44,20 +65,23 @@ func (s *UserService) Create(req *dto.CreateUserRequest, createdBy uuid.UUID) (*
 	}
 
 	user := &models.User{
-		Username:   req.Username,
-		Password:   hashedPassword,
-		ManagerID:  req.ManagerID,
-		FirstName:  req.FirstName,
-		MiddleName: req.MiddleName,
-		LastName:   req.LastName,
-		Email:      req.Email,
-		Telephone:  req.Telephone,
-		Role:       req.Role,
-		IsActive:   isActive,
-		ValidFrom:  req.ValidFrom.ToTimePtr(),
-		ValidTo:    req.ValidTo.ToTimePtr(),
-		VpnIP:      req.VpnIP,
-		CreatedBy:  createdBy,
+		Username:            req.Username,
+		Password:            hashedPassword,
+		PasswordChangedAt:   &now,
+		MustChangePassword:  mustChangePassword,
+		ManagerID:           req.ManagerID,
+		FirstName:           req.FirstName,
+		MiddleName:          req.MiddleName,
+		LastName:            req.LastName,
+		Email:               req.Email,
+		Telephone:           req.Telephone,
+		Role:                req.Role,
+		IsActive:            isActive,
+		ValidFrom:           req.ValidFrom.ToTimePtr(),
+		ValidTo:             req.ValidTo.ToTimePtr(),
+		VpnIP:               req.VpnIP,
+		CreatedBy:           createdBy,
+		MonthlyTrafficQuota: req.MonthlyTrafficQuota,
 	}
 
 	if err := database.GetDB().Create(user).Error; err != nil {
@@ -133,12 +157,25 @@ func (s *UserService) Update(id uuid.UUID, req *dto.UpdateUserRequest, updatedBy
 	if req.VpnIP != nil {
 		updates["vpn_ip"] = *req.VpnIP
 	}
+	if req.MonthlyTrafficQuota != nil {
+		updates["monthly_traffic_quota"] = *req.MonthlyTrafficQuota
+	}
 
 	updates["updated_by"] = updatedBy
 
+	// Sessions must not keep a previous role or outlive a deactivation
+	invalidateTokens := (req.Role != "" && req.Role != user.Role) || (req.IsActive != nil && !*req.IsActive && user.IsActive)
+
 	if err := database.GetDB().Model(user).Updates(updates).Error; err != nil {
 		return nil, err
 	}
+	vpnAuthCache.Invalidate(id)
+
+	if invalidateTokens {
+		if err := InvalidateUserTokens(id); err != nil {
+			return nil, err
+		}
+	}
 
 	return s.GetByID(id)
 }
@@ -184,24 +221,67 @@ func (s *UserService) UpdatePassword(id uuid.UUID, currentPassword, newPassword
 		return err
 	}
 
+	if !user.HasLocalPassword() {
+		return ErrPasswordManagedExternally
+	}
+
 	if !VerifyPassword(currentPassword, user.Password) {
 		return ErrInvalidCredentials
 	}
 
+	return s.setPassword(user, newPassword, updatedBy, nil)
+}
+
+// setPassword validates a new password against the policy and history, stores
+// it and signs out all sessions of the user. inTx runs in the same transaction
+// after the password was stored.
+func (s *UserService) setPassword(user *models.User, newPassword string, updatedBy uuid.UUID, inTx func(tx *gorm.DB) error) error {
+	if err := s.policy.Validate(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+	if err := s.policy.CheckHistory(database.GetDB(), user, newPassword); err != nil {
+		return err
+	}
+
 	hashedPassword, err := HashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 
-	return database.GetDB().Model(user).Updates(map[string]interface{}{
-		"password":   hashedPassword,
-		"updated_by": updatedBy,
-	}).Error
+	oldHash := user.Password
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password":             hashedPassword,
+			"password_changed_at":  time.Now(),
+			"must_change_password": false,
+			"updated_by":           updatedBy,
+		}).Error; err != nil {
+			return err
+		}
+		if err := s.policy.Remember(tx, user.ID, oldHash); err != nil {
+			return err
+		}
+		if inTx != nil {
+			return inTx(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	vpnAuthCache.Invalidate(user.ID)
+
+	// Sign out all sessions, including the current one
+	return InvalidateUserTokens(user.ID)
 }
 
 // Delete soft deletes a user
 func (s *UserService) Delete(id uuid.UUID) error {
-	return database.GetDB().Delete(&models.User{}, "id = ?", id).Error
+	if err := database.GetDB().Delete(&models.User{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	vpnAuthCache.Invalidate(id)
+	return InvalidateUserTokens(id)
 }
 
 // List lists users with pagination
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+// VpnAuthCache remembers successful VPN logins for a short time, so clients
+// reconnecting after a VPN server restart skip password hashing. Entries are
+// keyed by an HMAC of username and password with a random per-process key, so
+// neither is kept in memory, and are dropped when the user's password, account
+// or groups change or the user is over quota. With several manager
+// instances, changes made on another instance take effect after the TTL.
+type VpnAuthCache struct {
+	mu      sync.Mutex
+	enabled bool
+	ttl     time.Duration
+	max     int
+	key     []byte
+	entries map[string]*vpnAuthCacheEntry
+	byUser  map[uuid.UUID]map[string]struct{}
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	invalidations atomic.Int64
+}
+
+type vpnAuthCacheEntry struct {
+	user      models.User
+	expiresAt time.Time
+}
+
+// VpnAuthCacheStats are the counters of the VPN authentication cache
+type VpnAuthCacheStats struct {
+	Enabled       bool  `json:"enabled"`
+	TTL           int   `json:"ttl"` // in seconds
+	Entries       int   `json:"entries"`
+	MaxEntries    int   `json:"max_entries"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+// vpnAuthCache is shared by the VPN Auth API and the RADIUS server
+var vpnAuthCache = newVpnAuthCache(nil)
+
+func newVpnAuthCache(cfg *config.VpnAuthCacheConfig) *VpnAuthCache {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	c := &VpnAuthCache{
+		ttl:     time.Minute,
+		max:     10000,
+		key:     key,
+		entries: make(map[string]*vpnAuthCacheEntry),
+		byUser:  make(map[uuid.UUID]map[string]struct{}),
+	}
+	if cfg != nil {
+		c.enabled = cfg.Enabled
+		if cfg.TTL > 0 {
+			c.ttl = time.Duration(cfg.TTL) * time.Second
+		}
+		if cfg.MaxEntries > 0 {
+			c.max = cfg.MaxEntries
+		}
+	}
+	return c
+}
+
+// ConfigureVpnAuthCache replaces the VPN authentication cache with an empty
+// one configured by cfg, typically once at startup
+func ConfigureVpnAuthCache(cfg *config.VpnAuthCacheConfig) {
+	cache := newVpnAuthCache(cfg)
+	vpnAuthCache.mu.Lock()
+	defer vpnAuthCache.mu.Unlock()
+	vpnAuthCache.enabled = cache.enabled
+	vpnAuthCache.ttl = cache.ttl
+	vpnAuthCache.max = cache.max
+	vpnAuthCache.entries = cache.entries
+	vpnAuthCache.byUser = cache.byUser
+	vpnAuthCache.hits.Store(0)
+	vpnAuthCache.misses.Store(0)
+	vpnAuthCache.invalidations.Store(0)
+}
+
+// GetVpnAuthCache returns the VPN authentication cache
+func GetVpnAuthCache() *VpnAuthCache {
+	return vpnAuthCache
+}
+
+// cacheKey returns the keyed hash of the credentials
+func (c *VpnAuthCache) cacheKey(username, password string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Get returns the user of a cached successful login with these credentials
+func (c *VpnAuthCache) Get(username, password string, now time.Time) (*models.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return nil, false
+	}
+
+	key := c.cacheKey(username, password)
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		if ok {
+			c.remove(key, entry.user.ID)
+		}
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	user := entry.user
+	return &user, true
+}
+
+// Put remembers a successful login. When the cache is full and no entry has
+// expired, the login is not cached.
+func (c *VpnAuthCache) Put(username, password string, user *models.User, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return
+	}
+
+	if len(c.entries) >= c.max {
+		for key, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				c.remove(key, entry.user.ID)
+			}
+		}
+		if len(c.entries) >= c.max {
+			return
+		}
+	}
+
+	key := c.cacheKey(username, password)
+	c.entries[key] = &vpnAuthCacheEntry{user: *user, expiresAt: now.Add(c.ttl)}
+	if c.byUser[user.ID] == nil {
+		c.byUser[user.ID] = make(map[string]struct{})
+	}
+	c.byUser[user.ID][key] = struct{}{}
+}
+
+// Invalidate drops the cached logins of a user
+func (c *VpnAuthCache) Invalidate(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys, ok := c.byUser[userID]
+	if !ok {
+		return
+	}
+	for key := range keys {
+		delete(c.entries, key)
+	}
+	delete(c.byUser, userID)
+	c.invalidations.Add(1)
+}
+
+// Clear drops all cached logins, e.g. when a group with members changed
+func (c *VpnAuthCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) == 0 {
+		return
+	}
+	c.entries = make(map[string]*vpnAuthCacheEntry)
+	c.byUser = make(map[uuid.UUID]map[string]struct{})
+	c.invalidations.Add(1)
+}
+
+// Stats returns the cache counters
+func (c *VpnAuthCache) Stats() VpnAuthCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return VpnAuthCacheStats{
+		Enabled:       c.enabled,
+		TTL:           int(c.ttl.Seconds()),
+		Entries:       len(c.entries),
+		MaxEntries:    c.max,
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+func (c *VpnAuthCache) remove(key string, userID uuid.UUID) {
+	delete(c.entries, key)
+	if keys, ok := c.byUser[userID]; ok {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.byUser, userID)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+var (
+	ErrAccountLocked      = apperror.TooManyRequests("Account temporarily locked")
+	ErrVpnLoginBlocked    = apperror.Forbidden("Login blocked by anomaly detection")
+	ErrAnomalyCheckFailed = apperror.Internal("Failed to check login anomalies")
+	ErrQuotaCheckFailed   = apperror.Internal("Failed to check traffic quota")
+)
+
+// AccountLockedError is returned for a VPN login to an account locked after
+// too many failed logins. It matches ErrAccountLocked with errors.Is.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return ErrAccountLocked.Error()
+}
+
+// Unwrap returns ErrAccountLocked
+func (e *AccountLockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// VpnAuthService decides whether a user may connect to the VPN. It is shared
+// by the VPN Auth API and the RADIUS server.
+type VpnAuthService struct {
+	authenticator  Authenticator
+	userService    *UserService
+	quotaService   *QuotaService
+	anomalyService *AnomalyService
+	cache          *VpnAuthCache
+	security       *config.SecurityConfig
+}
+
+// NewVpnAuthService creates a new VPN auth service
+func NewVpnAuthService(authCfg *config.AuthConfig, anomalyCfg *config.AnomalyConfig) *VpnAuthService {
+	return &VpnAuthService{
+		authenticator:  NewAuthenticator(authCfg),
+		userService:    NewUserService(),
+		quotaService:   NewQuotaService(),
+		anomalyService: NewAnomalyService(anomalyCfg),
+		cache:          GetVpnAuthCache(),
+	}
+}
+
+// NewVpnAuthServiceWithSecurity creates a new VPN auth service with security config for lockout
+func NewVpnAuthServiceWithSecurity(authCfg *config.AuthConfig, anomalyCfg *config.AnomalyConfig, sec *config.SecurityConfig) *VpnAuthService {
+	s := NewVpnAuthService(authCfg, anomalyCfg)
+	s.security = sec
+	return s
+}
+
+// Authenticate verifies the credentials of a VPN login from clientIP (the
+// client's real IP, may be empty) and checks the account, the monthly traffic
+// quota and login anomalies. It returns ErrInvalidCredentials, ErrUserInactive,
+// ErrUserNotYetValid, ErrUserExpired, ErrQuotaExceeded, ErrVpnLoginBlocked or
+// an *AccountLockedError when the login is denied. With a security config,
+// failed logins count towards the lockout of the username like web logins.
+// Logins remembered by the VPN authentication cache skip only the password
+// verification.
+func (s *VpnAuthService) Authenticate(username, password, clientIP string) (*models.User, error) {
+	now := time.Now()
+	anomaly := s.anomalyService.Enabled()
+
+	// Deny logins from sources doing credential stuffing
+	if anomaly {
+		blocked, err := s.anomalyService.IsSourceBlocked(clientIP, now)
+		if err != nil {
+			return nil, ErrAnomalyCheckFailed
+		}
+		if blocked {
+			_ = s.anomalyService.RecordAttempt(username, nil, clientIP, false, now)
+			return nil, ErrVpnLoginBlocked
+		}
+	}
+
+	// Deny logins to locked accounts, even with the right password
+	var existing *models.User
+	if s.security != nil {
+		var u models.User
+		if err := database.GetDB().Where("username = ?", username).First(&u).Error; err == nil {
+			existing = &u
+		}
+		if existing != nil && existing.LockedUntil != nil && existing.LockedUntil.After(now) {
+			return nil, &AccountLockedError{Until: *existing.LockedUntil}
+		}
+	}
+
+	user, cached := s.cache.Get(username, password, now)
+	if !cached {
+		var err error
+		user, err = s.authenticator.Authenticate(username, password)
+		if err != nil {
+			if errors.Is(err, ErrInvalidCredentials) && existing != nil {
+				recordFailedLogin(s.security, existing)
+			}
+			return nil, s.failedLogin(username, clientIP, err, anomaly, now)
+		}
+	}
+
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+	if user.ValidFrom != nil && now.Before(*user.ValidFrom) {
+		return nil, ErrUserNotYetValid
+	}
+	if user.ValidTo != nil && now.After(*user.ValidTo) {
+		return nil, ErrUserExpired
+	}
+
+	// Reset failed attempts on successful login
+	if existing != nil {
+		resetFailedLogin(s.security, existing)
+	}
+
+	// Checked on cache hits too, since traffic grows while an entry is cached
+	if err := s.quotaService.Check(user.ID); err != nil {
+		if err == ErrQuotaExceeded {
+			s.cache.Invalidate(user.ID)
+			return nil, ErrQuotaExceeded
+		}
+		return nil, ErrQuotaCheckFailed
+	}
+
+	if anomaly {
+		blocked, err := s.anomalyService.CheckLogin(user, clientIP, now)
+		if err != nil {
+			return nil, ErrAnomalyCheckFailed
+		}
+		if blocked {
+			return nil, ErrVpnLoginBlocked
+		}
+		if err := s.anomalyService.RecordAttempt(user.Username, &user.ID, clientIP, true, now); err != nil {
+			return nil, ErrAnomalyCheckFailed
+		}
+	}
+
+	if !cached {
+		s.cache.Put(username, password, user, now)
+	}
+
+	return user, nil
+}
+
+// failedLogin records a login with wrong credentials for anomaly detection
+// and returns the error to report
+func (s *VpnAuthService) failedLogin(username, clientIP string, err error, anomaly bool, now time.Time) error {
+	if !errors.Is(err, ErrInvalidCredentials) {
+		return err
+	}
+	if anomaly {
+		var userID *uuid.UUID
+		if u, err := s.userService.GetByUsername(username); err == nil {
+			userID = &u.ID
+		}
+		if err := s.anomalyService.RecordAttempt(username, userID, clientIP, false, now); err == nil {
+			_, _ = s.anomalyService.CheckFailedLogin(username, clientIP, now)
+		}
+	}
+	return ErrInvalidCredentials
+}
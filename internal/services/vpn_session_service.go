@@ -3,6 +3,7 @@ package services
 import (
 	"errors"
 	"math"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
@@ -89,10 +90,11 @@ func (s *VpnSessionService) GetByID(id uuid.UUID) (*models.VpnSession, error) {
 // Create creates a new VPN session
 func (s *VpnSessionService) Create(req *dto.CreateVpnSessionRequest) (*models.VpnSession, error) {
 	session := &models.VpnSession{
-		UserID:      req.UserID,
-		VpnIP:       req.VpnIP,
-		ClientIP:    req.ClientIP,
-		ConnectedAt: req.ConnectedAt,
+		UserID:        req.UserID,
+		VpnIP:         req.VpnIP,
+		ClientIP:      req.ClientIP,
+		ConnectedAt:   req.ConnectedAt,
+		AcctSessionID: req.AcctSessionID,
 	}
 
 	if err := database.GetDB().Create(session).Error; err != nil {
@@ -141,6 +143,16 @@ func (s *VpnSessionService) GetActiveSessionByUserID(userID uuid.UUID) (*models.
 	return &session, nil
 }
 
+// GetActiveSessionByAcctSessionID returns the active session with a RADIUS Acct-Session-Id
+func (s *VpnSessionService) GetActiveSessionByAcctSessionID(acctSessionID string) (*models.VpnSession, error) {
+	var session models.VpnSession
+	if err := database.GetDB().Where("acct_session_id = ? AND disconnected_at IS NULL", acctSessionID).
+		Order("connected_at DESC").First(&session).Error; err != nil {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
 // GetUsageStats returns aggregated usage statistics
 func (s *VpnSessionService) GetUsageStats() (*dto.VpnUsageStats, error) {
 	var stats dto.VpnUsageStats
@@ -170,6 +182,20 @@ func (s *VpnSessionService) GetUsageStats() (*dto.VpnUsageStats, error) {
 	stats.TotalBytesSent = byteStats.TotalSent
 	stats.TotalBytes = byteStats.TotalReceived + byteStats.TotalSent
 
+	// Recent traffic from rollups
+	now := time.Now()
+	last24Hours, err := SumTraffic(nil, now.Add(-24*time.Hour).Truncate(time.Hour), now)
+	if err != nil {
+		return nil, err
+	}
+	stats.BytesLast24Hours = last24Hours.Total()
+
+	last30Days, err := SumTraffic(nil, now.AddDate(0, 0, -30).Truncate(time.Hour), now)
+	if err != nil {
+		return nil, err
+	}
+	stats.BytesLast30Days = last30Days.Total()
+
 	return &stats, nil
 }
 
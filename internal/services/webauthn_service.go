@@ -0,0 +1,367 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/database"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/webauthn"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebAuthnChallengeInvalid   = apperror.Validation("Security key request is invalid or has expired, please try again")
+	ErrWebAuthnFailed             = apperror.Unauthorized("Security key verification failed")
+	ErrWebAuthnCredentialNotFound = apperror.NotFound("Security key not found")
+	ErrWebAuthnCredentialExists   = apperror.Conflict("Security key is already registered")
+	ErrWebAuthnLastAdminKey       = apperror.Validation("Administrators must keep at least one security key")
+)
+
+// webAuthnTransports are the authenticator transports stored with a credential
+var webAuthnTransports = map[string]bool{
+	"usb": true, "nfc": true, "ble": true, "hybrid": true, "internal": true, "smart-card": true,
+}
+
+// WebAuthnService registers security keys and passkeys and signs users in
+// with them, as second factor after the password or without password
+type WebAuthnService struct {
+	config *config.WebAuthnConfig
+	rp     *webauthn.RelyingParty
+}
+
+// NewWebAuthnService creates a new WebAuthn service
+func NewWebAuthnService(cfg *config.WebAuthnConfig) *WebAuthnService {
+	return &WebAuthnService{
+		config: cfg,
+		rp: &webauthn.RelyingParty{
+			ID:      cfg.RPID,
+			Name:    cfg.RPName,
+			Origins: cfg.Origins,
+		},
+	}
+}
+
+// timeout returns the time a user has to complete a ceremony
+func (s *WebAuthnService) timeout() time.Duration {
+	if s.config.Timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(s.config.Timeout) * time.Second
+}
+
+// HasCredentials checks if a user has registered a security key
+func (s *WebAuthnService) HasCredentials(userID uuid.UUID) bool {
+	var count int64
+	database.GetDB().Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count)
+	return count > 0
+}
+
+// SetupRequired checks if a user must register a security key before
+// anything else, because the policy requires one for admins
+func (s *WebAuthnService) SetupRequired(user *models.User) bool {
+	return s.config.Enabled && s.config.RequireForAdmins && user.Role == models.RoleAdmin && !s.HasCredentials(user.ID)
+}
+
+// BeginRegistration starts registering a new security key for a user
+func (s *WebAuthnService) BeginRegistration(user *models.User) (*webauthn.CreationOptions, error) {
+	credentials, err := s.ListCredentials(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.createChallenge(models.WebAuthnPurposeRegister, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]webauthn.CredentialParameter, 0, len(webauthn.SupportedAlgorithms))
+	for _, alg := range webauthn.SupportedAlgorithms {
+		params = append(params, webauthn.CredentialParameter{Type: "public-key", Algorithm: alg})
+	}
+	return &webauthn.CreationOptions{
+		Challenge: challenge,
+		RP:        webauthn.RelyingPartyEntity{ID: s.rp.ID, Name: s.rp.Name},
+		User: webauthn.UserEntity{
+			ID:          user.ID[:],
+			Name:        user.Username,
+			DisplayName: user.GetFullName(),
+		},
+		PubKeyCredParams:   params,
+		Timeout:            int(s.timeout().Milliseconds()),
+		ExcludeCredentials: descriptors(credentials),
+		AuthenticatorSelection: webauthn.AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: webauthn.UserVerificationPreferred,
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration verifies the browser's response to BeginRegistration
+// and stores the new security key
+func (s *WebAuthnService) FinishRegistration(user *models.User, name string, response *webauthn.CredentialResponse) (*models.WebAuthnCredential, error) {
+	challenge, err := s.consumeChallenge(response)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Purpose != models.WebAuthnPurposeRegister || challenge.UserID == nil || *challenge.UserID != user.ID {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+
+	expected, err := webauthn.DecodeBase64URL(challenge.Challenge)
+	if err != nil {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	verified, err := s.rp.VerifyRegistration(expected, response, false)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+
+	credentialID := webauthn.Base64URL(verified.ID).String()
+	var count int64
+	database.GetDB().Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credentialID).Count(&count)
+	if count > 0 {
+		return nil, ErrWebAuthnCredentialExists
+	}
+
+	var transports []string
+	for _, t := range response.Response.Transports {
+		if webAuthnTransports[t] {
+			transports = append(transports, t)
+		}
+	}
+	aaguid := ""
+	if id, err := uuid.FromBytes(verified.AAGUID); err == nil && id != uuid.Nil {
+		aaguid = id.String()
+	}
+
+	credential := &models.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         strings.TrimSpace(name),
+		CredentialID: credentialID,
+		PublicKey:    verified.PublicKey,
+		Algorithm:    verified.Algorithm,
+		SignCount:    verified.SignCount,
+		AAGUID:       aaguid,
+		Transports:   strings.Join(transports, ","),
+	}
+	if err := database.GetDB().Create(credential).Error; err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// BeginLogin starts a security key login. With a user, whose password was
+// verified, the key is the second factor and must be one of theirs; without,
+// any discoverable credential (passkey) signs its owner in, which requires
+// user verification by the authenticator.
+func (s *WebAuthnService) BeginLogin(user *models.User) (*webauthn.RequestOptions, error) {
+	purpose := models.WebAuthnPurposeLogin
+	userVerification := webauthn.UserVerificationRequired
+	var userID *uuid.UUID
+	var allowed []webauthn.CredentialDescriptor
+	if user != nil {
+		credentials, err := s.ListCredentials(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		purpose = models.WebAuthnPurposeSecondFactor
+		userVerification = webauthn.UserVerificationPreferred
+		userID = &user.ID
+		allowed = descriptors(credentials)
+	}
+
+	challenge, err := s.createChallenge(purpose, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &webauthn.RequestOptions{
+		Challenge:        challenge,
+		Timeout:          int(s.timeout().Milliseconds()),
+		RPID:             s.rp.ID,
+		AllowCredentials: allowed,
+		UserVerification: userVerification,
+	}, nil
+}
+
+// FinishLogin verifies the browser's response to BeginLogin and returns the
+// user who signed in
+func (s *WebAuthnService) FinishLogin(response *webauthn.CredentialResponse) (*models.User, error) {
+	challenge, err := s.consumeChallenge(response)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Purpose != models.WebAuthnPurposeLogin && challenge.Purpose != models.WebAuthnPurposeSecondFactor {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+
+	var credential models.WebAuthnCredential
+	if err := database.GetDB().First(&credential, "credential_id = ?", webauthn.Base64URL(response.RawID).String()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnFailed
+		}
+		return nil, err
+	}
+	if challenge.UserID != nil && *challenge.UserID != credential.UserID {
+		return nil, ErrWebAuthnFailed
+	}
+	if handle := response.Response.UserHandle; len(handle) > 0 && string(handle) != string(credential.UserID[:]) {
+		return nil, ErrWebAuthnFailed
+	}
+
+	expected, err := webauthn.DecodeBase64URL(challenge.Challenge)
+	if err != nil {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	requireUV := challenge.Purpose == models.WebAuthnPurposeLogin
+	assertion, err := s.rp.VerifyAssertion(expected, credential.PublicKey, response, requireUV)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+	// A counter that does not increase indicates a cloned authenticator
+	if (assertion.SignCount != 0 || credential.SignCount != 0) && assertion.SignCount <= credential.SignCount {
+		return nil, ErrWebAuthnFailed
+	}
+
+	now := time.Now()
+	if err := database.GetDB().Model(&credential).Updates(map[string]interface{}{
+		"sign_count":   assertion.SignCount,
+		"last_used_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, "id = ?", credential.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnFailed
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListCredentials lists the security keys of a user
+func (s *WebAuthnService) ListCredentials(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	if err := database.GetDB().Where("user_id = ?", userID).Order("created_at ASC").Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// RenameCredential renames a security key of a user
+func (s *WebAuthnService) RenameCredential(userID, id uuid.UUID, name string) (*models.WebAuthnCredential, error) {
+	credential, err := s.getCredential(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Model(credential).Update("name", strings.TrimSpace(name)).Error; err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// DeleteCredential removes a security key of a user. Admins cannot remove
+// their last key while the policy requires one.
+func (s *WebAuthnService) DeleteCredential(user *models.User, id uuid.UUID) (*models.WebAuthnCredential, error) {
+	credential, err := s.getCredential(user.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.RequireForAdmins && user.Role == models.RoleAdmin {
+		var count int64
+		database.GetDB().Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&count)
+		if count <= 1 {
+			return nil, ErrWebAuthnLastAdminKey
+		}
+	}
+	if err := database.GetDB().Delete(credential).Error; err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// DeleteAllCredentials removes all security keys of a user who lost them,
+// and returns how many were removed
+func (s *WebAuthnService) DeleteAllCredentials(userID uuid.UUID) (int64, error) {
+	result := database.GetDB().Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *WebAuthnService) getCredential(userID, id uuid.UUID) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	if err := database.GetDB().First(&credential, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// createChallenge stores a new single-use challenge
+func (s *WebAuthnService) createChallenge(purpose string, userID *uuid.UUID) (webauthn.Base64URL, error) {
+	now := time.Now()
+	database.GetDB().Where("expires_at < ?", now).Delete(&models.WebAuthnChallenge{})
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Create(&models.WebAuthnChallenge{
+		Challenge: challenge.String(),
+		Purpose:   purpose,
+		UserID:    userID,
+		ExpiresAt: now.Add(s.timeout()),
+	}).Error; err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumeChallenge looks up and deletes the challenge a response was created
+// for, so that it cannot be answered twice
+func (s *WebAuthnService) consumeChallenge(response *webauthn.CredentialResponse) (*models.WebAuthnChallenge, error) {
+	received, err := webauthn.ClientChallenge(response)
+	if err != nil || len(received) == 0 {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+
+	var challenge models.WebAuthnChallenge
+	if err := database.GetDB().First(&challenge, "challenge = ?", webauthn.Base64URL(received).String()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnChallengeInvalid
+		}
+		return nil, err
+	}
+	result := database.GetDB().Delete(&models.WebAuthnChallenge{}, "id = ?", challenge.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrWebAuthnChallengeInvalid
+	}
+	return &challenge, nil
+}
+
+// descriptors lists credentials for the allow and exclude lists of a ceremony
+func descriptors(credentials []models.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	list := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		id, err := webauthn.DecodeBase64URL(c.CredentialID)
+		if err != nil {
+			continue
+		}
+		descriptor := webauthn.CredentialDescriptor{Type: "public-key", ID: id}
+		if c.Transports != "" {
+			descriptor.Transports = strings.Split(c.Transports, ",")
+		}
+		list = append(list, descriptor)
+	}
+	return list
+}
@@ -0,0 +1,198 @@
+// Package tlsserver serves HTTPS with a certificate and optional client CA
+// bundle loaded from files. The files are reloaded without a restart: new
+// handshakes use the new certificate while established connections go on.
+package tlsserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+)
+
+// cipherSuites are the TLS 1.2 suites offered: forward secret AEAD only.
+// TLS 1.3 suites are not configurable and always secure.
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Reloader holds the certificate and client CAs loaded from the files of a
+// TLSConfig
+type Reloader struct {
+	cfg *config.TLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	digest    [sha256.Size]byte // of the file contents, to detect changes
+}
+
+// NewReloader loads the files of cfg
+func NewReloader(cfg *config.TLSConfig) (*Reloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("cert_file and key_file are required")
+	}
+	r := &Reloader{cfg: cfg}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again and reports whether they changed. On error
+// the previous certificate stays in use.
+func (r *Reloader) Reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.cfg.CertFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(r.cfg.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	var caPEM []byte
+	if r.cfg.ClientCAFile != "" {
+		if caPEM, err = os.ReadFile(r.cfg.ClientCAFile); err != nil {
+			return false, err
+		}
+	}
+
+	digest := sha256.Sum256(bytes.Join([][]byte{certPEM, keyPEM, caPEM}, []byte{0}))
+	r.mu.RLock()
+	unchanged := r.cert != nil && digest == r.digest
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if caPEM != nil {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return false, fmt.Errorf("no certificates in %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCAs, r.digest = &cert, clientCAs, digest
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Certificate returns the current certificate
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// Watch reloads the files every interval until stop is closed. onReload is
+// called after each reload of changed files or failed attempt.
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}, onReload func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if changed, err := r.Reload(); changed || err != nil {
+				onReload(err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Config returns the server TLS configuration: TLS 1.2 or newer with forward
+// secret AEAD ciphers, HTTP/2, and client certificates verified against the
+// client CAs if configured
+func (r *Reloader) Config() (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	switch r.cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS min_version %q", r.cfg.MinVersion)
+	}
+	clientAuth := tls.NoClientCert
+	if r.cfg.ClientCAFile != "" {
+		switch r.cfg.ClientAuth {
+		case "", "require":
+			clientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			clientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unsupported TLS client_auth %q", r.cfg.ClientAuth)
+		}
+	}
+
+	base := &tls.Config{
+		MinVersion:       minVersion,
+		CipherSuites:     cipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+		NextProtos:       []string{"h2", "http/1.1"},
+		ClientAuth:       clientAuth,
+	}
+	// Each handshake gets the current certificate and client CAs
+	cfg := base.Clone()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*r.cert}
+		c.ClientCAs = r.clientCAs
+		return c, nil
+	}
+	return cfg, nil
+}
+
+// RedirectHandler redirects plain HTTP requests to HTTPS: to the host of
+// publicURL if it is https, otherwise to the requested host on httpsPort
+func RedirectHandler(publicURL string, httpsPort int) http.Handler {
+	var target *url.URL
+	if u, err := url.Parse(publicURL); err == nil && u.Scheme == "https" && u.Host != "" {
+		target = u
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		u := *req.URL
+		u.Scheme = "https"
+		if target != nil {
+			u.Host = target.Host
+		} else {
+			host := req.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+			if httpsPort != 443 {
+				host += ":" + strconv.Itoa(httpsPort)
+			}
+			u.Host = host
+		}
+		http.Redirect(w, req, u.String(), http.StatusPermanentRedirect)
+	})
+}
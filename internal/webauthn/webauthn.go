@@ -0,0 +1,384 @@
+// Package webauthn implements the relying party side of WebAuthn
+// (https://www.w3.org/TR/webauthn-2/): registration and authentication
+// ceremonies with security keys and passkeys. Attestation "none" is
+// requested, so attestation statements are not verified; ES256, EdDSA and
+// RS256 credentials are supported.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagAttestedData   = 0x40
+	flagExtensionsData = 0x80
+)
+
+// User verification requirements
+const (
+	UserVerificationRequired  = "required"
+	UserVerificationPreferred = "preferred"
+)
+
+// Client data types of the two ceremonies
+const (
+	clientDataCreate = "webauthn.create"
+	clientDataGet    = "webauthn.get"
+)
+
+// challengeSize is the number of random bytes of a challenge
+const challengeSize = 32
+
+// ErrVerification is returned, wrapped with the reason, when a ceremony
+// response does not verify
+var ErrVerification = errors.New("webauthn verification failed")
+
+// Base64URL is binary data encoded as unpadded base64url in JSON, as
+// exchanged with the browser
+type Base64URL []byte
+
+// MarshalJSON encodes the data as unpadded base64url
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes base64url data, with or without padding
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := DecodeBase64URL(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// DecodeBase64URL decodes base64url data, with or without padding
+func DecodeBase64URL(s string) (Base64URL, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// String returns the unpadded base64url encoding
+func (b Base64URL) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewChallenge returns a random challenge
+func NewChallenge() (Base64URL, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// RelyingPartyEntity identifies the relying party to the authenticator
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the user account of a new credential
+type UserEntity struct {
+	ID          Base64URL `json:"id" swaggertype:"string"` // user handle, returned by discoverable credentials
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialParameter is a credential type and algorithm the relying party accepts
+type CredentialParameter struct {
+	Type      string `json:"type"` // always "public-key"
+	Algorithm int    `json:"alg"`  // COSE algorithm
+}
+
+// CredentialDescriptor refers to a registered credential
+type CredentialDescriptor struct {
+	Type       string    `json:"type"` // always "public-key"
+	ID         Base64URL `json:"id" swaggertype:"string"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states requirements on the authenticator of a new credential
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the options of navigator.credentials.create()
+type CreationOptions struct {
+	Challenge              Base64URL              `json:"challenge" swaggertype:"string"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"` // in milliseconds
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options of navigator.credentials.get()
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge" swaggertype:"string"`
+	Timeout          int                    `json:"timeout"` // in milliseconds
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"` // empty for discoverable credentials
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CredentialResponse is the PublicKeyCredential returned by the browser,
+// with binary fields encoded as base64url
+type CredentialResponse struct {
+	ID       string                `json:"id"`
+	RawID    Base64URL             `json:"rawId" swaggertype:"string"`
+	Type     string                `json:"type"`
+	Response AuthenticatorResponse `json:"response"`
+}
+
+// AuthenticatorResponse holds the attestation response of a registration or
+// the assertion response of an authentication
+type AuthenticatorResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON" swaggertype:"string"`
+	AttestationObject Base64URL `json:"attestationObject,omitempty" swaggertype:"string"` // registration
+	Transports        []string  `json:"transports,omitempty"`                             // registration
+	AuthenticatorData Base64URL `json:"authenticatorData,omitempty" swaggertype:"string"` // authentication
+	Signature         Base64URL `json:"signature,omitempty" swaggertype:"string"`         // authentication
+	UserHandle        Base64URL `json:"userHandle,omitempty" swaggertype:"string"`        // authentication
+}
+
+// Credential is a verified new credential
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	Algorithm int
+	SignCount uint32
+	AAGUID    []byte
+}
+
+// Assertion is a verified authentication
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// clientData is the subset of CollectedClientData that is verified
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData is parsed authenticator data
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	aaguid    []byte
+	credID    []byte
+	publicKey []byte // COSE_Key, raw bytes
+}
+
+// RelyingParty verifies ceremonies for one relying party ID
+type RelyingParty struct {
+	ID      string   // domain of the web UI, e.g. "vpn.example.com"
+	Name    string   // shown by the authenticator
+	Origins []string // accepted origins, e.g. "https://vpn.example.com"
+}
+
+// ClientChallenge returns the challenge a response was created for, so the
+// ceremony can be looked up before the response is verified
+func ClientChallenge(cred *CredentialResponse) ([]byte, error) {
+	data, err := parseClientData(cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBase64URL(data.Challenge)
+}
+
+// VerifyRegistration verifies the response of navigator.credentials.create()
+// to challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, cred *CredentialResponse, requireUV bool) (*Credential, error) {
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, clientDataCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	value, _, err := decodeCBOR(cred.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrVerification, err)
+	}
+	attestation, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrVerification)
+	}
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if _, ok := attestation["fmt"].(string); !ok {
+		return nil, fmt.Errorf("%w: attestation format missing", ErrVerification)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 || len(authData.credID) == 0 {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrVerification)
+	}
+	if len(cred.RawID) > 0 && !bytes.Equal(cred.RawID, authData.credID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrVerification)
+	}
+
+	key, err := ParsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	return &Credential{
+		ID:        authData.credID,
+		PublicKey: authData.publicKey,
+		Algorithm: key.Algorithm,
+		SignCount: authData.signCount,
+		AAGUID:    authData.aaguid,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of navigator.credentials.get() to
+// challenge, signed with the credential's COSE public key
+func (rp *RelyingParty) VerifyAssertion(challenge, publicKey []byte, cred *CredentialResponse, requireUV bool) (*Assertion, error) {
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, clientDataGet, challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(cred.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), cred.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.Verify(signed, cred.Response.Signature) {
+		return nil, fmt.Errorf("%w: invalid signature", ErrVerification)
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// verifyClientData checks type, challenge and origin of the client data
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	data, err := parseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrVerification, data.Type)
+	}
+	received, err := DecodeBase64URL(data.Challenge)
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin request", ErrVerification)
+	}
+	origin := strings.TrimRight(data.Origin, "/")
+	for _, allowed := range rp.Origins {
+		if origin == strings.TrimRight(allowed, "/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q is not allowed", ErrVerification, data.Origin)
+}
+
+// verifyAuthenticatorData checks the relying party ID hash and user flags
+func (rp *RelyingParty) verifyAuthenticatorData(data *authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(data.rpIDHash, rpIDHash[:]) != 1 {
+		return fmt.Errorf("%w: relying party ID mismatch", ErrVerification)
+	}
+	if data.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	if requireUV && data.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrVerification)
+	}
+	return nil
+}
+
+func parseClientData(raw []byte) (*clientData, error) {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("%w: client data: %v", ErrVerification, err)
+	}
+	return &data, nil
+}
+
+// parseAuthenticatorData parses authenticator data, including attested
+// credential data when present
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+	data := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if data.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrVerification)
+		}
+		data.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("%w: invalid credential ID length", ErrVerification)
+		}
+		data.credID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %v", ErrVerification, err)
+		}
+		data.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if data.flags&flagExtensionsData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: extensions: %v", ErrVerification, err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrVerification)
+	}
+	return data, nil
+}
@@ -154,6 +154,57 @@ func TestAuthHandler_Login(t *testing.T) {
 	})
 }
 
+func TestAuthHandler_LoginWithSecurityKey(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:     "test-secret-key-for-testing-minimum-32-chars",
+		TokenExpiry:   24,
+		SessionExpiry: 24,
+		WebAuthn: config.WebAuthnConfig{
+			Enabled: true,
+			RPID:    "vpn.example.com",
+			Origins: []string{"https://vpn.example.com"},
+			Timeout: 300,
+		},
+	}
+	handler := handlers.NewAuthHandler(cfg, nil)
+	router := gin.New()
+	router.POST("/api/v1/auth/login", handler.Login)
+
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "keyowner")
+	require.NoError(t, db.Create(&models.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         "YubiKey",
+		CredentialID: "AQID",
+		PublicKey:    []byte{0xa0},
+		Algorithm:    -7,
+	}).Error)
+
+	jsonBody, _ := json.Marshal(dto.LoginRequest{Username: "keyowner", Password: "testpassword123"})
+	req, _ := http.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+
+	var response dto.LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.WebAuthnRequired)
+	assert.Empty(t, response.Token)
+	assert.Empty(t, response.RefreshToken)
+	require.NotNil(t, response.WebAuthn)
+	assert.Equal(t, "vpn.example.com", response.WebAuthn.PublicKey.RPID)
+	require.Len(t, response.WebAuthn.PublicKey.AllowCredentials, 1)
+	assert.Equal(t, []byte{1, 2, 3}, []byte(response.WebAuthn.PublicKey.AllowCredentials[0].ID))
+}
+
 func TestAuthHandler_Logout(t *testing.T) {
 	db := testutil.SetupTestDB(t)
 	defer testutil.CleanupTestDB(t, db)
@@ -207,6 +258,156 @@ func TestAuthHandler_Logout(t *testing.T) {
 	})
 }
 
+func TestAuthHandler_Refresh(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:     "test-secret-key-for-testing-minimum-32-chars",
+		TokenExpiry:   24,
+		SessionExpiry: 24,
+	}
+	handler := handlers.NewAuthHandler(cfg, nil)
+	testutil.CreateTestUserWithName(t, models.RoleUser, "refreshtest")
+
+	router := gin.New()
+	router.POST("/api/v1/auth/login", handler.Login)
+	router.POST("/api/v1/auth/refresh", handler.Refresh)
+	router.GET("/dashboard", handler.RefreshSession, middleware.AuthMiddleware(cfg, nil), func(c *gin.Context) {
+		c.String(http.StatusOK, middleware.GetAuthUser(c).Username)
+	})
+
+	login := func(t *testing.T) dto.LoginResponse {
+		t.Helper()
+		jsonBody, _ := json.Marshal(dto.LoginRequest{Username: "refreshtest", Password: "testpassword123"})
+		req, _ := http.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response dto.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+
+	t.Run("login returns short-lived access token and refresh token", func(t *testing.T) {
+		response := login(t)
+		assert.Equal(t, 15*60, response.ExpiresIn)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.InDelta(t, 24*3600, response.RefreshExpiresIn, 5)
+	})
+
+	t.Run("refresh with body rotates the token", func(t *testing.T) {
+		first := login(t)
+
+		jsonBody, _ := json.Marshal(dto.RefreshRequest{RefreshToken: first.RefreshToken})
+		req, _ := http.NewRequest("POST", "/api/v1/auth/refresh", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var response dto.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotEmpty(t, response.Token)
+		assert.NotEqual(t, first.RefreshToken, response.RefreshToken)
+		assert.Equal(t, "refreshtest", response.User.Username)
+		require.NotNil(t, cookie(w, "refresh_token"))
+		assert.Equal(t, response.RefreshToken, cookie(w, "refresh_token").Value)
+	})
+
+	t.Run("login sets session cookies and CSRF cookie", func(t *testing.T) {
+		jsonBody, _ := json.Marshal(dto.LoginRequest{Username: "refreshtest", Password: "testpassword123"})
+		req, _ := http.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotNil(t, cookie(w, "token"))
+		assert.True(t, cookie(w, "token").HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie(w, "token").SameSite)
+		assert.False(t, cookie(w, "token").Secure)
+		require.NotNil(t, cookie(w, "csrf_token"))
+		assert.NotEmpty(t, cookie(w, "csrf_token").Value)
+		assert.False(t, cookie(w, "csrf_token").HttpOnly)
+	})
+
+	t.Run("refresh with cookie", func(t *testing.T) {
+		first := login(t)
+
+		req, _ := http.NewRequest("POST", "/api/v1/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: first.RefreshToken})
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+		req.Header.Set("X-CSRF-Token", "csrf")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("refresh with cookie requires CSRF token", func(t *testing.T) {
+		first := login(t)
+
+		req, _ := http.NewRequest("POST", "/api/v1/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: first.RefreshToken})
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+		req.Header.Set("X-CSRF-Token", "other")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Nil(t, cookie(w, "refresh_token"))
+	})
+
+	t.Run("invalid refresh token clears cookies", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v1/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "invalid"})
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+		req.Header.Set("X-CSRF-Token", "csrf")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		require.NotNil(t, cookie(w, "refresh_token"))
+		assert.Empty(t, cookie(w, "refresh_token").Value)
+	})
+
+	t.Run("web page renews expired access token", func(t *testing.T) {
+		first := login(t)
+
+		req, _ := http.NewRequest("GET", "/dashboard", nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: "expired"})
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: first.RefreshToken})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "refreshtest", w.Body.String())
+		require.NotNil(t, cookie(w, "token"))
+		assert.NotEmpty(t, cookie(w, "token").Value)
+	})
+
+	t.Run("web page without refresh token is rejected", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/dashboard", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
 func TestAuthHandler_Me(t *testing.T) {
 	db := testutil.SetupTestDB(t)
 	defer testutil.CleanupTestDB(t, db)
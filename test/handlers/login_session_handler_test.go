@@ -0,0 +1,136 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/handlers"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestLoginSessionHandler(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:     "test-secret-key-for-testing-minimum-32-chars",
+		TokenExpiry:   24,
+		SessionExpiry: 24,
+	}
+	blacklist := middleware.NewTokenBlacklist()
+	defer blacklist.Stop()
+	authHandler := handlers.NewAuthHandler(cfg, blacklist)
+	handler := handlers.NewLoginSessionHandler(cfg, blacklist)
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "sessionuser")
+	testutil.CreateTestUserWithName(t, models.RoleAdmin, "sessionadmin")
+
+	router := gin.New()
+	router.POST("/api/v1/auth/login", authHandler.Login)
+	protected := router.Group("/api/v1", middleware.AuthMiddleware(cfg, blacklist))
+	protected.GET("/auth/sessions", handler.List)
+	protected.DELETE("/auth/sessions", handler.RevokeOthers)
+	protected.DELETE("/auth/sessions/:id", handler.Revoke)
+	protected.GET("/users/:id/sessions", middleware.RequireAdmin(), handler.ListUserSessions)
+	protected.DELETE("/users/:id/sessions", middleware.RequireAdmin(), handler.RevokeUserSessions)
+
+	login := func(t *testing.T, username, userAgent string) string {
+		t.Helper()
+		jsonBody, _ := json.Marshal(dto.LoginRequest{Username: username, Password: "testpassword123"})
+		req, _ := http.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response dto.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Token
+	}
+	call := func(method, url, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	list := func(t *testing.T, url, token string) dto.LoginSessionListResponse {
+		t.Helper()
+		w := call("GET", url, token)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response dto.LoginSessionListResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("list and revoke own sessions", func(t *testing.T) {
+		laptop := login(t, "sessionuser", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+		script := login(t, "sessionuser", "curl/8.5.0")
+
+		response := list(t, "/api/v1/auth/sessions", laptop)
+		require.Equal(t, int64(2), response.Total)
+		var other dto.LoginSessionResponse
+		for _, s := range response.Sessions {
+			if s.Device == "Firefox on Linux" {
+				assert.True(t, s.Current)
+			} else {
+				other = s
+			}
+		}
+		assert.Equal(t, "curl", other.Device)
+		assert.False(t, other.Current)
+
+		w := call("DELETE", "/api/v1/auth/sessions/"+other.ID.String(), laptop)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// The access token of the revoked session stops working at once
+		assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/v1/auth/sessions", script).Code)
+		assert.Equal(t, int64(1), list(t, "/api/v1/auth/sessions", laptop).Total)
+
+		w = call("DELETE", "/api/v1/auth/sessions/"+other.ID.String(), laptop)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = call("DELETE", "/api/v1/auth/sessions/invalid", laptop)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("revoke other sessions keeps the current one", func(t *testing.T) {
+		current := login(t, "sessionuser", "test-agent")
+		other := login(t, "sessionuser", "test-agent")
+
+		w := call("DELETE", "/api/v1/auth/sessions", current)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/v1/auth/sessions", other).Code)
+		response := list(t, "/api/v1/auth/sessions", current)
+		require.Equal(t, int64(1), response.Total)
+		assert.True(t, response.Sessions[0].Current)
+	})
+
+	t.Run("admin revokes all sessions of a user", func(t *testing.T) {
+		userToken := login(t, "sessionuser", "test-agent")
+		admin := login(t, "sessionadmin", "test-agent")
+		url := "/api/v1/users/" + user.ID.String() + "/sessions"
+
+		assert.Equal(t, http.StatusForbidden, call("GET", url, userToken).Code)
+		assert.NotZero(t, list(t, url, admin).Total)
+
+		w := call("DELETE", url, admin)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/v1/auth/sessions", userToken).Code)
+		assert.Zero(t, list(t, url, admin).Total)
+		assert.Equal(t, http.StatusOK, call("GET", "/api/v1/auth/sessions", admin).Code)
+	})
+}
@@ -0,0 +1,300 @@
+package handlers_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/handlers"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+// oidcStartLogin follows the login redirect to the issuer and returns the callback URL and state cookie
+func oidcStartLogin(t *testing.T, router *gin.Engine, issuer *testutil.OIDCIssuer) (*url.URL, *http.Cookie) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/oidc/login", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	var stateCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "oidc_login" {
+			stateCookie = c
+		}
+	}
+	require.NotNil(t, stateCookie)
+
+	return issuer.Authorize(t, w.Header().Get("Location")), stateCookie
+}
+
+// oidcCallback completes the login at the callback and returns the response
+func oidcCallback(t *testing.T, router *gin.Engine, issuer *testutil.OIDCIssuer) *httptest.ResponseRecorder {
+	callback, stateCookie := oidcStartLogin(t, router, issuer)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/oidc/callback?"+callback.RawQuery, nil)
+	req.AddCookie(stateCookie)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	return w
+}
+
+func TestOIDCHandler_Flow(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	gin.SetMode(gin.TestMode)
+
+	issuer := testutil.StartOIDCIssuer(t, "openvpn-mng", "client-secret")
+	cfg := &config.AuthConfig{
+		JWTSecret:     "test-secret-key-for-testing-minimum-32-chars",
+		TokenExpiry:   24,
+		SessionExpiry: 24,
+		OIDC: config.OIDCConfig{
+			Enabled:       true,
+			IssuerURL:     issuer.URL,
+			ClientID:      issuer.ClientID,
+			ClientSecret:  issuer.ClientSecret,
+			RedirectURL:   "http://vpn.example.com/auth/oidc/callback",
+			Scopes:        []string{"openid", "profile", "email"},
+			UsernameClaim: "preferred_username",
+			EmailClaim:    "email",
+			AutoCreate:    true,
+			DefaultRole:   "USER",
+		},
+	}
+	handler := handlers.NewOIDCHandler(cfg)
+
+	router := gin.New()
+	router.GET("/auth/oidc/login", handler.Login)
+	router.GET("/auth/oidc/callback", handler.Callback)
+	router.POST("/api/v1/auth/oidc/link", middleware.AuthMiddleware(cfg, nil), handler.StartLink)
+	router.GET("/auth/oidc/link/complete", middleware.AuthMiddleware(cfg, nil), handler.LinkComplete)
+	router.GET("/api/v1/auth/me", middleware.AuthMiddleware(cfg, nil), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"username": middleware.GetAuthUser(c).Username})
+	})
+
+	startLogin := func(t *testing.T) (*url.URL, *http.Cookie) {
+		return oidcStartLogin(t, router, issuer)
+	}
+
+	t.Run("sets token cookie accepted by auth middleware", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "webssouser", "email": "webssouser@example.com"})
+		callback, stateCookie := startLogin(t)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/auth/oidc/callback?"+callback.RawQuery, nil)
+		req.AddCookie(stateCookie)
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "/dashboard", w.Header().Get("Location"))
+
+		var tokenCookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "token" {
+				tokenCookie = c
+			}
+		}
+		require.NotNil(t, tokenCookie)
+		assert.True(t, tokenCookie.HttpOnly)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/v1/auth/me", nil)
+		req.AddCookie(tokenCookie)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "webssouser")
+	})
+
+	t.Run("rejects state mismatch", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "webssouser"})
+		callback, stateCookie := startLogin(t)
+
+		query := callback.Query()
+		query.Set("state", "forged")
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/auth/oidc/callback?"+query.Encode(), nil)
+		req.AddCookie(stateCookie)
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Contains(t, w.Header().Get("Location"), "/login?sso_error=")
+		for _, c := range w.Result().Cookies() {
+			assert.NotEqual(t, "token", c.Name)
+		}
+	})
+
+	t.Run("shows provider error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/auth/oidc/callback?error=access_denied&error_description=User+cancelled", nil)
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusFound, w.Code)
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Contains(t, location.Query().Get("sso_error"), "User cancelled")
+	})
+
+	t.Run("links identity to signed-in local user", func(t *testing.T) {
+		local := testutil.CreateTestUserWithName(t, models.RoleUser, "weblinked")
+		token, err := services.NewAuthService(cfg).IssueToken(local)
+		require.NoError(t, err)
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "weblinked"})
+
+		// The username alone does not sign in the local user
+		callback, stateCookie := startLogin(t)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/auth/oidc/callback?"+callback.RawQuery, nil)
+		req.AddCookie(stateCookie)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Contains(t, w.Header().Get("Location"), "/login?sso_error=")
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/api/v1/auth/oidc/link", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			URL string `json:"url"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		linkCookie := w.Result().Cookies()[0]
+		require.Equal(t, "oidc_login", linkCookie.Name)
+
+		callback = issuer.Authorize(t, response.URL)
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/auth/oidc/callback?"+callback.RawQuery, nil)
+		req.AddCookie(linkCookie)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusFound, w.Code)
+		location := w.Header().Get("Location")
+		assert.Equal(t, "/auth/oidc/link/complete?"+callback.RawQuery, location)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", location, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.AddCookie(linkCookie)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "/profile?sso_linked=1", w.Header().Get("Location"))
+
+		callback, stateCookie = startLogin(t)
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/auth/oidc/callback?"+callback.RawQuery, nil)
+		req.AddCookie(stateCookie)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "/dashboard", w.Header().Get("Location"))
+	})
+}
+
+func TestOIDCHandler_SecurityKey(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	gin.SetMode(gin.TestMode)
+
+	issuer := testutil.StartOIDCIssuer(t, "openvpn-mng", "client-secret")
+	cfg := &config.AuthConfig{
+		JWTSecret:     "test-secret-key-for-testing-minimum-32-chars",
+		TokenExpiry:   24,
+		SessionExpiry: 24,
+		OIDC: config.OIDCConfig{
+			Enabled:       true,
+			IssuerURL:     issuer.URL,
+			ClientID:      issuer.ClientID,
+			ClientSecret:  issuer.ClientSecret,
+			RedirectURL:   "http://vpn.example.com/auth/oidc/callback",
+			Scopes:        []string{"openid", "profile", "email"},
+			UsernameClaim: "preferred_username",
+			RoleClaim:     "groups",
+			RoleMapping:   map[string]string{"vpn-admins": "ADMIN"},
+			AutoCreate:    true,
+			DefaultRole:   "USER",
+		},
+		WebAuthn: config.WebAuthnConfig{
+			Enabled:          true,
+			RPID:             "vpn.example.com",
+			Origins:          []string{"https://vpn.example.com"},
+			Timeout:          300,
+			RequireForAdmins: true,
+		},
+	}
+	handler := handlers.NewOIDCHandler(cfg)
+
+	router := gin.New()
+	router.GET("/auth/oidc/login", handler.Login)
+	router.GET("/auth/oidc/callback", handler.Callback)
+
+	hasTokenCookie := func(w *httptest.ResponseRecorder) bool {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "token" {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("requires security key of user who has one", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "keyssouser"})
+		w := oidcCallback(t, router, issuer)
+		require.Equal(t, "/dashboard", w.Header().Get("Location"))
+
+		var user models.User
+		require.NoError(t, db.First(&user, "username = ?", "keyssouser").Error)
+		require.NoError(t, db.Create(&models.WebAuthnCredential{
+			UserID:       user.ID,
+			Name:         "YubiKey",
+			CredentialID: "AQID",
+			PublicKey:    []byte{0xa0},
+			Algorithm:    -7,
+		}).Error)
+
+		w = oidcCallback(t, router, issuer)
+		assert.False(t, hasTokenCookie(w))
+
+		location := w.Header().Get("Location")
+		require.True(t, strings.HasPrefix(location, "/login#webauthn="), location)
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(location, "/login#webauthn="))
+		require.NoError(t, err)
+
+		var options dto.WebAuthnLoginOptions
+		require.NoError(t, json.Unmarshal(data, &options))
+		assert.Equal(t, "vpn.example.com", options.PublicKey.RPID)
+		require.Len(t, options.PublicKey.AllowCredentials, 1)
+		assert.Equal(t, []byte{1, 2, 3}, []byte(options.PublicKey.AllowCredentials[0].ID))
+	})
+
+	t.Run("sends admin without security key to registration", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "ssoadmin", "groups": "vpn-admins"})
+		w := oidcCallback(t, router, issuer)
+
+		assert.Equal(t, "/profile", w.Header().Get("Location"))
+		var token string
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "token" {
+				token = c.Value
+			}
+		}
+		require.NotEmpty(t, token)
+		claims, err := middleware.ParseToken(cfg, token)
+		require.NoError(t, err)
+		assert.True(t, claims.WebAuthnSetupRequired)
+	})
+}
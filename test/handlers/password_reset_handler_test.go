@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/handlers"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/mailer"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+// blockingMailer holds every message until released
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan *mailer.Message
+}
+
+func (m *blockingMailer) Send(msg *mailer.Message) error {
+	<-m.release
+	m.sent <- msg
+	return nil
+}
+
+func TestPasswordResetHandler_ForgotPassword(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	// The request completes in the background; share the in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:           "test-secret-key-for-testing-minimum-32-chars",
+		PasswordResetExpiry: 30,
+	}
+	m := &blockingMailer{release: make(chan struct{}), sent: make(chan *mailer.Message, 1)}
+	handler := handlers.NewPasswordResetHandler(cfg, "https://vpn.example.com", m)
+	router := gin.New()
+	router.POST("/api/v1/auth/password/forgot", handler.ForgotPassword)
+
+	forgot := func(login string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(dto.ForgotPasswordRequest{Login: login})
+		req, _ := http.NewRequest("POST", "/api/v1/auth/password/forgot", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "slowsmtp")
+
+	// The response does not wait for the SMTP server
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- forgot("slowsmtp") }()
+	var existing *httptest.ResponseRecorder
+	select {
+	case existing = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Response waited for the email")
+	}
+	unknown := forgot("nobody")
+	assert.Equal(t, http.StatusOK, existing.Code)
+	assert.Equal(t, unknown.Code, existing.Code)
+	assert.Equal(t, unknown.Body.String(), existing.Body.String())
+
+	close(m.release)
+	select {
+	case msg := <-m.sent:
+		assert.Equal(t, user.Email, msg.To)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reset link was not sent")
+	}
+
+	assert.Eventually(t, func() bool {
+		var count int64
+		db.Model(&models.AuditLog{}).
+			Where("user_id = ? AND action = ?", user.ID, models.AuditActionPasswordReset).
+			Count(&count)
+		return count == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/handlers"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestSecurityAlertHandler_ListMarkupInUsername(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AnomalyConfig{
+		Enabled:           true,
+		BlockSeverity:     "high",
+		StuffingWindow:    10,
+		StuffingUsernames: 3,
+	}
+	anomaly := services.NewAnomalyService(cfg)
+	handler := handlers.NewSecurityAlertHandler(cfg)
+	router := gin.New()
+	router.GET("/api/v1/security/alerts", handler.List)
+
+	// The username of a failed VPN login is chosen by the client
+	const username = `<img src=x onerror=alert(document.cookie)>`
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, anomaly.RecordAttempt(fmt.Sprintf("stuffed%d", i), nil, "192.0.2.60", false, now))
+	}
+	require.NoError(t, anomaly.RecordAttempt(username, nil, "192.0.2.60", false, now))
+	alert, err := anomaly.CheckFailedLogin(username, "192.0.2.60", now)
+	require.NoError(t, err)
+	require.NotNil(t, alert)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/security/alerts", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Markup never appears raw in the response; the page escapes it as text
+	assert.NotContains(t, w.Body.String(), "<img")
+
+	var response dto.SecurityAlertListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Alerts, 1)
+	assert.Equal(t, username, response.Alerts[0].Username)
+}
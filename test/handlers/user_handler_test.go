@@ -133,6 +133,57 @@ func TestUserHandler_Create(t *testing.T) {
 		assert.Equal(t, http.StatusForbidden, w.Code)
 	})
 
+	t.Run("only admins skip the password change", func(t *testing.T) {
+		admin := testutil.CreateTestAdmin(t)
+		manager := testutil.CreateTestManager(t)
+
+		for i, tt := range []struct {
+			creator  *models.User
+			apiKey   bool
+			expected int
+		}{
+			{manager, false, http.StatusForbidden},
+			{admin, true, http.StatusForbidden},
+			{admin, false, http.StatusCreated},
+		} {
+			router, handler := setupUserRouter(&dto.AuthUser{
+				ID:       tt.creator.ID.String(),
+				Username: tt.creator.Username,
+				Role:     tt.creator.Role,
+			})
+			if tt.apiKey {
+				router.Use(func(c *gin.Context) {
+					c.Set(middleware.APIKeyContextKey, &models.APIKey{CreatedBy: tt.creator.ID})
+					c.Next()
+				})
+			}
+			router.POST("/api/v1/users", handler.Create)
+
+			username := fmt.Sprintf("keeppassword%d", i)
+			jsonBody, _ := json.Marshal(dto.CreateUserRequest{
+				Username:           username,
+				Password:           "password123",
+				FirstName:          "Keep",
+				LastName:           "Password",
+				Email:              username + "@test.com",
+				Role:               models.RoleUser,
+				MustChangePassword: testutil.BoolPtr(false),
+			})
+
+			req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		}
+
+		var created models.User
+		require.NoError(t, db.First(&created, "username = ?", "keeppassword2").Error)
+		assert.False(t, created.MustChangePassword)
+	})
+
 	t.Run("fails with invalid body", func(t *testing.T) {
 		admin := testutil.CreateTestAdmin(t)
 		router, handler := setupUserRouter(&dto.AuthUser{
@@ -431,6 +482,38 @@ func TestUserHandler_Update(t *testing.T) {
 
 		assert.Equal(t, http.StatusForbidden, w.Code)
 	})
+
+	t.Run("manager cannot change traffic quota", func(t *testing.T) {
+		manager := testutil.CreateTestManager(t)
+		subordinate := testutil.CreateManagedUser(t, manager.ID)
+
+		router, handler := setupUserRouter(&dto.AuthUser{
+			ID:       manager.ID.String(),
+			Username: manager.Username,
+			Role:     manager.Role,
+		})
+		router.PUT("/api/v1/users/:id", handler.Update)
+
+		unlimited := int64(0)
+		quota := int64(1 << 30)
+		for _, tt := range []struct {
+			quota    *int64
+			expected int
+		}{
+			{&quota, http.StatusForbidden},
+			{&unlimited, http.StatusOK}, // unchanged
+		} {
+			jsonBody, _ := json.Marshal(dto.UpdateUserRequest{MonthlyTrafficQuota: tt.quota})
+
+			req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/v1/users/%s", subordinate.ID), bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		}
+	})
 }
 
 func TestUserHandler_Delete(t *testing.T) {
@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/handlers"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestVpnAuthHandler_Authenticate(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	gin.SetMode(gin.TestMode)
+
+	secCfg := &config.SecurityConfig{
+		RateLimitEnabled:   true,
+		RateLimitRequests:  1,
+		RateLimitWindow:    60,
+		RateLimitBurst:     3,
+		LockoutMaxAttempts: 3,
+		LockoutDuration:    15,
+	}
+	rl := middleware.NewRateLimiter(secCfg)
+	defer rl.Stop()
+	handler := handlers.NewVpnAuthHandler(&config.AuthConfig{}, &config.AnomalyConfig{}, secCfg, rl)
+
+	router := gin.New()
+	router.POST("/api/v1/vpn-auth/authenticate", handler.Authenticate)
+
+	authenticate := func(username, password, untrustedIP string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(handlers.VpnAuthRequest{
+			Username:    username,
+			Password:    password,
+			UntrustedIP: untrustedIP,
+		})
+		req, _ := http.NewRequest("POST", "/api/v1/vpn-auth/authenticate", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		// Every request comes from the VPN server
+		req.RemoteAddr = "10.0.0.1:40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("rate limit applies per end user IP", func(t *testing.T) {
+		testutil.CreateTestUserWithName(t, models.RoleUser, "vpnratelimit")
+
+		for i := 0; i < 3; i++ {
+			w := authenticate("vpnratelimit", "testpassword123", "198.51.100.1")
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+		w := authenticate("vpnratelimit", "testpassword123", "198.51.100.1")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		// Another end user behind the same VPN server is not affected
+		w = authenticate("vpnratelimit", "testpassword123", "198.51.100.2")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("locked account gets a distinct response", func(t *testing.T) {
+		testutil.CreateTestUserWithName(t, models.RoleUser, "vpnlocked")
+
+		for i := 0; i < 3; i++ {
+			w := authenticate("vpnlocked", "wrongpassword", "198.51.100.10")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+
+		w := authenticate("vpnlocked", "testpassword123", "198.51.100.11")
+		assert.Equal(t, http.StatusLocked, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		var response handlers.VpnAuthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.False(t, response.Success)
+		assert.True(t, response.Locked)
+	})
+}
@@ -0,0 +1,162 @@
+package jwtkeys_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/jwtkeys"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+const testSecret = "test-secret-key-for-testing-minimum-32-chars"
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "user",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func TestKeySet_HS256(t *testing.T) {
+	keys := jwtkeys.For(&config.AuthConfig{JWTSecret: testSecret})
+	require.NoError(t, keys.Load())
+	assert.Equal(t, jwtkeys.AlgorithmHS256, keys.Algorithm())
+
+	t.Run("signs and verifies", func(t *testing.T) {
+		token, err := keys.Sign(testClaims())
+		require.NoError(t, err)
+
+		_, err = keys.Parse(token, jwt.MapClaims{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects other signing methods", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims()).SignedString([]byte(testSecret))
+		require.NoError(t, err)
+
+		_, err = keys.Parse(token, jwt.MapClaims{})
+		assert.Error(t, err)
+
+		unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+		_, err = keys.Parse(unsigned, jwt.MapClaims{})
+		assert.Error(t, err)
+	})
+
+	t.Run("publishes no keys", func(t *testing.T) {
+		jwks, err := keys.JWKS()
+		require.NoError(t, err)
+		assert.Empty(t, jwks.Keys)
+	})
+
+	t.Run("cannot rotate", func(t *testing.T) {
+		_, err := keys.Rotate()
+		assert.ErrorIs(t, err, jwtkeys.ErrNotRotatable)
+	})
+}
+
+func TestKeySet_Asymmetric(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		kty       string
+	}{
+		{jwtkeys.AlgorithmRS256, "RSA"},
+		{jwtkeys.AlgorithmEdDSA, "OKP"},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			db := testutil.SetupTestDB(t)
+			defer testutil.CleanupTestDB(t, db)
+
+			cfg := &config.AuthConfig{JWTSecret: testSecret, JWTAlgorithm: tc.algorithm}
+			keys := jwtkeys.For(cfg)
+			require.NoError(t, keys.Load())
+
+			token, err := keys.Sign(testClaims())
+			require.NoError(t, err)
+			parsed, err := keys.Parse(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			firstKid := parsed.Header["kid"].(string)
+			assert.NotEmpty(t, firstKid)
+
+			jwks, err := keys.JWKS()
+			require.NoError(t, err)
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, tc.kty, jwks.Keys[0].Kty)
+			assert.Equal(t, tc.algorithm, jwks.Keys[0].Alg)
+			assert.Equal(t, firstKid, jwks.Keys[0].Kid)
+
+			t.Run("rotation keeps issued tokens valid", func(t *testing.T) {
+				rotated, err := keys.Rotate()
+				require.NoError(t, err)
+				assert.NotEqual(t, firstKid, rotated.ID)
+
+				_, err = keys.Parse(token, jwt.MapClaims{})
+				assert.NoError(t, err)
+
+				newToken, err := keys.Sign(testClaims())
+				require.NoError(t, err)
+				parsed, err := keys.Parse(newToken, jwt.MapClaims{})
+				require.NoError(t, err)
+				assert.Equal(t, rotated.ID, parsed.Header["kid"])
+
+				jwks, err := keys.JWKS()
+				require.NoError(t, err)
+				assert.Len(t, jwks.Keys, 2)
+			})
+
+			t.Run("other instances verify keys rotated elsewhere", func(t *testing.T) {
+				other := jwtkeys.For(&config.AuthConfig{JWTSecret: testSecret, JWTAlgorithm: tc.algorithm})
+				require.NoError(t, other.Load())
+
+				rotated, err := keys.Rotate()
+				require.NoError(t, err)
+				newToken, err := keys.Sign(testClaims())
+				require.NoError(t, err)
+
+				parsed, err := other.Parse(newToken, jwt.MapClaims{})
+				require.NoError(t, err)
+				assert.Equal(t, rotated.ID, parsed.Header["kid"])
+			})
+
+			t.Run("expired retired keys are removed", func(t *testing.T) {
+				require.NoError(t, db.Model(&models.JWTSigningKey{}).Where("retired_at IS NOT NULL").
+					Update("retired_at", time.Now().Add(-24*time.Hour)).Error)
+				_, err := keys.Rotate()
+				require.NoError(t, err)
+
+				_, err = keys.Parse(token, jwt.MapClaims{})
+				assert.Error(t, err)
+			})
+
+			t.Run("rejects HS256 tokens", func(t *testing.T) {
+				hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte(testSecret))
+				require.NoError(t, err)
+
+				_, err = keys.Parse(hmac, jwt.MapClaims{})
+				assert.Error(t, err)
+			})
+
+			t.Run("rejects unknown kid", func(t *testing.T) {
+				other := jwtkeys.For(&config.AuthConfig{JWTSecret: testSecret, JWTAlgorithm: tc.algorithm})
+				foreign, err := other.Sign(testClaims())
+				require.NoError(t, err)
+				require.NoError(t, db.Where("1 = 1").Delete(&models.JWTSigningKey{}).Error)
+
+				fresh := jwtkeys.For(&config.AuthConfig{JWTSecret: testSecret, JWTAlgorithm: tc.algorithm})
+				_, err = fresh.Parse(foreign, jwt.MapClaims{})
+				assert.Error(t, err)
+			})
+		})
+	}
+}
+
+func TestKeySet_UnsupportedAlgorithm(t *testing.T) {
+	keys := jwtkeys.For(&config.AuthConfig{JWTSecret: testSecret, JWTAlgorithm: "none"})
+	assert.ErrorIs(t, keys.Load(), jwtkeys.ErrUnsupportedAlgorithm)
+}
@@ -0,0 +1,107 @@
+package mailer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/mailer"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestSMTPMailer(t *testing.T) {
+	stub := testutil.StartSMTPStub(t)
+	stub.Username = "mailer"
+	stub.Password = "secret"
+
+	cfg := &config.MailConfig{
+		Enabled:            true,
+		Host:               stub.Host,
+		Port:               stub.Port,
+		Username:           "mailer",
+		Password:           "secret",
+		From:               "OpenVPN Manager <vpn@example.com>",
+		TLS:                mailer.TLSModeStartTLS,
+		InsecureSkipVerify: true,
+	}
+
+	t.Run("sends multipart message over STARTTLS", func(t *testing.T) {
+		err := mailer.New(cfg).Send(&mailer.Message{
+			To:      "John Doe <john@example.com>",
+			Subject: "Hello",
+			Text:    "Plain body",
+			HTML:    "<p>HTML body</p>",
+		})
+		require.NoError(t, err)
+
+		msg := stub.WaitMessage(t)
+		assert.Equal(t, "vpn@example.com", msg.From)
+		assert.Equal(t, []string{"john@example.com"}, msg.To)
+		assert.Contains(t, msg.Data, "Subject: Hello")
+		assert.Contains(t, msg.Data, "multipart/alternative")
+		assert.Contains(t, msg.Data, "Plain body")
+		assert.Contains(t, msg.Data, "<p>HTML body</p>")
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		wrong := *cfg
+		wrong.Password = "wrong"
+		err := mailer.New(&wrong).Send(&mailer.Message{To: "john@example.com", Subject: "Hello", Text: "Body"})
+		assert.Error(t, err)
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		strict := *cfg
+		strict.InsecureSkipVerify = false
+		err := mailer.New(&strict).Send(&mailer.Message{To: "john@example.com", Subject: "Hello", Text: "Body"})
+		assert.Error(t, err)
+	})
+
+	t.Run("plain connection", func(t *testing.T) {
+		plain := testutil.StartSMTPStub(t)
+		plainCfg := &config.MailConfig{
+			Enabled: true,
+			Host:    plain.Host,
+			Port:    plain.Port,
+			From:    "vpn@example.com",
+			TLS:     mailer.TLSModeNone,
+		}
+		require.NoError(t, mailer.New(plainCfg).Send(&mailer.Message{To: "john@example.com", Subject: "Hello", Text: "Body"}))
+
+		msg := plain.WaitMessage(t)
+		assert.Contains(t, msg.Data, "text/plain")
+		assert.NotContains(t, msg.Data, "multipart")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		err := mailer.New(&config.MailConfig{}).Send(&mailer.Message{To: "john@example.com"})
+		assert.ErrorIs(t, err, mailer.ErrMailDisabled)
+	})
+}
+
+func TestRender(t *testing.T) {
+	t.Run("password reset", func(t *testing.T) {
+		msg, err := mailer.Render("password_reset", "john@example.com", map[string]interface{}{
+			"Name":      "John <Doe>",
+			"Username":  "jdoe",
+			"Link":      "https://vpn.example.com/reset-password?token=abc",
+			"ExpiresIn": 30,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "john@example.com", msg.To)
+		assert.Equal(t, "Reset your OpenVPN Manager password", msg.Subject)
+		assert.Contains(t, msg.Text, "Hello John <Doe>,")
+		assert.Contains(t, msg.Text, "https://vpn.example.com/reset-password?token=abc")
+		assert.Contains(t, msg.Text, "30 minutes")
+		// HTML is escaped
+		assert.Contains(t, msg.HTML, "John &lt;Doe&gt;")
+		assert.Contains(t, msg.HTML, `href="https://vpn.example.com/reset-password?token=abc"`)
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		_, err := mailer.Render("missing", "john@example.com", nil)
+		assert.Error(t, err)
+	})
+}
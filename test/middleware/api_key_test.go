@@ -0,0 +1,134 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+)
+
+// stubKeys accepts a single key granting one scope
+type stubKeys struct {
+	key   string
+	scope models.APIKeyScope
+	owner *models.User
+}
+
+func (s *stubKeys) ValidateAPIKey(key, clientIP string, scope models.APIKeyScope) (*models.APIKey, error) {
+	if key != s.key {
+		return nil, services.ErrInvalidAPIKey
+	}
+	if scope != s.scope {
+		return nil, services.ErrAPIKeyScope
+	}
+	return &models.APIKey{ID: uuid.New(), Scopes: string(s.scope), Creator: s.owner}, nil
+}
+
+func TestVpnTokenAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := &stubKeys{key: "ovm_vpnkey", scope: models.APIKeyScopeVpnAuth}
+	router := gin.New()
+	router.GET("/test", middleware.VpnTokenAuth("bootstrap-token", keys), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"api_key": middleware.GetAPIKey(c) != nil})
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"config token", middleware.VpnTokenHeader, "bootstrap-token", http.StatusOK},
+		{"API key in X-VPN-Token", middleware.VpnTokenHeader, "ovm_vpnkey", http.StatusOK},
+		{"API key in X-API-Key", middleware.APIKeyHeader, "ovm_vpnkey", http.StatusOK},
+		{"invalid token", middleware.VpnTokenHeader, "wrong", http.StatusUnauthorized},
+		{"missing token", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/test", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/test", middleware.VpnTokenAuth("", nil), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set(middleware.VpnTokenHeader, "anything")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
+
+func TestAuthOrAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AuthConfig{JWTSecret: "test-secret-key-for-testing-minimum-32-chars", TokenExpiry: 24}
+	owner := &models.User{ID: uuid.New(), Username: "keyadmin", Role: models.RoleAdmin, IsActive: true}
+	keys := &stubKeys{key: "ovm_reports", scope: models.APIKeyScopeReports, owner: owner}
+
+	router := gin.New()
+	router.GET("/reports", middleware.AuthOrAPIKey(cfg, nil, keys, models.APIKeyScopeReports), middleware.RequireAdmin(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"username": middleware.GetAuthUser(c).Username})
+	})
+	router.GET("/users", middleware.AuthOrAPIKey(cfg, nil, keys, models.APIKeyScopeUsers), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	t.Run("API key acts as its owner", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/reports", nil)
+		req.Header.Set(middleware.APIKeyHeader, "ovm_reports")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "keyadmin")
+	})
+
+	t.Run("API key without scope is forbidden", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/users", nil)
+		req.Header.Set(middleware.APIKeyHeader, "ovm_reports")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("falls back to JWT", func(t *testing.T) {
+		token := createTestToken(uuid.New(), "jwtadmin", models.RoleAdmin, cfg.JWTSecret, time.Hour)
+		req, _ := http.NewRequest("GET", "/reports", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "jwtadmin")
+	})
+
+	t.Run("disabled owner is rejected", func(t *testing.T) {
+		owner.IsActive = false
+		defer func() { owner.IsActive = true }()
+
+		req, _ := http.NewRequest("GET", "/reports", nil)
+		req.Header.Set(middleware.APIKeyHeader, "ovm_reports")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
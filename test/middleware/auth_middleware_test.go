@@ -152,6 +152,47 @@ func TestAuthMiddleware(t *testing.T) {
 
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
+
+	t.Run("expired password restricts token", func(t *testing.T) {
+		claims := &middleware.Claims{
+			UserID:                 uuid.New().String(),
+			Username:               "testuser",
+			Role:                   models.RoleUser,
+			PasswordChangeRequired: true,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWTSecret))
+		require.NoError(t, err)
+
+		router := gin.New()
+		router.Use(middleware.AuthMiddleware(cfg, nil))
+		ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "ok"}) }
+		router.PUT("/api/v1/users/password", ok)
+		router.GET("/api/v1/groups", ok)
+		router.GET("/dashboard", ok)
+
+		tests := []struct {
+			method string
+			path   string
+			code   int
+		}{
+			{"PUT", "/api/v1/users/password", http.StatusOK},
+			{"GET", "/api/v1/groups", http.StatusForbidden},
+			{"GET", "/dashboard", http.StatusFound},
+		}
+		for _, tt := range tests {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code, tt.path)
+		}
+	})
 }
 
 func TestRequireRole(t *testing.T) {
@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+)
+
+func TestConfigureClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(t *testing.T, cfg *config.SecurityConfig) *gin.Engine {
+		t.Helper()
+		router := gin.New()
+		require.NoError(t, middleware.ConfigureClientIP(router, cfg))
+		router.GET("/ip", func(c *gin.Context) {
+			c.String(http.StatusOK, c.ClientIP())
+		})
+		router.GET("/filtered", middleware.IPFilter([]string{"203.0.113.0/24"}), func(c *gin.Context) {
+			c.String(http.StatusOK, "ok")
+		})
+		return router
+	}
+
+	request := func(router *gin.Engine, path, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("forwarding headers are ignored without trusted proxies", func(t *testing.T) {
+		router := newRouter(t, &config.SecurityConfig{})
+
+		w := request(router, "/ip", "198.51.100.5:40000", "203.0.113.7")
+		assert.Equal(t, "198.51.100.5", w.Body.String())
+
+		// A spoofed header does not pass the IP filter
+		w = request(router, "/filtered", "198.51.100.5:40000", "203.0.113.7")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("trusted proxy forwards the client IP", func(t *testing.T) {
+		router := newRouter(t, &config.SecurityConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+
+		w := request(router, "/ip", "10.0.0.2:40000", "203.0.113.7, 10.0.0.3")
+		assert.Equal(t, "203.0.113.7", w.Body.String())
+
+		w = request(router, "/filtered", "10.0.0.2:40000", "203.0.113.7")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Other peers cannot spoof it
+		w = request(router, "/ip", "198.51.100.5:40000", "203.0.113.7")
+		assert.Equal(t, "198.51.100.5", w.Body.String())
+	})
+
+	t.Run("configured header", func(t *testing.T) {
+		router := newRouter(t, &config.SecurityConfig{
+			TrustedProxies:  []string{"10.0.0.2"},
+			RemoteIPHeaders: []string{"X-Real-IP"},
+		})
+
+		req, _ := http.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = "10.0.0.2:40000"
+		req.Header.Set("X-Forwarded-For", "192.0.2.1")
+		req.Header.Set("X-Real-IP", "203.0.113.8")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, "203.0.113.8", w.Body.String())
+	})
+
+	t.Run("invalid trusted proxy is rejected", func(t *testing.T) {
+		assert.Error(t, middleware.ConfigureClientIP(gin.New(), &config.SecurityConfig{TrustedProxies: []string{"bogus"}}))
+	})
+}
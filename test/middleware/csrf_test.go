@@ -0,0 +1,203 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+)
+
+func TestAuthMiddleware_CSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:   "test-secret-key-for-testing-minimum-32-chars",
+		TokenExpiry: 24,
+	}
+	token := createTestToken(uuid.New(), "testuser", models.RoleUser, cfg.JWTSecret, time.Hour)
+
+	router := gin.New()
+	router.Use(middleware.AuthMiddleware(cfg, nil))
+	router.GET("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name     string
+		method   string
+		prepare  func(req *http.Request)
+		expected int
+	}{
+		{
+			name:   "cookie GET needs no token",
+			method: "GET",
+			prepare: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name:   "cookie POST without token",
+			method: "POST",
+			prepare: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "token", Value: token})
+				req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: "csrf"})
+			},
+			expected: http.StatusForbidden,
+		},
+		{
+			name:   "cookie POST with wrong token",
+			method: "POST",
+			prepare: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "token", Value: token})
+				req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: "csrf"})
+				req.Header.Set(middleware.CSRFHeader, "other")
+			},
+			expected: http.StatusForbidden,
+		},
+		{
+			name:   "cookie POST with header but no CSRF cookie",
+			method: "POST",
+			prepare: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "token", Value: token})
+				req.Header.Set(middleware.CSRFHeader, "")
+			},
+			expected: http.StatusForbidden,
+		},
+		{
+			name:   "cookie POST with token",
+			method: "POST",
+			prepare: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "token", Value: token})
+				req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: "csrf"})
+				req.Header.Set(middleware.CSRFHeader, "csrf")
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name:   "bearer POST needs no token",
+			method: "POST",
+			prepare: func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+token)
+			},
+			expected: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/test", nil)
+			tt.prepare(req)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestSetCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cookie := func(cfg *config.CookieConfig, httpsRequest bool) *http.Cookie {
+		router := gin.New()
+		router.GET("/test", func(c *gin.Context) {
+			middleware.SetCookie(c, cfg, "token", "value", "/", 60, true)
+		})
+		req, _ := http.NewRequest("GET", "/test", nil)
+		if httpsRequest {
+			req.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return cookies[0]
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		c := cookie(&config.CookieConfig{}, false)
+		assert.Equal(t, http.SameSiteLaxMode, c.SameSite)
+		assert.False(t, c.Secure)
+		assert.True(t, c.HttpOnly)
+	})
+
+	t.Run("auto is secure over TLS", func(t *testing.T) {
+		c := cookie(&config.CookieConfig{Secure: "auto"}, true)
+		assert.True(t, c.Secure)
+	})
+
+	t.Run("configured attributes", func(t *testing.T) {
+		httpOnly := false
+		c := cookie(&config.CookieConfig{
+			SameSite: "strict",
+			Secure:   "always",
+			HTTPOnly: &httpOnly,
+			Domain:   "example.com",
+		}, false)
+		assert.Equal(t, http.SameSiteStrictMode, c.SameSite)
+		assert.True(t, c.Secure)
+		assert.False(t, c.HttpOnly)
+		assert.Equal(t, "example.com", c.Domain)
+	})
+
+	t.Run("never is not secure over TLS", func(t *testing.T) {
+		c := cookie(&config.CookieConfig{SameSite: "none", Secure: "never"}, true)
+		assert.Equal(t, http.SameSiteNoneMode, c.SameSite)
+		assert.False(t, c.Secure)
+	})
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.SecurityHeadersConfig{
+		ContentSecurityPolicy: "default-src 'self';",
+		FrameAncestors:        "'none'",
+		HSTSMaxAge:            31536000,
+		HSTSIncludeSubdomains: true,
+	}
+
+	serve := func(https bool, req *http.Request) http.Header {
+		router := gin.New()
+		router.Use(middleware.SecurityHeaders(cfg, https))
+		router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		header := serve(false, req)
+
+		assert.Equal(t, "default-src 'self'; frame-ancestors 'none'", header.Get("Content-Security-Policy"))
+		assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+		assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+		assert.Equal(t, "same-origin", header.Get("Referrer-Policy"))
+		assert.Empty(t, header.Get("Strict-Transport-Security"))
+	})
+
+	t.Run("HTTPS public URL", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		header := serve(true, req)
+
+		assert.Equal(t, "max-age=31536000; includeSubDomains", header.Get("Strict-Transport-Security"))
+	})
+
+	t.Run("TLS request", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.TLS = &tls.ConnectionState{}
+		header := serve(false, req)
+
+		assert.Equal(t, "max-age=31536000; includeSubDomains", header.Get("Strict-Transport-Security"))
+	})
+}
@@ -8,8 +8,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
 )
 
 func TestRateLimiter(t *testing.T) {
@@ -146,3 +149,107 @@ func TestRateLimiter(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+func TestRateLimiter_Policies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.SecurityConfig{
+		RateLimitEnabled: true,
+		RateLimits: config.RateLimitPolicies{
+			Login:   config.RateLimitPolicy{Requests: 1, Window: 60, Burst: 2},
+			VpnAuth: config.RateLimitPolicy{Requests: 1, Window: 60, Burst: 1},
+		},
+	}
+	rl := middleware.NewRateLimiter(cfg)
+	defer rl.Stop()
+
+	t.Run("policies count separately", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			allowed, _ := rl.Allow(middleware.RateLimitLogin, "10.0.0.1")
+			assert.True(t, allowed)
+		}
+		allowed, retryAfter := rl.Allow(middleware.RateLimitLogin, "10.0.0.1")
+		assert.False(t, allowed)
+		assert.Positive(t, retryAfter)
+
+		allowed, _ = rl.Allow(middleware.RateLimitVpnAuth, "10.0.0.1")
+		assert.True(t, allowed)
+		allowed, _ = rl.Allow(middleware.RateLimitVpnAuth, "10.0.0.1")
+		assert.False(t, allowed)
+	})
+
+	t.Run("policy without limit allows all requests", func(t *testing.T) {
+		router := gin.New()
+		router.Use(rl.PolicyMiddleware(middleware.RateLimitAPI))
+		router.GET("/api/v1/users", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		})
+
+		for i := 0; i < 20; i++ {
+			req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+			req.RemoteAddr = "10.0.0.1:12345"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("unknown backend is rejected", func(t *testing.T) {
+		_, err := middleware.NewRateLimitBackend(&config.SecurityConfig{RateLimitBackend: "redis"})
+		assert.Error(t, err)
+	})
+}
+
+func TestRateLimiter_DatabaseBackend(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := &config.SecurityConfig{
+		RateLimitEnabled: true,
+		RateLimitBackend: middleware.RateLimitBackendDatabase,
+		RateLimits: config.RateLimitPolicies{
+			Login: config.RateLimitPolicy{Requests: 3, Window: 60, Burst: 3},
+		},
+	}
+
+	// Two instances behind a load balancer
+	newInstance := func() *middleware.RateLimiter {
+		backend, err := middleware.NewRateLimitBackend(cfg)
+		require.NoError(t, err)
+		return middleware.NewRateLimiterWithBackend(cfg, backend)
+	}
+	first, second := newInstance(), newInstance()
+	defer first.Stop()
+	defer second.Stop()
+
+	t.Run("instances share the limit", func(t *testing.T) {
+		allowed, _ := first.Allow(middleware.RateLimitLogin, "192.0.2.1")
+		assert.True(t, allowed)
+		allowed, _ = second.Allow(middleware.RateLimitLogin, "192.0.2.1")
+		assert.True(t, allowed)
+		allowed, _ = first.Allow(middleware.RateLimitLogin, "192.0.2.1")
+		assert.True(t, allowed)
+
+		allowed, retryAfter := second.Allow(middleware.RateLimitLogin, "192.0.2.1")
+		assert.False(t, allowed)
+		assert.Positive(t, retryAfter)
+	})
+
+	t.Run("rejected requests are not counted", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			allowed, _ := first.Allow(middleware.RateLimitLogin, "192.0.2.1")
+			assert.False(t, allowed)
+		}
+
+		var hits int64
+		require.NoError(t, db.Model(&models.RateLimitCounter{}).
+			Where("limit_key = ?", "login:192.0.2.1").
+			Select("COALESCE(SUM(hits), 0)").Scan(&hits).Error)
+		assert.Equal(t, int64(3), hits)
+	})
+
+	t.Run("different IPs have independent limits", func(t *testing.T) {
+		allowed, _ := second.Allow(middleware.RateLimitLogin, "192.0.2.2")
+		assert.True(t, allowed)
+	})
+}
@@ -6,7 +6,12 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
 )
 
 func TestTokenBlacklist(t *testing.T) {
@@ -61,3 +66,75 @@ func TestTokenBlacklist(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+func TestTokenBlacklist_Persistent(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := &config.AuthConfig{JWTSecret: "test-secret-key-for-testing-minimum-32-chars"}
+	authService := services.NewAuthService(cfg)
+
+	issue := func(t *testing.T, user *models.User) (string, *middleware.Claims) {
+		t.Helper()
+		token, err := authService.IssueToken(user)
+		require.NoError(t, err)
+		claims, err := middleware.ParseToken(cfg, token)
+		require.NoError(t, err)
+		require.NotEmpty(t, claims.ID)
+		return token, claims
+	}
+
+	t.Run("revocation is shared through the database", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "revokeshared")
+		token, claims := issue(t, user)
+
+		replica := middleware.NewTokenBlacklist()
+		defer replica.Stop()
+		assert.False(t, replica.IsRevoked(token, claims))
+
+		bl := middleware.NewTokenBlacklist()
+		defer bl.Stop()
+		bl.Add(token, claims.ExpiresAt.Time)
+
+		var stored models.RevokedToken
+		require.NoError(t, db.First(&stored, "jti = ?", claims.ID).Error)
+		assert.Equal(t, user.ID, stored.UserID)
+
+		// A process started after the revocation sees it
+		restarted := middleware.NewTokenBlacklist()
+		defer restarted.Stop()
+		assert.True(t, restarted.IsRevoked(token, claims))
+	})
+
+	t.Run("tokens issued before the watermark are revoked", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "revokewatermark")
+		token, claims := issue(t, user)
+
+		// A second later, as iat has second precision
+		require.NoError(t, db.Model(user).Update("tokens_valid_after", time.Now().Add(time.Second)).Error)
+
+		bl := middleware.NewTokenBlacklist()
+		defer bl.Stop()
+		assert.True(t, bl.IsRevoked(token, claims))
+	})
+
+	t.Run("tokens issued after the watermark are valid", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "revokeafter")
+		require.NoError(t, services.InvalidateUserTokens(user.ID))
+		token, claims := issue(t, user)
+
+		bl := middleware.NewTokenBlacklist()
+		defer bl.Stop()
+		assert.False(t, bl.IsRevoked(token, claims))
+	})
+
+	t.Run("tokens of deleted users are revoked", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "revokedeleted")
+		token, claims := issue(t, user)
+		require.NoError(t, services.NewUserService().Delete(user.ID))
+
+		bl := middleware.NewTokenBlacklist()
+		defer bl.Stop()
+		assert.True(t, bl.IsRevoked(token, claims))
+	})
+}
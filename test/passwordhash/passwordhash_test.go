@@ -0,0 +1,121 @@
+package passwordhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/passwordhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasher_Argon2id(t *testing.T) {
+	hasher := passwordhash.New(&config.PasswordHashConfig{
+		Algorithm:         "argon2id",
+		Argon2Memory:      8192,
+		Argon2Time:        1,
+		Argon2Parallelism: 2,
+	})
+
+	hash, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=2$"), hash)
+
+	t.Run("verifies", func(t *testing.T) {
+		ok, err := hasher.Verify("correct horse", hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = hasher.Verify("wrong horse", hash)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("random salt", func(t *testing.T) {
+		other, err := hasher.Hash("correct horse")
+		require.NoError(t, err)
+		assert.NotEqual(t, hash, other)
+	})
+
+	t.Run("current parameters need no rehash", func(t *testing.T) {
+		assert.False(t, hasher.NeedsRehash(hash))
+	})
+
+	t.Run("raised parameters need rehash", func(t *testing.T) {
+		stronger := passwordhash.New(&config.PasswordHashConfig{Argon2Memory: 16384, Argon2Time: 1, Argon2Parallelism: 2})
+		assert.True(t, stronger.NeedsRehash(hash))
+
+		// Hashes with the old parameters still verify
+		ok, err := stronger.Verify("correct horse", hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("bcrypt hash needs rehash", func(t *testing.T) {
+		legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+		require.NoError(t, err)
+		assert.True(t, hasher.NeedsRehash(string(legacy)))
+
+		ok, err := hasher.Verify("correct horse", string(legacy))
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("malformed hashes", func(t *testing.T) {
+		for _, hash := range []string{
+			"",
+			"plaintext",
+			"$argon2id$v=19$m=8192,t=1,p=2$c2FsdA",
+			"$argon2id$v=16$m=8192,t=1,p=2$c2FsdHNhbHRzYWx0$aGFzaA",
+			"$argon2id$v=19$m=0,t=1,p=2$c2FsdHNhbHRzYWx0$aGFzaA",
+			"$argon2id$v=19$m=99999999,t=1,p=2$c2FsdHNhbHRzYWx0$aGFzaA",
+			"$argon2id$v=19$m=8192,t=1,p=2$!!!$aGFzaA",
+		} {
+			ok, err := hasher.Verify("correct horse", hash)
+			assert.Error(t, err, hash)
+			assert.False(t, ok, hash)
+			assert.True(t, hasher.NeedsRehash(hash), hash)
+		}
+	})
+}
+
+func TestHasher_Bcrypt(t *testing.T) {
+	hasher := passwordhash.New(&config.PasswordHashConfig{Algorithm: "bcrypt", BcryptCost: bcrypt.MinCost})
+
+	hash, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(hash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost, cost)
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	ok, err := hasher.Verify("wrong horse", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	t.Run("raised cost needs rehash", func(t *testing.T) {
+		stronger := passwordhash.New(&config.PasswordHashConfig{Algorithm: "bcrypt", BcryptCost: bcrypt.MinCost + 1})
+		assert.True(t, stronger.NeedsRehash(hash))
+	})
+
+	t.Run("argon2id hash needs rehash", func(t *testing.T) {
+		argon, err := passwordhash.New(nil).Hash("correct horse")
+		require.NoError(t, err)
+		assert.True(t, hasher.NeedsRehash(argon))
+
+		ok, err := hasher.Verify("correct horse", argon)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestHasher_Defaults(t *testing.T) {
+	hasher := passwordhash.New(nil)
+	assert.Equal(t, passwordhash.AlgorithmArgon2id, hasher.Algorithm())
+
+	hash, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"), hash)
+}
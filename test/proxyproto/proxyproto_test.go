@@ -0,0 +1,138 @@
+package proxyproto_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/proxyproto"
+)
+
+func v2Header(command byte, family byte, addresses []byte) []byte {
+	header := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestReadHeader(t *testing.T) {
+	t.Run("v1 TCP4", func(t *testing.T) {
+		r := bufio.NewReader(strings.NewReader("PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\nGET / HTTP/1.1\r\n"))
+		addr, err := proxyproto.ReadHeader(r)
+		require.NoError(t, err)
+		assert.Equal(t, "203.0.113.7:51234", addr.String())
+
+		rest, _ := io.ReadAll(r)
+		assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+	})
+
+	t.Run("v1 TCP6", func(t *testing.T) {
+		r := bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::7 2001:db8::1 51234 443\r\n"))
+		addr, err := proxyproto.ReadHeader(r)
+		require.NoError(t, err)
+		assert.Equal(t, "[2001:db8::7]:51234", addr.String())
+	})
+
+	t.Run("v1 UNKNOWN keeps the proxy address", func(t *testing.T) {
+		addr, err := proxyproto.ReadHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+		require.NoError(t, err)
+		assert.Nil(t, addr)
+	})
+
+	t.Run("v1 with mismatched family is rejected", func(t *testing.T) {
+		_, err := proxyproto.ReadHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 2001:db8::7 2001:db8::1 51234 443\r\n")))
+		assert.Error(t, err)
+	})
+
+	t.Run("v2 IPv4", func(t *testing.T) {
+		addresses := []byte{198, 51, 100, 9, 10, 0, 0, 1}
+		addresses = binary.BigEndian.AppendUint16(addresses, 40000)
+		addresses = binary.BigEndian.AppendUint16(addresses, 443)
+		addresses = append(addresses, 0x04, 0x00, 0x01, 0x00) // TLV, skipped
+		data := append(v2Header(0x1, 0x11, addresses), "GET"...)
+
+		r := bufio.NewReader(bytes.NewReader(data))
+		addr, err := proxyproto.ReadHeader(r)
+		require.NoError(t, err)
+		assert.Equal(t, "198.51.100.9:40000", addr.String())
+
+		rest, _ := io.ReadAll(r)
+		assert.Equal(t, "GET", string(rest))
+	})
+
+	t.Run("v2 IPv6", func(t *testing.T) {
+		addresses := append(net.ParseIP("2001:db8::9").To16(), net.ParseIP("2001:db8::1").To16()...)
+		addresses = binary.BigEndian.AppendUint16(addresses, 40000)
+		addresses = binary.BigEndian.AppendUint16(addresses, 443)
+
+		addr, err := proxyproto.ReadHeader(bufio.NewReader(bytes.NewReader(v2Header(0x1, 0x21, addresses))))
+		require.NoError(t, err)
+		assert.Equal(t, "[2001:db8::9]:40000", addr.String())
+	})
+
+	t.Run("v2 LOCAL keeps the proxy address", func(t *testing.T) {
+		addr, err := proxyproto.ReadHeader(bufio.NewReader(bytes.NewReader(v2Header(0x0, 0x00, nil))))
+		require.NoError(t, err)
+		assert.Nil(t, addr)
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		_, err := proxyproto.ReadHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\n\r\n")))
+		assert.ErrorIs(t, err, proxyproto.ErrNoHeader)
+	})
+}
+
+func TestListener(t *testing.T) {
+	serve := func(t *testing.T, trusted []string, send string) (string, string) {
+		t.Helper()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listener, err := proxyproto.NewListener(l, trusted)
+		require.NoError(t, err)
+		defer listener.Close()
+
+		go func() {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte(send))
+		}()
+
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+		remote := conn.RemoteAddr().String()
+		data, _ := io.ReadAll(conn)
+		return remote, string(data)
+	}
+
+	t.Run("header of a trusted proxy sets the client address", func(t *testing.T) {
+		remote, data := serve(t, []string{"127.0.0.0/8"}, "PROXY TCP4 203.0.113.7 127.0.0.1 51234 8080\r\nhello")
+		assert.Equal(t, "203.0.113.7:51234", remote)
+		assert.Equal(t, "hello", data)
+	})
+
+	t.Run("header of an untrusted peer is not parsed", func(t *testing.T) {
+		remote, data := serve(t, []string{"192.0.2.1"}, "PROXY TCP4 203.0.113.7 127.0.0.1 51234 8080\r\nhello")
+		assert.True(t, strings.HasPrefix(remote, "127.0.0.1:"))
+		assert.True(t, strings.HasPrefix(data, "PROXY TCP4"))
+	})
+
+	t.Run("trusted proxy without header is dropped", func(t *testing.T) {
+		_, data := serve(t, []string{"127.0.0.1"}, "GET / HTTP/1.1\r\n\r\n")
+		assert.Empty(t, data)
+	})
+
+	t.Run("invalid trusted proxy is rejected", func(t *testing.T) {
+		_, err := proxyproto.NewListener(nil, []string{"not-an-ip"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,202 @@
+package radius_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/radius"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+	layeh "layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+)
+
+const testSecret = "radius-secret"
+
+func startServer(t *testing.T, clientAddress string) *radius.Server {
+	t.Helper()
+
+	cfg := &config.RADIUSConfig{
+		Enabled:  true,
+		AuthAddr: "127.0.0.1:0",
+		AcctAddr: "127.0.0.1:0",
+		Clients:  []config.RADIUSClient{{Name: "openvpn", Address: clientAddress, Secret: testSecret}},
+	}
+	authCfg := &config.AuthConfig{JWTSecret: "test-secret-key-for-testing-minimum-32-chars"}
+
+	server, err := radius.NewServer(cfg, authCfg, &config.AnomalyConfig{})
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	t.Cleanup(server.Stop)
+	return server
+}
+
+func exchange(t *testing.T, packet *layeh.Packet, addr net.Addr) (*layeh.Packet, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return layeh.Exchange(ctx, packet, addr.String())
+}
+
+func accessRequest(username, password string) *layeh.Packet {
+	packet := layeh.New(layeh.CodeAccessRequest, []byte(testSecret))
+	_ = rfc2865.UserName_SetString(packet, username)
+	_ = rfc2865.UserPassword_SetString(packet, password)
+	_ = rfc2865.CallingStationID_SetString(packet, "203.0.113.10")
+	return packet
+}
+
+func accountingRequest(status rfc2866.AcctStatusType, username, acctSessionID string, received, sent uint32) *layeh.Packet {
+	packet := layeh.New(layeh.CodeAccountingRequest, []byte(testSecret))
+	_ = rfc2866.AcctStatusType_Set(packet, status)
+	_ = rfc2865.UserName_SetString(packet, username)
+	_ = rfc2866.AcctSessionID_SetString(packet, acctSessionID)
+	_ = rfc2865.FramedIPAddress_Set(packet, net.ParseIP("10.8.0.50"))
+	_ = rfc2865.CallingStationID_SetString(packet, "203.0.113.10")
+	_ = rfc2866.AcctInputOctets_Set(packet, rfc2866.AcctInputOctets(received))
+	_ = rfc2866.AcctOutputOctets_Set(packet, rfc2866.AcctOutputOctets(sent))
+	return packet
+}
+
+func TestServer_AccessRequest(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	server := startServer(t, "127.0.0.0/8")
+
+	admin := testutil.CreateTestAdmin(t)
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "radiususer")
+	require.NoError(t, db.Model(user).Update("vpn_ip", "10.8.0.50").Error)
+
+	group := testutil.CreateTestGroup(t, admin.ID)
+	network := testutil.CreateTestNetwork(t, admin.ID)
+	require.NoError(t, db.Create(&models.UserGroup{UserID: user.ID, GroupID: group.ID, CreatedBy: admin.ID}).Error)
+	require.NoError(t, db.Create(&models.NetworkGroup{NetworkID: network.ID, GroupID: group.ID, CreatedBy: admin.ID}).Error)
+
+	t.Run("accepts valid credentials with address and routes", func(t *testing.T) {
+		response, err := exchange(t, accessRequest("radiususer", "testpassword123"), server.AuthAddr())
+		require.NoError(t, err)
+		require.Equal(t, layeh.CodeAccessAccept, response.Code)
+		assert.Equal(t, "10.8.0.50", rfc2865.FramedIPAddress_Get(response).String())
+
+		routes, err := rfc2865.FramedRoute_GetStrings(response)
+		require.NoError(t, err)
+		assert.Equal(t, []string{network.CIDR + " 0.0.0.0 1"}, routes)
+	})
+
+	t.Run("rejects wrong password", func(t *testing.T) {
+		response, err := exchange(t, accessRequest("radiususer", "wrongpassword"), server.AuthAddr())
+		require.NoError(t, err)
+		assert.Equal(t, layeh.CodeAccessReject, response.Code)
+		assert.Equal(t, "Invalid credentials", rfc2865.ReplyMessage_GetString(response))
+	})
+
+	t.Run("rejects disabled user", func(t *testing.T) {
+		disabled := testutil.CreateTestUserWithName(t, models.RoleUser, "radiusdisabled")
+		require.NoError(t, db.Model(disabled).Update("is_active", false).Error)
+
+		response, err := exchange(t, accessRequest("radiusdisabled", "testpassword123"), server.AuthAddr())
+		require.NoError(t, err)
+		assert.Equal(t, layeh.CodeAccessReject, response.Code)
+		assert.Equal(t, "User account is disabled", rfc2865.ReplyMessage_GetString(response))
+	})
+
+	t.Run("ignores unknown client", func(t *testing.T) {
+		other := startServer(t, "192.0.2.0/24")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		_, err := layeh.Exchange(ctx, accessRequest("radiususer", "testpassword123"), other.AuthAddr().String())
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_Accounting(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	server := startServer(t, "127.0.0.1")
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "radiusacct")
+
+	send := func(t *testing.T, packet *layeh.Packet) {
+		t.Helper()
+		response, err := exchange(t, packet, server.AcctAddr())
+		require.NoError(t, err)
+		require.Equal(t, layeh.CodeAccountingResponse, response.Code)
+	}
+	session := func(t *testing.T) *models.VpnSession {
+		t.Helper()
+		var sessions []models.VpnSession
+		require.NoError(t, db.Where("acct_session_id = ?", "acct-1").Find(&sessions).Error)
+		require.Len(t, sessions, 1)
+		return &sessions[0]
+	}
+
+	t.Run("start creates session", func(t *testing.T) {
+		send(t, accountingRequest(rfc2866.AcctStatusType_Value_Start, "radiusacct", "acct-1", 0, 0))
+		// Retransmission does not create another session
+		send(t, accountingRequest(rfc2866.AcctStatusType_Value_Start, "radiusacct", "acct-1", 0, 0))
+
+		s := session(t)
+		assert.Equal(t, user.ID, s.UserID)
+		assert.Equal(t, "10.8.0.50", s.VpnIP)
+		assert.Equal(t, "203.0.113.10", s.ClientIP)
+		assert.True(t, s.IsActive())
+	})
+
+	t.Run("interim update records traffic", func(t *testing.T) {
+		send(t, accountingRequest(rfc2866.AcctStatusType_Value_InterimUpdate, "radiusacct", "acct-1", 1000, 4000))
+
+		s := session(t)
+		assert.Equal(t, int64(1000), s.BytesReceived)
+		assert.Equal(t, int64(4000), s.BytesSent)
+
+		var stats []models.VpnTrafficStats
+		require.NoError(t, db.Where("session_id = ?", s.ID).Find(&stats).Error)
+		require.Len(t, stats, 1)
+		assert.Equal(t, int64(1000), stats[0].BytesReceivedDelta)
+	})
+
+	t.Run("stop disconnects session", func(t *testing.T) {
+		packet := accountingRequest(rfc2866.AcctStatusType_Value_Stop, "radiusacct", "acct-1", 1500, 6000)
+		_ = rfc2866.AcctTerminateCause_Set(packet, rfc2866.AcctTerminateCause_Value_UserRequest)
+		send(t, packet)
+
+		s := session(t)
+		assert.False(t, s.IsActive())
+		assert.Equal(t, int64(1500), s.BytesReceived)
+		assert.Equal(t, int64(6000), s.BytesSent)
+		require.NotNil(t, s.DisconnectReason)
+		assert.Equal(t, models.DisconnectReasonUserRequest, *s.DisconnectReason)
+
+		var count int64
+		db.Model(&models.VpnTrafficStats{}).Where("session_id = ?", s.ID).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("interim update without start creates session", func(t *testing.T) {
+		packet := accountingRequest(rfc2866.AcctStatusType_Value_InterimUpdate, "radiusacct", "acct-2", 10, 20)
+		_ = rfc2866.AcctSessionTime_Set(packet, 600)
+		send(t, packet)
+
+		var s models.VpnSession
+		require.NoError(t, db.Where("acct_session_id = ?", "acct-2").First(&s).Error)
+		assert.True(t, s.IsActive())
+		assert.WithinDuration(t, time.Now().Add(-10*time.Minute), s.ConnectedAt, 5*time.Second)
+		assert.Equal(t, int64(20), s.BytesSent)
+	})
+
+	t.Run("acknowledges unknown user", func(t *testing.T) {
+		send(t, accountingRequest(rfc2866.AcctStatusType_Value_Start, "nobody", "acct-3", 0, 0))
+
+		var count int64
+		db.Model(&models.VpnSession{}).Where("acct_session_id = ?", "acct-3").Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+}
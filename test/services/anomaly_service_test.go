@@ -0,0 +1,247 @@
+package services_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func newTestAnomalyConfig(blockSeverity string) *config.AnomalyConfig {
+	return &config.AnomalyConfig{
+		Enabled:              true,
+		BlockSeverity:        blockSeverity,
+		MinHistorySessions:   20,
+		UnusualHourRatio:     0.02,
+		TrafficSpikeFactor:   5,
+		TrafficSpikeMinBytes: 1000,
+		StuffingWindow:       10,
+		StuffingUsernames:    3,
+	}
+}
+
+func listAlerts(t *testing.T, service *services.AnomalyService, alertType models.AlertType) []models.SecurityAlert {
+	alerts, _, err := service.List(&dto.SecurityAlertFilter{Type: &alertType, Page: 1, PageSize: 100})
+	require.NoError(t, err)
+	return alerts
+}
+
+func TestAnomalyService_NewIP(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewAnomalyService(newTestAnomalyConfig("medium"))
+	user := testutil.CreateTestRegularUser(t)
+	now := time.Now()
+
+	t.Run("first login is not reported", func(t *testing.T) {
+		blocked, err := service.CheckLogin(user, "198.51.100.1", now)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+		assert.Empty(t, listAlerts(t, service, models.AlertTypeNewIP))
+	})
+
+	require.NoError(t, db.Create(&models.VpnSession{
+		UserID:      user.ID,
+		VpnIP:       "10.8.0.100",
+		ClientIP:    "198.51.100.1",
+		ConnectedAt: now.Add(-time.Hour),
+	}).Error)
+
+	t.Run("known IP is not reported", func(t *testing.T) {
+		blocked, err := service.CheckLogin(user, "198.51.100.1", now)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+		assert.Empty(t, listAlerts(t, service, models.AlertTypeNewIP))
+	})
+
+	t.Run("new IP is reported and blocked", func(t *testing.T) {
+		blocked, err := service.CheckLogin(user, "203.0.113.7", now)
+		require.NoError(t, err)
+		assert.True(t, blocked)
+
+		alerts := listAlerts(t, service, models.AlertTypeNewIP)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, models.AlertSeverityMedium, alerts[0].Severity)
+		assert.Equal(t, "203.0.113.7", alerts[0].SourceIP)
+		assert.True(t, alerts[0].Blocked)
+	})
+
+	t.Run("retry stays blocked without a duplicate alert", func(t *testing.T) {
+		blocked, err := service.CheckLogin(user, "203.0.113.7", now)
+		require.NoError(t, err)
+		assert.True(t, blocked)
+		assert.Len(t, listAlerts(t, service, models.AlertTypeNewIP), 1)
+	})
+
+	t.Run("acknowledged IP is approved", func(t *testing.T) {
+		alerts := listAlerts(t, service, models.AlertTypeNewIP)
+		admin := testutil.CreateTestAdmin(t)
+		acknowledged, err := service.Acknowledge(alerts[0].ID, admin.ID)
+		require.NoError(t, err)
+		assert.True(t, acknowledged.Acknowledged)
+		require.NotNil(t, acknowledged.AcknowledgedBy)
+		assert.Equal(t, admin.ID, *acknowledged.AcknowledgedBy)
+
+		blocked, err := service.CheckLogin(user, "203.0.113.7", now)
+		require.NoError(t, err)
+		assert.False(t, blocked)
+		assert.Len(t, listAlerts(t, service, models.AlertTypeNewIP), 1)
+	})
+}
+
+func TestAnomalyService_UnusualHour(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewAnomalyService(newTestAnomalyConfig(""))
+	user := testutil.CreateTestRegularUser(t)
+
+	today := time.Now()
+	day := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	for i := 1; i <= 25; i++ {
+		createTestSessionAt(t, user.ID, day.AddDate(0, 0, -i).Add(10*time.Hour), time.Hour)
+	}
+
+	t.Run("usual hour is not reported", func(t *testing.T) {
+		_, err := service.CheckLogin(user, "", day.Add(11*time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, listAlerts(t, service, models.AlertTypeUnusualHour))
+	})
+
+	t.Run("unusual hour is reported once a day", func(t *testing.T) {
+		blocked, err := service.CheckLogin(user, "", day.Add(3*time.Hour))
+		require.NoError(t, err)
+		assert.False(t, blocked)
+
+		_, err = service.CheckLogin(user, "", day.Add(3*time.Hour+5*time.Minute))
+		require.NoError(t, err)
+
+		alerts := listAlerts(t, service, models.AlertTypeUnusualHour)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, models.AlertSeverityLow, alerts[0].Severity)
+		assert.False(t, alerts[0].Blocked)
+	})
+
+	t.Run("user with short history is not reported", func(t *testing.T) {
+		other := testutil.CreateTestRegularUser(t)
+		createTestSessionAt(t, other.ID, day.AddDate(0, 0, -1).Add(10*time.Hour), time.Hour)
+
+		_, err := service.CheckLogin(other, "", day.Add(3*time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, listAlerts(t, service, models.AlertTypeUnusualHour), 1)
+	})
+}
+
+func TestAnomalyService_CredentialStuffing(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewAnomalyService(newTestAnomalyConfig("high"))
+	now := time.Now()
+	ip := "192.0.2.50"
+
+	for i := 0; i < 2; i++ {
+		username := fmt.Sprintf("victim%d", i)
+		require.NoError(t, service.RecordAttempt(username, nil, ip, false, now))
+		alert, err := service.CheckFailedLogin(username, ip, now)
+		require.NoError(t, err)
+		assert.Nil(t, alert)
+	}
+
+	blocked, err := service.IsSourceBlocked(ip, now)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	require.NoError(t, service.RecordAttempt("victim2", nil, ip, false, now))
+	alert, err := service.CheckFailedLogin("victim2", ip, now)
+	require.NoError(t, err)
+	require.NotNil(t, alert)
+	assert.Equal(t, models.AlertTypeCredentialStuffing, alert.Type)
+	assert.Equal(t, models.AlertSeverityHigh, alert.Severity)
+	assert.True(t, alert.Blocked)
+
+	// One alert per IP and window
+	require.NoError(t, service.RecordAttempt("victim3", nil, ip, false, now))
+	alert, err = service.CheckFailedLogin("victim3", ip, now)
+	require.NoError(t, err)
+	assert.Nil(t, alert)
+
+	blocked, err = service.IsSourceBlocked(ip, now)
+	require.NoError(t, err)
+	assert.True(t, blocked)
+
+	blocked, err = service.IsSourceBlocked("192.0.2.51", now)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	// The window expires
+	blocked, err = service.IsSourceBlocked(ip, now.Add(11*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, blocked)
+}
+
+func TestAnomalyService_TrafficSpikes(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewAnomalyService(newTestAnomalyConfig("medium"))
+	user := testutil.CreateTestRegularUser(t)
+	steady := testutil.CreateTestRegularUser(t)
+
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	for i := 1; i <= 30; i++ {
+		bucket := hour.Add(-time.Duration(i) * time.Hour)
+		require.NoError(t, db.Create(&models.VpnTrafficHourly{BucketStart: bucket, UserID: user.ID, BytesReceived: 500, BytesSent: 500}).Error)
+		require.NoError(t, db.Create(&models.VpnTrafficHourly{BucketStart: bucket, UserID: steady.ID, BytesReceived: 500, BytesSent: 500}).Error)
+	}
+	require.NoError(t, db.Create(&models.VpnTrafficHourly{BucketStart: hour, UserID: user.ID, BytesReceived: 6000, BytesSent: 0}).Error)
+	require.NoError(t, db.Create(&models.VpnTrafficHourly{BucketStart: hour, UserID: steady.ID, BytesReceived: 1500, BytesSent: 0}).Error)
+	require.NoError(t, db.Create(&models.TrafficRollupState{Name: "hourly", RolledUpUntil: hour.Add(time.Hour)}).Error)
+
+	alerts, err := service.CheckTrafficSpikes(time.Now())
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, user.ID, *alerts[0].UserID)
+	assert.Equal(t, models.AlertSeverityMedium, alerts[0].Severity)
+	assert.True(t, hour.Equal(alerts[0].ObservedAt))
+
+	// Each user and hour is reported once
+	alerts, err = service.CheckTrafficSpikes(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	// Unacknowledged spikes block further logins
+	blocked, err := service.CheckLogin(user, "", time.Now())
+	require.NoError(t, err)
+	assert.True(t, blocked)
+
+	blocked, err = service.CheckLogin(steady, "", time.Now())
+	require.NoError(t, err)
+	assert.False(t, blocked)
+}
+
+func TestAnomalyService_Disabled(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := newTestAnomalyConfig("low")
+	cfg.Enabled = false
+	service := services.NewAnomalyService(cfg)
+	user := testutil.CreateTestRegularUser(t)
+
+	blocked, err := service.CheckLogin(user, "203.0.113.7", time.Now())
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	blocked, err = service.IsSourceBlocked("203.0.113.7", time.Now())
+	require.NoError(t, err)
+	assert.False(t, blocked)
+}
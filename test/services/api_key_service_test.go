@@ -0,0 +1,131 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewAPIKeyService()
+	admin := testutil.CreateTestAdmin(t)
+
+	create := func(t *testing.T, req *dto.CreateAPIKeyRequest) (*models.APIKey, string) {
+		t.Helper()
+		key, secret, err := service.Create(req, admin.ID)
+		require.NoError(t, err)
+		return key, secret
+	}
+
+	t.Run("stores only a hash of the key", func(t *testing.T) {
+		key, secret := create(t, &dto.CreateAPIKeyRequest{
+			Name:   "vpn1",
+			Scopes: []models.APIKeyScope{models.APIKeyScopeVpnAuth, models.APIKeyScopeVpnAuth},
+		})
+
+		assert.True(t, len(secret) > 40)
+		assert.Equal(t, secret[:len(key.Prefix)], key.Prefix)
+		assert.NotContains(t, key.KeyHash, secret)
+		assert.Equal(t, []models.APIKeyScope{models.APIKeyScopeVpnAuth}, key.ScopeList())
+		assert.Equal(t, admin.ID, key.Creator.ID)
+	})
+
+	t.Run("validates key, scope and records use", func(t *testing.T) {
+		key, secret := create(t, &dto.CreateAPIKeyRequest{Name: "reporting", Scopes: []models.APIKeyScope{models.APIKeyScopeReports}})
+
+		validated, err := service.ValidateAPIKey(secret, "198.51.100.7", models.APIKeyScopeReports)
+		require.NoError(t, err)
+		assert.Equal(t, key.ID, validated.ID)
+
+		stored, err := service.GetByID(key.ID)
+		require.NoError(t, err)
+		require.NotNil(t, stored.LastUsedAt)
+		assert.Equal(t, "198.51.100.7", stored.LastUsedIP)
+
+		_, err = service.ValidateAPIKey(secret, "198.51.100.7", models.APIKeyScopeUsers)
+		assert.ErrorIs(t, err, services.ErrAPIKeyScope)
+
+		_, err = service.ValidateAPIKey(secret+"x", "198.51.100.7", models.APIKeyScopeReports)
+		assert.ErrorIs(t, err, services.ErrInvalidAPIKey)
+	})
+
+	t.Run("restricts key to allowed IPs", func(t *testing.T) {
+		_, secret := create(t, &dto.CreateAPIKeyRequest{
+			Name:       "restricted",
+			Scopes:     []models.APIKeyScope{models.APIKeyScopeVpnAuth},
+			AllowedIPs: []string{"10.0.0.0/24", "192.0.2.1"},
+		})
+
+		_, err := service.ValidateAPIKey(secret, "10.0.0.15", models.APIKeyScopeVpnAuth)
+		assert.NoError(t, err)
+		_, err = service.ValidateAPIKey(secret, "192.0.2.1", models.APIKeyScopeVpnAuth)
+		assert.NoError(t, err)
+		_, err = service.ValidateAPIKey(secret, "10.0.1.15", models.APIKeyScopeVpnAuth)
+		assert.ErrorIs(t, err, services.ErrAPIKeyIPNotAllowed)
+	})
+
+	t.Run("rejects expired key", func(t *testing.T) {
+		key, secret := create(t, &dto.CreateAPIKeyRequest{
+			Name:      "expiring",
+			Scopes:    []models.APIKeyScope{models.APIKeyScopeVpnAuth},
+			ExpiresAt: testutil.TimePtr(time.Now().Add(time.Hour)),
+		})
+		require.NoError(t, db.Model(key).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		_, err := service.ValidateAPIKey(secret, "10.0.0.1", models.APIKeyScopeVpnAuth)
+		assert.ErrorIs(t, err, services.ErrAPIKeyExpired)
+	})
+
+	t.Run("revoked key is rejected and cannot be rotated", func(t *testing.T) {
+		key, secret := create(t, &dto.CreateAPIKeyRequest{Name: "revoked", Scopes: []models.APIKeyScope{models.APIKeyScopeVpnAuth}})
+
+		revoked, err := service.Revoke(key.ID)
+		require.NoError(t, err)
+		assert.True(t, revoked.IsRevoked())
+
+		_, err = service.ValidateAPIKey(secret, "10.0.0.1", models.APIKeyScopeVpnAuth)
+		assert.ErrorIs(t, err, services.ErrAPIKeyRevoked)
+
+		_, _, err = service.Rotate(key.ID)
+		assert.ErrorIs(t, err, services.ErrAPIKeyNotRotatable)
+	})
+
+	t.Run("rotation replaces the key", func(t *testing.T) {
+		key, oldSecret := create(t, &dto.CreateAPIKeyRequest{Name: "rotated", Scopes: []models.APIKeyScope{models.APIKeyScopeVpnAuth}})
+
+		rotated, newSecret, err := service.Rotate(key.ID)
+		require.NoError(t, err)
+		assert.NotEqual(t, oldSecret, newSecret)
+		assert.Equal(t, key.ID, rotated.ID)
+
+		_, err = service.ValidateAPIKey(oldSecret, "10.0.0.1", models.APIKeyScopeVpnAuth)
+		assert.ErrorIs(t, err, services.ErrInvalidAPIKey)
+		_, err = service.ValidateAPIKey(newSecret, "10.0.0.1", models.APIKeyScopeVpnAuth)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects invalid allowed IP and past expiry", func(t *testing.T) {
+		_, _, err := service.Create(&dto.CreateAPIKeyRequest{
+			Name:       "invalid",
+			Scopes:     []models.APIKeyScope{models.APIKeyScopeVpnAuth},
+			AllowedIPs: []string{"not-an-ip"},
+		}, admin.ID)
+		assert.ErrorIs(t, err, services.ErrInvalidAllowedIP)
+
+		_, _, err = service.Create(&dto.CreateAPIKeyRequest{
+			Name:      "invalid",
+			Scopes:    []models.APIKeyScope{models.APIKeyScopeVpnAuth},
+			ExpiresAt: testutil.TimePtr(time.Now().Add(-time.Hour)),
+		}, admin.ID)
+		assert.ErrorIs(t, err, services.ErrAPIKeyExpiryPast)
+	})
+}
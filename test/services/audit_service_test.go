@@ -234,6 +234,7 @@ func TestAuditService_GetActions(t *testing.T) {
 			models.AuditActionDelete,
 			models.AuditActionLogin,
 			models.AuditActionLogout,
+			models.AuditActionPasswordReset,
 		}
 
 		assert.Equal(t, len(expectedActions), len(actions))
@@ -122,3 +122,67 @@ func TestAuthService_AccountLockout(t *testing.T) {
 		assert.NotEmpty(t, token)
 	})
 }
+
+func TestVpnAuthService_AccountLockout(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	secCfg := &config.SecurityConfig{
+		LockoutMaxAttempts: 3,
+		LockoutDuration:    15,
+	}
+	service := services.NewVpnAuthServiceWithSecurity(&config.AuthConfig{}, &config.AnomalyConfig{}, secCfg)
+
+	t.Run("locked account rejects correct password", func(t *testing.T) {
+		testutil.CreateTestUserWithName(t, models.RoleUser, "vpnlock1")
+
+		for i := 0; i < 3; i++ {
+			_, err := service.Authenticate("vpnlock1", "wrongpassword", "203.0.113.10")
+			assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+		}
+
+		_, err := service.Authenticate("vpnlock1", "testpassword123", "203.0.113.10")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, services.ErrAccountLocked)
+		var locked *services.AccountLockedError
+		require.ErrorAs(t, err, &locked)
+		assert.True(t, locked.Until.After(time.Now()))
+	})
+
+	t.Run("web and VPN failures share the counter", func(t *testing.T) {
+		testutil.CreateTestUserWithName(t, models.RoleUser, "vpnlock2")
+		authService := services.NewAuthServiceWithSecurity(&config.AuthConfig{
+			JWTSecret:   "test-secret-key-for-testing",
+			TokenExpiry: 24,
+		}, secCfg)
+
+		for i := 0; i < 2; i++ {
+			authService.Authenticate("vpnlock2", "wrongpassword")
+		}
+		service.Authenticate("vpnlock2", "wrongpassword", "")
+
+		_, err := service.Authenticate("vpnlock2", "testpassword123", "")
+		assert.ErrorIs(t, err, services.ErrAccountLocked)
+	})
+
+	t.Run("successful login resets failed counter", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "vpnlock3")
+
+		for i := 0; i < 2; i++ {
+			service.Authenticate("vpnlock3", "wrongpassword", "")
+		}
+		_, err := service.Authenticate("vpnlock3", "testpassword123", "")
+		require.NoError(t, err)
+
+		var stored models.User
+		require.NoError(t, testutil.TestDB.First(&stored, "id = ?", user.ID).Error)
+		assert.Zero(t, stored.FailedLoginAttempts)
+	})
+
+	t.Run("unknown usernames are not locked", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			_, err := service.Authenticate("vpnnobody", "wrongpassword", "")
+			assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+		}
+	})
+}
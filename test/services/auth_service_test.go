@@ -1,6 +1,7 @@
 package services_test
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestAuthService_Authenticate(t *testing.T) {
@@ -152,10 +154,53 @@ func TestHashPassword(t *testing.T) {
 		assert.NotEqual(t, hash1, hash2)
 	})
 
-	t.Run("same password produces different hashes (bcrypt salt)", func(t *testing.T) {
+	t.Run("same password produces different hashes (random salt)", func(t *testing.T) {
 		hash1, _ := services.HashPassword("samepassword")
 		hash2, _ := services.HashPassword("samepassword")
-		assert.NotEqual(t, hash1, hash2) // bcrypt uses random salt
+		assert.NotEqual(t, hash1, hash2)
+	})
+}
+
+func TestAuthService_RehashOnLogin(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewAuthService(&config.AuthConfig{
+		JWTSecret:   "test-secret-key-for-testing",
+		TokenExpiry: 24,
+	})
+
+	t.Run("bcrypt hash is upgraded to argon2id", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "legacyhash")
+		legacy, err := bcrypt.GenerateFromPassword([]byte("testpassword123"), bcrypt.MinCost)
+		require.NoError(t, err)
+		require.NoError(t, db.Model(user).UpdateColumn("password", string(legacy)).Error)
+
+		_, _, err = service.Authenticate("legacyhash", "testpassword123")
+		require.NoError(t, err)
+
+		var stored models.User
+		require.NoError(t, db.First(&stored, "id = ?", user.ID).Error)
+		assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$"), stored.Password)
+		assert.Nil(t, stored.PasswordChangedAt)
+
+		// The new hash keeps working
+		_, _, err = service.Authenticate("legacyhash", "testpassword123")
+		assert.NoError(t, err)
+	})
+
+	t.Run("failed login keeps the old hash", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "legacyhash2")
+		legacy, err := bcrypt.GenerateFromPassword([]byte("testpassword123"), bcrypt.MinCost)
+		require.NoError(t, err)
+		require.NoError(t, db.Model(user).UpdateColumn("password", string(legacy)).Error)
+
+		_, _, err = service.Authenticate("legacyhash2", "wrongpassword")
+		assert.Equal(t, services.ErrInvalidCredentials, err)
+
+		var stored models.User
+		require.NoError(t, db.First(&stored, "id = ?", user.ID).Error)
+		assert.Equal(t, string(legacy), stored.Password)
 	})
 }
 
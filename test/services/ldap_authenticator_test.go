@@ -0,0 +1,272 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+const (
+	ldapVpnUsersDN = "cn=vpn-users,ou=groups,dc=example,dc=com"
+	ldapAdminsDN   = "cn=vpn-admins,ou=groups,dc=example,dc=com"
+)
+
+func ldapTestEntries() []testutil.LDAPEntry {
+	return []testutil.LDAPEntry{
+		{
+			DN:       "cn=service,dc=example,dc=com",
+			Password: "service-secret",
+		},
+		{
+			DN:       "uid=jdoe,ou=people,dc=example,dc=com",
+			Password: "directory-pass",
+			Attributes: map[string][]string{
+				"uid":       {"jdoe"},
+				"givenName": {"John"},
+				"sn":        {"Doe"},
+				"mail":      {"jdoe@example.com"},
+				"memberOf":  {ldapVpnUsersDN},
+			},
+		},
+		{
+			DN:       "uid=asmith,ou=people,dc=example,dc=com",
+			Password: "admin-pass",
+			Attributes: map[string][]string{
+				"uid":       {"asmith"},
+				"givenName": {"Alice"},
+				"sn":        {"Smith"},
+				"mail":      {"asmith@example.com"},
+				"memberOf":  {ldapVpnUsersDN, ldapAdminsDN},
+			},
+		},
+	}
+}
+
+func newTestLDAPConfig(stub *testutil.LDAPStub) *config.AuthConfig {
+	return &config.AuthConfig{
+		JWTSecret:   "test-secret-key-for-testing",
+		TokenExpiry: 24,
+		LDAP: config.LDAPConfig{
+			Enabled:            true,
+			URL:                stub.URL,
+			Timeout:            5,
+			UserDNTemplate:     "uid=%s,ou=people,dc=example,dc=com",
+			UserFilter:         "(uid=%s)",
+			FirstNameAttribute: "givenName",
+			LastNameAttribute:  "sn",
+			EmailAttribute:     "mail",
+			GroupAttribute:     "memberOf",
+			AutoCreate:         true,
+			DefaultRole:        "USER",
+		},
+	}
+}
+
+func TestLDAPAuthenticator_SimpleBind(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	stub := testutil.StartLDAPStub(t, ldapTestEntries()...)
+	cfg := newTestLDAPConfig(stub)
+	authenticator := services.NewAuthenticator(cfg)
+
+	t.Run("creates user on first login", func(t *testing.T) {
+		user, err := authenticator.Authenticate("jdoe", "directory-pass")
+		require.NoError(t, err)
+		assert.Equal(t, "jdoe", user.Username)
+		assert.Equal(t, "John", user.FirstName)
+		assert.Equal(t, "Doe", user.LastName)
+		assert.Equal(t, "jdoe@example.com", user.Email)
+		assert.Equal(t, models.RoleUser, user.Role)
+		assert.Equal(t, models.AuthSourceLDAP, user.AuthSource)
+		assert.True(t, user.IsActive)
+
+		var count int64
+		db.Model(&models.User{}).Where("username = ?", "jdoe").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("updates profile on later login", func(t *testing.T) {
+		db.Model(&models.User{}).Where("username = ?", "jdoe").
+			Updates(map[string]interface{}{"first_name": "Old", "email": "old@example.com"})
+
+		user, err := authenticator.Authenticate("jdoe", "directory-pass")
+		require.NoError(t, err)
+		assert.Equal(t, "John", user.FirstName)
+
+		var stored models.User
+		require.NoError(t, db.Where("username = ?", "jdoe").First(&stored).Error)
+		assert.Equal(t, "John", stored.FirstName)
+		assert.Equal(t, "jdoe@example.com", stored.Email)
+	})
+
+	t.Run("rejects wrong password", func(t *testing.T) {
+		_, err := authenticator.Authenticate("jdoe", "wrong")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+
+	t.Run("rejects empty password", func(t *testing.T) {
+		_, err := authenticator.Authenticate("jdoe", "")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+
+	t.Run("rejects unknown user", func(t *testing.T) {
+		_, err := authenticator.Authenticate("nobody", "directory-pass")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+
+	t.Run("local user keeps local password", func(t *testing.T) {
+		admin := testutil.CreateTestUserWithName(t, models.RoleAdmin, "localadmin")
+
+		user, err := authenticator.Authenticate("localadmin", "testpassword123")
+		require.NoError(t, err)
+		assert.Equal(t, admin.ID, user.ID)
+
+		_, err = authenticator.Authenticate("localadmin", "wrong")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+
+	t.Run("directory user cannot use local password", func(t *testing.T) {
+		_, err := services.AuthenticateUser("jdoe", "directory-pass")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+}
+
+func TestLDAPAuthenticator_SearchBindStartTLS(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	stub := testutil.StartLDAPStub(t, ldapTestEntries()...)
+	cfg := newTestLDAPConfig(stub)
+	cfg.LDAP.UserDNTemplate = ""
+	cfg.LDAP.BindDN = "cn=service,dc=example,dc=com"
+	cfg.LDAP.BindPassword = "service-secret"
+	cfg.LDAP.BaseDN = "ou=people,dc=example,dc=com"
+	cfg.LDAP.StartTLS = true
+	cfg.LDAP.CACertFile = stub.CACertFile
+	authenticator := services.NewAuthenticator(cfg)
+
+	t.Run("authenticates found user", func(t *testing.T) {
+		user, err := authenticator.Authenticate("asmith", "admin-pass")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", user.FirstName)
+		assert.Equal(t, "asmith@example.com", user.Email)
+	})
+
+	t.Run("rejects wrong password", func(t *testing.T) {
+		_, err := authenticator.Authenticate("asmith", "wrong")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+
+	t.Run("escapes filter input", func(t *testing.T) {
+		_, err := authenticator.Authenticate("*", "admin-pass")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+
+	t.Run("fails with wrong service account", func(t *testing.T) {
+		badCfg := *cfg
+		badCfg.LDAP.BindPassword = "wrong"
+		_, err := services.NewAuthenticator(&badCfg).Authenticate("asmith", "admin-pass")
+		assert.ErrorIs(t, err, services.ErrLDAPUnavailable)
+	})
+}
+
+func TestLDAPAuthenticator_Mapping(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	admin := testutil.CreateTestAdmin(t)
+	vpnGroup := testutil.CreateTestGroup(t, admin.ID)
+	adminGroup := testutil.CreateTestGroup(t, admin.ID)
+
+	stub := testutil.StartLDAPStub(t, ldapTestEntries()...)
+	cfg := newTestLDAPConfig(stub)
+	cfg.LDAP.GroupMapping = map[string]string{
+		ldapVpnUsersDN: vpnGroup.Name,
+		ldapAdminsDN:   adminGroup.Name,
+	}
+	cfg.LDAP.RoleMapping = map[string]string{
+		ldapVpnUsersDN: "USER",
+		ldapAdminsDN:   "ADMIN",
+	}
+	authenticator := services.NewAuthenticator(cfg)
+
+	memberships := func(t *testing.T, userID interface{}) []string {
+		var groupIDs []string
+		require.NoError(t, db.Model(&models.UserGroup{}).Where("user_id = ?", userID).Pluck("group_id", &groupIDs).Error)
+		return groupIDs
+	}
+
+	t.Run("maps groups and highest role", func(t *testing.T) {
+		user, err := authenticator.Authenticate("asmith", "admin-pass")
+		require.NoError(t, err)
+		assert.Equal(t, models.RoleAdmin, user.Role)
+		assert.ElementsMatch(t, []string{vpnGroup.ID.String(), adminGroup.ID.String()}, memberships(t, user.ID))
+
+		user, err = authenticator.Authenticate("jdoe", "directory-pass")
+		require.NoError(t, err)
+		assert.Equal(t, models.RoleUser, user.Role)
+		assert.ElementsMatch(t, []string{vpnGroup.ID.String()}, memberships(t, user.ID))
+	})
+
+	t.Run("removes memberships of mapped groups", func(t *testing.T) {
+		entries := ldapTestEntries()
+		entries[2].Attributes["memberOf"] = []string{ldapVpnUsersDN}
+		demoted := newTestLDAPConfig(testutil.StartLDAPStub(t, entries...))
+		demoted.LDAP.GroupMapping = cfg.LDAP.GroupMapping
+		demoted.LDAP.RoleMapping = cfg.LDAP.RoleMapping
+
+		user, err := services.NewAuthenticator(demoted).Authenticate("asmith", "admin-pass")
+		require.NoError(t, err)
+		assert.Equal(t, models.RoleUser, user.Role)
+		assert.ElementsMatch(t, []string{vpnGroup.ID.String()}, memberships(t, user.ID))
+	})
+
+	t.Run("does not create users when auto create is disabled", func(t *testing.T) {
+		noCreate := *cfg
+		noCreate.LDAP.AutoCreate = false
+		db.Where("username = ?", "jdoe").Delete(&models.User{})
+
+		_, err := services.NewAuthenticator(&noCreate).Authenticate("jdoe", "directory-pass")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+}
+
+func TestAuthService_AuthenticateLDAP(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	stub := testutil.StartLDAPStub(t, ldapTestEntries()...)
+	cfg := newTestLDAPConfig(stub)
+	security := &config.SecurityConfig{LockoutMaxAttempts: 3, LockoutDuration: 15}
+
+	t.Run("issues token for directory user", func(t *testing.T) {
+		token, user, err := services.NewAuthServiceWithSecurity(cfg, security).Authenticate("jdoe", "directory-pass")
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.Equal(t, models.AuthSourceLDAP, user.AuthSource)
+	})
+
+	t.Run("records failed directory logins", func(t *testing.T) {
+		service := services.NewAuthServiceWithSecurity(cfg, security)
+		_, _, err := service.Authenticate("jdoe", "wrong")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+
+		var stored models.User
+		require.NoError(t, db.Where("username = ?", "jdoe").First(&stored).Error)
+		assert.Equal(t, 1, stored.FailedLoginAttempts)
+	})
+
+	t.Run("reports unavailable directory", func(t *testing.T) {
+		down := newTestLDAPConfig(stub)
+		down.LDAP.URL = "ldap://127.0.0.1:1"
+
+		_, _, err := services.NewAuthService(down).Authenticate("jdoe", "directory-pass")
+		assert.ErrorIs(t, err, services.ErrLDAPUnavailable)
+	})
+}
@@ -0,0 +1,257 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func newTestOIDCConfig(issuer *testutil.OIDCIssuer) *config.OIDCConfig {
+	return &config.OIDCConfig{
+		Enabled:        true,
+		IssuerURL:      issuer.URL,
+		ClientID:       issuer.ClientID,
+		ClientSecret:   issuer.ClientSecret,
+		RedirectURL:    "http://vpn.example.com/auth/oidc/callback",
+		Scopes:         []string{"openid", "profile", "email"},
+		UsernameClaim:  "preferred_username",
+		FirstNameClaim: "given_name",
+		LastNameClaim:  "family_name",
+		EmailClaim:     "email",
+		RoleClaim:      "groups",
+		RoleMapping:    map[string]string{"vpn-admins": "ADMIN", "vpn-managers": "MANAGER"},
+		AutoCreate:     true,
+		DefaultRole:    "USER",
+	}
+}
+
+// oidcLogin runs the authorization code flow for the claims set on the issuer
+func oidcLogin(t *testing.T, service *services.OIDCService, issuer *testutil.OIDCIssuer) (*models.User, error) {
+	state, err := services.NewOIDCLoginState()
+	require.NoError(t, err)
+
+	authURL, err := service.AuthorizationURL(state)
+	require.NoError(t, err)
+
+	callback := issuer.Authorize(t, authURL)
+	require.Equal(t, state.State, callback.Query().Get("state"))
+
+	return service.Exchange(callback.Query().Get("code"), state)
+}
+
+// oidcLink runs the authorization code flow and links the identity to userID
+func oidcLink(t *testing.T, service *services.OIDCService, issuer *testutil.OIDCIssuer, userID uuid.UUID) error {
+	state, err := services.NewOIDCLoginState()
+	require.NoError(t, err)
+
+	authURL, err := service.AuthorizationURL(state)
+	require.NoError(t, err)
+
+	callback := issuer.Authorize(t, authURL)
+	return service.Link(callback.Query().Get("code"), state, userID)
+}
+
+func TestOIDCService_Login(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	issuer := testutil.StartOIDCIssuer(t, "openvpn-mng", "client-secret")
+	service := services.NewOIDCService(newTestOIDCConfig(issuer))
+
+	t.Run("creates user on first login with role from claim", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{
+			"preferred_username": "ssouser",
+			"given_name":         "Sso",
+			"family_name":        "User",
+			"email":              "sso@example.com",
+			"groups":             []string{"staff", "vpn-managers"},
+		})
+
+		user, err := oidcLogin(t, service, issuer)
+		require.NoError(t, err)
+		assert.Equal(t, "ssouser", user.Username)
+		assert.Equal(t, "Sso", user.FirstName)
+		assert.Equal(t, "sso@example.com", user.Email)
+		assert.Equal(t, models.RoleManager, user.Role)
+		assert.Equal(t, models.AuthSourceOIDC, user.AuthSource)
+	})
+
+	t.Run("updates existing user", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{
+			"preferred_username": "ssouser",
+			"given_name":         "Renamed",
+			"family_name":        "User",
+			"email":              "sso@example.com",
+			"groups":             "vpn-admins",
+		})
+
+		user, err := oidcLogin(t, service, issuer)
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", user.FirstName)
+		assert.Equal(t, models.RoleAdmin, user.Role)
+
+		var count int64
+		db.Model(&models.User{}).Where("username = ?", "ssouser").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("rejects local user with the same username", func(t *testing.T) {
+		testutil.CreateTestUserWithName(t, models.RoleUser, "localsso")
+		issuer.SetClaims(map[string]interface{}{
+			"preferred_username": "localsso",
+			"given_name":         "Other",
+			"groups":             "vpn-admins",
+		})
+
+		_, err := oidcLogin(t, service, issuer)
+		assert.ErrorIs(t, err, services.ErrOIDCNotLinked)
+	})
+
+	t.Run("signs in linked local user without changing profile", func(t *testing.T) {
+		local := testutil.CreateTestUserWithName(t, models.RoleUser, "linkedsso")
+		issuer.SetClaims(map[string]interface{}{
+			"preferred_username": "someone-else",
+			"sub":                "linked-subject",
+			"given_name":         "Other",
+			"groups":             "vpn-admins",
+		})
+		require.NoError(t, oidcLink(t, service, issuer, local.ID))
+
+		user, err := oidcLogin(t, service, issuer)
+		require.NoError(t, err)
+		assert.Equal(t, local.ID, user.ID)
+		assert.Equal(t, local.FirstName, user.FirstName)
+		assert.Equal(t, models.RoleUser, user.Role)
+	})
+
+	t.Run("rejects linking an identity of another user", func(t *testing.T) {
+		other := testutil.CreateTestUserWithName(t, models.RoleUser, "othersso")
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "ssouser"})
+
+		err := oidcLink(t, service, issuer, other.ID)
+		assert.ErrorIs(t, err, services.ErrOIDCLinkedToOther)
+	})
+
+	t.Run("keeps identity after username change at provider", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{
+			"preferred_username": "renamed-ssouser",
+			"sub":                "subject-ssouser",
+		})
+
+		user, err := oidcLogin(t, service, issuer)
+		require.NoError(t, err)
+		assert.Equal(t, "ssouser", user.Username)
+	})
+
+	t.Run("rejects another identity claiming an OIDC username", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{
+			"preferred_username": "ssouser",
+			"sub":                "impostor",
+		})
+
+		_, err := oidcLogin(t, service, issuer)
+		assert.ErrorIs(t, err, services.ErrOIDCNotLinked)
+	})
+
+	t.Run("OIDC user cannot use password login", func(t *testing.T) {
+		_, err := services.AuthenticateUser("ssouser", "")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	})
+
+	t.Run("verifies tokens after key rotation", func(t *testing.T) {
+		issuer.RotateKey(t)
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "ssouser"})
+
+		_, err := oidcLogin(t, service, issuer)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects unknown user without auto create", func(t *testing.T) {
+		cfg := newTestOIDCConfig(issuer)
+		cfg.AutoCreate = false
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "stranger"})
+
+		_, err := oidcLogin(t, services.NewOIDCService(cfg), issuer)
+		assert.ErrorIs(t, err, services.ErrOIDCUserNotFound)
+	})
+
+	t.Run("rejects missing username claim", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"email": "nobody@example.com"})
+
+		_, err := oidcLogin(t, service, issuer)
+		assert.ErrorIs(t, err, services.ErrOIDCLoginFailed)
+	})
+}
+
+func TestOIDCService_Verification(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	issuer := testutil.StartOIDCIssuer(t, "openvpn-mng", "")
+	issuer.SetClaims(map[string]interface{}{"preferred_username": "verifyuser"})
+	service := services.NewOIDCService(newTestOIDCConfig(issuer))
+
+	t.Run("rejects wrong PKCE verifier", func(t *testing.T) {
+		state, err := services.NewOIDCLoginState()
+		require.NoError(t, err)
+		authURL, err := service.AuthorizationURL(state)
+		require.NoError(t, err)
+		callback := issuer.Authorize(t, authURL)
+
+		state.Verifier = "wrong-verifier"
+		_, err = service.Exchange(callback.Query().Get("code"), state)
+		assert.ErrorIs(t, err, services.ErrOIDCLoginFailed)
+	})
+
+	t.Run("rejects reused code", func(t *testing.T) {
+		state, err := services.NewOIDCLoginState()
+		require.NoError(t, err)
+		authURL, err := service.AuthorizationURL(state)
+		require.NoError(t, err)
+		code := issuer.Authorize(t, authURL).Query().Get("code")
+
+		_, err = service.Exchange(code, state)
+		require.NoError(t, err)
+		_, err = service.Exchange(code, state)
+		assert.ErrorIs(t, err, services.ErrOIDCLoginFailed)
+	})
+
+	t.Run("rejects nonce mismatch", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "verifyuser", "nonce": "replayed-nonce"})
+
+		_, err := oidcLogin(t, service, issuer)
+		assert.ErrorIs(t, err, services.ErrOIDCLoginFailed)
+	})
+
+	t.Run("rejects token for another audience", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "verifyuser", "aud": "other-client"})
+
+		_, err := oidcLogin(t, service, issuer)
+		assert.ErrorIs(t, err, services.ErrOIDCLoginFailed)
+	})
+
+	t.Run("rejects expired token", func(t *testing.T) {
+		issuer.SetClaims(map[string]interface{}{"preferred_username": "verifyuser", "exp": time.Now().Add(-time.Hour).Unix()})
+
+		_, err := oidcLogin(t, service, issuer)
+		assert.ErrorIs(t, err, services.ErrOIDCLoginFailed)
+	})
+
+	t.Run("reports unavailable issuer", func(t *testing.T) {
+		down := testutil.StartOIDCIssuer(t, "openvpn-mng", "")
+		cfg := newTestOIDCConfig(down)
+		down.Close()
+
+		state, err := services.NewOIDCLoginState()
+		require.NoError(t, err)
+		_, err = services.NewOIDCService(cfg).AuthorizationURL(state)
+		assert.ErrorIs(t, err, services.ErrOIDCUnavailable)
+	})
+}
@@ -0,0 +1,165 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/apperror"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	bannedFile := filepath.Join(t.TempDir(), "banned.txt")
+	require.NoError(t, os.WriteFile(bannedFile, []byte("# common passwords\nSummer2024!\n\n"), 0600))
+
+	policy := services.NewPasswordPolicy(&config.PasswordPolicyConfig{
+		MinLength:        10,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSpecial:   true,
+		BannedListFile:   bannedFile,
+	})
+	require.NoError(t, policy.Load())
+
+	t.Run("valid password", func(t *testing.T) {
+		assert.NoError(t, policy.Validate("Correct-Horse7", "jdoe", "jdoe@example.com"))
+	})
+
+	t.Run("reports all missing rules", func(t *testing.T) {
+		err := policy.Validate("short", "jdoe", "jdoe@example.com")
+		require.Error(t, err)
+
+		var appErr *apperror.AppError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, 400, appErr.Code)
+		assert.Contains(t, appErr.Message, "at least 10 characters")
+		assert.Contains(t, appErr.Message, "an uppercase letter")
+		assert.Contains(t, appErr.Message, "a digit")
+		assert.Contains(t, appErr.Message, "a special character")
+		assert.NotContains(t, appErr.Message, "a lowercase letter")
+	})
+
+	t.Run("banned password is case-insensitive", func(t *testing.T) {
+		assert.ErrorIs(t, policy.Validate("sUMMER2024!", "jdoe", "jdoe@example.com"), services.ErrPasswordBanned)
+	})
+
+	t.Run("username and email", func(t *testing.T) {
+		assert.ErrorIs(t, policy.Validate("My-Jdoe-Pass1", "jdoe", "x@example.com"), services.ErrPasswordUserInfo)
+		assert.ErrorIs(t, policy.Validate("Hello-John.Doe1", "x", "john.doe@example.com"), services.ErrPasswordUserInfo)
+	})
+
+	t.Run("user info allowed", func(t *testing.T) {
+		lenient := services.NewPasswordPolicy(&config.PasswordPolicyConfig{AllowUserInfo: true})
+		assert.NoError(t, lenient.Validate("jdoe-password", "jdoe", "jdoe@example.com"))
+	})
+
+	t.Run("missing banned list file", func(t *testing.T) {
+		missing := services.NewPasswordPolicy(&config.PasswordPolicyConfig{BannedListFile: filepath.Join(t.TempDir(), "none.txt")})
+		assert.Error(t, missing.Load())
+	})
+}
+
+func TestUserService_PasswordPolicy(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewUserServiceWithPolicy(&config.PasswordPolicyConfig{
+		MinLength:    12,
+		RequireDigit: true,
+		HistorySize:  2,
+	})
+	admin := testutil.CreateTestAdmin(t)
+
+	t.Run("create enforces policy", func(t *testing.T) {
+		req := &dto.CreateUserRequest{
+			Username:  "policyuser",
+			Password:  "password-only",
+			FirstName: "Policy",
+			LastName:  "User",
+			Email:     "policyuser@test.com",
+			Role:      models.RoleUser,
+		}
+		_, err := service.Create(req, admin.ID)
+		assert.Error(t, err)
+
+		req.Password = "password-123"
+		user, err := service.Create(req, admin.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, user.PasswordChangedAt)
+	})
+
+	t.Run("history prevents reuse", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "historyuser")
+
+		// The current password cannot be reused
+		err := service.UpdatePassword(user.ID, "testpassword123", "testpassword123", user.ID)
+		assert.ErrorIs(t, err, services.ErrPasswordReused)
+
+		require.NoError(t, service.UpdatePassword(user.ID, "testpassword123", "second-pass-1", user.ID))
+		require.NoError(t, service.UpdatePassword(user.ID, "second-pass-1", "third-pass-22", user.ID))
+
+		err = service.UpdatePassword(user.ID, "third-pass-22", "testpassword123", user.ID)
+		assert.ErrorIs(t, err, services.ErrPasswordReused)
+		err = service.UpdatePassword(user.ID, "third-pass-22", "second-pass-1", user.ID)
+		assert.ErrorIs(t, err, services.ErrPasswordReused)
+
+		// Only the last two replaced passwords are kept
+		require.NoError(t, service.UpdatePassword(user.ID, "third-pass-22", "fourth-pass-333", user.ID))
+		var count int64
+		db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(2), count)
+		assert.NoError(t, service.UpdatePassword(user.ID, "fourth-pass-333", "testpassword123", user.ID))
+	})
+
+	t.Run("update enforces policy", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "weakchange")
+		err := service.UpdatePassword(user.ID, "testpassword123", "no-digits-here", user.ID)
+
+		var appErr *apperror.AppError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, "Password must contain a digit", appErr.Message)
+	})
+}
+
+func TestAuthService_PasswordMaxAge(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:      "test-secret-key-for-testing-minimum-32-chars",
+		TokenExpiry:    24,
+		PasswordPolicy: config.PasswordPolicyConfig{MaxAgeDays: 90},
+	}
+	service := services.NewAuthService(cfg)
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "aginguser")
+
+	t.Run("recent password", func(t *testing.T) {
+		token, _, err := service.Authenticate("aginguser", "testpassword123")
+		require.NoError(t, err)
+
+		claims, err := middleware.ParseToken(cfg, token)
+		require.NoError(t, err)
+		assert.False(t, claims.PasswordChangeRequired)
+	})
+
+	t.Run("expired password requires change", func(t *testing.T) {
+		require.NoError(t, db.Model(user).Update("password_changed_at", time.Now().AddDate(0, 0, -91)).Error)
+
+		token, _, err := service.Authenticate("aginguser", "testpassword123")
+		require.NoError(t, err)
+
+		claims, err := middleware.ParseToken(cfg, token)
+		require.NoError(t, err)
+		assert.True(t, claims.PasswordChangeRequired)
+	})
+}
@@ -0,0 +1,160 @@
+package services_test
+
+import (
+	"io"
+	"mime/quotedprintable"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/mailer"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+var resetLinkPattern = regexp.MustCompile(`https://vpn\.example\.com/reset-password\?token=([A-Za-z0-9_%-]+)`)
+
+// resetToken extracts the token of the reset link from a received message
+func resetToken(t *testing.T, msg testutil.SMTPMessage) string {
+	t.Helper()
+	body, err := readQuotedPrintable(msg.Data)
+	require.NoError(t, err)
+	match := resetLinkPattern.FindStringSubmatch(body)
+	require.NotNil(t, match, "reset link not found in message")
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+func readQuotedPrintable(data string) (string, error) {
+	b, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(data)))
+	return string(b), err
+}
+
+func TestPasswordResetService(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	stub := testutil.StartSMTPStub(t)
+	mailCfg := &config.MailConfig{
+		Enabled: true,
+		Host:    stub.Host,
+		Port:    stub.Port,
+		From:    "vpn@example.com",
+		TLS:     mailer.TLSModeNone,
+	}
+	cfg := &config.AuthConfig{
+		JWTSecret:           "test-secret-key-for-testing-minimum-32-chars",
+		PasswordResetExpiry: 30,
+	}
+	service := services.NewPasswordResetService(cfg, "https://vpn.example.com/", mailer.New(mailCfg))
+
+	t.Run("unknown account sends nothing", func(t *testing.T) {
+		user, err := service.Request("nobody@example.com", "203.0.113.1")
+		assert.NoError(t, err)
+		assert.Nil(t, user)
+		assert.Empty(t, stub.Messages)
+	})
+
+	t.Run("reset by emailed link", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "forgetful")
+		lockedUntil := time.Now().Add(time.Hour)
+		require.NoError(t, db.Model(user).Updates(map[string]interface{}{
+			"failed_login_attempts": 5,
+			"locked_until":          lockedUntil,
+		}).Error)
+
+		requested, err := service.Request(user.Email, "203.0.113.1")
+		require.NoError(t, err)
+		require.NotNil(t, requested)
+		assert.Equal(t, user.ID, requested.ID)
+
+		msg := stub.WaitMessage(t)
+		assert.Equal(t, []string{user.Email}, msg.To)
+		token := resetToken(t, msg)
+
+		// Only the hash is stored
+		var stored models.PasswordResetToken
+		require.NoError(t, db.First(&stored, "user_id = ?", user.ID).Error)
+		assert.NotEqual(t, token, stored.TokenHash)
+		assert.WithinDuration(t, time.Now().Add(30*time.Minute), stored.ExpiresAt, time.Minute)
+
+		_, err = service.Reset(token, "brand-new-password")
+		require.NoError(t, err)
+
+		var updated models.User
+		require.NoError(t, db.First(&updated, "id = ?", user.ID).Error)
+		assert.True(t, services.VerifyPassword("brand-new-password", updated.Password))
+		assert.Nil(t, updated.LockedUntil)
+		assert.Equal(t, 0, updated.FailedLoginAttempts)
+		assert.NotNil(t, updated.TokensValidAfter)
+
+		// The link works once
+		_, err = service.Reset(token, "another-password-1")
+		assert.ErrorIs(t, err, services.ErrInvalidResetToken)
+	})
+
+	t.Run("new request invalidates earlier links", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "tworequests")
+
+		_, err := service.Request("tworequests", "203.0.113.1")
+		require.NoError(t, err)
+		first := resetToken(t, stub.WaitMessage(t))
+		_, err = service.Request("tworequests", "203.0.113.1")
+		require.NoError(t, err)
+		second := resetToken(t, stub.WaitMessage(t))
+
+		_, err = service.Reset(first, "brand-new-password")
+		assert.ErrorIs(t, err, services.ErrInvalidResetToken)
+		_, err = service.Reset(second, "brand-new-password")
+		assert.NoError(t, err)
+
+		var used int64
+		db.Model(&models.PasswordResetToken{}).Where("user_id = ? AND used_at IS NOT NULL", user.ID).Count(&used)
+		assert.Equal(t, int64(1), used)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "slowreader")
+		_, err := service.Request("slowreader", "203.0.113.1")
+		require.NoError(t, err)
+		token := resetToken(t, stub.WaitMessage(t))
+		require.NoError(t, db.Model(&models.PasswordResetToken{}).Where("user_id = ?", user.ID).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		_, err = service.Reset(token, "brand-new-password")
+		assert.ErrorIs(t, err, services.ErrInvalidResetToken)
+	})
+
+	t.Run("policy violation keeps the link", func(t *testing.T) {
+		testutil.CreateTestUserWithName(t, models.RoleUser, "weakreset")
+		_, err := service.Request("weakreset", "203.0.113.1")
+		require.NoError(t, err)
+		token := resetToken(t, stub.WaitMessage(t))
+
+		_, err = service.Reset(token, "weakreset-password")
+		assert.ErrorIs(t, err, services.ErrPasswordUserInfo)
+		_, err = service.Reset(token, "brand-new-password")
+		assert.NoError(t, err)
+	})
+
+	t.Run("inactive and directory users", func(t *testing.T) {
+		inactive := testutil.CreateTestUserWithName(t, models.RoleUser, "inactivereset")
+		require.NoError(t, db.Model(inactive).Update("is_active", false).Error)
+		directory := testutil.CreateTestUserWithName(t, models.RoleUser, "ldapreset")
+		require.NoError(t, db.Model(directory).Update("auth_source", models.AuthSourceLDAP).Error)
+
+		for _, login := range []string{"inactivereset", "ldapreset"} {
+			user, err := service.Request(login, "203.0.113.1")
+			assert.NoError(t, err)
+			assert.Nil(t, user)
+		}
+		assert.Empty(t, stub.Messages)
+	})
+}
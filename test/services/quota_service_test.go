@@ -0,0 +1,137 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func addTestTraffic(t *testing.T, sessionID uuid.UUID, timestamp time.Time, received, sent int64) {
+	stats := &models.VpnTrafficStats{
+		SessionID:          sessionID,
+		Timestamp:          timestamp,
+		BytesReceivedDelta: received,
+		BytesSentDelta:     sent,
+	}
+	require.NoError(t, testutil.TestDB.Create(stats).Error)
+}
+
+func TestCurrentQuotaPeriod(t *testing.T) {
+	now := time.Date(2024, time.February, 15, 13, 45, 0, 0, time.UTC)
+
+	start, end := services.CurrentQuotaPeriod(now)
+	assert.Equal(t, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), end)
+}
+
+func TestQuotaService_GetStatus(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewQuotaService()
+	periodStart, _ := services.CurrentQuotaPeriod(time.Now())
+
+	t.Run("unlimited user is never exceeded", func(t *testing.T) {
+		user := testutil.CreateTestRegularUser(t)
+		session := testutil.CreateTestVpnSession(t, user.ID)
+		addTestTraffic(t, session.ID, time.Now(), 5000, 5000)
+
+		status, err := service.GetStatus(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), status.Quota)
+		assert.Equal(t, int64(10000), status.Usage)
+		assert.False(t, status.Exceeded)
+		assert.NoError(t, service.Check(user.ID))
+	})
+
+	t.Run("ignores traffic from previous periods", func(t *testing.T) {
+		user := testutil.CreateTestRegularUser(t)
+		require.NoError(t, db.Model(user).Update("monthly_traffic_quota", 1000).Error)
+		session := testutil.CreateTestVpnSession(t, user.ID)
+		addTestTraffic(t, session.ID, periodStart.Add(-time.Hour), 5000, 5000)
+		addTestTraffic(t, session.ID, time.Now(), 100, 200)
+
+		status, err := service.GetStatus(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(300), status.Usage)
+		assert.False(t, status.Exceeded)
+	})
+
+	t.Run("user quota exceeded", func(t *testing.T) {
+		user := testutil.CreateTestRegularUser(t)
+		require.NoError(t, db.Model(user).Update("monthly_traffic_quota", 1000).Error)
+		session := testutil.CreateTestVpnSession(t, user.ID)
+		addTestTraffic(t, session.ID, time.Now(), 600, 400)
+
+		status, err := service.GetStatus(user.ID)
+		require.NoError(t, err)
+		assert.True(t, status.Exceeded)
+		require.NotNil(t, status.ExceededBy)
+		assert.Equal(t, "user", status.ExceededBy.Scope)
+		assert.ErrorIs(t, service.Check(user.ID), services.ErrQuotaExceeded)
+	})
+
+	t.Run("group quota is shared by members", func(t *testing.T) {
+		admin := testutil.CreateTestAdmin(t)
+		group := testutil.CreateTestGroup(t, admin.ID)
+		require.NoError(t, db.Model(group).Update("monthly_traffic_quota", 1000).Error)
+
+		member1 := testutil.CreateTestRegularUser(t)
+		member2 := testutil.CreateTestRegularUser(t)
+		groupService := services.NewGroupService()
+		require.NoError(t, groupService.AddUserToGroup(group.ID, member1.ID, admin.ID))
+		require.NoError(t, groupService.AddUserToGroup(group.ID, member2.ID, admin.ID))
+
+		addTestTraffic(t, testutil.CreateTestVpnSession(t, member1.ID).ID, time.Now(), 300, 300)
+
+		status, err := service.GetStatus(member2.ID)
+		require.NoError(t, err)
+		require.Len(t, status.Groups, 1)
+		assert.Equal(t, int64(600), status.Groups[0].Usage)
+		assert.False(t, status.Exceeded)
+
+		addTestTraffic(t, testutil.CreateTestVpnSession(t, member2.ID).ID, time.Now(), 200, 200)
+
+		status, err = service.GetStatus(member1.ID)
+		require.NoError(t, err)
+		assert.True(t, status.Exceeded)
+		require.NotNil(t, status.ExceededBy)
+		assert.Equal(t, "group", status.ExceededBy.Scope)
+		assert.Equal(t, group.Name, status.ExceededBy.Name)
+	})
+
+	t.Run("returns error for non-existent user", func(t *testing.T) {
+		_, err := service.GetStatus(uuid.New())
+		assert.Error(t, err)
+	})
+}
+
+func TestQuotaService_GetSessionsOverQuota(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewQuotaService()
+
+	overUser := testutil.CreateTestRegularUser(t)
+	require.NoError(t, db.Model(overUser).Update("monthly_traffic_quota", 100).Error)
+	overSession := testutil.CreateTestVpnSession(t, overUser.ID)
+	addTestTraffic(t, overSession.ID, time.Now(), 100, 100)
+
+	okUser := testutil.CreateTestRegularUser(t)
+	require.NoError(t, db.Model(okUser).Update("monthly_traffic_quota", 1000000).Error)
+	okSession := testutil.CreateTestVpnSession(t, okUser.ID)
+	addTestTraffic(t, okSession.ID, time.Now(), 100, 100)
+
+	sessions, err := service.GetSessionsOverQuota()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, overSession.ID, sessions[0].SessionID)
+	assert.Equal(t, overUser.ID, sessions[0].UserID)
+	assert.Equal(t, overUser.Username, sessions[0].Username)
+}
@@ -0,0 +1,272 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestRefreshTokenService(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:         "test-secret-key-for-testing-minimum-32-chars",
+		AccessTokenExpiry: 5,
+		TokenExpiry:       24,
+		SessionExpiry:     8,
+	}
+	service := services.NewRefreshTokenService(cfg)
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "refreshuser")
+
+	t.Run("issue stores only a hash", func(t *testing.T) {
+		secret, token, err := service.Issue(user, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+
+		assert.True(t, len(secret) > 40)
+		assert.NotContains(t, token.TokenHash, secret)
+		assert.WithinDuration(t, time.Now().Add(8*time.Hour), token.ExpiresAt, time.Minute)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), token.FamilyExpiresAt, time.Minute)
+	})
+
+	t.Run("refresh rotates the token", func(t *testing.T) {
+		secret, first, err := service.Issue(user, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+
+		pair, err := service.Refresh(secret, "203.0.113.2", "test-agent")
+		require.NoError(t, err)
+		assert.NotEqual(t, secret, pair.RefreshToken)
+		assert.Equal(t, first.FamilyID, pair.Refresh.FamilyID)
+		assert.Equal(t, user.ID, pair.User.ID)
+
+		claims, err := middleware.ParseToken(cfg, pair.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID.String(), claims.UserID)
+		assert.WithinDuration(t, time.Now().Add(5*time.Minute), claims.ExpiresAt.Time, 5*time.Second)
+
+		var used models.RefreshToken
+		require.NoError(t, db.First(&used, "id = ?", first.ID).Error)
+		require.NotNil(t, used.UsedAt)
+		assert.Equal(t, pair.Refresh.ID, *used.ReplacedBy)
+
+		// The new token can be refreshed in turn
+		_, err = service.Refresh(pair.RefreshToken, "203.0.113.2", "test-agent")
+		require.NoError(t, err)
+	})
+
+	t.Run("concurrent reuse within grace period", func(t *testing.T) {
+		secret, _, err := service.Issue(user, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+
+		pair, err := service.Refresh(secret, "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+
+		_, err = service.Refresh(secret, "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrRefreshTokenRotated)
+
+		// The family stays valid
+		_, err = service.Refresh(pair.RefreshToken, "203.0.113.1", "test-agent")
+		assert.NoError(t, err)
+	})
+
+	t.Run("reuse revokes the whole family", func(t *testing.T) {
+		secret, first, err := service.Issue(user, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+
+		pair, err := service.Refresh(secret, "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+
+		// Move the rotation out of the grace period
+		require.NoError(t, db.Model(&models.RefreshToken{}).Where("id = ?", first.ID).
+			Update("used_at", time.Now().Add(-time.Minute)).Error)
+
+		_, err = service.Refresh(secret, "198.51.100.1", "attacker")
+		assert.ErrorIs(t, err, services.ErrRefreshTokenReused)
+
+		_, err = service.Refresh(pair.RefreshToken, "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+
+		var active int64
+		db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", first.FamilyID).Count(&active)
+		assert.Equal(t, int64(0), active)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		secret, token, err := service.Issue(user, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+		require.NoError(t, db.Model(token).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		_, err = service.Refresh(secret, "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrRefreshTokenExpired)
+	})
+
+	t.Run("family lifetime caps token expiry", func(t *testing.T) {
+		secret, token, err := service.Issue(user, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+		familyEnd := time.Now().Add(time.Hour)
+		require.NoError(t, db.Model(token).Update("family_expires_at", familyEnd).Error)
+
+		pair, err := service.Refresh(secret, "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+		assert.WithinDuration(t, familyEnd, pair.Refresh.ExpiresAt, time.Second)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := service.Refresh("not-a-token", "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+	})
+
+	t.Run("disabled user", func(t *testing.T) {
+		disabled := testutil.CreateTestUserWithName(t, models.RoleUser, "refreshdisabled")
+		secret, token, err := service.Issue(disabled, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+		require.NoError(t, db.Model(disabled).Update("is_active", false).Error)
+
+		_, err = service.Refresh(secret, "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrUserInactive)
+
+		var revoked models.RefreshToken
+		require.NoError(t, db.First(&revoked, "id = ?", token.ID).Error)
+		assert.True(t, revoked.IsRevoked())
+	})
+
+	t.Run("revoke ends the login", func(t *testing.T) {
+		secret, _, err := service.Issue(user, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+		require.NoError(t, service.Revoke(secret))
+
+		_, err = service.Refresh(secret, "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+		assert.NoError(t, service.Revoke("unknown"))
+	})
+}
+
+func TestRefreshTokenService_Sessions(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := &config.AuthConfig{
+		JWTSecret:         "test-secret-key-for-testing-minimum-32-chars",
+		AccessTokenExpiry: 5,
+		TokenExpiry:       24,
+		SessionExpiry:     8,
+	}
+	service := services.NewRefreshTokenService(cfg)
+	authService := services.NewAuthService(cfg)
+	user := testutil.CreateTestUserWithName(t, models.RoleUser, "sessionuser")
+
+	login := func(t *testing.T, userAgent string) (string, string, *models.RefreshToken) {
+		t.Helper()
+		accessToken, err := authService.IssueToken(user)
+		require.NoError(t, err)
+		secret, token, err := service.Issue(user, accessToken, "203.0.113.1", userAgent)
+		require.NoError(t, err)
+		return accessToken, secret, token
+	}
+	tokenID := func(t *testing.T, accessToken string) string {
+		t.Helper()
+		claims, err := middleware.ParseToken(cfg, accessToken)
+		require.NoError(t, err)
+		return claims.ID
+	}
+
+	t.Run("lists active logins", func(t *testing.T) {
+		firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+		accessToken, secret, first := login(t, firefox)
+		_, _, other := login(t, "curl/8.5.0")
+
+		// A refresh keeps the session and updates its last activity
+		pair, err := service.Refresh(secret, "198.51.100.7", firefox)
+		require.NoError(t, err)
+
+		sessions, err := service.ListSessions(user.ID, tokenID(t, pair.AccessToken))
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		byID := map[string]services.LoginSession{}
+		for _, s := range sessions {
+			byID[s.ID.String()] = s
+		}
+
+		current := byID[first.FamilyID.String()]
+		assert.True(t, current.Current)
+		assert.Equal(t, "Firefox on Linux", current.Device)
+		assert.Equal(t, "198.51.100.7", current.IPAddress)
+		assert.Equal(t, first.CreatedAt.Unix(), current.CreatedAt.Unix())
+		assert.False(t, current.LastSeenAt.Before(current.CreatedAt))
+		assert.False(t, byID[other.FamilyID.String()].Current)
+		assert.Equal(t, "curl", byID[other.FamilyID.String()].Device)
+
+		// The access token from before the refresh still identifies the session
+		sessions, err = service.ListSessions(user.ID, tokenID(t, accessToken))
+		require.NoError(t, err)
+		for _, s := range sessions {
+			assert.Equal(t, s.ID == first.FamilyID, s.Current)
+		}
+		assert.Equal(t, first.FamilyID, service.SessionOfToken(user.ID, tokenID(t, accessToken)))
+	})
+
+	t.Run("revoke ends the session and its access tokens", func(t *testing.T) {
+		accessToken, secret, token := login(t, "test-agent")
+
+		jtis, err := service.RevokeSession(user.ID, token.FamilyID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{tokenID(t, accessToken)}, jtis)
+
+		var count int64
+		db.Model(&models.RevokedToken{}).Where("jti = ?", jtis[0]).Count(&count)
+		assert.Equal(t, int64(1), count)
+		_, err = service.Refresh(secret, "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+
+		_, err = service.RevokeSession(user.ID, token.FamilyID)
+		assert.Error(t, err)
+	})
+
+	t.Run("sessions of other users cannot be revoked", func(t *testing.T) {
+		_, _, token := login(t, "test-agent")
+		other := testutil.CreateTestUserWithName(t, models.RoleUser, "sessionother")
+
+		_, err := service.RevokeSession(other.ID, token.FamilyID)
+		assert.Error(t, err)
+	})
+
+	t.Run("revoke all but one", func(t *testing.T) {
+		_, _, keep := login(t, "test-agent")
+		login(t, "test-agent")
+
+		_, err := service.RevokeSessions(user.ID, keep.FamilyID)
+		require.NoError(t, err)
+		sessions, err := service.ListSessions(user.ID, "")
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, keep.FamilyID, sessions[0].ID)
+
+		_, err = service.RevokeSessions(user.ID, uuid.Nil)
+		require.NoError(t, err)
+		sessions, err = service.ListSessions(user.ID, "")
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+}
+
+func TestDeviceName(t *testing.T) {
+	tests := map[string]string{
+		"":           "Unknown",
+		"curl/8.5.0": "curl",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0":    "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15":               "Safari on macOS",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36":                     "Chrome on Android",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile Safari/604.1": "Safari on iOS",
+	}
+	for userAgent, expected := range tests {
+		assert.Equal(t, expected, services.DeviceName(userAgent), userAgent)
+	}
+}
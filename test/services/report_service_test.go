@@ -0,0 +1,128 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func createTestSessionAt(t *testing.T, userID uuid.UUID, connectedAt time.Time, duration time.Duration) *models.VpnSession {
+	disconnectedAt := connectedAt.Add(duration)
+	session := &models.VpnSession{
+		UserID:         userID,
+		VpnIP:          "10.8.0.100",
+		ConnectedAt:    connectedAt,
+		DisconnectedAt: &disconnectedAt,
+	}
+	require.NoError(t, testutil.TestDB.Create(session).Error)
+	return session
+}
+
+func TestReportService_GetTopTalkers(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewReportService()
+	end := time.Now().UTC().Truncate(time.Hour)
+	start := end.Add(-24 * time.Hour)
+
+	admin := testutil.CreateTestAdmin(t)
+	group := testutil.CreateTestGroup(t, admin.ID)
+	heavy := testutil.CreateTestRegularUser(t)
+	light := testutil.CreateTestRegularUser(t)
+	require.NoError(t, services.NewGroupService().AddUserToGroup(group.ID, heavy.ID, admin.ID))
+	require.NoError(t, services.NewGroupService().AddUserToGroup(group.ID, light.ID, admin.ID))
+
+	// Current period
+	heavySession := createTestSessionAt(t, heavy.ID, start.Add(time.Hour), 2*time.Hour)
+	addTestTraffic(t, heavySession.ID, start.Add(90*time.Minute), 5000, 1000)
+	lightSession1 := createTestSessionAt(t, light.ID, start.Add(2*time.Hour), 30*time.Minute)
+	addTestTraffic(t, lightSession1.ID, start.Add(2*time.Hour+10*time.Minute), 100, 0)
+	createTestSessionAt(t, light.ID, start.Add(5*time.Hour), 30*time.Minute)
+	createTestSessionAt(t, light.ID, start.Add(6*time.Hour), 30*time.Minute)
+
+	// Previous period
+	previousSession := createTestSessionAt(t, heavy.ID, start.Add(-12*time.Hour), time.Hour)
+	addTestTraffic(t, previousSession.ID, start.Add(-12*time.Hour+time.Minute), 2000, 1000)
+
+	t.Run("ranks users by bytes with previous period comparison", func(t *testing.T) {
+		report, err := service.GetTopTalkers(&dto.TopTalkersFilter{Start: &start, End: &end, Limit: 10, SortBy: "bytes"})
+		require.NoError(t, err)
+		assert.True(t, start.Equal(report.Start))
+		assert.True(t, start.Add(-24*time.Hour).Equal(report.PreviousStart))
+
+		require.Len(t, report.Users, 2)
+		assert.Equal(t, heavy.ID, report.Users[0].ID)
+		assert.Equal(t, heavy.Username, report.Users[0].Name)
+		assert.Equal(t, 1, report.Users[0].Rank)
+		assert.Equal(t, int64(6000), report.Users[0].Current.TotalBytes)
+		assert.Equal(t, int64(3000), report.Users[0].Previous.TotalBytes)
+		require.NotNil(t, report.Users[0].ChangePercent)
+		assert.InDelta(t, 100.0, *report.Users[0].ChangePercent, 0.01)
+		assert.Nil(t, report.Users[1].ChangePercent)
+
+		require.Len(t, report.Groups, 1)
+		assert.Equal(t, group.Name, report.Groups[0].Name)
+		assert.Equal(t, int64(6100), report.Groups[0].Current.TotalBytes)
+		assert.Equal(t, int64(4), report.Groups[0].Current.Sessions)
+	})
+
+	t.Run("ranks users by sessions", func(t *testing.T) {
+		report, err := service.GetTopTalkers(&dto.TopTalkersFilter{Start: &start, End: &end, Limit: 10, SortBy: "sessions"})
+		require.NoError(t, err)
+		require.Len(t, report.Users, 2)
+		assert.Equal(t, light.ID, report.Users[0].ID)
+		assert.Equal(t, int64(3), report.Users[0].Current.Sessions)
+	})
+
+	t.Run("ranks users by connected time", func(t *testing.T) {
+		report, err := service.GetTopTalkers(&dto.TopTalkersFilter{Start: &start, End: &end, Limit: 1, SortBy: "duration"})
+		require.NoError(t, err)
+		require.Len(t, report.Users, 1)
+		assert.Equal(t, heavy.ID, report.Users[0].ID)
+		assert.Equal(t, int64(7200), report.Users[0].Current.ConnectedSeconds)
+	})
+
+	t.Run("reads periods past the hourly retention from daily rollups", func(t *testing.T) {
+		cfg := newTestTrafficConfig()
+		require.NoError(t, services.NewTrafficRollupService(cfg).Prune(time.Now()))
+
+		local := time.Now().AddDate(0, 0, -(cfg.HourlyRetentionDays + 30)).Local()
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		for _, d := range []struct {
+			start time.Time
+			bytes int64
+		}{
+			{day, 8000},
+			{day.AddDate(0, 0, -1), 2000},
+		} {
+			require.NoError(t, db.Create(&models.VpnTrafficDaily{
+				BucketStart:   d.start.UTC(),
+				UserID:        heavy.ID,
+				BytesReceived: d.bytes,
+			}).Error)
+		}
+
+		oldStart, oldEnd := day.Add(10*time.Hour), day.Add(20*time.Hour)
+		report, err := service.GetTopTalkers(&dto.TopTalkersFilter{Start: &oldStart, End: &oldEnd, Limit: 10, SortBy: "bytes"})
+		require.NoError(t, err)
+		assert.True(t, day.Equal(report.Start))
+		assert.True(t, day.AddDate(0, 0, -1).Equal(report.PreviousStart))
+		require.Len(t, report.Users, 1)
+		assert.Equal(t, heavy.ID, report.Users[0].ID)
+		assert.Equal(t, int64(8000), report.Users[0].Current.TotalBytes)
+		assert.Equal(t, int64(2000), report.Users[0].Previous.TotalBytes)
+	})
+
+	t.Run("rejects invalid period", func(t *testing.T) {
+		_, err := service.GetTopTalkers(&dto.TopTalkersFilter{Start: &end, End: &start})
+		assert.Equal(t, services.ErrInvalidReportPeriod, err)
+	})
+}
@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestVpnTrafficStatsService_CreateBatch(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewVpnTrafficStatsService()
+	user := testutil.CreateTestRegularUser(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	deltaSession := &models.VpnSession{UserID: user.ID, VpnIP: "10.8.0.100", ConnectedAt: now.Add(-time.Hour)}
+	counterSession := &models.VpnSession{UserID: user.ID, VpnIP: "10.8.0.101", ConnectedAt: now.Add(-time.Hour)}
+	require.NoError(t, db.Create(deltaSession).Error)
+	require.NoError(t, db.Create(counterSession).Error)
+	closed := createTestSessionAt(t, user.ID, now.Add(-2*time.Hour), time.Hour)
+
+	getSession := func(id uuid.UUID) models.VpnSession {
+		var s models.VpnSession
+		require.NoError(t, db.First(&s, "id = ?", id).Error)
+		return s
+	}
+
+	t.Run("stores deltas and cumulative counters", func(t *testing.T) {
+		earlier := now.Add(-time.Minute)
+		missing := uuid.New()
+		resp, err := service.CreateBatch(&dto.CreateVpnTrafficStatsBatchRequest{
+			Timestamp: &now,
+			Entries: []dto.VpnTrafficStatsBatchEntry{
+				{SessionID: deltaSession.ID, BytesReceivedDelta: int64Ptr(100), BytesSentDelta: int64Ptr(50)},
+				{SessionID: counterSession.ID, BytesReceived: int64Ptr(3000), BytesSent: int64Ptr(1000)},
+				{SessionID: counterSession.ID, Timestamp: &earlier, BytesReceived: int64Ptr(1000), BytesSent: int64Ptr(400)},
+				{SessionID: closed.ID, BytesReceivedDelta: int64Ptr(10)},
+				{SessionID: missing, BytesReceivedDelta: int64Ptr(10)},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, resp.Inserted)
+		assert.Equal(t, 2, resp.Sessions)
+		require.Len(t, resp.Skipped, 2)
+
+		s := getSession(deltaSession.ID)
+		assert.Equal(t, int64(100), s.BytesReceived)
+		assert.Equal(t, int64(50), s.BytesSent)
+
+		s = getSession(counterSession.ID)
+		assert.Equal(t, int64(3000), s.BytesReceived)
+		assert.Equal(t, int64(1000), s.BytesSent)
+
+		// Counters are converted to deltas in chronological order
+		var stats []models.VpnTrafficStats
+		require.NoError(t, db.Where("session_id = ?", counterSession.ID).Order("timestamp ASC").Find(&stats).Error)
+		require.Len(t, stats, 2)
+		assert.Equal(t, int64(1000), stats[0].BytesReceivedDelta)
+		assert.Equal(t, int64(400), stats[0].BytesSentDelta)
+		assert.Equal(t, int64(2000), stats[1].BytesReceivedDelta)
+		assert.Equal(t, int64(600), stats[1].BytesSentDelta)
+
+		var closedStats int64
+		require.NoError(t, db.Model(&models.VpnTrafficStats{}).Where("session_id = ?", closed.ID).Count(&closedStats).Error)
+		assert.Zero(t, closedStats)
+	})
+
+	t.Run("ignores counters below the running total", func(t *testing.T) {
+		resp, err := service.CreateBatch(&dto.CreateVpnTrafficStatsBatchRequest{
+			Entries: []dto.VpnTrafficStatsBatchEntry{
+				{SessionID: counterSession.ID, BytesReceived: int64Ptr(2500), BytesSent: int64Ptr(1000)},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 0, resp.Inserted)
+
+		s := getSession(counterSession.ID)
+		assert.Equal(t, int64(3000), s.BytesReceived)
+	})
+
+	t.Run("returns users over quota with their sessions", func(t *testing.T) {
+		limited := testutil.CreateTestRegularUser(t)
+		require.NoError(t, db.Model(limited).Update("monthly_traffic_quota", 1000).Error)
+		limitedSession := &models.VpnSession{UserID: limited.ID, VpnIP: "10.8.0.102", ConnectedAt: now.Add(-time.Hour)}
+		require.NoError(t, db.Create(limitedSession).Error)
+
+		resp, err := service.CreateBatch(&dto.CreateVpnTrafficStatsBatchRequest{
+			Entries: []dto.VpnTrafficStatsBatchEntry{
+				{SessionID: limitedSession.ID, BytesReceivedDelta: int64Ptr(800), BytesSentDelta: int64Ptr(300)},
+				{SessionID: deltaSession.ID, BytesReceivedDelta: int64Ptr(100)},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.QuotaExceeded, 1)
+		assert.Equal(t, limited.ID, resp.QuotaExceeded[0].UserID)
+		assert.Equal(t, []uuid.UUID{limitedSession.ID}, resp.QuotaExceeded[0].SessionIDs)
+
+		s := getSession(deltaSession.ID)
+		assert.Equal(t, int64(200), s.BytesReceived)
+	})
+
+	t.Run("rejects entries mixing deltas and counters", func(t *testing.T) {
+		_, err := service.CreateBatch(&dto.CreateVpnTrafficStatsBatchRequest{
+			Entries: []dto.VpnTrafficStatsBatchEntry{
+				{SessionID: deltaSession.ID, BytesReceivedDelta: int64Ptr(1), BytesSent: int64Ptr(1)},
+			},
+		})
+		assert.Equal(t, services.ErrInvalidTrafficEntry, err)
+
+		_, err = service.CreateBatch(&dto.CreateVpnTrafficStatsBatchRequest{
+			Entries: []dto.VpnTrafficStatsBatchEntry{{SessionID: deltaSession.ID}},
+		})
+		assert.Equal(t, services.ErrInvalidTrafficEntry, err)
+	})
+}
@@ -0,0 +1,153 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func newTestTrafficConfig() *config.TrafficConfig {
+	return &config.TrafficConfig{
+		RollupInterval:      5,
+		RollupLookback:      2,
+		RawRetentionDays:    30,
+		HourlyRetentionDays: 90,
+	}
+}
+
+func TestTrafficRollupService_Run(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewTrafficRollupService(newTestTrafficConfig())
+	now := time.Now().UTC().Truncate(time.Hour).Add(30 * time.Minute)
+	previousHour := now.Truncate(time.Hour).Add(-time.Hour)
+
+	user := testutil.CreateTestRegularUser(t)
+	session := testutil.CreateTestVpnSession(t, user.ID)
+	addTestTraffic(t, session.ID, previousHour.Add(5*time.Minute), 100, 10)
+	addTestTraffic(t, session.ID, previousHour.Add(35*time.Minute), 200, 20)
+	addTestTraffic(t, session.ID, now.Add(-10*time.Minute), 400, 40) // current hour, not rolled up yet
+
+	require.NoError(t, service.Run(now))
+
+	t.Run("aggregates complete hours per user", func(t *testing.T) {
+		var hourly []models.VpnTrafficHourly
+		require.NoError(t, db.Find(&hourly).Error)
+		require.Len(t, hourly, 1)
+		assert.Equal(t, user.ID, hourly[0].UserID)
+		assert.True(t, previousHour.Equal(hourly[0].BucketStart))
+		assert.Equal(t, int64(300), hourly[0].BytesReceived)
+		assert.Equal(t, int64(30), hourly[0].BytesSent)
+
+		var daily []models.VpnTrafficDaily
+		require.NoError(t, db.Find(&daily).Error)
+		require.Len(t, daily, 1)
+		assert.Equal(t, int64(300), daily[0].BytesReceived)
+	})
+
+	t.Run("moves watermark to current hour", func(t *testing.T) {
+		watermark, err := services.GetTrafficRollupWatermark()
+		require.NoError(t, err)
+		assert.True(t, now.Truncate(time.Hour).Equal(watermark))
+	})
+
+	t.Run("sums rollups and raw tail without double counting", func(t *testing.T) {
+		totals, err := services.SumTraffic([]uuid.UUID{user.ID}, previousHour.Add(-time.Hour), now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(700), totals.BytesReceived)
+		assert.Equal(t, int64(70), totals.BytesSent)
+	})
+
+	t.Run("re-run picks up late stats within lookback", func(t *testing.T) {
+		addTestTraffic(t, session.ID, previousHour.Add(50*time.Minute), 1000, 0)
+		require.NoError(t, service.Run(now))
+
+		var hourly models.VpnTrafficHourly
+		require.NoError(t, db.First(&hourly, "user_id = ?", user.ID).Error)
+		assert.Equal(t, int64(1300), hourly.BytesReceived)
+
+		var count int64
+		db.Model(&models.VpnTrafficHourly{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func TestTrafficRollupService_Prune(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := newTestTrafficConfig()
+	service := services.NewTrafficRollupService(cfg)
+	now := time.Now().UTC()
+
+	user := testutil.CreateTestRegularUser(t)
+	session := testutil.CreateTestVpnSession(t, user.ID)
+	addTestTraffic(t, session.ID, now.AddDate(0, 0, -40), 500, 50)
+	addTestTraffic(t, session.ID, now.Add(-3*time.Hour), 100, 10)
+
+	t.Run("keeps raw stats that were not rolled up", func(t *testing.T) {
+		require.NoError(t, service.Prune(now))
+
+		var count int64
+		db.Model(&models.VpnTrafficStats{}).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("prunes raw stats after rollup and keeps totals", func(t *testing.T) {
+		require.NoError(t, service.Run(now))
+
+		var count int64
+		db.Model(&models.VpnTrafficStats{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		totals, err := services.SumTraffic(nil, now.AddDate(0, 0, -41).Truncate(time.Hour), now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(600), totals.BytesReceived)
+	})
+
+	t.Run("prunes hourly rollups past retention", func(t *testing.T) {
+		old := &models.VpnTrafficHourly{
+			BucketStart:   now.AddDate(0, 0, -(cfg.HourlyRetentionDays + 1)).Truncate(time.Hour),
+			UserID:        user.ID,
+			BytesReceived: 1,
+		}
+		require.NoError(t, db.Create(old).Error)
+
+		require.NoError(t, service.Prune(now))
+
+		var count int64
+		db.Model(&models.VpnTrafficHourly{}).Where("id = ?", old.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+
+		db.Model(&models.VpnTrafficDaily{}).Count(&count)
+		assert.Greater(t, count, int64(0))
+	})
+
+	t.Run("sums daily rollups past hourly retention", func(t *testing.T) {
+		local := now.AddDate(0, 0, -120).Local()
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		require.NoError(t, db.Create(&models.VpnTrafficDaily{
+			BucketStart:   day.UTC(),
+			UserID:        user.ID,
+			BytesReceived: 5000,
+			BytesSent:     500,
+		}).Error)
+
+		totals, err := services.SumTraffic([]uuid.UUID{user.ID}, day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5000), totals.BytesReceived)
+
+		byUser, err := services.SumTrafficByUser(day.AddDate(0, 0, -1), now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5600), byUser[user.ID].BytesReceived)
+		assert.Equal(t, int64(560), byUser[user.ID].BytesSent)
+	})
+}
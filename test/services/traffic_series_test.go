@@ -0,0 +1,131 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestVpnTrafficStatsService_GetSeries(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewVpnTrafficStatsService()
+	base := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+
+	admin := testutil.CreateTestAdmin(t)
+	group := testutil.CreateTestGroup(t, admin.ID)
+	member := testutil.CreateTestRegularUser(t)
+	other := testutil.CreateTestRegularUser(t)
+	require.NoError(t, services.NewGroupService().AddUserToGroup(group.ID, member.ID, admin.ID))
+
+	memberSession := testutil.CreateTestVpnSession(t, member.ID)
+	otherSession := testutil.CreateTestVpnSession(t, other.ID)
+	addTestTraffic(t, memberSession.ID, base.Add(1*time.Minute), 100, 10)
+	addTestTraffic(t, memberSession.ID, base.Add(7*time.Minute), 200, 20)
+	addTestTraffic(t, otherSession.ID, base.Add(2*time.Minute), 1000, 100)
+	addTestTraffic(t, memberSession.ID, base.Add(2*time.Hour+30*time.Minute), 400, 40)
+
+	t.Run("buckets raw stats into 5 minutes", func(t *testing.T) {
+		start, end := base, base.Add(15*time.Minute)
+		series, err := service.GetSeries(&dto.TrafficSeriesFilter{Start: &start, End: &end, Bucket: "5m"})
+		require.NoError(t, err)
+		require.Len(t, series.Points, 3)
+		assert.True(t, base.Equal(series.Points[0].Timestamp))
+		assert.Equal(t, int64(1100), series.Points[0].BytesReceived)
+		assert.Equal(t, int64(200), series.Points[1].BytesReceived)
+		assert.Equal(t, int64(0), series.Points[2].BytesReceived)
+	})
+
+	t.Run("filters by user", func(t *testing.T) {
+		start, end := base, base.Add(3*time.Hour)
+		series, err := service.GetSeries(&dto.TrafficSeriesFilter{UserID: &member.ID, Start: &start, End: &end, Bucket: "1h"})
+		require.NoError(t, err)
+		require.Len(t, series.Points, 3)
+		assert.Equal(t, int64(300), series.Points[0].BytesReceived)
+		assert.Equal(t, int64(0), series.Points[1].BytesReceived)
+		assert.Equal(t, int64(400), series.Points[2].BytesReceived)
+	})
+
+	t.Run("filters by group", func(t *testing.T) {
+		start, end := base, base.Add(time.Hour)
+		series, err := service.GetSeries(&dto.TrafficSeriesFilter{GroupID: &group.ID, Start: &start, End: &end, Bucket: "1h"})
+		require.NoError(t, err)
+		require.Len(t, series.Points, 1)
+		assert.Equal(t, int64(300), series.Points[0].BytesReceived)
+		assert.Equal(t, int64(30), series.Points[0].BytesSent)
+	})
+
+	t.Run("filters by network", func(t *testing.T) {
+		network := testutil.CreateTestNetwork(t, admin.ID)
+		require.NoError(t, services.NewNetworkService().AddGroupToNetwork(network.ID, group.ID, admin.ID))
+
+		start, end := base, base.Add(time.Hour)
+		series, err := service.GetSeries(&dto.TrafficSeriesFilter{NetworkID: &network.ID, Start: &start, End: &end, Bucket: "1h"})
+		require.NoError(t, err)
+		require.Len(t, series.Points, 1)
+		assert.Equal(t, int64(300), series.Points[0].BytesReceived)
+	})
+
+	t.Run("combines rollups with raw tail", func(t *testing.T) {
+		rollup := services.NewTrafficRollupService(newTestTrafficConfig())
+		require.NoError(t, rollup.RollupHours(base, base.Add(time.Hour)))
+
+		start, end := base, base.Add(3*time.Hour)
+		series, err := service.GetSeries(&dto.TrafficSeriesFilter{Start: &start, End: &end, Bucket: "1h"})
+		require.NoError(t, err)
+		require.Len(t, series.Points, 3)
+		assert.Equal(t, int64(1300), series.Points[0].BytesReceived)
+		assert.Equal(t, int64(400), series.Points[2].BytesReceived)
+	})
+
+	t.Run("rejects invalid range", func(t *testing.T) {
+		start, end := base, base.Add(-time.Hour)
+		_, err := service.GetSeries(&dto.TrafficSeriesFilter{Start: &start, End: &end, Bucket: "1h"})
+		assert.Equal(t, services.ErrInvalidSeriesRange, err)
+	})
+
+	t.Run("rejects too many buckets", func(t *testing.T) {
+		start, end := base.AddDate(0, 0, -30), base
+		_, err := service.GetSeries(&dto.TrafficSeriesFilter{Start: &start, End: &end, Bucket: "5m"})
+		assert.Equal(t, services.ErrSeriesTooLarge, err)
+	})
+
+	t.Run("rejects unknown bucket", func(t *testing.T) {
+		_, err := service.GetSeries(&dto.TrafficSeriesFilter{Bucket: "1w"})
+		assert.Equal(t, services.ErrInvalidSeriesBucket, err)
+	})
+}
+
+func TestVpnTrafficStatsService_GetSeriesLocalDays(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	defer func() { time.Local = local }()
+
+	service := services.NewVpnTrafficStatsService()
+	today := time.Now().In(time.Local)
+	midnight := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+
+	user := testutil.CreateTestRegularUser(t)
+	session := testutil.CreateTestVpnSession(t, user.ID)
+	// Same UTC day, different local days
+	addTestTraffic(t, session.ID, midnight.Add(-30*time.Minute), 100, 10)
+	addTestTraffic(t, session.ID, midnight.Add(30*time.Minute), 200, 20)
+
+	start, end := midnight.AddDate(0, 0, -1).Add(time.Hour), midnight.AddDate(0, 0, 1)
+	series, err := service.GetSeries(&dto.TrafficSeriesFilter{Start: &start, End: &end, Bucket: "1d"})
+	require.NoError(t, err)
+	require.Len(t, series.Points, 2)
+	assert.True(t, midnight.AddDate(0, 0, -1).Equal(series.Points[0].Timestamp))
+	assert.Equal(t, int64(100), series.Points[0].BytesReceived)
+	assert.True(t, midnight.Equal(series.Points[1].Timestamp))
+	assert.Equal(t, int64(200), series.Points[1].BytesReceived)
+}
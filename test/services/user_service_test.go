@@ -6,7 +6,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/middleware"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
 	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
@@ -187,6 +189,15 @@ func TestUserService_Update(t *testing.T) {
 		user, err := service.Update(testUser.ID, req, admin.ID)
 		require.NoError(t, err)
 		assert.Equal(t, models.RoleManager, user.Role)
+		assert.NotNil(t, user.TokensValidAfter)
+	})
+
+	t.Run("profile changes keep tokens valid", func(t *testing.T) {
+		testUser := testutil.CreateTestRegularUser(t)
+
+		user, err := service.Update(testUser.ID, &dto.UpdateUserRequest{FirstName: "Kept"}, admin.ID)
+		require.NoError(t, err)
+		assert.Nil(t, user.TokensValidAfter)
 	})
 
 	t.Run("updates user active status", func(t *testing.T) {
@@ -200,6 +211,7 @@ func TestUserService_Update(t *testing.T) {
 		user, err := service.Update(testUser.ID, req, admin.ID)
 		require.NoError(t, err)
 		assert.False(t, user.IsActive)
+		assert.NotNil(t, user.TokensValidAfter)
 	})
 
 	t.Run("returns error for non-existent user", func(t *testing.T) {
@@ -252,6 +264,20 @@ func TestUserService_UpdatePassword(t *testing.T) {
 		assert.True(t, services.VerifyPassword("newpassword123", updatedUser.Password))
 	})
 
+	t.Run("signs out all sessions", func(t *testing.T) {
+		testUser := testutil.CreateTestRegularUser(t)
+		refreshService := services.NewRefreshTokenService(&config.AuthConfig{JWTSecret: "test-secret-key-for-testing-minimum-32-chars"})
+		refreshToken, _, err := refreshService.Issue(testUser, "", "203.0.113.1", "test-agent")
+		require.NoError(t, err)
+
+		require.NoError(t, service.UpdatePassword(testUser.ID, "testpassword123", "newpassword123", testUser.ID))
+
+		updatedUser, _ := service.GetByID(testUser.ID)
+		assert.NotNil(t, updatedUser.TokensValidAfter)
+		_, err = refreshService.Refresh(refreshToken, "203.0.113.1", "test-agent")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+	})
+
 	t.Run("fails with wrong current password", func(t *testing.T) {
 		testUser := testutil.CreateTestRegularUser(t)
 
@@ -259,6 +285,58 @@ func TestUserService_UpdatePassword(t *testing.T) {
 		assert.Error(t, err)
 		assert.Equal(t, services.ErrInvalidCredentials, err)
 	})
+
+	t.Run("clears must change password", func(t *testing.T) {
+		testUser := testutil.CreateTestRegularUser(t)
+		require.NoError(t, db.Model(testUser).Update("must_change_password", true).Error)
+
+		require.NoError(t, service.UpdatePassword(testUser.ID, "testpassword123", "newpassword123", testUser.ID))
+
+		updatedUser, _ := service.GetByID(testUser.ID)
+		assert.False(t, updatedUser.MustChangePassword)
+	})
+}
+
+func TestUserService_MustChangePassword(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	service := services.NewUserService()
+	admin := testutil.CreateTestAdmin(t)
+	cfg := &config.AuthConfig{JWTSecret: "test-secret-key-for-testing-minimum-32-chars"}
+
+	newRequest := func(username string) *dto.CreateUserRequest {
+		return &dto.CreateUserRequest{
+			Username:  username,
+			Password:  "password123",
+			FirstName: "New",
+			LastName:  "User",
+			Email:     username + "@test.com",
+			Role:      models.RoleUser,
+		}
+	}
+
+	t.Run("set for created users", func(t *testing.T) {
+		user, err := service.Create(newRequest("firstlogin"), admin.ID)
+		require.NoError(t, err)
+		assert.True(t, user.MustChangePassword)
+
+		token, _, err := services.NewAuthService(cfg).Authenticate("firstlogin", "password123")
+		require.NoError(t, err)
+		claims, err := middleware.ParseToken(cfg, token)
+		require.NoError(t, err)
+		assert.True(t, claims.PasswordChangeRequired)
+	})
+
+	t.Run("can be disabled on create", func(t *testing.T) {
+		req := newRequest("provisioned")
+		mustChange := false
+		req.MustChangePassword = &mustChange
+
+		user, err := service.Create(req, admin.ID)
+		require.NoError(t, err)
+		assert.False(t, user.MustChangePassword)
+	})
 }
 
 func TestUserService_Delete(t *testing.T) {
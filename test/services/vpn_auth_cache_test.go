@@ -0,0 +1,118 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/dto"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+func TestVpnAuthCache(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	services.ConfigureVpnAuthCache(&config.VpnAuthCacheConfig{Enabled: true, TTL: 60, MaxEntries: 100})
+	defer services.ConfigureVpnAuthCache(nil)
+
+	service := services.NewVpnAuthService(&config.AuthConfig{}, &config.AnomalyConfig{})
+	cache := services.GetVpnAuthCache()
+
+	t.Run("second login is served from the cache", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "cacheduser")
+
+		_, err := service.Authenticate("cacheduser", "testpassword123", "198.51.100.7")
+		require.NoError(t, err)
+		before := cache.Stats()
+
+		authenticated, err := service.Authenticate("cacheduser", "testpassword123", "198.51.100.7")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, authenticated.ID)
+		assert.Equal(t, before.Hits+1, cache.Stats().Hits)
+	})
+
+	t.Run("wrong password is not served from the cache", func(t *testing.T) {
+		testutil.CreateTestUserWithName(t, models.RoleUser, "cacheduser2")
+		_, err := service.Authenticate("cacheduser2", "testpassword123", "")
+		require.NoError(t, err)
+
+		_, err = service.Authenticate("cacheduser2", "wrongpassword", "")
+		assert.Equal(t, services.ErrInvalidCredentials, err)
+	})
+
+	t.Run("deactivation invalidates the cache", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "cacheduser3")
+		_, err := service.Authenticate("cacheduser3", "testpassword123", "")
+		require.NoError(t, err)
+
+		_, err = services.NewUserService().Update(user.ID, &dto.UpdateUserRequest{IsActive: testutil.BoolPtr(false)}, user.ID)
+		require.NoError(t, err)
+
+		_, err = service.Authenticate("cacheduser3", "testpassword123", "")
+		assert.Equal(t, services.ErrUserInactive, err)
+	})
+
+	t.Run("password change invalidates the cache", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "cacheduser4")
+		_, err := service.Authenticate("cacheduser4", "testpassword123", "")
+		require.NoError(t, err)
+
+		require.NoError(t, services.NewUserService().UpdatePassword(user.ID, "testpassword123", "newpassword456", user.ID))
+
+		_, err = service.Authenticate("cacheduser4", "testpassword123", "")
+		assert.Equal(t, services.ErrInvalidCredentials, err)
+		_, err = service.Authenticate("cacheduser4", "newpassword456", "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("quota is checked on cache hits", func(t *testing.T) {
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "quotacacheuser")
+		require.NoError(t, db.Model(user).Update("monthly_traffic_quota", 1000).Error)
+		_, err := service.Authenticate("quotacacheuser", "testpassword123", "")
+		require.NoError(t, err)
+
+		session := testutil.CreateTestVpnSession(t, user.ID)
+		addTestTraffic(t, session.ID, time.Now(), 600, 400)
+
+		_, err = service.Authenticate("quotacacheuser", "testpassword123", "")
+		assert.Equal(t, services.ErrQuotaExceeded, err)
+
+		// The entry is dropped, so the next login checks the password again
+		before := cache.Stats()
+		_, err = service.Authenticate("quotacacheuser", "testpassword123", "")
+		assert.Equal(t, services.ErrQuotaExceeded, err)
+		assert.Equal(t, before.Hits, cache.Stats().Hits)
+	})
+
+	t.Run("group change invalidates the cache", func(t *testing.T) {
+		admin := testutil.CreateTestAdmin(t)
+		user := testutil.CreateTestUserWithName(t, models.RoleUser, "cacheduser5")
+		group := testutil.CreateTestGroup(t, admin.ID)
+		_, err := service.Authenticate("cacheduser5", "testpassword123", "")
+		require.NoError(t, err)
+		before := cache.Stats()
+
+		require.NoError(t, services.NewGroupService().AddUserToGroup(group.ID, user.ID, admin.ID))
+		assert.Equal(t, before.Invalidations+1, cache.Stats().Invalidations)
+		assert.Equal(t, before.Entries-1, cache.Stats().Entries)
+	})
+
+	t.Run("disabled cache is bypassed", func(t *testing.T) {
+		services.ConfigureVpnAuthCache(&config.VpnAuthCacheConfig{})
+		testutil.CreateTestUserWithName(t, models.RoleUser, "cacheduser6")
+
+		for i := 0; i < 2; i++ {
+			_, err := service.Authenticate("cacheduser6", "testpassword123", "")
+			require.NoError(t, err)
+		}
+		stats := cache.Stats()
+		assert.False(t, stats.Enabled)
+		assert.Zero(t, stats.Hits)
+		assert.Zero(t, stats.Entries)
+	})
+}
@@ -0,0 +1,278 @@
+package services_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/models"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/services"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/webauthn"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/test/testutil"
+)
+
+const (
+	testRPID   = "vpn.example.com"
+	testOrigin = "https://vpn.example.com"
+)
+
+// softAuthenticator is an ES256 security key in software
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	signCount  uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	return &softAuthenticator{key: key, id: id}
+}
+
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, -1-n)
+	}
+	return cborHead(0, n)
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+
+func cborText(s string) []byte { return append(cborHead(3, len(s)), s...) }
+
+func (a *softAuthenticator) coseKey() []byte {
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+	key := cborHead(5, 5)
+	key = append(key, cborInt(1)...)
+	key = append(key, cborInt(2)...)
+	key = append(key, cborInt(3)...)
+	key = append(key, cborInt(webauthn.AlgES256)...)
+	key = append(key, cborInt(-1)...)
+	key = append(key, cborInt(1)...)
+	key = append(key, cborInt(-2)...)
+	key = append(key, cborBytes(x)...)
+	key = append(key, cborInt(-3)...)
+	key = append(key, cborBytes(y)...)
+	return key
+}
+
+func (a *softAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	if attested {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony string, challenge webauthn.Base64URL, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    origin,
+	})
+	require.NoError(t, err)
+	return data
+}
+
+// create answers navigator.credentials.create()
+func (a *softAuthenticator) create(t *testing.T, options *webauthn.CreationOptions) *webauthn.CredentialResponse {
+	t.Helper()
+	a.userHandle = options.User.ID
+	attestation := cborHead(5, 3)
+	attestation = append(attestation, cborText("fmt")...)
+	attestation = append(attestation, cborText("none")...)
+	attestation = append(attestation, cborText("attStmt")...)
+	attestation = append(attestation, cborHead(5, 0)...)
+	attestation = append(attestation, cborText("authData")...)
+	attestation = append(attestation, cborBytes(a.authData(options.RP.ID, 0x05, true))...)
+	return &webauthn.CredentialResponse{
+		ID:    webauthn.Base64URL(a.id).String(),
+		RawID: a.id,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorResponse{
+			ClientDataJSON:    clientDataJSON(t, "webauthn.create", options.Challenge, testOrigin),
+			AttestationObject: attestation,
+			Transports:        []string{"usb", "bogus"},
+		},
+	}
+}
+
+// get answers navigator.credentials.get()
+func (a *softAuthenticator) get(t *testing.T, options *webauthn.RequestOptions, origin string) *webauthn.CredentialResponse {
+	t.Helper()
+	a.signCount++
+	authData := a.authData(options.RPID, 0x05, false)
+	clientData := clientDataJSON(t, "webauthn.get", options.Challenge, origin)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+	return &webauthn.CredentialResponse{
+		ID:    webauthn.Base64URL(a.id).String(),
+		RawID: a.id,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         signature,
+			UserHandle:        a.userHandle,
+		},
+	}
+}
+
+func TestWebAuthnService(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer testutil.CleanupTestDB(t, db)
+
+	cfg := &config.WebAuthnConfig{
+		Enabled:          true,
+		RPID:             testRPID,
+		RPName:           "OpenVPN Manager",
+		Origins:          []string{testOrigin},
+		Timeout:          300,
+		RequireForAdmins: true,
+	}
+	service := services.NewWebAuthnService(cfg)
+
+	admin := testutil.CreateTestAdmin(t)
+	key := newSoftAuthenticator(t)
+
+	t.Run("admin without key must register one", func(t *testing.T) {
+		assert.True(t, service.SetupRequired(admin))
+		assert.False(t, service.SetupRequired(testutil.CreateTestRegularUser(t)))
+	})
+
+	t.Run("register security key", func(t *testing.T) {
+		options, err := service.BeginRegistration(admin)
+		require.NoError(t, err)
+		assert.Equal(t, testRPID, options.RP.ID)
+		assert.Empty(t, options.ExcludeCredentials)
+
+		credential, err := service.FinishRegistration(admin, " YubiKey ", key.create(t, options))
+		require.NoError(t, err)
+		assert.Equal(t, "YubiKey", credential.Name)
+		assert.Equal(t, "usb", credential.Transports)
+		assert.True(t, service.HasCredentials(admin.ID))
+		assert.False(t, service.SetupRequired(admin))
+	})
+
+	t.Run("challenge can be answered once", func(t *testing.T) {
+		options, err := service.BeginRegistration(admin)
+		require.NoError(t, err)
+		assert.Len(t, options.ExcludeCredentials, 1)
+
+		other := newSoftAuthenticator(t)
+		response := other.create(t, options)
+		_, err = service.FinishRegistration(admin, "Backup", response)
+		require.NoError(t, err)
+		_, err = service.FinishRegistration(admin, "Backup", response)
+		assert.ErrorIs(t, err, services.ErrWebAuthnChallengeInvalid)
+	})
+
+	t.Run("second factor login", func(t *testing.T) {
+		options, err := service.BeginLogin(admin)
+		require.NoError(t, err)
+		assert.Len(t, options.AllowCredentials, 2)
+
+		user, err := service.FinishLogin(key.get(t, options, testOrigin))
+		require.NoError(t, err)
+		assert.Equal(t, admin.ID, user.ID)
+	})
+
+	t.Run("wrong origin is rejected", func(t *testing.T) {
+		options, err := service.BeginLogin(admin)
+		require.NoError(t, err)
+		_, err = service.FinishLogin(key.get(t, options, "https://phishing.example.net"))
+		assert.ErrorIs(t, err, services.ErrWebAuthnFailed)
+	})
+
+	t.Run("key of another user is rejected for second factor", func(t *testing.T) {
+		other := testutil.CreateTestUserWithName(t, models.RoleUser, "otherkeyowner")
+		otherKey := newSoftAuthenticator(t)
+		registration, err := service.BeginRegistration(other)
+		require.NoError(t, err)
+		_, err = service.FinishRegistration(other, "Key", otherKey.create(t, registration))
+		require.NoError(t, err)
+
+		options, err := service.BeginLogin(admin)
+		require.NoError(t, err)
+		_, err = service.FinishLogin(otherKey.get(t, options, testOrigin))
+		assert.ErrorIs(t, err, services.ErrWebAuthnFailed)
+	})
+
+	t.Run("passwordless login requires user verification", func(t *testing.T) {
+		options, err := service.BeginLogin(nil)
+		require.NoError(t, err)
+		assert.Empty(t, options.AllowCredentials)
+		assert.Equal(t, webauthn.UserVerificationRequired, options.UserVerification)
+
+		// The soft authenticator sets UP and UV
+		user, err := service.FinishLogin(key.get(t, options, testOrigin))
+		require.NoError(t, err)
+		assert.Equal(t, admin.ID, user.ID)
+	})
+
+	t.Run("replayed sign counter is rejected", func(t *testing.T) {
+		options, err := service.BeginLogin(admin)
+		require.NoError(t, err)
+		key.signCount--
+		_, err = service.FinishLogin(key.get(t, options, testOrigin))
+		assert.ErrorIs(t, err, services.ErrWebAuthnFailed)
+	})
+
+	t.Run("rename and remove keys", func(t *testing.T) {
+		credentials, err := service.ListCredentials(admin.ID)
+		require.NoError(t, err)
+		require.Len(t, credentials, 2)
+
+		renamed, err := service.RenameCredential(admin.ID, credentials[0].ID, "Primary")
+		require.NoError(t, err)
+		assert.Equal(t, "Primary", renamed.Name)
+
+		_, err = service.DeleteCredential(admin, credentials[1].ID)
+		require.NoError(t, err)
+
+		// The policy keeps the last key of an admin
+		_, err = service.DeleteCredential(admin, credentials[0].ID)
+		assert.ErrorIs(t, err, services.ErrWebAuthnLastAdminKey)
+
+		removed, err := service.DeleteAllCredentials(admin.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), removed)
+		assert.True(t, service.SetupRequired(admin))
+	})
+}
@@ -0,0 +1,201 @@
+package testutil
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SMTPMessage is a message received by the SMTP stub
+type SMTPMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// SMTPStub is an in-process SMTP server supporting STARTTLS and AUTH PLAIN,
+// for testing outgoing email
+type SMTPStub struct {
+	// Host and Port are the address of the server
+	Host string
+	Port int
+	// Username and Password, if set, are required with AUTH PLAIN
+	Username string
+	Password string
+	// Messages receives every accepted message
+	Messages chan SMTPMessage
+
+	listener  net.Listener
+	tlsConfig *tls.Config
+	wg        sync.WaitGroup
+}
+
+// StartSMTPStub starts an SMTP stub, stopped when the test ends
+func StartSMTPStub(t *testing.T) *SMTPStub {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start SMTP stub: %v", err)
+	}
+	cert, _ := selfSignedCert(t)
+	addr := listener.Addr().(*net.TCPAddr)
+
+	stub := &SMTPStub{
+		Host:      "127.0.0.1",
+		Port:      addr.Port,
+		Messages:  make(chan SMTPMessage, 10),
+		listener:  listener,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	stub.wg.Add(1)
+	go stub.serve()
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+// Close stops the server
+func (s *SMTPStub) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+// WaitMessage returns the next received message, failing the test after a timeout
+func (s *SMTPStub) WaitMessage(t *testing.T) SMTPMessage {
+	t.Helper()
+	select {
+	case msg := <-s.Messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("No message received by SMTP stub")
+		return SMTPMessage{}
+	}
+}
+
+func (s *SMTPStub) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle runs an SMTP session until QUIT or the connection is closed
+func (s *SMTPStub) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	reply := func(lines ...string) bool {
+		for _, line := range lines {
+			if _, err := conn.Write([]byte(line + "\r\n")); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	reply("220 smtp-stub ESMTP")
+	secure := false
+	authenticated := s.Username == ""
+	var msg SMTPMessage
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"250-smtp-stub"}
+			if !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			reply(append(lines, "250-AUTH PLAIN", "250 8BITMIME")...)
+		case "STARTTLS":
+			reply("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			reader = bufio.NewReader(conn)
+			secure = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mechanism, "PLAIN") {
+				reply("504 Unrecognized authentication type")
+				continue
+			}
+			decoded, _ := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if len(parts) == 3 && parts[1] == s.Username && parts[2] == s.Password {
+				authenticated = true
+				reply("235 Authentication successful")
+			} else {
+				reply("535 Authentication failed")
+			}
+		case "MAIL":
+			if !authenticated {
+				reply("530 Authentication required")
+				continue
+			}
+			msg = SMTPMessage{From: addressArg(arg)}
+			reply("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, addressArg(arg))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			msg.Data = data.String()
+			s.Messages <- msg
+			reply("250 OK: queued as " + strconv.Itoa(len(msg.Data)))
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// addressArg extracts the address of a MAIL FROM:<...> or RCPT TO:<...> argument
+func addressArg(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.LastIndex(arg, ">")
+	if start < 0 || end < start {
+		return arg
+	}
+	return arg[start+1 : end]
+}
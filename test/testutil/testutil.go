@@ -30,13 +30,28 @@ func SetupTestDB(t *testing.T) *gorm.DB {
 	// Auto migrate all models
 	err = db.AutoMigrate(
 		&models.User{},
+		&models.UserIdentity{},
 		&models.Group{},
 		&models.Network{},
 		&models.UserGroup{},
 		&models.NetworkGroup{},
 		&models.VpnSession{},
 		&models.VpnTrafficStats{},
+		&models.VpnTrafficHourly{},
+		&models.VpnTrafficDaily{},
+		&models.TrafficRollupState{},
 		&models.AuditLog{},
+		&models.VpnLoginAttempt{},
+		&models.SecurityAlert{},
+		&models.APIKey{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.JWTSigningKey{},
+		&models.PasswordHistory{},
+		&models.PasswordResetToken{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.RateLimitCounter{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
@@ -0,0 +1,265 @@
+package tlsserver_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/config"
+	"github.com/tldr-it-stepankutaj/openvpn-mng/internal/tlsserver"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newCert creates a certificate signed by parent, or a self-signed CA
+func newCert(t *testing.T, serial int64, parent *testCert, client bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if client {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.ExtKeyUsage = nil
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeCert(t *testing.T, cfg *config.TLSConfig, c *testCert) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(cfg.CertFile, c.certPEM, 0o600))
+	require.NoError(t, os.WriteFile(cfg.KeyFile, c.keyPEM, 0o600))
+}
+
+// serve starts an HTTPS server with the reloader's configuration
+func serve(t *testing.T, reloader *tlsserver.Reloader) string {
+	t.Helper()
+	tlsConfig, err := reloader.Config()
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		}),
+		TLSConfig: tlsConfig,
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go func() { _ = server.ServeTLS(listener, "", "") }()
+	t.Cleanup(func() { _ = server.Close() })
+	return listener.Addr().String()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.TLSConfig{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+	}
+	ca := newCert(t, 1, nil, false)
+	writeCert(t, cfg, newCert(t, 100, ca, false))
+
+	reloader, err := tlsserver.NewReloader(cfg)
+	require.NoError(t, err)
+	addr := serve(t, reloader)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(t *testing.T) *tls.Conn {
+		t.Helper()
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+		require.NoError(t, err)
+		return conn
+	}
+
+	t.Run("serves the certificate with modern defaults", func(t *testing.T) {
+		conn := dial(t)
+		defer conn.Close()
+		state := conn.ConnectionState()
+		assert.Equal(t, int64(100), state.PeerCertificates[0].SerialNumber.Int64())
+		assert.GreaterOrEqual(t, state.Version, uint16(tls.VersionTLS12))
+
+		_, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost", MaxVersion: tls.VersionTLS11})
+		assert.Error(t, err)
+	})
+
+	t.Run("unchanged files are not reloaded", func(t *testing.T) {
+		changed, err := reloader.Reload()
+		require.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("reload keeps established connections", func(t *testing.T) {
+		before := dial(t)
+		defer before.Close()
+		client := &http.Client{Transport: &http.Transport{
+			DialTLSContext: func(context.Context, string, string) (net.Conn, error) { return before, nil },
+		}}
+
+		writeCert(t, cfg, newCert(t, 200, ca, false))
+		changed, err := reloader.Reload()
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		after := dial(t)
+		defer after.Close()
+		assert.Equal(t, int64(200), after.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+
+		response, err := client.Get("https://localhost/")
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+
+	t.Run("invalid files keep the previous certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(cfg.KeyFile, []byte("garbage"), 0o600))
+		_, err := reloader.Reload()
+		assert.Error(t, err)
+
+		conn := dial(t)
+		defer conn.Close()
+		assert.Equal(t, int64(200), conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+	})
+
+	t.Run("watch picks up changed files", func(t *testing.T) {
+		stop := make(chan struct{})
+		defer close(stop)
+		reloaded := make(chan error, 10)
+		go reloader.Watch(10*time.Millisecond, stop, func(err error) { reloaded <- err })
+
+		writeCert(t, cfg, newCert(t, 300, ca, false))
+		for err := range reloaded {
+			if err == nil {
+				break
+			}
+		}
+		assert.Equal(t, int64(300), reloader.Certificate().Leaf.SerialNumber.Int64())
+	})
+}
+
+func TestReloader_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "clients.crt"),
+	}
+	ca := newCert(t, 1, nil, false)
+	writeCert(t, cfg, newCert(t, 100, ca, false))
+	clientCA := newCert(t, 2, nil, false)
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, clientCA.certPEM, 0o600))
+
+	reloader, err := tlsserver.NewReloader(cfg)
+	require.NoError(t, err)
+	addr := serve(t, reloader)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certificates []tls.Certificate) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: certificates,
+		}}}
+		defer client.CloseIdleConnections()
+		response, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			return err
+		}
+		return response.Body.Close()
+	}
+	clientCert := func(signer *testCert) []tls.Certificate {
+		c := newCert(t, 500, signer, true)
+		pair, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+		require.NoError(t, err)
+		return []tls.Certificate{pair}
+	}
+
+	assert.Error(t, get(nil), "client certificate is required")
+	assert.NoError(t, get(clientCert(clientCA)))
+	assert.Error(t, get(clientCert(newCert(t, 3, nil, false))), "unknown client CA")
+}
+
+func TestReloader_InvalidConfig(t *testing.T) {
+	_, err := tlsserver.NewReloader(&config.TLSConfig{CertFile: "server.crt"})
+	assert.Error(t, err)
+
+	_, err = tlsserver.NewReloader(&config.TLSConfig{CertFile: "missing.crt", KeyFile: "missing.key"})
+	assert.Error(t, err)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicURL string
+		port      int
+		host      string
+		expected  string
+	}{
+		{"default port", "", 443, "vpn.example.com", "https://vpn.example.com/users?page=2"},
+		{"custom port", "", 8443, "vpn.example.com:8080", "https://vpn.example.com:8443/users?page=2"},
+		{"IPv6", "", 8443, "[2001:db8::1]:8080", "https://[2001:db8::1]:8443/users?page=2"},
+		{"public URL", "https://vpn.example.com", 8443, "10.0.0.1:8080", "https://vpn.example.com/users?page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users?page=2", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			tlsserver.RedirectHandler(tt.publicURL, tt.port).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.expected, w.Header().Get("Location"))
+		})
+	}
+}
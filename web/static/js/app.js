@@ -1,5 +1,55 @@
 // OpenVPN Manager JavaScript
 
+// Silent session refresh: access tokens are short-lived, so a request that
+// fails with 401 renews the token cookies once via the refresh token cookie
+// and is retried. Concurrent requests share a single refresh.
+const originalFetch = globalThis.fetch.bind(globalThis);
+let refreshInFlight = null;
+
+// CSRF protection: state-changing requests echo the csrf_token cookie in the
+// X-CSRF-Token header. It is read on every request, as a refresh may set it.
+function csrfToken() {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : '';
+}
+
+function withCSRF(input, init) {
+    const method = ((init && init.method) || (typeof input === 'string' ? 'GET' : input.method)).toUpperCase();
+    const url = new URL(typeof input === 'string' ? input : input.url, globalThis.location.href);
+    if (['GET', 'HEAD', 'OPTIONS'].includes(method) || url.origin !== globalThis.location.origin) {
+        return init;
+    }
+    const headers = new Headers((init && init.headers) || (typeof input === 'string' ? undefined : input.headers));
+    headers.set('X-CSRF-Token', csrfToken());
+    return { ...init, headers };
+}
+
+function refreshSession() {
+    if (!refreshInFlight) {
+        refreshInFlight = originalFetch('/api/v1/auth/refresh', withCSRF('/api/v1/auth/refresh', { method: 'POST', credentials: 'same-origin' }))
+            // 409: another tab has just rotated the token, its cookies are already set
+            .then(response => response.ok || response.status === 409)
+            .catch(() => false)
+            .finally(() => { refreshInFlight = null; });
+    }
+    return refreshInFlight;
+}
+
+globalThis.fetch = async function (input, init) {
+    const response = await originalFetch(input, withCSRF(input, init));
+    const url = typeof input === 'string' ? input : input.url;
+    if (response.status !== 401 || url.includes('/api/v1/auth/login') || url.includes('/api/v1/auth/refresh')) {
+        return response;
+    }
+    if (await refreshSession()) {
+        return originalFetch(input, withCSRF(input, init));
+    }
+    if (!globalThis.location.pathname.startsWith('/login')) {
+        globalThis.location.href = '/login';
+    }
+    return response;
+};
+
 // Logout function
 async function logout() {
     try {
@@ -0,0 +1,63 @@
+// Security key (WebAuthn) helpers. The server exchanges binary fields as
+// unpadded base64url, the browser API uses ArrayBuffers.
+
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+    return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const bytes = new Uint8Array(buffer);
+    let binary = '';
+    bytes.forEach(b => { binary += String.fromCharCode(b); });
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function webAuthnSupported() {
+    return !!(globalThis.PublicKeyCredential && navigator.credentials);
+}
+
+// Asks the authenticator to sign in with the options of a login begin
+// response and returns the credential to send to /api/v1/auth/webauthn/login/finish
+async function webAuthnGet(options) {
+    const publicKey = Object.assign({}, options.publicKey, {
+        challenge: base64urlToBuffer(options.publicKey.challenge),
+        allowCredentials: (options.publicKey.allowCredentials || []).map(c =>
+            Object.assign({}, c, { id: base64urlToBuffer(c.id) }))
+    });
+    const credential = await navigator.credentials.get({ publicKey });
+    return {
+        id: credential.id,
+        rawId: bufferToBase64url(credential.rawId),
+        type: credential.type,
+        response: {
+            clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+            authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+            signature: bufferToBase64url(credential.response.signature),
+            userHandle: credential.response.userHandle ? bufferToBase64url(credential.response.userHandle) : undefined
+        }
+    };
+}
+
+// Asks the authenticator to create a credential with the options of a
+// registration begin response and returns it for /api/v1/auth/webauthn/register/finish
+async function webAuthnCreate(options) {
+    const publicKey = Object.assign({}, options.publicKey, {
+        challenge: base64urlToBuffer(options.publicKey.challenge),
+        user: Object.assign({}, options.publicKey.user, { id: base64urlToBuffer(options.publicKey.user.id) }),
+        excludeCredentials: (options.publicKey.excludeCredentials || []).map(c =>
+            Object.assign({}, c, { id: base64urlToBuffer(c.id) }))
+    });
+    const credential = await navigator.credentials.create({ publicKey });
+    return {
+        id: credential.id,
+        rawId: bufferToBase64url(credential.rawId),
+        type: credential.type,
+        response: {
+            clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+            attestationObject: bufferToBase64url(credential.response.attestationObject),
+            transports: credential.response.getTransports ? credential.response.getTransports() : []
+        }
+    };
+}